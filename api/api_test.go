@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"funcbase/constants"
+	"funcbase/model"
+	"funcbase/pkg/cache"
+	pkg_sqlite "funcbase/pkg/sqlite"
+	"funcbase/service"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sarulabs/di"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type testAPI struct {
+	*API
+	db      *gorm.DB
+	service *service.Service
+}
+
+// newTestAPI
+//
+// Apis on a fresh database, run from a data directory removed once the test ends
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, constants.DATA_PATH), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, constants.DATA_PATH, constants.CONFIG_PATH), []byte{}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+
+	builder, err := di.NewBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = builder.Add(
+		di.Def{
+			Name: constants.CONTAINER_DB,
+			Build: func(ctn di.Container) (interface{}, error) {
+				return pkg_sqlite.NewSQLiteClient(filepath.Join(dir, constants.DATA_PATH, "database.sqlite"), pkg_sqlite.SQLiteOption{Migrate: true, LogMode: logger.Silent})
+			},
+		},
+		di.Def{
+			Name: constants.CONTAINER_CACHE,
+			Build: func(ctn di.Container) (interface{}, error) {
+				return cache.NewCache()
+			},
+		},
+		di.Def{
+			Name: constants.CONTAINER_SERVICE,
+			Build: func(ctn di.Container) (interface{}, error) {
+				return service.NewService(ctn), nil
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ioc := builder.Build()
+	db := ioc.Get(constants.CONTAINER_DB).(*gorm.DB)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return &testAPI{
+		API:     NewAPI(echo.New(), ioc),
+		db:      db,
+		service: ioc.Get(constants.CONTAINER_SERVICE).(*service.Service),
+	}
+}
+
+// context
+//
+// Request of the given user, the way RequireAuth leaves it. An empty role is a guest
+func (a *testAPI) context(method string, body interface{}, role string, userID interface{}) (echo.Context, *httptest.ResponseRecorder) {
+	data, _ := json.Marshal(body)
+	request := httptest.NewRequest(method, "/", bytes.NewReader(data))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+
+	c := a.app.NewContext(request, recorder)
+	if role != "" {
+		c.Set("user_id", userID)
+		c.Set("roles", role)
+		c.Set("collection", "members")
+	}
+
+	return c, recorder
+}
+
+// createMembers
+//
+// Auth table members with a hidden balance, listed by everyone
+func (a *testAPI) createMembers(t *testing.T) {
+	t.Helper()
+
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		return a.service.Table.Create(tx, model.CreateTable{
+			Name: "members",
+			Type: "users",
+			Fields: []model.Field{
+				{Type: "number", Name: "balance", Nullable: true, Permission: model.FIELD_HIDDEN},
+				{Type: "text", Name: "bio", Nullable: true},
+			},
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	everyone := ""
+	err = a.service.Table.SetRules(a.db, "members", model.Rules{List: &everyone, View: &everyone})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := a.db.WithContext(service.WithActor(a.db.Statement.Context, service.Actor{ID: "1", Role: "ADMIN"}))
+	for _, row := range []map[string]interface{}{
+		{"email": "a@a", "password": "x", "salt": "y", "balance": 5000, "bio": "first"},
+		{"email": "b@b", "password": "x", "salt": "y", "balance": 10, "bio": "second"},
+	} {
+		err = a.service.DB.Insert(admin, "members", row)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"funcbase/constants"
 	auth_libraries "funcbase/library/auth"
 	"funcbase/middleware"
@@ -11,7 +12,6 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/sarulabs/di"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 type AuthAPI interface {
@@ -98,14 +98,11 @@ func (h *AuthAPIImpl) Register(c echo.Context) error {
 		newUser[k] = v
 	}
 
-	err = h.db.Table(tableName).Clauses(clause.Returning{
-		Columns: []clause.Column{
-			{
-				Name: "id",
-			},
-		},
-	}).Create(&newUser).Error
+	err = h.service.DB.Insert(withActor(c, h.db), tableName, newUser)
 	if err != nil {
+		if errors.Is(err, service.ErrFieldForbidden) {
+			return forbiddenFieldResponse(c, err)
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
 	}
 
@@ -114,9 +111,10 @@ func (h *AuthAPIImpl) Register(c echo.Context) error {
 
 	if body.ReturnsToken {
 		token, err := auth_libraries.GenerateJWT(map[string]interface{}{
-			"sub":   newUser["id"].(int64),
-			"email": newUser["email"].(string),
-			"roles": "USER",
+			"sub":        newUser["id"],
+			"email":      newUser["email"].(string),
+			"roles":      "USER",
+			"collection": tableName,
 		})
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
@@ -186,9 +184,10 @@ func (h *AuthAPIImpl) Login(c echo.Context) error {
 	}
 
 	token, err := auth_libraries.GenerateJWT(map[string]interface{}{
-		"sub":   user["id"].(int),
-		"email": user["email"].(string),
-		"roles": "USER",
+		"sub":        user["id"],
+		"email":      user["email"].(string),
+		"roles":      "USER",
+		"collection": tableName,
 	})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
@@ -202,8 +201,8 @@ func (h *AuthAPIImpl) Login(c echo.Context) error {
 }
 
 func (h *AuthAPIImpl) GetMyUserID(c echo.Context) error {
-	userID, ok := c.Get("user_id").(int)
-	if !ok {
+	userID := c.Get("user_id")
+	if userID == nil {
 		return c.JSON(http.StatusUnauthorized, map[string]interface{}{
 			"error": "JWT Not found",
 		})
@@ -1,8 +1,20 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"funcbase/pkg/responses"
+	"funcbase/service"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
 	"github.com/labstack/echo/v4"
 	"github.com/sarulabs/di"
+	"gorm.io/gorm"
 )
 
 type API struct {
@@ -13,7 +25,10 @@ type API struct {
 	Backup   BackupAPI
 	Database DatabaseAPI
 	Function FunctionAPI
+	GraphQL  GraphQLAPI
 	Log      LogAPI
+	Realtime RealtimeAPI
+	Schema   SchemaAPI
 	Setting  SettingAPI
 	Storage  StorageAPI
 }
@@ -31,7 +46,10 @@ func NewAPI(app *echo.Echo, ioc di.Container) *API {
 		Backup:   NewBackupAPI(ioc),
 		Database: NewDatabaseAPI(ioc),
 		Log:      NewLogAPI(ioc),
+		Realtime: NewRealtimeAPI(ioc),
+		Schema:   NewSchemaAPI(ioc),
 		Function: NewFunctionAPI(ioc),
+		GraphQL:  NewGraphQLAPI(ioc),
 		Setting:  NewSettingAPI(ioc),
 		Storage:  NewStorageAPI(ioc),
 	}
@@ -46,4 +64,222 @@ func (api *API) Serve() {
 	api.BackupAPI()
 	api.FunctionAPI()
 	api.LogAPI()
+	api.SchemaAPI()
+	api.GraphQLAPI()
+	api.RealtimeAPI()
+}
+
+// withActor
+//
+// Attach the requesting user to the db context so that recorded changes know who made them
+func withActor(c echo.Context, db *gorm.DB) *gorm.DB {
+	actor := service.Actor{
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+
+	actor.ID = requestUserID(c)
+
+	if roles, ok := c.Get("roles").(string); ok {
+		actor.Role = roles
+	}
+
+	return db.WithContext(service.WithActor(c.Request().Context(), actor))
+}
+
+// violationResponse
+//
+// Constraint violation is a client error, 409 when the row already exists and 422 when the row is invalid
+func violationResponse(c echo.Context, violation *service.ConstraintViolation) error {
+	status := http.StatusUnprocessableEntity
+	if violation.Conflict() {
+		status = http.StatusConflict
+	}
+
+	return c.JSON(status, responses.APIResponse{
+		Data:    violation,
+		Message: violation.Error(),
+		Error:   violation.Unwrap().Error(),
+	})
+}
+
+// idString
+//
+// Id of any strategy as text so that ids can be compared, integer ids stored on a
+// REAL relation column are read as float64
+func idString(id interface{}) string {
+	switch v := id.(type) {
+	case nil:
+		return ""
+	case float64:
+		if v == math.Trunc(v) {
+			return strconv.FormatInt(int64(v), 10)
+		}
+	case []byte:
+		return string(v)
+	}
+
+	return fmt.Sprintf("%v", id)
+}
+
+// requestUserID
+//
+// Id of the requesting user, empty on anonymous requests
+func requestUserID(c echo.Context) string {
+	return idString(c.Get("user_id"))
+}
+
+// userFilterValue
+//
+// Id of the requesting user written into a filter in place of @user.id, text ids are quoted
+func userFilterValue(c echo.Context) string {
+	userId := requestUserID(c)
+	if _, ok := c.Get("user_id").(string); ok {
+		return "'" + strings.ReplaceAll(userId, "'", "''") + "'"
+	}
+
+	return userId
+}
+
+// ruleAuth
+//
+// Requesting user the access rules are checked against
+func ruleAuth(c echo.Context) service.Auth {
+	collection, _ := c.Get("collection").(string)
+
+	return service.Auth{ID: c.Get("user_id"), Collection: collection}
+}
+
+// ruleCondition
+//
+// Condition of the access rule of the operation for the requesting user, the admin is not
+// bound by the rules
+func ruleCondition(rules service.RuleService, c echo.Context, tableName string, operation string) (string, []interface{}, error) {
+	if c.Get("roles") == "ADMIN" {
+		return "", nil, nil
+	}
+
+	return rules.Condition(tableName, operation, ruleAuth(c))
+}
+
+// ruleAllowed
+//
+// Check the access rule of the operation against stored rows
+func ruleAllowed(rules service.RuleService, c echo.Context, db *gorm.DB, tableName string, operation string, ids []interface{}) (bool, error) {
+	if c.Get("roles") == "ADMIN" {
+		return true, nil
+	}
+
+	return rules.Allowed(db, tableName, operation, ruleAuth(c), ids)
+}
+
+// ruleMatch
+//
+// Check the access rule of the operation against a row that is not stored
+func ruleMatch(rules service.RuleService, c echo.Context, db *gorm.DB, tableName string, operation string, row map[string]interface{}) (bool, error) {
+	if c.Get("roles") == "ADMIN" {
+		return true, nil
+	}
+
+	return rules.Match(db, tableName, operation, ruleAuth(c), row)
+}
+
+// ruleResponse
+//
+// Response of a request denied by an access rule, or of a rule that failed to be checked
+func ruleResponse(c echo.Context, err error) error {
+	if err == nil || errors.Is(err, service.ErrRuleDenied) {
+		return c.JSON(http.StatusForbidden, responses.APIResponse{
+			Message: "You don't have access to this data",
+			Error:   "Data restricted",
+		})
+	}
+
+	return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+		Message: "failed to check access",
+		Error:   err.Error(),
+	})
+}
+
+// etags
+//
+// Entity tags listed by an If-Match or If-None-Match header, nil when the header is missing
+func etags(header string) []string {
+	if strings.TrimSpace(header) == "" {
+		return nil
+	}
+
+	tags := []string{}
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// withIfMatch
+//
+// Write only the rows still matching the If-Match header of the request
+func withIfMatch(c echo.Context, db *gorm.DB) *gorm.DB {
+	tags := etags(c.Request().Header.Get("If-Match"))
+	if tags == nil {
+		return db
+	}
+
+	return db.WithContext(service.WithIfMatch(db.Statement.Context, tags))
+}
+
+// notModified
+//
+// Weak comparison of If-None-Match, the client already holds the tagged response
+func notModified(c echo.Context, etag string) bool {
+	for _, tag := range etags(c.Request().Header.Get("If-None-Match")) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// jsonWithETag
+//
+// Json response tagged with a hash of its body, 304 when the client already holds it
+func jsonWithETag(c echo.Context, status int, value interface{}) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	hash := fnv.New64a()
+	hash.Write(body)
+	etag := fmt.Sprintf(`W/"%x"`, hash.Sum64())
+
+	c.Response().Header().Set("ETag", etag)
+	if notModified(c, etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.JSONBlob(status, body)
+}
+
+// preconditionResponse
+//
+// Row changed since the client read it, its If-Match or version is outdated
+func preconditionResponse(c echo.Context, err error) error {
+	return c.JSON(http.StatusPreconditionFailed, responses.APIResponse{
+		Message: "The data has been changed since it was read",
+		Error:   err.Error(),
+	})
+}
+
+// forbiddenFieldResponse
+//
+// Data holds a field the user can't write
+func forbiddenFieldResponse(c echo.Context, err error) error {
+	return c.JSON(http.StatusForbidden, responses.APIResponse{
+		Message: "The field can't be written",
+		Error:   err.Error(),
+	})
 }
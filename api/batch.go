@@ -0,0 +1,373 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"funcbase/constants"
+	"funcbase/model"
+	"funcbase/pkg/responses"
+	"funcbase/service"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	BATCH_INSERT = "insert"
+	BATCH_UPDATE = "update"
+	BATCH_DELETE = "delete"
+	BATCH_UPSERT = "upsert"
+)
+
+// batchReferenceRegex
+//
+// Value written by an earlier operation of the batch, e.g. @ops.0.id is the id inserted by the
+// first operation
+var batchReferenceRegex = regexp.MustCompile(`^@ops\.(\d+)\.([A-Za-z_][A-Za-z0-9_]*)$`)
+
+type batchOperation struct {
+	Op    string                 `json:"op"`
+	Table string                 `json:"table"`
+	Data  map[string]interface{} `json:"data"`
+	// rows removed by a delete
+	ID []interface{} `json:"id"`
+	// columns identifying the row of an upsert, the id by default
+	On []string `json:"on"`
+}
+
+type batchReq struct {
+	Operations []batchOperation `json:"operations"`
+}
+
+type batchResult struct {
+	Op    string `json:"op"`
+	Table string `json:"table"`
+	// insert or update, the write an upsert turned into
+	Action string                 `json:"action,omitempty"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+	ID     []interface{}          `json:"id,omitempty"`
+}
+
+// batchError
+//
+// Failed operation, the whole batch is rolled back
+type batchError struct {
+	Index   int
+	Status  int
+	Message string
+	err     error
+}
+
+func (e *batchError) Error() string {
+	return e.err.Error()
+}
+
+func newBatchError(status int, message string, err error) *batchError {
+	return &batchError{Status: status, Message: message, err: err}
+}
+
+var errBatchRestricted = newBatchError(http.StatusForbidden, "You don't have access to this data", errors.New("Data restricted"))
+
+// Batch
+//
+// Run an ordered list of inserts, updates, deletes and upserts in a single transaction with the
+// access checks of the single row endpoints. Values like @ops.0.id are replaced by what an
+// earlier operation wrote, nothing is written when one of the operations fails
+func (d *DatabaseAPIImpl) Batch(c echo.Context) error {
+	var params *batchReq = new(batchReq)
+	if err := c.Bind(&params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	if len(params.Operations) == 0 || len(params.Operations) > constants.BATCH_MAX_OPERATIONS {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: fmt.Sprintf("A batch holds between 1 and %d operations", constants.BATCH_MAX_OPERATIONS),
+			Error:   "invalid operations",
+		})
+	}
+
+	results := []batchResult{}
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		for i, operation := range params.Operations {
+			result, err := d.batchOperation(c, tx, operation, results)
+			if err != nil {
+				var failed *batchError
+				if !errors.As(err, &failed) {
+					failed = newBatchError(http.StatusInternalServerError, "failed to write data", err)
+					if errors.Is(err, service.ErrPreconditionFailed) {
+						failed = newBatchError(http.StatusPreconditionFailed, "The data has been changed since it was read", err)
+					}
+					if errors.Is(err, service.ErrFieldForbidden) {
+						failed = newBatchError(http.StatusForbidden, "The field can't be written", err)
+					}
+					if violation, ok := d.service.Table.Violation(err); ok {
+						failed = newBatchError(http.StatusUnprocessableEntity, violation.Error(), violation)
+						if violation.Conflict() {
+							failed.Status = http.StatusConflict
+						}
+					}
+				}
+
+				failed = &batchError{Index: i, Status: failed.Status, Message: failed.Message, err: failed.err}
+				return failed
+			}
+
+			results = append(results, result)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		var failed *batchError
+		if !errors.As(err, &failed) {
+			return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+				Message: "failed to write data",
+				Error:   err.Error(),
+			})
+		}
+
+		data := map[string]interface{}{
+			"index": failed.Index,
+			"op":    params.Operations[failed.Index].Op,
+			"table": params.Operations[failed.Index].Table,
+		}
+		message := failed.Error()
+		var violation *service.ConstraintViolation
+		if errors.As(failed.err, &violation) {
+			data["violation"] = violation
+			message = violation.Unwrap().Error()
+		}
+
+		return c.JSON(failed.Status, responses.APIResponse{
+			Data:    data,
+			Message: failed.Message,
+			Error:   message,
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Data:    results,
+		Message: "success",
+	})
+}
+
+func (d *DatabaseAPIImpl) batchOperation(c echo.Context, tx *gorm.DB, operation batchOperation, results []batchResult) (batchResult, error) {
+	result := batchResult{Op: operation.Op, Table: operation.Table}
+
+	tableInfo, err := d.service.Table.Info(operation.Table, service.TABLE_INFO_AUTH, service.TABLE_INFO_TYPE)
+	if err != nil {
+		return result, newBatchError(http.StatusBadRequest, "failed to get table info", err)
+	}
+	if tableInfo.IsView() {
+		return result, newBatchError(http.StatusMethodNotAllowed, "View collection is read only", errors.New("Table is read only"))
+	}
+
+	switch operation.Op {
+	case BATCH_INSERT, BATCH_UPDATE, BATCH_UPSERT:
+		data, err := batchData(c, operation.Data, results)
+		if err != nil {
+			return result, err
+		}
+
+		action := operation.Op
+		if action == BATCH_UPSERT {
+			key := operation.On
+			if len(key) == 0 {
+				key = []string{"id"}
+			}
+
+			existing, err := d.service.DB.Lookup(tx, operation.Table, key, data)
+			if err != nil {
+				return result, newBatchError(http.StatusBadRequest, "failed to find the row to upsert", err)
+			}
+
+			action = BATCH_INSERT
+			if existing != nil {
+				action = BATCH_UPDATE
+				data["id"] = existing["id"]
+			}
+			result.Action = action
+		}
+
+		if action == BATCH_INSERT {
+			err = d.batchAccess(c, tx, operation.Table, tableInfo, BATCH_INSERT, nil, data)
+			if err != nil {
+				return result, err
+			}
+
+			err = d.service.DB.Insert(withActor(c, tx), operation.Table, data)
+		} else {
+			if data["id"] == nil {
+				return result, newBatchError(http.StatusBadRequest, "Data ID is required to update", errors.New("ID not found"))
+			}
+
+			err = d.batchAccess(c, tx, operation.Table, tableInfo, BATCH_UPDATE, []interface{}{data["id"]}, nil)
+			if err != nil {
+				return result, err
+			}
+
+			data["updated_at"] = time.Now()
+			err = d.service.DB.Update(withActor(c, tx), operation.Table, data)
+		}
+		if err != nil {
+			return result, err
+		}
+
+		result.Data = data
+	case BATCH_DELETE:
+		if len(operation.ID) == 0 {
+			return result, newBatchError(http.StatusBadRequest, "Data ID is required to delete", errors.New("ID not found"))
+		}
+
+		ids := []string{}
+		for _, id := range operation.ID {
+			value, err := batchValue(id, results)
+			if err != nil {
+				return result, err
+			}
+			ids = append(ids, idString(value))
+			result.ID = append(result.ID, value)
+		}
+
+		err = d.batchAccess(c, tx, operation.Table, tableInfo, BATCH_DELETE, result.ID, nil)
+		if err != nil {
+			return result, err
+		}
+
+		err = d.service.DB.BatchDelete(withActor(c, tx), operation.Table, ids)
+		if err != nil {
+			return result, err
+		}
+	default:
+		return result, newBatchError(http.StatusBadRequest, "op must be insert, update, delete or upsert", fmt.Errorf("invalid op %s", operation.Op))
+	}
+
+	return result, nil
+}
+
+// batchAccess
+//
+// Access rule check of a single row endpoint. The rows are read inside the transaction, so that
+// the rows written by earlier operations are seen, and must all exist. A new row is checked
+// against the create rule before it is written
+func (d *DatabaseAPIImpl) batchAccess(c echo.Context, tx *gorm.DB, tableName string, tableInfo model.Tables, action string, ids []interface{}, data map[string]interface{}) error {
+	if action == BATCH_INSERT {
+		if tableInfo.Auth {
+			return newBatchError(http.StatusBadRequest, "Insertion to user type table can only be done through auth API", errors.New("user type table"))
+		}
+
+		allowed, err := ruleMatch(d.service.Rule, c, tx, tableName, model.RULE_CREATE, data)
+		if err != nil {
+			return newBatchError(http.StatusInternalServerError, "failed to check access", err)
+		}
+		if !allowed {
+			return errBatchRestricted
+		}
+
+		return nil
+	}
+
+	rows, err := d.service.DB.Fetch(tx, &service.FetchParams{
+		Table: tableName,
+		IDs:   ids,
+	})
+	if err != nil {
+		return newBatchError(http.StatusInternalServerError, "failed to fetch data", err)
+	}
+	found := map[string]bool{}
+	for _, row := range rows {
+		found[idString(row["id"])] = true
+	}
+	for _, id := range ids {
+		if !found[idString(id)] {
+			return newBatchError(http.StatusNotFound, "Data not found", fmt.Errorf("%s not found in %s", idString(id), tableName))
+		}
+	}
+
+	operation := model.RULE_UPDATE
+	if action == BATCH_DELETE {
+		operation = model.RULE_DELETE
+	}
+
+	allowed, err := ruleAllowed(d.service.Rule, c, tx, tableName, operation, ids)
+	if err != nil {
+		return newBatchError(http.StatusInternalServerError, "failed to check access", err)
+	}
+	if !allowed {
+		return errBatchRestricted
+	}
+
+	return nil
+}
+
+// batchData
+//
+// Row data of an operation with its references and @user.id replaced
+func batchData(c echo.Context, input map[string]interface{}, results []batchResult) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	for k, v := range input {
+		if v == "@user.id" {
+			if requestUserID(c) == "" {
+				return nil, newBatchError(http.StatusBadRequest, "User not authorized", errors.New("Token not found"))
+			}
+			data[k] = c.Get("user_id")
+			continue
+		}
+
+		// ids of a multiple relation may reference earlier operations too
+		if values, ok := v.([]interface{}); ok {
+			resolved := make([]interface{}, len(values))
+			for i, value := range values {
+				value, err := batchValue(value, results)
+				if err != nil {
+					return nil, err
+				}
+				resolved[i] = value
+			}
+			data[k] = resolved
+			continue
+		}
+
+		value, err := batchValue(v, results)
+		if err != nil {
+			return nil, err
+		}
+		data[k] = value
+	}
+
+	return data, nil
+}
+
+// batchValue
+//
+// Value written by an earlier operation when the value references one
+func batchValue(value interface{}, results []batchResult) (interface{}, error) {
+	reference, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+
+	match := batchReferenceRegex.FindStringSubmatch(reference)
+	if match == nil {
+		return value, nil
+	}
+
+	index, _ := strconv.Atoi(match[1])
+	if index >= len(results) {
+		return nil, newBatchError(http.StatusBadRequest, "Invalid reference", fmt.Errorf("%s references an operation that has not run yet", reference))
+	}
+
+	referenced, ok := results[index].Data[match[2]]
+	if !ok {
+		return nil, newBatchError(http.StatusBadRequest, "Invalid reference", fmt.Errorf("operation %d did not write %s", index, match[2]))
+	}
+
+	return referenced, nil
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	a := newTestAPI(t)
+	a.createMembers(t)
+	a.createNotes(t, 2)
+
+	batch := func(operations ...map[string]interface{}) (int, map[string]interface{}) {
+		t.Helper()
+
+		c, recorder := a.context(http.MethodPost, map[string]interface{}{"operations": operations}, "USER", 2)
+		err := a.Database.Batch(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := map[string]interface{}{}
+		err = json.Unmarshal(recorder.Body.Bytes(), &result)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return recorder.Code, result
+	}
+	bodies := func() []string {
+		t.Helper()
+		var bodies []string
+		err := a.db.Table("notes").Order("id").Pluck("body", &bodies).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bodies
+	}
+
+	status, result := batch(
+		map[string]interface{}{"op": "insert", "table": "notes", "data": map[string]interface{}{"body": "a", "owner": "@user.id"}},
+		map[string]interface{}{"op": "update", "table": "notes", "data": map[string]interface{}{"id": "@ops.0.id", "body": "b"}},
+		map[string]interface{}{"op": "insert", "table": "notes", "data": map[string]interface{}{"body": "c", "owner": 2}},
+		map[string]interface{}{"op": "delete", "table": "notes", "id": []interface{}{"@ops.2.id"}},
+		map[string]interface{}{"op": "upsert", "table": "notes", "data": map[string]interface{}{"id": 1, "body": "d"}},
+	)
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %v", status, result)
+	}
+	results := result["data"].([]interface{})
+	if id := results[3].(map[string]interface{})["id"].([]interface{})[0]; id != float64(4) {
+		t.Errorf("deleted %v, want the row of the third operation", id)
+	}
+	if action := results[4].(map[string]interface{})["action"]; action != "update" {
+		t.Errorf("upsert of a stored row turned into %v", action)
+	}
+	if got := bodies(); len(got) != 3 || got[0] != "d" || got[2] != "b" {
+		t.Errorf("notes %v", got)
+	}
+
+	tests := []struct {
+		name       string
+		operations []map[string]interface{}
+		status     int
+		index      float64
+	}{
+		{"note of another member", []map[string]interface{}{
+			{"op": "insert", "table": "notes", "data": map[string]interface{}{"body": "x", "owner": 2}},
+			{"op": "update", "table": "notes", "data": map[string]interface{}{"id": 2, "body": "x"}},
+		}, http.StatusForbidden, 1},
+		{"reference to a later operation", []map[string]interface{}{
+			{"op": "delete", "table": "notes", "id": []interface{}{1}},
+			{"op": "update", "table": "notes", "data": map[string]interface{}{"id": "@ops.2.id", "body": "x"}},
+			{"op": "insert", "table": "notes", "data": map[string]interface{}{"body": "x", "owner": 2}},
+		}, http.StatusBadRequest, 1},
+		{"missing row", []map[string]interface{}{
+			{"op": "update", "table": "notes", "data": map[string]interface{}{"id": 1, "body": "x"}},
+			{"op": "delete", "table": "notes", "id": []interface{}{99}},
+		}, http.StatusNotFound, 1},
+		{"unknown op", []map[string]interface{}{
+			{"op": "insert", "table": "notes", "data": map[string]interface{}{"body": "x", "owner": 2}},
+			{"op": "merge", "table": "notes"},
+		}, http.StatusBadRequest, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, result := batch(test.operations...)
+			if status != test.status {
+				t.Errorf("status %d, want %d: %v", status, test.status, result)
+			}
+			if data, _ := result["data"].(map[string]interface{}); data["index"] != test.index {
+				t.Errorf("failed operation %v, want %v", data["index"], test.index)
+			}
+
+			// nothing written by the operations before the failed one is kept
+			if got := bodies(); len(got) != 3 || got[0] != "d" {
+				t.Errorf("notes %v", got)
+			}
+		})
+	}
+}
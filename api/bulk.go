@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"funcbase/constants"
+	"funcbase/model"
+	"funcbase/pkg/responses"
+	"funcbase/service"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type bulkParam struct {
+	Filter string `query:"filter"`
+	// nothing is written when the filter matches more rows
+	MaxAffected int64 `query:"max_affected"`
+	// only count the matching rows
+	DryRun bool `query:"dry_run"`
+}
+
+type bulkRes struct {
+	Affected int64 `json:"affected"`
+	DryRun   bool  `json:"dry_run,omitempty"`
+}
+
+// BulkUpdate
+//
+// Apply the change set of the body to every row matching the filter
+func (d *DatabaseAPIImpl) BulkUpdate(c echo.Context) error {
+	data := map[string]interface{}{}
+	if err := json.NewDecoder(c.Request().Body).Decode(&data); err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "failed to decode JSON data",
+			Error:   err.Error(),
+		})
+	}
+	if len(data) == 0 {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Nothing to update",
+			Error:   "empty change set",
+		})
+	}
+	if _, ok := data["id"]; ok {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Data ID can't be changed by a bulk update",
+			Error:   "id in change set",
+		})
+	}
+
+	return d.bulkWrite(c, data)
+}
+
+// bulkWrite
+//
+// Update the rows matching the filter with the data, or delete them when the data is nil. The
+// access rule of the table is checked next to the filter of the requesting user
+func (d *DatabaseAPIImpl) bulkWrite(c echo.Context, data map[string]interface{}) error {
+	var (
+		tableName            = c.Param("table_name")
+		params    *bulkParam = new(bulkParam)
+		userId               = requestUserID(c)
+	)
+
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	if strings.TrimSpace(params.Filter) == "" {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "A filter is required to write several rows",
+			Error:   "filter not found",
+		})
+	}
+	if params.MaxAffected == 0 {
+		params.MaxAffected = constants.BULK_DEFAULT_MAX_AFFECTED
+	}
+	if params.MaxAffected < 0 || params.MaxAffected > constants.BULK_MAX_AFFECTED {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: fmt.Sprintf("max_affected must be between 1 and %d", constants.BULK_MAX_AFFECTED),
+			Error:   "invalid max_affected",
+		})
+	}
+
+	if strings.Contains(params.Filter, "@user.id") {
+		if userId == "" {
+			return c.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error": "User ID is required",
+			})
+		}
+		params.Filter = strings.ReplaceAll(params.Filter, "@user.id", userFilterValue(c))
+	}
+
+	tableInfo, err := d.service.Table.Info(tableName, service.TABLE_INFO_TYPE)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+			Message: "failed to get table info",
+			Error:   err.Error(),
+		})
+	}
+	if tableInfo.IsView() {
+		return c.JSON(http.StatusMethodNotAllowed, responses.APIResponse{
+			Message: "View collection is read only",
+			Error:   "Table is read only",
+		})
+	}
+
+	option := &service.BulkParams{
+		Table:       tableName,
+		Filter:      params.Filter,
+		MaxAffected: params.MaxAffected,
+		DryRun:      params.DryRun,
+	}
+
+	operation := model.RULE_UPDATE
+	if data == nil {
+		operation = model.RULE_DELETE
+	}
+	option.Condition, option.ConditionArgs, err = ruleCondition(d.service.Rule, c, tableName, operation)
+	if err != nil {
+		return ruleResponse(c, err)
+	}
+
+	var affected int64
+	if data == nil {
+		affected, err = d.service.DB.BulkDelete(withActor(c, d.db), option)
+	} else {
+		for k, v := range data {
+			if v == "@user.id" {
+				if userId == "" {
+					return c.JSON(http.StatusBadRequest, responses.APIResponse{
+						Message: "User not authorized",
+						Error:   "Token not found",
+					})
+				}
+				data[k] = c.Get("user_id")
+			}
+		}
+
+		affected, err = d.service.DB.BulkUpdate(withActor(c, d.db), option, data)
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrTooManyRows) {
+			return c.JSON(http.StatusUnprocessableEntity, responses.APIResponse{
+				Data:    bulkRes{Affected: affected},
+				Message: fmt.Sprintf("The filter matches %d rows, more than max_affected %d", affected, params.MaxAffected),
+				Error:   err.Error(),
+			})
+		}
+		if errors.Is(err, service.ErrInvalidFilter) {
+			return c.JSON(http.StatusBadRequest, responses.APIResponse{
+				Message: "Invalid filter",
+				Error:   err.Error(),
+			})
+		}
+		if errors.Is(err, service.ErrFieldForbidden) {
+			return forbiddenFieldResponse(c, err)
+		}
+		if violation, ok := d.service.Table.Violation(err); ok {
+			return violationResponse(c, violation)
+		}
+		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+			Message: "failed to write data",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Data:    bulkRes{Affected: affected, DryRun: params.DryRun},
+		Message: "success",
+	})
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"funcbase/constants"
+	"funcbase/model"
+	"funcbase/pkg/responses"
+	"funcbase/service"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type changesParam struct {
+	Since uint `query:"since"`
+	// comma separated, every collection when empty
+	Tables string `query:"tables"`
+	Limit  int    `query:"limit"`
+}
+
+// Changes
+//
+// Read the change log of the collections after a sequence. Only the changes of the rows the
+// requesting user can list are returned
+func (d *DatabaseAPIImpl) Changes(c echo.Context) error {
+	var (
+		params *changesParam = new(changesParam)
+		names  []string
+	)
+
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	if params.Limit == 0 {
+		params.Limit = constants.CHANGES_DEFAULT_LIMIT
+	}
+	if params.Limit < 0 || params.Limit > constants.CHANGES_MAX_LIMIT {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: fmt.Sprintf("limit must be between 1 and %d", constants.CHANGES_MAX_LIMIT),
+			Error:   "invalid limit",
+		})
+	}
+
+	if params.Tables != "" {
+		for _, name := range strings.Split(params.Tables, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	} else {
+		err := d.db.Model(&model.Tables{}).
+			Where("system = ?", false).
+			Where("(type IS NULL OR type != ?)", model.TABLE_TYPE_VIEW).
+			Order("name").
+			Pluck("name", &names).Error
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+				Message: "failed to get tables",
+				Error:   err.Error(),
+			})
+		}
+	}
+
+	option := &service.ChangesParams{
+		Since:  params.Since,
+		Limit:  params.Limit,
+		Scopes: []service.ChangeScope{},
+	}
+	for _, name := range names {
+		tableInfo, err := d.service.Table.Info(name, service.TABLE_INFO_TYPE, service.TABLE_INFO_SYSTEM)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, responses.APIResponse{
+				Message: "failed to get table info",
+				Error:   err.Error(),
+			})
+		}
+		if tableInfo.IsView() || tableInfo.System {
+			return c.JSON(http.StatusBadRequest, responses.APIResponse{
+				Message: fmt.Sprintf("%s has no change log", name),
+				Error:   "invalid table",
+			})
+		}
+
+		scope := service.ChangeScope{Table: name}
+		if c.Get("roles") != "ADMIN" {
+			scope.Condition, scope.ConditionArgs, err = d.service.Rule.Condition(name, model.RULE_LIST, ruleAuth(c))
+			if err == nil && scope.Condition != "" {
+				scope.DeletedCondition, scope.DeletedConditionArgs, err = d.service.Rule.RowCondition(name, model.RULE_LIST, ruleAuth(c), `"_changes"."data"`)
+			}
+			if errors.Is(err, service.ErrRuleDenied) && params.Tables == "" {
+				continue
+			}
+			if err != nil {
+				return ruleResponse(c, err)
+			}
+		}
+
+		option.Scopes = append(option.Scopes, scope)
+	}
+
+	page, err := d.service.DB.Changes(d.db, option)
+	if err != nil {
+		if errors.Is(err, service.ErrChangesExpired) {
+			return c.JSON(http.StatusGone, responses.APIResponse{
+				Data:    page,
+				Message: "Read the data again and continue from next",
+				Error:   err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+			Message: "failed to get changes",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Data:    page,
+		Message: "success",
+	})
+}
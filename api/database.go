@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"funcbase/config"
 	"funcbase/constants"
 	"funcbase/middleware"
 	"funcbase/model"
@@ -29,6 +30,12 @@ type DatabaseAPI interface {
 	FetchTableColumns(c echo.Context) error
 	UpdateTable(c echo.Context) error
 	DeleteTable(c echo.Context) error
+	CreateView(c echo.Context) error
+	UpdateView(c echo.Context) error
+	UpdateTableSoftDelete(c echo.Context) error
+	UpdateTableHistory(c echo.Context) error
+	UpdateTableVersioned(c echo.Context) error
+	BulkUpdate(c echo.Context) error
 	FetchTableAccess(c echo.Context) error
 	UpdateTableAccess(c echo.Context) error
 
@@ -37,6 +44,26 @@ type DatabaseAPI interface {
 	Insert(c echo.Context) error
 	Update(c echo.Context) error
 	Delete(c echo.Context) error
+	Import(c echo.Context) error
+	Export(c echo.Context) error
+	Batch(c echo.Context) error
+	Changes(c echo.Context) error
+
+	ListTrash(c echo.Context) error
+	RestoreTrash(c echo.Context) error
+	PurgeTrash(c echo.Context) error
+
+	FetchHistory(c echo.Context) error
+	RevertHistory(c echo.Context) error
+
+	CreateIndex(c echo.Context) error
+	DropIndex(c echo.Context) error
+	DiagnoseIndexes(c echo.Context) error
+
+	FetchTriggers(c echo.Context) error
+	CreateTrigger(c echo.Context) error
+	UpdateTrigger(c echo.Context) error
+	DropTrigger(c echo.Context) error
 
 	RunQuery(c echo.Context) error
 	FetchQueryHistory(c echo.Context) error
@@ -67,12 +94,38 @@ func (api *API) MainAPI() {
 	mainRouter.DELETE("/:table_name", api.Database.DeleteTable, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
 	mainRouter.GET("/table/:table_name/access", api.Database.FetchTableAccess, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
 	mainRouter.PUT("/table/access", api.Database.UpdateTableAccess, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+	mainRouter.POST("/view/create", api.Database.CreateView, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+	mainRouter.PUT("/view/update", api.Database.UpdateView, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+	mainRouter.PUT("/table/soft_delete", api.Database.UpdateTableSoftDelete, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+	mainRouter.PUT("/table/history", api.Database.UpdateTableHistory, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+	mainRouter.PUT("/table/versioned", api.Database.UpdateTableVersioned, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
 
 	mainRouter.GET("/:table_name/:id", api.Database.View, middleware.ValidateAPIKey, middleware.RequireAuth(false))
 	mainRouter.GET("/:table_name/rows", api.Database.List, middleware.ValidateAPIKey, middleware.RequireAuth(false))
 	mainRouter.POST("/:table_name/insert", api.Database.Insert, middleware.ValidateAPIKey, middleware.RequireAuth(false))
 	mainRouter.PUT("/:table_name/update", api.Database.Update, middleware.ValidateAPIKey, middleware.RequireAuth(false))
 	mainRouter.DELETE("/:table_name/rows", api.Database.Delete, middleware.ValidateAPIKey, middleware.RequireAuth(false))
+	mainRouter.PATCH("/:table_name/rows", api.Database.BulkUpdate, middleware.ValidateAPIKey, middleware.RequireAuth(false))
+	mainRouter.POST("/:table_name/import", api.Database.Import, middleware.ValidateAPIKey, middleware.RequireAuth(false))
+	mainRouter.GET("/:table_name/export", api.Database.Export, middleware.ValidateAPIKey, middleware.RequireAuth(false))
+	mainRouter.POST("/batch", api.Database.Batch, middleware.ValidateAPIKey, middleware.RequireAuth(false))
+	mainRouter.GET("/changes", api.Database.Changes, middleware.ValidateAPIKey, middleware.RequireAuth(false))
+
+	mainRouter.GET("/:table_name/trash", api.Database.ListTrash, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+	mainRouter.POST("/:table_name/trash/restore", api.Database.RestoreTrash, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+	mainRouter.DELETE("/:table_name/trash", api.Database.PurgeTrash, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+
+	mainRouter.GET("/:table_name/:id/history", api.Database.FetchHistory, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+	mainRouter.POST("/:table_name/:id/history/:history_id/revert", api.Database.RevertHistory, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+
+	mainRouter.POST("/table/:table_name/index", api.Database.CreateIndex, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+	mainRouter.DELETE("/table/:table_name/index/:index_name", api.Database.DropIndex, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+	mainRouter.GET("/diagnostics/indexes", api.Database.DiagnoseIndexes, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+
+	mainRouter.GET("/table/:table_name/triggers", api.Database.FetchTriggers, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+	mainRouter.POST("/table/:table_name/trigger", api.Database.CreateTrigger, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+	mainRouter.PUT("/table/:table_name/trigger/:trigger_name", api.Database.UpdateTrigger, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+	mainRouter.DELETE("/table/:table_name/trigger/:trigger_name", api.Database.DropTrigger, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
 
 	mainRouter.POST("/query", api.Database.RunQuery, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
 	mainRouter.GET("/query", api.Database.FetchQueryHistory, middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
@@ -91,7 +144,7 @@ func (d *DatabaseAPIImpl) FetchAllTables(c echo.Context) error {
 	}
 
 	query := d.db.Model(&model.Tables{}).
-		Select("name", "auth").
+		Select("name", "auth", "type").
 		Where("system = ?", false).
 		Order("name ASC")
 
@@ -125,7 +178,7 @@ func (d *DatabaseAPIImpl) FetchTableInfo(c echo.Context) error {
 		})
 	}
 
-	table, err := d.service.Table.Info(tableName, service.TABLE_INFO_INDEXES)
+	table, err := d.service.Table.Info(tableName, service.TABLE_INFO_INDEXES, service.TABLE_INFO_CONSTRAINTS)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
 			Message: "Error fetching table info",
@@ -133,6 +186,7 @@ func (d *DatabaseAPIImpl) FetchTableInfo(c echo.Context) error {
 		})
 	}
 	response["index"] = table.SystemIndex
+	response["constraints"] = table.SystemConstraint
 
 	datas := strings.Split(params.Data, ",")
 	for _, data := range datas {
@@ -183,6 +237,17 @@ type fetchRowsParam struct {
 	Page     int    `query:"page"`
 	PageSize int    `query:"page_size"`
 	GetCount bool   `query:"get_count"`
+	Expand   string `query:"expand"`
+	Search   string `query:"search"`
+	// cursor pagination, used instead of page when one of them is given
+	After  string `query:"after"`
+	Before string `query:"before"`
+	Limit  int    `query:"limit"`
+	// exact or approximate, get_count is an exact count
+	Count string `query:"count"`
+	// comma separated fields returned or left out
+	Fields  string `query:"fields"`
+	Exclude string `query:"exclude"`
 }
 
 type fetchRowsRes struct {
@@ -192,24 +257,22 @@ type fetchRowsRes struct {
 	TotalData int64                    `json:"total_data"`
 }
 
+type fetchCursorRes struct {
+	Data       []map[string]interface{} `json:"data"`
+	Limit      int                      `json:"limit"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+	PrevCursor string                   `json:"prev_cursor,omitempty"`
+	TotalData  *int64                   `json:"total_data,omitempty"`
+}
+
 func (d *DatabaseAPIImpl) List(c echo.Context) error {
 	var (
-		tableName                  = c.Param("table_name")
-		params     *fetchRowsParam = new(fetchRowsParam)
-		res        fetchRowsRes
-		requestUID = c.Get("user_id")
+		tableName                 = c.Param("table_name")
+		params    *fetchRowsParam = new(fetchRowsParam)
+		res       fetchRowsRes
+		userId    = requestUserID(c)
 	)
 
-	var userId int
-	var ok bool
-	if requestUID != nil {
-		userId, ok = requestUID.(int)
-		if !ok {
-			userId = 0
-		}
-		userId = int(userId)
-	}
-
 	if err := (&echo.DefaultBinder{}).BindQueryParams(c, params); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]interface{}{
 			"error": err.Error(),
@@ -217,34 +280,114 @@ func (d *DatabaseAPIImpl) List(c echo.Context) error {
 	}
 
 	if strings.Contains(params.Filter, "@user.id") {
-		if userId == 0 {
+		if userId == "" {
 			return c.JSON(http.StatusBadRequest, map[string]interface{}{
 				"error": "User ID is required",
 			})
 		}
-		str := fmt.Sprintf("%d", userId)
-		params.Filter = strings.ReplaceAll(params.Filter, "@user.id", str)
+		params.Filter = strings.ReplaceAll(params.Filter, "@user.id", userFilterValue(c))
 	}
 
-	data, err := d.service.DB.Fetch(d.db, &service.FetchParams{
-		Table:  tableName,
-		Filter: params.Filter,
-		Order:  params.Sort,
-		Limit:  params.PageSize,
-		Offset: (params.Page - 1) * params.PageSize,
-	})
+	if params.Count != "" && params.Count != "exact" && params.Count != "approximate" {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "count must be exact or approximate",
+			Error:   "invalid count",
+		})
+	}
+
+	projection, expand, err := d.projection(c, tableName, params.Fields, params.Exclude, params.Expand)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Invalid fields",
+			Error:   err.Error(),
+		})
+	}
+
+	condition, conditionArgs, err := ruleCondition(d.service.Rule, c, tableName, model.RULE_LIST)
+	if err != nil {
+		return ruleResponse(c, err)
+	}
+
+	option := &service.FetchParams{
+		Table:         tableName,
+		Filter:        params.Filter,
+		Search:        params.Search,
+		Order:         params.Sort,
+		Condition:     condition,
+		ConditionArgs: conditionArgs,
+	}
+	if projection != nil {
+		option.Columns = projection.Columns
+	}
+
+	var (
+		data    []map[string]interface{}
+		cursors service.PageCursors
+	)
+	isCursor := params.After != "" || params.Before != "" || params.Limit > 0
+	if isCursor {
+		if params.Limit <= 0 {
+			params.Limit = constants.CURSOR_DEFAULT_LIMIT
+		}
+		if params.Limit > constants.CURSOR_MAX_LIMIT {
+			params.Limit = constants.CURSOR_MAX_LIMIT
+		}
+
+		option.Limit = params.Limit
+		option.After = params.After
+		option.Before = params.Before
+		data, cursors, err = d.service.DB.FetchPage(withActor(c, d.db), option)
+	} else {
+		option.Limit = params.PageSize
+		option.Offset = (params.Page - 1) * params.PageSize
+		data, err = d.service.DB.Fetch(withActor(c, d.db), option)
+	}
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidCursor) {
+			return c.JSON(http.StatusBadRequest, responses.APIResponse{
+				Message: "Invalid pagination",
+				Error:   err.Error(),
+			})
+		}
+		if errors.Is(err, service.ErrInvalidFilter) {
+			return c.JSON(http.StatusBadRequest, responses.APIResponse{
+				Message: "Invalid filter",
+				Error:   err.Error(),
+			})
+		}
 		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
 			Message: "Error fetching data",
 			Error:   err.Error(),
 		})
 	}
+
+	if len(expand) > 0 {
+		err = d.service.DB.Expand(withActor(c, d.db), tableName, data, &service.ExpandParams{
+			Expand:        expand,
+			MaxDepth:      config.GetInstance().GetExpandMaxDepth(),
+			ViewCondition: viewCondition(d.service.Rule, c),
+		})
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, responses.APIResponse{
+				Message: "Error expanding data",
+				Error:   err.Error(),
+			})
+		}
+	}
+	if projection != nil {
+		data = projection.Apply(data)
+	}
 	res.Data = data
 
-	if params.GetCount {
-		count, err := d.service.DB.Count(d.db, &service.FetchParams{
-			Table:  tableName,
-			Filter: params.Filter,
+	var count *int64
+	if params.GetCount || params.Count != "" {
+		total, err := d.service.DB.Count(withActor(c, d.db), &service.FetchParams{
+			Table:         tableName,
+			Filter:        params.Filter,
+			Search:        params.Search,
+			Approximate:   params.Count == "approximate",
+			Condition:     condition,
+			ConditionArgs: conditionArgs,
 		})
 
 		if err != nil {
@@ -253,13 +396,24 @@ func (d *DatabaseAPIImpl) List(c echo.Context) error {
 				Error:   err.Error(),
 			})
 		}
-		res.TotalData = count
+		count = &total
+		res.TotalData = total
+	}
+
+	if isCursor {
+		return jsonWithETag(c, http.StatusOK, fetchCursorRes{
+			Data:       data,
+			Limit:      params.Limit,
+			NextCursor: cursors.Next,
+			PrevCursor: cursors.Prev,
+			TotalData:  count,
+		})
 	}
 
 	res.Page = params.Page
 	res.PageSize = params.PageSize
 
-	return c.JSON(http.StatusOK, res)
+	return jsonWithETag(c, http.StatusOK, res)
 }
 
 func (d *DatabaseAPIImpl) CreateTable(c echo.Context) error {
@@ -288,133 +442,219 @@ func (d *DatabaseAPIImpl) CreateTable(c echo.Context) error {
 	return c.JSON(http.StatusOK, nil)
 }
 
+type viewParam struct {
+	Expand  string `query:"expand"`
+	Fields  string `query:"fields"`
+	Exclude string `query:"exclude"`
+}
+
+// projection
+//
+// Compile the fields and exclude params of a read. The relations expanded by the request
+// are selected along so that they can still be expanded
+func (d *DatabaseAPIImpl) projection(c echo.Context, tableName string, fields string, exclude string, expand string) (*service.Projection, []string, error) {
+	paths := []string{}
+	if expand != "" {
+		paths = strings.Split(expand, ",")
+	}
+
+	if fields == "" && exclude == "" {
+		return nil, paths, nil
+	}
+
+	projection, err := d.service.DB.Projection(withActor(c, d.db), tableName, fields, exclude)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	paths = projection.ExpandPaths(paths)
+	for _, path := range paths {
+		projection.Include(strings.SplitN(path, ".", 2)[0])
+	}
+
+	return projection, paths, nil
+}
+
+func (d *DatabaseAPIImpl) CreateView(c echo.Context) error {
+	var params *model.CreateView = new(model.CreateView)
+	if err := c.Bind(&params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		return d.service.Table.CreateView(tx, *params)
+	})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to create view",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, nil)
+}
+
+func (d *DatabaseAPIImpl) UpdateView(c echo.Context) error {
+	var params *model.CreateView = new(model.CreateView)
+	if err := c.Bind(&params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		return d.service.Table.UpdateView(tx, *params)
+	})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to update view",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Message: "success",
+	})
+}
+
+// isView
+//
+// View collection is read only, any write to it should be rejected
+func (d *DatabaseAPIImpl) isView(tableName string) (bool, error) {
+	tableInfo, err := d.service.Table.Info(tableName, service.TABLE_INFO_TYPE)
+	if err != nil {
+		return false, err
+	}
+
+	return tableInfo.IsView(), nil
+}
+
+// setETag
+//
+// Tag the response with the current entity tag of a row
+func (d *DatabaseAPIImpl) setETag(c echo.Context, tableName string, id interface{}) string {
+	tags, err := d.service.DB.ETags(d.db, tableName, []interface{}{id})
+	if err != nil {
+		return ""
+	}
+
+	etag := tags[idString(id)]
+	if etag != "" {
+		c.Response().Header().Set("ETag", etag)
+	}
+
+	return etag
+}
+
 func (d *DatabaseAPIImpl) View(c echo.Context) error {
 	var (
-		tableName                              = c.Param("table_name")
-		requestID                              = c.Param("id")
-		requestUID                             = c.Get("user_id")
-		result          map[string]interface{} = make(map[string]interface{}, 0)
-		roles                                  = c.Get("roles")
-		referencedTable                        = ""
+		tableName                        = c.Param("table_name")
+		requestID                        = c.Param("id")
+		result    map[string]interface{} = make(map[string]interface{}, 0)
+		params    *viewParam             = new(viewParam)
 	)
 
-	var userId int
-	var ok bool
-	if requestUID != nil {
-		userId, ok = requestUID.(int)
-		if !ok {
-			userId = 0
-		}
-		userId = int(userId)
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
 	}
 
-	var id int
-	var err error
-	if requestID != "" {
-		id, err = strconv.Atoi(requestID)
-		if err != nil {
-			return c.JSON(http.StatusBadRequest, responses.APIResponse{
-				Message: "ID must be an integer",
-				Error:   err.Error(),
-			})
-		}
-		id = int(id)
+	projection, expand, err := d.projection(c, tableName, params.Fields, params.Exclude, params.Expand)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Invalid fields",
+			Error:   err.Error(),
+		})
 	}
 
-	if roles != "ADMIN" {
-		tableInfo, err := d.service.Table.Info(tableName, service.TABLE_INFO_ACCESS, service.TABLE_INFO_AUTH)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, responses.APIResponse{
-				Message: "Error fetching data",
-				Error:   err.Error(),
-			})
-		}
+	option := &service.FetchParams{
+		Table: tableName,
+		IDs:   []interface{}{requestID},
+		Limit: 1,
+	}
+	if projection != nil {
+		option.Columns = projection.Columns
+	}
 
-		viewAccess := tableInfo.Access.View()
-		switch viewAccess {
-		case "0":
-			return c.JSON(http.StatusForbidden, responses.APIResponse{
-				Message: "You don't have access to view this data",
-				Error:   "Data restricted",
-			})
-		case "1":
-			if userId == 0 {
-				return c.JSON(http.StatusForbidden, responses.APIResponse{
-					Message: "You don't have access to view this data",
-					Error:   "Data restricted",
-				})
-			}
-		case "2":
-			// ignore since data is public
-		default:
-			if tableInfo.Auth {
-				if userId != id {
-					return c.JSON(http.StatusForbidden, responses.APIResponse{
-						Message: "You don't have access to view this data because you dont own it",
-						Error:   "Data restricted",
-					})
-				}
-			} else {
-				referencedTable = viewAccess
-			}
-		}
+	allowed, err := ruleAllowed(d.service.Rule, c, d.db, tableName, model.RULE_VIEW, option.IDs)
+	if err != nil || !allowed {
+		return ruleResponse(c, err)
 	}
 
-	if err := d.db.Table(tableName).
-		Select("*").
-		Where("id = ?", requestID).
-		Find(&result).
-		Limit(1).
-		Error; err != nil {
+	data, err := d.service.DB.Fetch(withActor(c, d.db), option)
+	if err != nil {
 		return err
 	}
+	if len(data) > 0 {
+		result = data[0]
+	}
+
+	if len(data) > 0 {
+		etag := d.setETag(c, tableName, result["id"])
+		// the tag doesn't follow the expanded rows, they are always sent again
+		if etag != "" && len(expand) == 0 && notModified(c, etag) {
+			return c.NoContent(http.StatusNotModified)
+		}
+	}
 
-	if referencedTable != "" {
-		userTable := int(result[referencedTable].(float64))
-		if userTable != userId {
-			return c.JSON(http.StatusForbidden, responses.APIResponse{
-				Message: "You don't have access to view this data 3",
-				Error:   "Data restricted",
+	if len(expand) > 0 && len(data) > 0 {
+		err = d.service.DB.Expand(withActor(c, d.db), tableName, data, &service.ExpandParams{
+			Expand:        expand,
+			MaxDepth:      config.GetInstance().GetExpandMaxDepth(),
+			ViewCondition: viewCondition(d.service.Rule, c),
+		})
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, responses.APIResponse{
+				Message: "Error expanding data",
+				Error:   err.Error(),
 			})
 		}
 	}
+	if projection != nil && len(data) > 0 {
+		result = projection.Apply(data)[0]
+	}
 
 	return c.JSON(http.StatusOK, result)
 }
 
+// viewCondition
+//
+// Condition of the view rule of a table, used to filter the expanded relations in the query
+// reading them
+func viewCondition(rules service.RuleService, c echo.Context) func(tableName string) (string, []interface{}, error) {
+	return func(tableName string) (string, []interface{}, error) {
+		return ruleCondition(rules, c, tableName, model.RULE_VIEW)
+	}
+}
+
 func (d *DatabaseAPIImpl) Insert(c echo.Context) error {
 	var (
 		tableName   = c.Param("table_name")
 		userId      = c.Get("user_id")
-		roles       = c.Get("roles")
 		contentType = c.Request().Header.Get("Content-Type")
 	)
-	tableInfo, err := d.service.Table.Info(tableName, service.TABLE_INFO_ACCESS, service.TABLE_INFO_AUTH)
+	readOnly, err := d.isView(tableName)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
-			"error": err.Error(),
+		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+			Message: "failed to get table info",
+			Error:   err.Error(),
+		})
+	}
+	if readOnly {
+		return c.JSON(http.StatusMethodNotAllowed, responses.APIResponse{
+			Message: "View collection is read only",
+			Error:   "Table is read only",
 		})
 	}
 
-	if roles != "ADMIN" {
-		insertAccess := tableInfo.Access.Create()
-		switch insertAccess {
-		case "0":
-			return c.JSON(http.StatusForbidden, responses.APIResponse{
-				Message: "You don't have access to this data",
-				Error:   "Data restricted",
-			})
-		case "1":
-			if userId == nil {
-				return c.JSON(http.StatusForbidden, responses.APIResponse{
-					Message: "You don't have access to this data",
-					Error:   "Data restricted",
-				})
-			}
-		case "2":
-		default:
-			// ignore since data is public
-		}
+	tableInfo, err := d.service.Table.Info(tableName, service.TABLE_INFO_AUTH)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": err.Error(),
+		})
 	}
 
 	if tableInfo.Auth {
@@ -451,12 +691,29 @@ func (d *DatabaseAPIImpl) Insert(c echo.Context) error {
 					})
 				}
 				filteredData[k] = userId
+				continue
 			}
 			filteredData[k] = v[0]
 		}
 
-		err = d.service.DB.Insert(d.db, tableName, filteredData)
+		allowed, err := ruleMatch(d.service.Rule, c, d.db, tableName, model.RULE_CREATE, filteredData)
+		if err != nil || !allowed {
+			return ruleResponse(c, err)
+		}
+
+		// the file fields are checked with the row, their names are only known once it has an id
+		for k := range form.File {
+			filteredData[k] = ""
+		}
+
+		err = d.service.DB.Insert(withActor(c, d.db), tableName, filteredData)
 		if err != nil {
+			if errors.Is(err, service.ErrFieldForbidden) {
+				return forbiddenFieldResponse(c, err)
+			}
+			if violation, ok := d.service.Table.Violation(err); ok {
+				return violationResponse(c, violation)
+			}
 			return c.JSON(http.StatusInternalServerError, responses.APIResponse{
 				Data:    nil,
 				Message: "failed to insert data",
@@ -464,8 +721,9 @@ func (d *DatabaseAPIImpl) Insert(c echo.Context) error {
 			})
 		}
 
-		for k, files := range form.File {
-			file, err := files[0].Open()
+		files := map[string]interface{}{"id": filteredData["id"]}
+		for k, formFiles := range form.File {
+			file, err := formFiles[0].Open()
 			if err != nil {
 				return c.JSON(http.StatusInternalServerError, map[string]interface{}{
 					"error": "Failed to open file",
@@ -474,8 +732,8 @@ func (d *DatabaseAPIImpl) Insert(c echo.Context) error {
 
 			defer file.Close()
 
-			newFileName := base64.StdEncoding.EncodeToString([]byte(string(filteredData["id"].(int64)) + k))
-			fileExtension := filepath.Ext(files[0].Filename)
+			newFileName := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%v", filteredData["id"]) + k))
+			fileExtension := filepath.Ext(formFiles[0].Filename)
 
 			storageDir := filepath.Join(storagePath, newFileName+fileExtension)
 			err = d.service.Storage.Save(file, storageDir)
@@ -486,16 +744,22 @@ func (d *DatabaseAPIImpl) Insert(c echo.Context) error {
 			}
 
 			filteredData[k] = fmt.Sprintf("%s%s", newFileName, fileExtension)
-			continue
+			files[k] = filteredData[k]
 		}
 
-		err = d.service.DB.Update(d.db, tableName, filteredData)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, responses.APIResponse{
-				Data:    nil,
-				Message: "failed to update data",
-				Error:   err.Error(),
-			})
+		if len(form.File) > 0 {
+			tx := withActor(c, d.db)
+			err = d.service.DB.Update(tx.WithContext(service.WithCheckedFields(tx.Statement.Context)), tableName, files)
+			if err != nil {
+				if violation, ok := d.service.Table.Violation(err); ok {
+					return violationResponse(c, violation)
+				}
+				return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+					Data:    nil,
+					Message: "failed to update data",
+					Error:   err.Error(),
+				})
+			}
 		}
 
 		return c.JSON(http.StatusOK, responses.APIResponse{
@@ -524,14 +788,26 @@ func (d *DatabaseAPIImpl) Insert(c echo.Context) error {
 			}
 		}
 
-		err = d.service.DB.Insert(d.db, tableName, param)
+		allowed, err := ruleMatch(d.service.Rule, c, d.db, tableName, model.RULE_CREATE, param)
+		if err != nil || !allowed {
+			return ruleResponse(c, err)
+		}
+
+		err = d.service.DB.Insert(withActor(c, d.db), tableName, param)
 		if err != nil {
+			if errors.Is(err, service.ErrFieldForbidden) {
+				return forbiddenFieldResponse(c, err)
+			}
+			if violation, ok := d.service.Table.Violation(err); ok {
+				return violationResponse(c, violation)
+			}
 			return c.JSON(http.StatusInternalServerError, responses.APIResponse{
 				Data:    param,
 				Message: "failed to insert data",
 				Error:   err.Error(),
 			})
 		}
+		d.setETag(c, tableName, param["id"])
 
 		return c.JSON(http.StatusCreated, responses.APIResponse{
 			Data:    param,
@@ -548,57 +824,23 @@ func (d *DatabaseAPIImpl) Insert(c echo.Context) error {
 
 func (d *DatabaseAPIImpl) Update(c echo.Context) error {
 	var (
-		tableName       = c.Param("table_name")
-		contentType     = c.Request().Header.Get("Content-Type")
-		requestUID      = c.Get("user_id")
-		roles           = c.Get("roles")
-		referencedTable = ""
+		tableName   = c.Param("table_name")
+		contentType = c.Request().Header.Get("Content-Type")
+		userId      = requestUserID(c)
 	)
 
-	var userId int
-	var ok bool
-	if requestUID != nil {
-		userId, ok = requestUID.(int)
-		if !ok {
-			userId = 0
-		}
-		userId = int(userId)
+	readOnly, err := d.isView(tableName)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+			Message: "failed to get table info",
+			Error:   err.Error(),
+		})
 	}
-
-	var isAuth = false
-	if roles != "ADMIN" {
-		tableInfo, err := d.service.Table.Info(tableName, service.TABLE_INFO_ACCESS, service.TABLE_INFO_AUTH)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, responses.APIResponse{
-				Data:    nil,
-				Message: "failed to get table info",
-				Error:   err.Error(),
-			})
-		}
-
-		updateAccess := tableInfo.Access.Update()
-		switch updateAccess {
-		case "0":
-			return c.JSON(http.StatusForbidden, responses.APIResponse{
-				Message: "You don't have access to this data",
-				Error:   "Data restricted",
-			})
-		case "1":
-			if userId == 0 {
-				return c.JSON(http.StatusForbidden, responses.APIResponse{
-					Message: "You don't have access to this data",
-					Error:   "Data restricted",
-				})
-			}
-		case "2":
-			// ignore since data is public
-		default:
-			if tableInfo.Auth {
-				isAuth = true
-			} else {
-				referencedTable = updateAccess
-			}
-		}
+	if readOnly {
+		return c.JSON(http.StatusMethodNotAllowed, responses.APIResponse{
+			Message: "View collection is read only",
+			Error:   "Table is read only",
+		})
 	}
 
 	switch {
@@ -625,13 +867,14 @@ func (d *DatabaseAPIImpl) Update(c echo.Context) error {
 				id = v[0]
 			}
 			if v[0] == "@user.id" {
-				if userId == 0 {
+				if userId == "" {
 					return c.JSON(http.StatusBadRequest, responses.APIResponse{
 						Message: "User not authorized",
 						Error:   "Token not found",
 					})
 				}
-				updatedData[k] = userId
+				updatedData[k] = c.Get("user_id")
+				continue
 			}
 			updatedData[k] = v[0]
 		}
@@ -643,15 +886,37 @@ func (d *DatabaseAPIImpl) Update(c echo.Context) error {
 			})
 		}
 
-		if isAuth && strconv.Itoa(userId) != id {
-			return c.JSON(http.StatusForbidden, responses.APIResponse{
-				Message: "You don't have access to this data",
-				Error:   "Data restricted",
-			})
+		allowed, err := ruleAllowed(d.service.Rule, c, d.db, tableName, model.RULE_UPDATE, []interface{}{id})
+		if err != nil || !allowed {
+			return ruleResponse(c, err)
 		}
 
 		updatedData["updated_at"] = time.Now()
 
+		for k, files := range form.File {
+			newFileName := base64.StdEncoding.EncodeToString([]byte(string(id) + k))
+			fileExtension := filepath.Ext(files[0].Filename)
+
+			updatedData[k] = fmt.Sprintf("%s%s", newFileName, fileExtension)
+		}
+
+		// the files are stored once the row is written, a field the user can't write keeps its file
+		err = d.service.DB.Update(withIfMatch(c, withActor(c, d.db)), tableName, updatedData)
+		if err != nil {
+			if errors.Is(err, service.ErrPreconditionFailed) {
+				return preconditionResponse(c, err)
+			}
+			if errors.Is(err, service.ErrFieldForbidden) {
+				return forbiddenFieldResponse(c, err)
+			}
+			if violation, ok := d.service.Table.Violation(err); ok {
+				return violationResponse(c, violation)
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+
 		for k, files := range form.File {
 			file, err := files[0].Open()
 			if err != nil {
@@ -662,54 +927,14 @@ func (d *DatabaseAPIImpl) Update(c echo.Context) error {
 
 			defer file.Close()
 
-			newFileName := base64.StdEncoding.EncodeToString([]byte(string(id) + k))
-			fileExtension := filepath.Ext(files[0].Filename)
-			storageDir := filepath.Join(storagePath, newFileName+fileExtension)
-
-			err = d.service.Storage.Save(file, storageDir)
+			err = d.service.Storage.Save(file, filepath.Join(storagePath, fmt.Sprintf("%v", updatedData[k])))
 			if err != nil {
 				return c.JSON(http.StatusInternalServerError, map[string]interface{}{
 					"error": err.Error(),
 				})
 			}
-
-			updatedData[k] = fmt.Sprintf("%s%s", newFileName, fileExtension)
-			continue
-		}
-
-		if referencedTable != "" {
-			data, err := d.service.DB.Fetch(d.db, &service.FetchParams{
-				Table:   tableName,
-				Filter:  fmt.Sprintf("id = '%s'", id),
-				Columns: []string{referencedTable},
-				Limit:   1,
-			})
-			if err != nil {
-				return c.JSON(http.StatusInternalServerError, responses.APIResponse{
-					Message: "failed to fetch data",
-					Error:   err.Error(),
-				})
-			}
-			if data[0][referencedTable] == nil {
-				return c.JSON(http.StatusNotFound, responses.APIResponse{
-					Message: "user data not found",
-					Error:   "user data not found",
-				})
-			}
-			if data[0][referencedTable] != userId {
-				return c.JSON(http.StatusForbidden, responses.APIResponse{
-					Message: "You don't have access to this data",
-					Error:   "Data restricted",
-				})
-			}
-		}
-
-		err = d.service.DB.Update(d.db, tableName, updatedData)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]interface{}{
-				"error": err.Error(),
-			})
 		}
+		d.setETag(c, tableName, id)
 
 		return c.JSON(http.StatusOK, responses.APIResponse{
 			Data:    updatedData,
@@ -733,12 +958,9 @@ func (d *DatabaseAPIImpl) Update(c echo.Context) error {
 			})
 		}
 
-		id := param["id"].(float64)
-		if isAuth && int(userId) != int(id) {
-			return c.JSON(http.StatusForbidden, responses.APIResponse{
-				Message: "You don't have access to this data",
-				Error:   "Data restricted",
-			})
+		allowed, err := ruleAllowed(d.service.Rule, c, d.db, tableName, model.RULE_UPDATE, []interface{}{param["id"]})
+		if err != nil || !allowed {
+			return ruleResponse(c, err)
 		}
 
 		for k, v := range param {
@@ -746,51 +968,34 @@ func (d *DatabaseAPIImpl) Update(c echo.Context) error {
 				continue
 			}
 			if v == "@user.id" {
-				if userId == 0 {
+				if userId == "" {
 					return c.JSON(http.StatusBadRequest, responses.APIResponse{
 						Message: "User not authorized",
 						Error:   "Token not found",
 					})
 				}
-				param[k] = userId
+				param[k] = c.Get("user_id")
 			}
 		}
 
-		if referencedTable != "" {
-			data, err := d.service.DB.Fetch(d.db, &service.FetchParams{
-				Table:   tableName,
-				Filter:  fmt.Sprintf("id = '%s'", param["id"]),
-				Columns: []string{referencedTable},
-				Limit:   1,
-			})
-			if err != nil {
-				return c.JSON(http.StatusInternalServerError, responses.APIResponse{
-					Message: "failed to fetch data",
-					Error:   err.Error(),
-				})
+		err = d.service.DB.Update(withIfMatch(c, withActor(c, d.db)), tableName, param)
+		if err != nil {
+			if errors.Is(err, service.ErrPreconditionFailed) {
+				return preconditionResponse(c, err)
 			}
-			if data[0][referencedTable] == nil {
-				return c.JSON(http.StatusNotFound, responses.APIResponse{
-					Message: "user data not found",
-					Error:   "user data not found",
-				})
+			if errors.Is(err, service.ErrFieldForbidden) {
+				return forbiddenFieldResponse(c, err)
 			}
-			if data[0][referencedTable] != userId {
-				return c.JSON(http.StatusForbidden, responses.APIResponse{
-					Message: "You don't have access to this data",
-					Error:   "Data restricted",
-				})
+			if violation, ok := d.service.Table.Violation(err); ok {
+				return violationResponse(c, violation)
 			}
-		}
-
-		err := d.service.DB.Update(d.db, tableName, param)
-		if err != nil {
 			return c.JSON(http.StatusInternalServerError, responses.APIResponse{
 				Data:    param,
 				Message: "failed to insert data",
 				Error:   err.Error(),
 			})
 		}
+		d.setETag(c, tableName, param["id"])
 
 		return c.JSON(http.StatusCreated, responses.APIResponse{
 			Data:    param,
@@ -812,100 +1017,323 @@ type deleteDataReq struct {
 
 func (d *DatabaseAPIImpl) Delete(c echo.Context) error {
 	var (
-		tableName                      = c.Param("table_name")
-		params          *deleteDataReq = new(deleteDataReq)
-		referencedTable                = ""
-		userId                         = c.Get("user_id")
-		roles                          = c.Get("roles")
+		tableName                = c.Param("table_name")
+		params    *deleteDataReq = new(deleteDataReq)
 	)
 
+	// rows matching a filter are deleted in one statement
+	if c.QueryParam("filter") != "" {
+		return d.bulkWrite(c, nil)
+	}
+
 	if err := c.Bind(&params); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]interface{}{
 			"error": err.Error(),
 		})
 	}
 
-	if roles != "ADMIN" {
-		tableInfo, err := d.service.Table.Info(tableName, service.TABLE_INFO_ACCESS, service.TABLE_INFO_AUTH)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, responses.APIResponse{
-				Message: "failed to fetch data",
-				Error:   err.Error(),
-			})
+	readOnly, err := d.isView(tableName)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+			Message: "failed to get table info",
+			Error:   err.Error(),
+		})
+	}
+	if readOnly {
+		return c.JSON(http.StatusMethodNotAllowed, responses.APIResponse{
+			Message: "View collection is read only",
+			Error:   "Table is read only",
+		})
+	}
+
+	for _, id := range params.ID {
+		allowed, err := ruleAllowed(d.service.Rule, c, d.db, tableName, model.RULE_DELETE, []interface{}{id})
+		if err != nil || !allowed {
+			return ruleResponse(c, err)
 		}
 
-		deleteAccess := tableInfo.Access.Delete()
-		switch deleteAccess {
-		case "0":
-			return c.JSON(http.StatusForbidden, responses.APIResponse{
-				Message: "You don't have access to this data",
-				Error:   "Data restricted",
-			})
-		case "1":
-			if userId == nil {
-				return c.JSON(http.StatusForbidden, responses.APIResponse{
-					Message: "You don't have access to this data",
-					Error:   "Data restricted",
-				})
+		err = d.service.DB.BatchDelete(withIfMatch(c, withActor(c, d.db)), tableName, []string{id})
+		if err != nil {
+			if errors.Is(err, service.ErrPreconditionFailed) {
+				return preconditionResponse(c, err)
 			}
-		case "2":
-			// ignore since data is public
-		default:
-			if tableInfo.Auth {
-				if len(params.ID) > 0 {
-					return c.JSON(http.StatusForbidden, responses.APIResponse{
-						Message: "On delete user data, only 1 data can be deleted at a time",
-						Error:   "Multiple ID not allowed",
-					})
-				}
-				if strconv.Itoa(userId.(int)) != params.ID[0] {
-					return c.JSON(http.StatusForbidden, responses.APIResponse{
-						Message: "You don't have access to this data",
-						Error:   "Data restricted",
-					})
-				}
-			} else {
-				referencedTable = deleteAccess
+			if violation, ok := d.service.Table.Violation(err); ok {
+				return violationResponse(c, violation)
 			}
+			return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+				"error": err.Error(),
+			})
 		}
 	}
 
-	for _, id := range params.ID {
-		if referencedTable != "" {
-			data, err := d.service.DB.Fetch(d.db, &service.FetchParams{
-				Table:   tableName,
-				Filter:  fmt.Sprintf("id = '%s'", id),
-				Columns: []string{referencedTable},
-				Limit:   1,
+	return c.JSON(http.StatusOK, nil)
+}
+
+type updateTableSoftDeleteReq struct {
+	TableName  string `json:"table_name"`
+	SoftDelete bool   `json:"soft_delete"`
+}
+
+func (d *DatabaseAPIImpl) UpdateTableSoftDelete(c echo.Context) error {
+	params := new(updateTableSoftDeleteReq)
+	if err := c.Bind(&params); err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to bind request body",
+			Error:   err.Error(),
+		})
+	}
+
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		return d.service.Table.SetSoftDelete(tx, params.TableName, params.SoftDelete)
+	})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to update soft delete",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Message: "success",
+	})
+}
+
+type updateTableHistoryReq struct {
+	TableName string `json:"table_name"`
+	History   bool   `json:"history"`
+}
+
+func (d *DatabaseAPIImpl) UpdateTableHistory(c echo.Context) error {
+	params := new(updateTableHistoryReq)
+	if err := c.Bind(&params); err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to bind request body",
+			Error:   err.Error(),
+		})
+	}
+
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		return d.service.Table.SetHistory(tx, params.TableName, params.History)
+	})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to update history",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Message: "success",
+	})
+}
+
+type updateTableVersionedReq struct {
+	TableName string `json:"table_name"`
+	Versioned bool   `json:"versioned"`
+}
+
+func (d *DatabaseAPIImpl) UpdateTableVersioned(c echo.Context) error {
+	params := new(updateTableVersionedReq)
+	if err := c.Bind(&params); err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to bind request body",
+			Error:   err.Error(),
+		})
+	}
+
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		return d.service.Table.SetVersioned(tx, params.TableName, params.Versioned)
+	})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to update versioning",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Message: "success",
+	})
+}
+
+func (d *DatabaseAPIImpl) ListTrash(c echo.Context) error {
+	var (
+		tableName                 = c.Param("table_name")
+		params    *fetchRowsParam = new(fetchRowsParam)
+		res       fetchRowsRes
+	)
+
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = constants.PAGE_DEFAULT_SIZE
+	}
+
+	data, err := d.service.DB.Fetch(withActor(c, d.db), &service.FetchParams{
+		Table:   tableName,
+		Filter:  params.Filter,
+		Order:   "deleted_at DESC",
+		Limit:   params.PageSize,
+		Offset:  (params.Page - 1) * params.PageSize,
+		Trashed: true,
+	})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Error fetching trash",
+			Error:   err.Error(),
+		})
+	}
+	res.Data = data
+
+	if params.GetCount {
+		count, err := d.service.DB.Count(withActor(c, d.db), &service.FetchParams{
+			Table:   tableName,
+			Filter:  params.Filter,
+			Trashed: true,
+		})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+				Message: "Error fetching trash",
+				Error:   err.Error(),
 			})
-			if err != nil {
-				return c.JSON(http.StatusInternalServerError, responses.APIResponse{
-					Message: "failed to fetch data",
-					Error:   err.Error(),
-				})
-			}
-			if data[0][referencedTable] == nil {
-				return c.JSON(http.StatusNotFound, responses.APIResponse{
-					Message: "Referenced table is empty",
-					Error:   "Data not found",
-				})
-			}
-			if data[0][referencedTable] != strconv.Itoa(userId.(int)) {
-				return c.JSON(http.StatusForbidden, responses.APIResponse{
-					Message: "You don't have access to this data",
-					Error:   "Data restricted",
-				})
-			}
 		}
-		err := d.service.DB.BatchDelete(d.db, tableName, []string{id})
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]interface{}{
-				"error": err.Error(),
+		res.TotalData = count
+	}
+
+	res.Page = params.Page
+	res.PageSize = params.PageSize
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (d *DatabaseAPIImpl) RestoreTrash(c echo.Context) error {
+	var (
+		tableName                = c.Param("table_name")
+		params    *deleteDataReq = new(deleteDataReq)
+	)
+
+	if err := c.Bind(&params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	if len(params.ID) == 0 {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Data ID is required to restore",
+			Error:   "ID not found",
+		})
+	}
+
+	err := d.service.DB.Restore(withActor(c, d.db), tableName, params.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+			Message: "Failed to restore data",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Message: "success",
+	})
+}
+
+// PurgeTrash
+//
+// Permanently delete the given rows from the trash, or empty the trash when no id is given
+func (d *DatabaseAPIImpl) PurgeTrash(c echo.Context) error {
+	var (
+		tableName                = c.Param("table_name")
+		params    *deleteDataReq = new(deleteDataReq)
+	)
+
+	if err := c.Bind(&params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	err := d.service.DB.Purge(withActor(c, d.db), tableName, params.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+			Message: "Failed to purge data",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Message: "success",
+	})
+}
+
+// FetchHistory
+//
+// List every recorded change of a single record, newest first
+func (d *DatabaseAPIImpl) FetchHistory(c echo.Context) error {
+	var (
+		tableName = c.Param("table_name")
+		id        = c.Param("id")
+	)
+
+	histories, err := d.service.DB.History(d.db, tableName, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+			Message: "Failed to fetch history",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Data:    histories,
+		Message: "success",
+	})
+}
+
+// RevertHistory
+//
+// Bring a record back to the state recorded by the given history
+func (d *DatabaseAPIImpl) RevertHistory(c echo.Context) error {
+	var (
+		tableName = c.Param("table_name")
+		id        = c.Param("id")
+	)
+
+	historyID, err := strconv.ParseUint(c.Param("history_id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Invalid history id",
+			Error:   err.Error(),
+		})
+	}
+
+	data, err := d.service.DB.Revert(withActor(c, d.db), tableName, id, uint(historyID))
+	if err != nil {
+		if violation, ok := d.service.Table.Violation(err); ok {
+			return violationResponse(c, violation)
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, responses.APIResponse{
+				Message: "History not found",
+				Error:   err.Error(),
 			})
 		}
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to revert data",
+			Error:   err.Error(),
+		})
 	}
 
-	return c.JSON(http.StatusOK, nil)
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Data:    data,
+		Message: "success",
+	})
 }
 
 type queryReq struct {
@@ -980,20 +1408,7 @@ func (d *DatabaseAPIImpl) DeleteTable(c echo.Context) error {
 	tableName := c.Param("table_name")
 
 	err := d.db.Transaction(func(tx *gorm.DB) error {
-		err := tx.Exec(fmt.Sprintf("DROP TABLE %s", tableName)).Error
-		if err != nil {
-			return err
-		}
-
-		err = tx.
-			Where("lower(name) = ?", strings.ToLower(tableName)).
-			Delete(&model.Tables{}).
-			Error
-		if err != nil {
-			return err
-		}
-
-		return nil
+		return d.service.Table.Drop(tx, tableName)
 	})
 
 	if err != nil {
@@ -1003,7 +1418,7 @@ func (d *DatabaseAPIImpl) DeleteTable(c echo.Context) error {
 	}
 
 	d.cache.Delete(fmt.Sprintf("columns_%s", tableName))
-	tableInfoCache := []string{service.TABLE_INFO_NAME, service.TABLE_INFO_AUTH, service.TABLE_INFO_INDEXES, service.TABLE_INFO_SYSTEM, service.TABLE_INFO_ACCESS}
+	tableInfoCache := []string{service.TABLE_INFO_NAME, service.TABLE_INFO_AUTH, service.TABLE_INFO_INDEXES, service.TABLE_INFO_SYSTEM, service.TABLE_INFO_RULES}
 	for _, info := range tableInfoCache {
 		d.cache.Delete(fmt.Sprintf("tableInfo:%s:%s", tableName, info))
 	}
@@ -1016,7 +1431,7 @@ func (d *DatabaseAPIImpl) FetchTableAccess(c echo.Context) error {
 		table = c.Param("table_name")
 	)
 
-	tableInfo, err := d.service.Table.Info(table, service.TABLE_INFO_ACCESS)
+	tableInfo, err := d.service.Table.Info(table, service.TABLE_INFO_RULES)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
 			Message: "Failed to fetch table access",
@@ -1025,13 +1440,18 @@ func (d *DatabaseAPIImpl) FetchTableAccess(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, responses.APIResponse{
-		Data:    tableInfo.Access,
+		Data:    tableInfo.SystemRule,
 		Message: "Table access fetched successfully",
 	})
 }
 
+// updateTableAccessReq
+//
+// A missing rule is reserved to admins and an empty one is public. The five slots of access
+// are still read when rules is missing, see model.RulesFromAccess
 type updateTableAccessReq struct {
-	TableName string `json:"table_name"`
+	TableName string       `json:"table_name"`
+	Rules     *model.Rules `json:"rules"`
 	Access    []struct {
 		Value     string `json:"value"`
 		Reference string `json:"reference"`
@@ -1048,29 +1468,48 @@ func (d *DatabaseAPIImpl) UpdateTableAccess(c echo.Context) error {
 		})
 	}
 
-	accessValue := []string{}
-	for _, access := range params.Access {
-		switch access.Value {
-		case "0", "1", "2":
-			accessValue = append(accessValue, access.Value)
-		case "3":
-			if access.Reference == "" {
+	tableInfo, err := d.service.Table.Info(params.TableName, service.TABLE_INFO_AUTH)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "failed to get table info",
+			Error:   err.Error(),
+		})
+	}
+
+	rules := params.Rules
+	if rules == nil {
+		accessValue := []string{}
+		for _, access := range params.Access {
+			switch access.Value {
+			case "0", "1", "2":
 				accessValue = append(accessValue, access.Value)
-			} else {
-				accessValue = append(accessValue, access.Reference)
+			case "3":
+				if access.Reference == "" {
+					accessValue = append(accessValue, access.Value)
+				} else {
+					accessValue = append(accessValue, access.Reference)
+				}
+			default:
+				return c.JSON(http.StatusBadRequest, responses.APIResponse{
+					Message: "Invalid access value",
+					Error:   "Invalid access value",
+				})
 			}
-		default:
-			return c.JSON(http.StatusBadRequest, responses.APIResponse{
-				Message: "Invalid access value",
-				Error:   "Invalid access value",
-			})
 		}
 
+		legacy := model.RulesFromAccess(strings.Join(accessValue, ";"), tableInfo.Auth)
+		rules = &legacy
+	}
+
+	err = d.service.Rule.Validate(params.TableName, *rules)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Invalid access rule",
+			Error:   err.Error(),
+		})
 	}
 
-	err := d.db.Model(&model.Tables{}).
-		Where("name = ?", params.TableName).
-		Update("access", strings.Join(accessValue, ";")).Error
+	err = d.service.Table.SetRules(d.db, params.TableName, *rules)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
 			Message: "Failed to update table access",
@@ -1078,8 +1517,6 @@ func (d *DatabaseAPIImpl) UpdateTableAccess(c echo.Context) error {
 		})
 	}
 
-	d.cache.Delete(fmt.Sprintf("tableInfo:%s:%s", params.TableName, service.TABLE_INFO_ACCESS))
-
 	return c.JSON(http.StatusOK, responses.APIResponse{
 		Message: "Table access updated successfully",
 	})
@@ -1092,6 +1529,9 @@ type updateTableReq struct {
 	Fields []model.Field `json:"fields"`
 	// indexes
 	Indexes []model.Index `json:"indexes"`
+	// constraints, kept as they are when left out
+	Uniques []model.Unique `json:"uniques"`
+	Checks  []model.Check  `json:"checks"`
 }
 
 func (d *DatabaseAPIImpl) UpdateTable(c echo.Context) error {
@@ -1101,93 +1541,58 @@ func (d *DatabaseAPIImpl) UpdateTable(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, errors.New("Failed to bind: "+err.Error()))
 	}
 
-	tableInfo, err := d.service.Table.Info(params.TableName, service.TABLE_INFO_AUTH)
+	tableInfo, err := d.service.Table.Info(params.TableName, service.TABLE_INFO_AUTH, service.TABLE_INFO_TYPE)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
 	}
 
+	if tableInfo.IsView() {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{"error": "view collection can only be changed through its query"})
+	}
+
 	tableType := "general"
 	if tableInfo.Auth {
 		tableType = "auth"
 	}
 
-	if len(params.Fields) > 0 || len(params.Indexes) > 0 {
-		if params.TableName == params.UpdatedTableName {
-			fmt.Println("Same table name")
-			err = d.db.Transaction(func(tx *gorm.DB) error {
-				// rename table to something else
-				tempTableName := "_temp_" + params.TableName
-				err := d.service.Table.Rename(tx, params.TableName, tempTableName)
-				if err != nil {
-					return err
-				}
-
-				indexes, err := d.service.Table.Indexes(params.TableName)
-				if err != nil {
-					return err
-				}
-
-				fmt.Println("Found indexes", indexes)
-
-				if len(indexes) > 0 {
-					err = d.service.Table.DropIndexes(tx, indexes)
-					if err != nil {
-						return err
-					}
-				}
-
-				// create new table with same name
-				err = d.service.Table.Create(tx, model.CreateTable{
-					Name:    params.TableName,
-					Fields:  params.Fields,
-					Indexes: params.Indexes,
-					Type:    tableType,
-				})
-				if err != nil {
-					return err
-				}
-
-				// copy all data from old table to new table
-				err = tx.Raw("INSERT INTO " + params.TableName + " SELECT * FROM " + tempTableName).Error
-				if err != nil {
-					return err
-				}
-
-				// delete old table
-				err = d.service.Table.Drop(tx, tempTableName)
-				if err != nil {
-					return err
-				}
+	if len(params.Fields) > 0 || params.Indexes != nil || params.Uniques != nil || params.Checks != nil {
+		if params.Fields == nil {
+			// only indexes or constraints are changed, keep the current fields
+			current, err := d.service.Schema.Table(params.TableName)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
+			}
+			params.Fields = current.Fields
+		}
 
-				return nil
+		err = d.service.Table.Alter(func(tx *gorm.DB) error {
+			// recreate the table with the new fields, keeping its data
+			err := d.service.Table.Rebuild(tx, model.CreateTable{
+				Name:    params.TableName,
+				Fields:  params.Fields,
+				Indexes: params.Indexes,
+				Uniques: params.Uniques,
+				Checks:  params.Checks,
+				Type:    tableType,
 			})
+			if err != nil {
+				return err
+			}
 
-		} else {
-			fmt.Println("Different table name")
-			err = d.db.Transaction(func(tx *gorm.DB) error {
-				// create new table with the new table name
-				err = d.service.Table.Create(tx, model.CreateTable{
-					Name:    params.UpdatedTableName,
-					Fields:  params.Fields,
-					Indexes: params.Indexes,
-					Type:    tableType,
-				})
-
-				// copy all data from old table to new table
-				err = tx.Raw("INSERT INTO " + params.UpdatedTableName + " SELECT * FROM " + params.TableName).Error
-				if err != nil {
-					return err
-				}
+			if params.UpdatedTableName == "" || params.TableName == params.UpdatedTableName {
+				return nil
+			}
 
-				// delete old table
-				err = d.service.Table.Drop(tx, params.TableName)
-				return err
-			})
-		}
+			return d.service.Table.Rename(tx, params.TableName, params.UpdatedTableName)
+		})
 
 		d.cache.Delete("columns_" + params.TableName)
 		d.cache.Delete("columns_" + params.UpdatedTableName)
 		if err != nil {
+			// existing rows breaking a new constraint
+			if violation, ok := d.service.Table.Violation(err); ok {
+				return violationResponse(c, violation)
+			}
 			return c.JSON(http.StatusInternalServerError, map[string]interface{}{
 				"message": "Failed to update table",
 				"error":   err.Error(),
@@ -1199,7 +1604,9 @@ func (d *DatabaseAPIImpl) UpdateTable(c echo.Context) error {
 		})
 	}
 
-	err = d.service.Table.Rename(d.db, params.TableName, params.UpdatedTableName)
+	err = d.service.Table.Alter(func(tx *gorm.DB) error {
+		return d.service.Table.Rename(tx, params.TableName, params.UpdatedTableName)
+	})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
 			"message": "Failed to update table name",
@@ -1211,3 +1618,174 @@ func (d *DatabaseAPIImpl) UpdateTable(c echo.Context) error {
 		Message: "success",
 	})
 }
+
+func (d *DatabaseAPIImpl) CreateIndex(c echo.Context) error {
+	tableName := c.Param("table_name")
+
+	params := new(model.Index)
+	if err := c.Bind(params); err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to bind request body",
+			Error:   err.Error(),
+		})
+	}
+
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		return d.service.Table.CreateIndex(tx, tableName, *params)
+	})
+	if err != nil {
+		// a unique index can't be created over duplicated rows
+		if violation, ok := d.service.Table.Violation(err); ok {
+			return violationResponse(c, violation)
+		}
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to create index",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Message: "success",
+		Data:    params,
+	})
+}
+
+func (d *DatabaseAPIImpl) DropIndex(c echo.Context) error {
+	var (
+		tableName = c.Param("table_name")
+		indexName = c.Param("index_name")
+	)
+
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		return d.service.Table.DropIndex(tx, tableName, indexName)
+	})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to drop index",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Message: "success",
+	})
+}
+
+func (d *DatabaseAPIImpl) FetchTriggers(c echo.Context) error {
+	triggers, err := d.service.Table.Triggers(c.Param("table_name"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, responses.APIResponse{
+				Message: "Table not found",
+				Error:   err.Error(),
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+			Message: "Failed to fetch triggers",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Message: "success",
+		Data:    triggers,
+	})
+}
+
+func (d *DatabaseAPIImpl) CreateTrigger(c echo.Context) error {
+	tableName := c.Param("table_name")
+
+	params := new(model.Trigger)
+	if err := c.Bind(params); err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to bind request body",
+			Error:   err.Error(),
+		})
+	}
+
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		return d.service.Table.CreateTrigger(tx, tableName, *params)
+	})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to create trigger",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Message: "success",
+		Data:    params,
+	})
+}
+
+func (d *DatabaseAPIImpl) UpdateTrigger(c echo.Context) error {
+	var (
+		tableName   = c.Param("table_name")
+		triggerName = c.Param("trigger_name")
+	)
+
+	params := new(model.Trigger)
+	if err := c.Bind(params); err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to bind request body",
+			Error:   err.Error(),
+		})
+	}
+
+	// the trigger keeps its name when left out
+	if params.Name == "" {
+		params.Name = triggerName
+	}
+
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		return d.service.Table.UpdateTrigger(tx, tableName, triggerName, *params)
+	})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to update trigger",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Message: "success",
+		Data:    params,
+	})
+}
+
+func (d *DatabaseAPIImpl) DropTrigger(c echo.Context) error {
+	var (
+		tableName   = c.Param("table_name")
+		triggerName = c.Param("trigger_name")
+	)
+
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		return d.service.Table.DropTrigger(tx, tableName, triggerName)
+	})
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to drop trigger",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Message: "success",
+	})
+}
+
+func (d *DatabaseAPIImpl) DiagnoseIndexes(c echo.Context) error {
+	diagnostics, err := d.service.DB.DiagnoseSlowQueries(d.db)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+			Message: "Failed to diagnose slow queries",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Message: "success",
+		Data:    diagnostics,
+	})
+}
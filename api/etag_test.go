@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIfMatch(t *testing.T) {
+	a := newTestAPI(t)
+	a.createMembers(t)
+	a.createNotes(t, 2)
+
+	view := func(ifNoneMatch string) (int, string) {
+		t.Helper()
+		c, recorder := a.context(http.MethodGet, nil, "USER", 2)
+		c.Request().Header.Set("If-None-Match", ifNoneMatch)
+		c.SetParamNames("table_name", "id")
+		c.SetParamValues("notes", "1")
+
+		err := a.Database.View(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return recorder.Code, recorder.Header().Get("ETag")
+	}
+	update := func(ifMatch string, body string) (int, string) {
+		t.Helper()
+		c, recorder := a.context(http.MethodPut, map[string]interface{}{"id": 1, "body": body}, "USER", 2)
+		c.Request().Header.Set("If-Match", ifMatch)
+		c.SetParamNames("table_name")
+		c.SetParamValues("notes")
+
+		err := a.Database.Update(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return recorder.Code, recorder.Header().Get("ETag")
+	}
+
+	status, etag := view("")
+	if status != http.StatusOK || etag == "" {
+		t.Fatalf("view: status %d, etag %q", status, etag)
+	}
+	if status, _ := view(etag); status != http.StatusNotModified {
+		t.Errorf("view of a held row: status %d, want %d", status, http.StatusNotModified)
+	}
+
+	if status, _ := update(`"stale"`, "a"); status != http.StatusPreconditionFailed {
+		t.Errorf("update with a stale tag: status %d, want %d", status, http.StatusPreconditionFailed)
+	}
+
+	status, updated := update(etag, "b")
+	if status != http.StatusCreated || updated == "" || updated == etag {
+		t.Errorf("update with the current tag: status %d, etag %q after %q", status, updated, etag)
+	}
+
+	// the tag read before the update no longer matches
+	if status, _ := update(etag, "c"); status != http.StatusPreconditionFailed {
+		t.Errorf("update with the replaced tag: status %d, want %d", status, http.StatusPreconditionFailed)
+	}
+	if status, _ := view(etag); status != http.StatusOK {
+		t.Errorf("view with the replaced tag: status %d, want %d", status, http.StatusOK)
+	}
+
+	var body string
+	err := a.db.Table("notes").Where("id = ?", 1).Pluck("body", &body).Error
+	if err != nil || body != "b" {
+		t.Errorf("body %q, error %v", body, err)
+	}
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"funcbase/model"
+	"funcbase/pkg/responses"
+	pkg_xlsx "funcbase/pkg/xlsx"
+	"funcbase/service"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	EXPORT_CSV    = "csv"
+	EXPORT_NDJSON = "ndjson"
+	EXPORT_XLSX   = "xlsx"
+
+	// rows written between two flushes of the response
+	EXPORT_FLUSH_ROWS = 1000
+)
+
+type exportParam struct {
+	Format string `query:"format"`
+	Filter string `query:"filter"`
+	Sort   string `query:"sort"`
+	Search string `query:"search"`
+}
+
+// Export
+//
+// Stream every row matching the filter as a file download, the rows are read from a cursor
+func (d *DatabaseAPIImpl) Export(c echo.Context) error {
+	var (
+		tableName              = c.Param("table_name")
+		userId                 = c.Get("user_id")
+		params    *exportParam = new(exportParam)
+	)
+
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	condition, conditionArgs, err := ruleCondition(d.service.Rule, c, tableName, model.RULE_LIST)
+	if err != nil {
+		return ruleResponse(c, err)
+	}
+
+	if strings.Contains(params.Filter, "@user.id") {
+		if userId == nil {
+			return c.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error": "User ID is required",
+			})
+		}
+		params.Filter = strings.ReplaceAll(params.Filter, "@user.id", userFilterValue(c))
+	}
+
+	var writer exportWriter
+	switch params.Format {
+	case EXPORT_CSV, "":
+		writer = &csvExportWriter{c: c, table: tableName}
+	case EXPORT_NDJSON:
+		writer = &ndjsonExportWriter{c: c, table: tableName}
+	case EXPORT_XLSX:
+		writer = &xlsxExportWriter{c: c, table: tableName}
+	default:
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Invalid export format",
+			Error:   "unsupported export format " + params.Format,
+		})
+	}
+
+	err = d.service.DB.Stream(withActor(c, d.db), &service.FetchParams{
+		Table:         tableName,
+		Filter:        params.Filter,
+		Search:        params.Search,
+		Order:         params.Sort,
+		Condition:     condition,
+		ConditionArgs: conditionArgs,
+	}, writer)
+	if err == nil {
+		err = writer.Close()
+	}
+
+	if err != nil {
+		if c.Response().Committed {
+			// the download has started, the client gets a truncated file
+			return err
+		}
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Error exporting data",
+			Error:   err.Error(),
+		})
+	}
+
+	return nil
+}
+
+type exportWriter interface {
+	service.RowWriter
+	Close() error
+}
+
+// startExport
+//
+// Send the download headers, called once the query succeeded
+func startExport(c echo.Context, contentType string, filename string) {
+	c.Response().Header().Set(echo.HeaderContentType, contentType)
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Response().WriteHeader(http.StatusOK)
+}
+
+func exportFilename(table string, extension string) string {
+	return fmt.Sprintf("%s-%s.%s", table, time.Now().Format("2006-01-02_15-04-05"), extension)
+}
+
+func exportValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+type csvExportWriter struct {
+	c      echo.Context
+	table  string
+	writer *csv.Writer
+	rows   int
+	record []string
+}
+
+func (w *csvExportWriter) WriteHeader(columns []string) error {
+	startExport(w.c, "text/csv; charset=utf-8", exportFilename(w.table, EXPORT_CSV))
+	w.writer = csv.NewWriter(w.c.Response())
+	w.record = make([]string, len(columns))
+
+	return w.writer.Write(columns)
+}
+
+func (w *csvExportWriter) WriteRow(values []interface{}) error {
+	for i, value := range values {
+		w.record[i] = exportValue(value)
+	}
+
+	err := w.writer.Write(w.record)
+	if err != nil {
+		return err
+	}
+
+	w.rows++
+	if w.rows%EXPORT_FLUSH_ROWS == 0 {
+		w.writer.Flush()
+		w.c.Response().Flush()
+	}
+
+	return w.writer.Error()
+}
+
+func (w *csvExportWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+type ndjsonExportWriter struct {
+	c       echo.Context
+	table   string
+	encoder *json.Encoder
+	columns []string
+	rows    int
+}
+
+func (w *ndjsonExportWriter) WriteHeader(columns []string) error {
+	startExport(w.c, "application/x-ndjson", exportFilename(w.table, EXPORT_NDJSON))
+	w.encoder = json.NewEncoder(w.c.Response())
+	w.columns = columns
+
+	return nil
+}
+
+func (w *ndjsonExportWriter) WriteRow(values []interface{}) error {
+	row := make(map[string]interface{}, len(w.columns))
+	for i, column := range w.columns {
+		row[column] = values[i]
+	}
+
+	w.rows++
+	if w.rows%EXPORT_FLUSH_ROWS == 0 {
+		w.c.Response().Flush()
+	}
+
+	return w.encoder.Encode(row)
+}
+
+func (w *ndjsonExportWriter) Close() error {
+	return nil
+}
+
+type xlsxExportWriter struct {
+	c      echo.Context
+	table  string
+	writer *pkg_xlsx.Writer
+	rows   int
+}
+
+func (w *xlsxExportWriter) WriteHeader(columns []string) error {
+	startExport(w.c, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", exportFilename(w.table, EXPORT_XLSX))
+
+	// sheet names are limited to 31 characters
+	sheetName := w.table
+	if len(sheetName) > 31 {
+		sheetName = sheetName[:31]
+	}
+
+	var err error
+	w.writer, err = pkg_xlsx.NewWriter(w.c.Response(), sheetName)
+	if err != nil {
+		return err
+	}
+
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column
+	}
+
+	return w.writer.WriteRow(header)
+}
+
+func (w *xlsxExportWriter) WriteRow(values []interface{}) error {
+	w.rows++
+	if w.rows%EXPORT_FLUSH_ROWS == 0 {
+		w.c.Response().Flush()
+	}
+
+	return w.writer.WriteRow(values)
+}
+
+func (w *xlsxExportWriter) Close() error {
+	return w.writer.Close()
+}
@@ -17,7 +17,6 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/sarulabs/di"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 type FunctionAPI interface {
@@ -140,21 +139,11 @@ func (f FunctionAPIImpl) DeleteFunction(c echo.Context) error {
 
 func (f FunctionAPIImpl) RunFunction(c echo.Context) error {
 	var (
-		requestUID = c.Get("user_id")
-		funcName   = c.Param("func_name")
-		function   *model.FunctionStored
+		userId   = requestUserID(c)
+		funcName = c.Param("func_name")
+		function *model.FunctionStored
 	)
 
-	var userId int
-	var ok bool
-	if requestUID != nil {
-		userId, ok = requestUID.(int)
-		if !ok {
-			userId = 0
-		}
-		userId = int(userId)
-	}
-
 	err := f.db.Model(&model.FunctionStored{}).Where("name = ?", funcName).First(&function).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -181,32 +170,28 @@ func (f FunctionAPIImpl) RunFunction(c echo.Context) error {
 	}
 
 	savedData := map[string]interface{}{}
-	err = f.db.Transaction(func(tx *gorm.DB) error {
+	err = withActor(c, f.db).Transaction(func(tx *gorm.DB) error {
 		for _, fun := range functions {
 			switch fun.Action {
 			case "insert":
 				if data, ok := caller.Data[fun.Name].([]interface{}); ok {
-					bindedInput, err := BindMultipleInput(fun.Values, data, savedData, fmt.Sprintf("%d", userId))
+					bindedInput, err := BindMultipleInput(fun.Values, data, savedData, userId)
 					if err != nil {
 						return err
 					}
 
-					err = tx.Table(fun.Table).Create(bindedInput).Error
-					if err != nil {
-						return err
+					for _, input := range bindedInput {
+						err = f.service.DB.Insert(tx, fun.Table, input)
+						if err != nil {
+							return err
+						}
 					}
 				} else if data, ok := caller.Data[fun.Name].(map[string]interface{}); ok {
-					bindedInput, err := BindSingularInput(fun.Values, data, savedData, fmt.Sprintf("%d", userId))
+					bindedInput, err := BindSingularInput(fun.Values, data, savedData, userId)
 					if err != nil {
 						return err
 					}
-					err = tx.Table(fun.Table).Clauses(clause.Returning{
-						Columns: []clause.Column{
-							{
-								Name: "id",
-							},
-						},
-					}).Create(bindedInput).Error
+					err = f.service.DB.Insert(tx, fun.Table, bindedInput)
 					if err != nil {
 						return err
 					}
@@ -216,38 +201,24 @@ func (f FunctionAPIImpl) RunFunction(c echo.Context) error {
 
 			case "update":
 				if data, ok := caller.Data[fun.Name].([]interface{}); ok {
-					bindedInput, err := BindMultipleInput(fun.Values, data, savedData, fmt.Sprintf("%d", userId))
+					bindedInput, err := BindMultipleInput(fun.Values, data, savedData, userId)
 					if err != nil {
 						return err
 					}
 					for _, input := range bindedInput {
-						filter := map[string]interface{}{
-							"id = ?": input["id"],
-						}
-
-						table := tx.Table(fun.Table)
-						for k, v := range filter {
-							table = table.Where(k, v)
-						}
-						err = table.Updates(input).Error
+						err = f.service.DB.Update(tx, fun.Table, input)
 						if err != nil {
 							return err
 						}
 					}
 				} else if data, ok := caller.Data[fun.Name].(map[string]interface{}); ok {
-					filter := map[string]interface{}{
-						"id = ?": data["id"],
-					}
-
-					bindedInput, err := BindSingularInput(fun.Values, data, savedData, fmt.Sprintf("%d", userId))
+					bindedInput, err := BindSingularInput(fun.Values, data, savedData, userId)
 					if err != nil {
 						return err
 					}
-					table := tx.Table(fun.Table)
-					for k, v := range filter {
-						table = table.Where(k, v)
-					}
-					err = table.Updates(bindedInput).Error
+					bindedInput["id"] = data["id"]
+
+					err = f.service.DB.Update(tx, fun.Table, bindedInput)
 					if err != nil {
 						return err
 					}
@@ -262,21 +233,16 @@ func (f FunctionAPIImpl) RunFunction(c echo.Context) error {
 				if ft, ok := data["filter"].(string); ok {
 					filter = ft
 					if strings.Contains(filter, "@user.id") {
-						if userId == 0 {
+						if userId == "" {
 							return errors.New("user id not found")
 						}
-						filter = strings.ReplaceAll(ft, "@user.id", fmt.Sprintf("%d", userId))
+						filter = strings.ReplaceAll(ft, "@user.id", userFilterValue(c))
 					}
 				} else {
 					return errors.New("filter cant be empty when deleting")
 				}
 
-				query := `
-					DELETE FROM %s
-					WHERE %s
-				`
-
-				err := tx.Exec(fmt.Sprintf(query, fun.Table, filter)).Error
+				_, err := f.service.DB.DeleteByFilter(tx, fun.Table, filter)
 				if err != nil {
 					return err
 				}
@@ -292,21 +258,16 @@ func (f FunctionAPIImpl) RunFunction(c echo.Context) error {
 					filter = ft
 				}
 
-				query := `
-					SELECT %s
-					FROM %s
-				`
-				query = fmt.Sprintf(query, strings.Join(columns, ","), fun.Table)
-				if filter != "" {
-					query = query + fmt.Sprintf("WHERE %s", filter)
-				}
-
-				err := tx.Exec(fmt.Sprintf(query, fun.Table, filter)).Error
+				// read through the service so that the fields the user can't see are left out
+				result, err := f.service.DB.Fetch(tx, &service.FetchParams{
+					Table:   fun.Table,
+					Columns: columns,
+					Filter:  filter,
+				})
 				if err != nil {
 					return err
 				}
 
-				result := []map[string]interface{}{}
 				savedData[fun.Name] = result
 			}
 		}
@@ -314,6 +275,18 @@ func (f FunctionAPIImpl) RunFunction(c echo.Context) error {
 		return nil
 	})
 	if err != nil {
+		if errors.Is(err, service.ErrPreconditionFailed) {
+			return preconditionResponse(c, err)
+		}
+		if errors.Is(err, service.ErrFieldForbidden) {
+			return forbiddenFieldResponse(c, err)
+		}
+		if errors.Is(err, service.ErrInvalidFilter) {
+			return c.JSON(http.StatusBadRequest, map[string]interface{}{"error": err.Error()})
+		}
+		if violation, ok := f.service.Table.Violation(err); ok {
+			return violationResponse(c, violation)
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]interface{}{"error": err.Error()})
 	}
 
@@ -0,0 +1,727 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"funcbase/constants"
+	"funcbase/middleware"
+	"funcbase/model"
+	pkg_graphql "funcbase/pkg/graphql"
+	"funcbase/pkg/responses"
+	"funcbase/service"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/patrickmn/go-cache"
+	"github.com/sarulabs/di"
+	"gorm.io/gorm"
+)
+
+const GRAPHQL_SCHEMA_CACHE = "graphql_schema"
+
+var errGraphQLRestricted = errors.New("you don't have access to this data")
+
+type GraphQLAPI interface {
+	Query(c echo.Context) error
+}
+
+type GraphQLAPIImpl struct {
+	db      *gorm.DB
+	service *service.Service
+	cache   *cache.Cache
+}
+
+func NewGraphQLAPI(ioc di.Container) GraphQLAPI {
+	return &GraphQLAPIImpl{
+		db:      ioc.Get(constants.CONTAINER_DB).(*gorm.DB),
+		service: ioc.Get(constants.CONTAINER_SERVICE).(*service.Service),
+		cache:   ioc.Get(constants.CONTAINER_CACHE).(*cache.Cache),
+	}
+}
+
+func (api *API) GraphQLAPI() {
+	api.router.GET("/graphql", api.GraphQL.Query, middleware.ValidateAPIKey, middleware.RequireAuth(false))
+	api.router.POST("/graphql", api.GraphQL.Query, middleware.ValidateAPIKey, middleware.RequireAuth(false))
+}
+
+type graphqlReq struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphqlCaller
+//
+// Requester of the current operation, read by the resolvers to check the table access
+type graphqlCaller struct {
+	c      echo.Context
+	userId string
+	roles  interface{}
+}
+
+type graphqlCallerKey struct{}
+
+func callerFrom(ctx context.Context) *graphqlCaller {
+	return ctx.Value(graphqlCallerKey{}).(*graphqlCaller)
+}
+
+// Query
+//
+// Run a graphql operation, POST takes a json body and GET the query, operationName and
+// variables query params. Mutations are only accepted on POST
+func (g *GraphQLAPIImpl) Query(c echo.Context) error {
+	params := new(graphqlReq)
+
+	if c.Request().Method == http.MethodGet {
+		params.Query = c.QueryParam("query")
+		params.OperationName = c.QueryParam("operationName")
+		if variables := c.QueryParam("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &params.Variables); err != nil {
+				return c.JSON(http.StatusBadRequest, responses.APIResponse{
+					Message: "Invalid variables",
+					Error:   err.Error(),
+				})
+			}
+		}
+	} else if err := json.NewDecoder(c.Request().Body).Decode(params); err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "failed to decode JSON data",
+			Error:   err.Error(),
+		})
+	}
+
+	if params.Query == "" {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Query is required",
+			Error:   "query not found",
+		})
+	}
+
+	schema, err := g.schema()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+			Message: "Failed to build GraphQL schema",
+			Error:   err.Error(),
+		})
+	}
+
+	caller := &graphqlCaller{c: c, userId: requestUserID(c), roles: c.Get("roles")}
+
+	result := pkg_graphql.Do(pkg_graphql.Params{
+		Schema:        schema,
+		Query:         params.Query,
+		OperationName: params.OperationName,
+		Variables:     params.Variables,
+		Context:       context.WithValue(c.Request().Context(), graphqlCallerKey{}, caller),
+		ReadOnly:      c.Request().Method == http.MethodGet,
+	})
+
+	return c.JSON(http.StatusOK, result)
+}
+
+type graphqlSchema struct {
+	version int64
+	schema  *pkg_graphql.Schema
+}
+
+// schema
+//
+// Schema of the collections, built again once the sqlite schema version moves,
+// which happens on every table or view change
+func (g *GraphQLAPIImpl) schema() (*pkg_graphql.Schema, error) {
+	var version int64
+	err := g.db.Raw("PRAGMA schema_version").Row().Scan(&version)
+	if err != nil {
+		return nil, err
+	}
+
+	if storedCache, ok := g.cache.Get(GRAPHQL_SCHEMA_CACHE); ok {
+		if cached := storedCache.(*graphqlSchema); cached.version == version {
+			return cached.schema, nil
+		}
+	}
+
+	schema, err := g.buildSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	g.cache.Set(GRAPHQL_SCHEMA_CACHE, &graphqlSchema{version: version, schema: schema}, cache.NoExpiration)
+
+	return schema, nil
+}
+
+type graphqlTable struct {
+	name      string
+	info      model.Tables
+	columns   []map[string]interface{}
+	relations map[string]model.Relation
+	object    *pkg_graphql.Object
+}
+
+func (g *GraphQLAPIImpl) buildSchema() (*pkg_graphql.Schema, error) {
+	var names []string
+	err := g.db.Model(&model.Tables{}).
+		Where("system = ?", false).
+		Order("name").
+		Pluck("name", &names).Error
+	if err != nil {
+		return nil, err
+	}
+
+	tables := []*graphqlTable{}
+	objects := map[string]*pkg_graphql.Object{}
+	for _, name := range names {
+		if !pkg_graphql.ValidName(name) {
+			continue
+		}
+
+		info, err := g.service.Table.Info(name, service.TABLE_INFO_AUTH, service.TABLE_INFO_TYPE, service.TABLE_INFO_ID_TYPE)
+		if err != nil {
+			return nil, err
+		}
+
+		columns, err := g.service.Table.Columns(name, false, false)
+		if err != nil {
+			return nil, err
+		}
+
+		relations, err := g.service.Table.Relations(name)
+		if err != nil {
+			return nil, err
+		}
+
+		table := &graphqlTable{
+			name:      name,
+			info:      info,
+			columns:   columns,
+			relations: map[string]model.Relation{},
+			object:    &pkg_graphql.Object{Name: pascalCase(name), Description: "Row of " + name},
+		}
+		for _, relation := range relations {
+			table.relations[relation.Field] = relation
+		}
+
+		tables = append(tables, table)
+		objects[name] = table.object
+	}
+
+	query := &pkg_graphql.Object{Name: "Query"}
+	mutation := &pkg_graphql.Object{Name: "Mutation"}
+
+	for _, table := range tables {
+		idScalar := graphqlIDScalar(table.info.TextID())
+		insert := &pkg_graphql.InputObject{Name: table.object.Name + "Insert"}
+		update := &pkg_graphql.InputObject{Name: table.object.Name + "Update"}
+
+		for _, column := range table.columns {
+			name := fmt.Sprintf("%v", service.ColumnValue(column, "name"))
+			if !pkg_graphql.ValidName(name) || table.info.Auth && (name == "password" || name == "salt") {
+				continue
+			}
+
+			field := &pkg_graphql.Field{Name: name}
+			var input pkg_graphql.Type
+
+			relation, isRelation := table.relations[name]
+			if reference, ok := objects[relation.Reference]; isRelation && ok {
+				referenceID := graphqlIDScalar(service.ColumnValue(column, "text_id") == true)
+				if relation.Multiple {
+					field.Type = &pkg_graphql.NonNull{Of: &pkg_graphql.List{Of: &pkg_graphql.NonNull{Of: reference}}}
+					input = &pkg_graphql.List{Of: &pkg_graphql.NonNull{Of: referenceID}}
+				} else {
+					field.Type = reference
+					input = referenceID
+				}
+				field.Batch = g.relationResolver(relation)
+			} else {
+				field.Type = graphqlScalar(column)
+				input = field.Type
+			}
+
+			notNull := fmt.Sprintf("%v", service.ColumnValue(column, "notnull")) == "1"
+			if notNull && !relation.Multiple {
+				field.Type = &pkg_graphql.NonNull{Of: field.Type}
+			}
+			table.object.Fields = append(table.object.Fields, field)
+
+			switch name {
+			case "id", "created_at", "updated_at", "deleted_at":
+				continue
+			}
+
+			required := notNull && service.ColumnValue(column, "dflt_value") == nil
+			if required {
+				insert.Fields = append(insert.Fields, &pkg_graphql.InputValue{Name: name, Type: &pkg_graphql.NonNull{Of: input}})
+			} else {
+				insert.Fields = append(insert.Fields, &pkg_graphql.InputValue{Name: name, Type: input})
+			}
+			update.Fields = append(update.Fields, &pkg_graphql.InputValue{Name: name, Type: input})
+		}
+
+		page := &pkg_graphql.Object{
+			Name:        table.object.Name + "Page",
+			Description: "Page of " + table.name + " rows",
+			Fields: []*pkg_graphql.Field{
+				{Name: "data", Type: &pkg_graphql.NonNull{Of: &pkg_graphql.List{Of: &pkg_graphql.NonNull{Of: table.object}}}, Resolve: func(p pkg_graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*graphqlPage).rows, nil
+				}},
+				{Name: "page", Type: &pkg_graphql.NonNull{Of: pkg_graphql.Int}, Resolve: func(p pkg_graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*graphqlPage).page, nil
+				}},
+				{Name: "page_size", Type: &pkg_graphql.NonNull{Of: pkg_graphql.Int}, Resolve: func(p pkg_graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*graphqlPage).pageSize, nil
+				}},
+				{Name: "total_data", Type: &pkg_graphql.NonNull{Of: pkg_graphql.Int}, Resolve: g.countResolver},
+			},
+		}
+
+		query.Fields = append(query.Fields,
+			&pkg_graphql.Field{
+				Name:        table.name,
+				Description: "List the rows of " + table.name,
+				Type:        &pkg_graphql.NonNull{Of: page},
+				Args: []*pkg_graphql.InputValue{
+					{Name: "filter", Type: pkg_graphql.String, Description: "Filter expression, @user.id is replaced by the requesting user"},
+					{Name: "sort", Type: pkg_graphql.String, Description: "Order by clause, e.g. created_at desc"},
+					{Name: "search", Type: pkg_graphql.String, Description: "Full text search"},
+					{Name: "page", Type: pkg_graphql.Int, Default: int64(1)},
+					{Name: "page_size", Type: pkg_graphql.Int, Description: fmt.Sprintf("Rows per page, %d when left out and at most %d", constants.PAGE_DEFAULT_SIZE, constants.PAGE_MAX_SIZE)},
+				},
+				Resolve: g.listResolver(table.name),
+			},
+			&pkg_graphql.Field{
+				Name:        table.name + "_by_id",
+				Description: "Single row of " + table.name,
+				Type:        table.object,
+				Args:        []*pkg_graphql.InputValue{{Name: "id", Type: &pkg_graphql.NonNull{Of: idScalar}}},
+				Resolve:     g.viewResolver(table.name),
+			},
+		)
+
+		if table.info.IsView() || len(update.Fields) == 0 {
+			continue
+		}
+
+		if !table.info.Auth {
+			mutation.Fields = append(mutation.Fields, &pkg_graphql.Field{
+				Name:        "insert_" + table.name,
+				Description: "Insert a row in " + table.name,
+				Type:        table.object,
+				Args:        []*pkg_graphql.InputValue{{Name: "data", Type: &pkg_graphql.NonNull{Of: insert}}},
+				Resolve:     g.insertResolver(table.name),
+			})
+		}
+
+		mutation.Fields = append(mutation.Fields,
+			&pkg_graphql.Field{
+				Name:        "update_" + table.name,
+				Description: "Update a row of " + table.name + ", the fields left out are kept",
+				Type:        table.object,
+				Args: []*pkg_graphql.InputValue{
+					{Name: "id", Type: &pkg_graphql.NonNull{Of: idScalar}},
+					{Name: "data", Type: &pkg_graphql.NonNull{Of: update}},
+				},
+				Resolve: g.updateResolver(table.name),
+			},
+			&pkg_graphql.Field{
+				Name:        "delete_" + table.name,
+				Description: "Delete rows of " + table.name + ", returns the number of deleted rows",
+				Type:        &pkg_graphql.NonNull{Of: pkg_graphql.Int},
+				Args:        []*pkg_graphql.InputValue{{Name: "id", Type: &pkg_graphql.NonNull{Of: &pkg_graphql.List{Of: &pkg_graphql.NonNull{Of: idScalar}}}}},
+				Resolve:     g.deleteResolver(table.name),
+			},
+		)
+	}
+
+	if len(mutation.Fields) == 0 {
+		mutation = nil
+	}
+
+	return pkg_graphql.NewSchema(query, mutation)
+}
+
+// pascalCase
+//
+// Type name of a table, order_items becomes OrderItems
+func pascalCase(name string) string {
+	result := ""
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			result += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+
+	if result == "" || result[0] >= '0' && result[0] <= '9' {
+		result = "T" + result
+	}
+
+	return result
+}
+
+// graphqlIDScalar
+//
+// Integer ids keep the Int type, uuid, ulid and nanoid ids are strings
+func graphqlIDScalar(textID bool) pkg_graphql.Type {
+	if textID {
+		return pkg_graphql.String
+	}
+
+	return pkg_graphql.Int
+}
+
+func graphqlScalar(column map[string]interface{}) pkg_graphql.Type {
+	switch strings.ToUpper(fmt.Sprintf("%v", service.ColumnValue(column, "type"))) {
+	case "RELATION":
+		return graphqlIDScalar(service.ColumnValue(column, "text_id") == true)
+	case "INTEGER":
+		return pkg_graphql.Int
+	case "REAL":
+		return pkg_graphql.Float
+	case "TEXT", "DATETIME", "TIMESTAMP", "BLOB":
+		return pkg_graphql.String
+	case "BOOLEAN":
+		return pkg_graphql.Boolean
+	default:
+		return pkg_graphql.JSON
+	}
+}
+
+type graphqlPage struct {
+	db       *gorm.DB
+	params   *service.FetchParams
+	rows     []map[string]interface{}
+	page     int
+	pageSize int
+}
+
+// listResolver
+//
+// Rows of a collection matching the list rule of the table
+func (g *GraphQLAPIImpl) listResolver(tableName string) func(p pkg_graphql.ResolveParams) (interface{}, error) {
+	return func(p pkg_graphql.ResolveParams) (interface{}, error) {
+		caller := callerFrom(p.Context)
+
+		condition, conditionArgs, err := ruleCondition(g.service.Rule, caller.c, tableName, model.RULE_LIST)
+		if errors.Is(err, service.ErrRuleDenied) {
+			return nil, errGraphQLRestricted
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		filter, _ := p.Args["filter"].(string)
+		if strings.Contains(filter, "@user.id") {
+			if caller.userId == "" {
+				return nil, errors.New("user ID is required")
+			}
+			filter = strings.ReplaceAll(filter, "@user.id", userFilterValue(caller.c))
+		}
+
+		page := &graphqlPage{db: withActor(caller.c, g.db), page: 1, pageSize: constants.PAGE_DEFAULT_SIZE}
+		if value, ok := p.Args["page"].(int64); ok && value > 0 {
+			page.page = int(value)
+		}
+		if value, ok := p.Args["page_size"].(int64); ok && value > 0 {
+			page.pageSize = int(min(value, constants.PAGE_MAX_SIZE))
+		}
+
+		sort, _ := p.Args["sort"].(string)
+		search, _ := p.Args["search"].(string)
+		page.params = &service.FetchParams{
+			Table:         tableName,
+			Filter:        filter,
+			Search:        search,
+			Order:         sort,
+			Limit:         page.pageSize,
+			Offset:        (page.page - 1) * page.pageSize,
+			Condition:     condition,
+			ConditionArgs: conditionArgs,
+		}
+
+		rows, err := g.service.DB.Fetch(page.db, page.params)
+		if err != nil {
+			return nil, err
+		}
+		page.rows = rows
+
+		return page, nil
+	}
+}
+
+// countResolver
+//
+// Total of the rows matching the list filter, only counted when selected
+func (g *GraphQLAPIImpl) countResolver(p pkg_graphql.ResolveParams) (interface{}, error) {
+	page := p.Source.(*graphqlPage)
+
+	return g.service.DB.Count(page.db, &service.FetchParams{
+		Table:         page.params.Table,
+		Filter:        page.params.Filter,
+		Search:        page.params.Search,
+		Condition:     page.params.Condition,
+		ConditionArgs: page.params.ConditionArgs,
+	})
+}
+
+// viewResolver
+//
+// Single row with the view rule of the table, rows the user can't view are an error
+func (g *GraphQLAPIImpl) viewResolver(tableName string) func(p pkg_graphql.ResolveParams) (interface{}, error) {
+	return func(p pkg_graphql.ResolveParams) (interface{}, error) {
+		caller := callerFrom(p.Context)
+
+		row, err := g.fetchRow(withActor(caller.c, g.db), tableName, p.Args["id"])
+		if err != nil || row == nil {
+			return nil, err
+		}
+
+		allowed, err := ruleMatch(g.service.Rule, caller.c, g.db, tableName, model.RULE_VIEW, row)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, errGraphQLRestricted
+		}
+
+		return row, nil
+	}
+}
+
+func (g *GraphQLAPIImpl) fetchRow(db *gorm.DB, tableName string, id interface{}) (map[string]interface{}, error) {
+	rows, err := g.service.DB.Fetch(db, &service.FetchParams{
+		Table: tableName,
+		IDs:   []interface{}{id},
+		Limit: 1,
+	})
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	return rows[0], nil
+}
+
+// relationResolver
+//
+// Referenced rows of every source of a level with one query, rows the user can't view
+// are left out like on expand
+func (g *GraphQLAPIImpl) relationResolver(relation model.Relation) func(p pkg_graphql.BatchParams) ([]interface{}, error) {
+	return func(p pkg_graphql.BatchParams) ([]interface{}, error) {
+		caller := callerFrom(p.Context)
+
+		ids := []interface{}{}
+		seen := map[string]bool{}
+		for _, source := range p.Sources {
+			for _, id := range linkedIDs(source.(map[string]interface{})[relation.Field]) {
+				key := fmt.Sprintf("%v", id)
+				if !seen[key] {
+					seen[key] = true
+					ids = append(ids, id)
+				}
+			}
+		}
+
+		// the view rule is checked by the query reading the rows
+		condition, args, err := ruleCondition(g.service.Rule, caller.c, relation.Reference, model.RULE_VIEW)
+		if errors.Is(err, service.ErrRuleDenied) {
+			ids = nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		rowByID := map[string]map[string]interface{}{}
+		if len(ids) > 0 {
+			rows, err := g.service.DB.Fetch(withActor(caller.c, g.db), &service.FetchParams{
+				Table:         relation.Reference,
+				IDs:           ids,
+				Condition:     condition,
+				ConditionArgs: args,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			for _, row := range rows {
+				rowByID[idString(row["id"])] = row
+			}
+		}
+
+		values := make([]interface{}, len(p.Sources))
+		for i, source := range p.Sources {
+			linked := linkedIDs(source.(map[string]interface{})[relation.Field])
+
+			if !relation.Multiple {
+				if len(linked) > 0 {
+					if row, ok := rowByID[idString(linked[0])]; ok {
+						values[i] = row
+					}
+				}
+				continue
+			}
+
+			rows := []interface{}{}
+			for _, id := range linked {
+				if row, ok := rowByID[idString(id)]; ok {
+					rows = append(rows, row)
+				}
+			}
+			values[i] = rows
+		}
+
+		return values, nil
+	}
+}
+
+func linkedIDs(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
+
+// graphqlData
+//
+// Input object of a mutation as row data, @user.id is replaced by the requesting user
+func graphqlData(caller *graphqlCaller, input interface{}) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	for k, v := range input.(map[string]interface{}) {
+		if v == "@user.id" {
+			if caller.userId == "" {
+				return nil, errors.New("user not authorized")
+			}
+			v = caller.c.Get("user_id")
+		}
+		data[k] = v
+	}
+
+	return data, nil
+}
+
+// graphqlError
+//
+// Constraint violations are reported with their message
+func (g *GraphQLAPIImpl) graphqlError(err error) error {
+	if violation, ok := g.service.Table.Violation(err); ok {
+		return violation
+	}
+
+	return err
+}
+
+func (g *GraphQLAPIImpl) insertResolver(tableName string) func(p pkg_graphql.ResolveParams) (interface{}, error) {
+	return func(p pkg_graphql.ResolveParams) (interface{}, error) {
+		caller := callerFrom(p.Context)
+
+		data, err := graphqlData(caller, p.Args["data"])
+		if err != nil {
+			return nil, err
+		}
+
+		err = graphqlAllowed(ruleMatch(g.service.Rule, caller.c, g.db, tableName, model.RULE_CREATE, data))
+		if err != nil {
+			return nil, err
+		}
+
+		err = g.service.DB.Insert(withActor(caller.c, g.db), tableName, data)
+		if err != nil {
+			return nil, g.graphqlError(err)
+		}
+
+		return g.fetchRow(withActor(caller.c, g.db), tableName, data["id"])
+	}
+}
+
+// graphqlAllowed
+//
+// Error of an access rule check, a denied request is restricted
+func graphqlAllowed(allowed bool, err error) error {
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return errGraphQLRestricted
+	}
+
+	return nil
+}
+
+func (g *GraphQLAPIImpl) updateResolver(tableName string) func(p pkg_graphql.ResolveParams) (interface{}, error) {
+	return func(p pkg_graphql.ResolveParams) (interface{}, error) {
+		caller := callerFrom(p.Context)
+		id := p.Args["id"]
+
+		err := graphqlAllowed(ruleAllowed(g.service.Rule, caller.c, g.db, tableName, model.RULE_UPDATE, []interface{}{id}))
+		if err != nil {
+			return nil, err
+		}
+
+		existing, err := g.fetchRow(withActor(caller.c, g.db), tableName, id)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			return nil, errors.New("data not found")
+		}
+
+		data, err := graphqlData(caller, p.Args["data"])
+		if err != nil {
+			return nil, err
+		}
+		data["id"] = id
+		data["updated_at"] = time.Now()
+
+		err = g.service.DB.Update(withActor(caller.c, g.db), tableName, data)
+		if err != nil {
+			return nil, g.graphqlError(err)
+		}
+
+		return g.fetchRow(withActor(caller.c, g.db), tableName, id)
+	}
+}
+
+func (g *GraphQLAPIImpl) deleteResolver(tableName string) func(p pkg_graphql.ResolveParams) (interface{}, error) {
+	return func(p pkg_graphql.ResolveParams) (interface{}, error) {
+		caller := callerFrom(p.Context)
+
+		requested := p.Args["id"].([]interface{})
+		if len(requested) == 0 {
+			return 0, nil
+		}
+
+		rows, err := g.service.DB.Fetch(g.db, &service.FetchParams{
+			Table: tableName,
+			IDs:   requested,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		err = graphqlAllowed(ruleAllowed(g.service.Rule, caller.c, g.db, tableName, model.RULE_DELETE, requested))
+		if err != nil {
+			return nil, err
+		}
+
+		ids := []string{}
+		for _, row := range rows {
+			ids = append(ids, idString(row["id"]))
+		}
+		if len(ids) == 0 {
+			return 0, nil
+		}
+
+		err = g.service.DB.BatchDelete(withActor(caller.c, g.db), tableName, ids)
+		if err != nil {
+			return nil, g.graphqlError(err)
+		}
+
+		return len(ids), nil
+	}
+}
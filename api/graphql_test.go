@@ -0,0 +1,227 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"funcbase/constants"
+	"funcbase/model"
+	"funcbase/service"
+	"net/http"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// graphql
+//
+// Result of a query sent by the given user
+func (a *testAPI) graphql(t *testing.T, role string, userID interface{}, query string) map[string]interface{} {
+	t.Helper()
+
+	c, recorder := a.context(http.MethodPost, map[string]interface{}{"query": query}, role, userID)
+	err := a.GraphQL.Query(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := map[string]interface{}{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestGraphQLHiddenFields(t *testing.T) {
+	a := newTestAPI(t)
+	a.createMembers(t)
+
+	query := func(role string, body string) map[string]interface{} {
+		t.Helper()
+		return a.graphql(t, role, 2, body)
+	}
+
+	for _, role := range []string{"", "USER", "ADMIN"} {
+		result := query(role, "{ members { data { id bio balance } } }")
+		if result["errors"] != nil {
+			t.Fatalf("role %q: %v", role, result["errors"])
+		}
+
+		data := result["data"].(map[string]interface{})["members"].(map[string]interface{})["data"].([]interface{})
+		if len(data) != 2 {
+			t.Fatalf("role %q: got %d rows, want 2", role, len(data))
+		}
+		for _, row := range data {
+			balance := row.(map[string]interface{})["balance"]
+			if role == "ADMIN" && balance == nil {
+				t.Errorf("balance left out for the admin")
+			}
+			if role != "ADMIN" && balance != nil {
+				t.Errorf("role %q: balance read %v", role, balance)
+			}
+		}
+	}
+
+	for _, filter := range []string{
+		"balance > 1000",
+		"(SELECT balance FROM members WHERE id = 1) > 1000",
+	} {
+		body, _ := json.Marshal(filter)
+		result := query("USER", "{ members(filter: "+string(body)+") { data { id } } }")
+		if result["errors"] == nil {
+			t.Errorf("filter %q accepted: %v", filter, result["data"])
+		}
+	}
+}
+
+// createNotes
+//
+// Notes owned by the members, each member only changes their own notes and views their own
+// profile
+func (a *testAPI) createNotes(t *testing.T, count int) {
+	t.Helper()
+
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		return a.service.Table.Create(tx, model.CreateTable{
+			Name: "notes",
+			Fields: []model.Field{
+				{Type: "text", Name: "body"},
+				{Type: "relation", Name: "owner", Reference: "members", Nullable: true},
+			},
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	everyone := ""
+	owner := "@request.auth.id = owner"
+	err = a.service.Table.SetRules(a.db, "notes", model.Rules{List: &everyone, View: &everyone, Create: &owner, Update: &owner, Delete: &owner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := "id = @request.auth.id"
+	err = a.service.Table.SetRules(a.db, "members", model.Rules{List: &everyone, View: &self})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := a.db.WithContext(service.WithActor(a.db.Statement.Context, service.Actor{ID: "1", Role: "ADMIN"}))
+	for i := 1; i <= count; i++ {
+		err = a.service.DB.Insert(admin, "notes", map[string]interface{}{"body": fmt.Sprintf("note %d", i), "owner": i%2 + 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func graphqlField(result map[string]interface{}, name string) interface{} {
+	data, _ := result["data"].(map[string]interface{})
+	return data[name]
+}
+
+func graphqlRestricted(result map[string]interface{}) bool {
+	errors, _ := result["errors"].([]interface{})
+	return len(errors) == 1 && errors[0].(map[string]interface{})["message"] == errGraphQLRestricted.Error()
+}
+
+func TestGraphQLPageSize(t *testing.T) {
+	a := newTestAPI(t)
+	a.createMembers(t)
+	a.createNotes(t, constants.PAGE_DEFAULT_SIZE+5)
+
+	tests := []struct {
+		args     string
+		rows     int
+		pageSize int
+	}{
+		{"", constants.PAGE_DEFAULT_SIZE, constants.PAGE_DEFAULT_SIZE},
+		{"(page_size: 3, page: 2)", 3, 3},
+		{"(page: 2)", 5, constants.PAGE_DEFAULT_SIZE},
+		{fmt.Sprintf("(page_size: %d)", constants.PAGE_MAX_SIZE+1), constants.PAGE_DEFAULT_SIZE + 5, constants.PAGE_MAX_SIZE},
+	}
+
+	for _, test := range tests {
+		result := a.graphql(t, "USER", 2, "{ notes"+test.args+" { page_size total_data data { id } } }")
+		if result["errors"] != nil {
+			t.Fatalf("%q: %v", test.args, result["errors"])
+		}
+
+		page := graphqlField(result, "notes").(map[string]interface{})
+		if rows := len(page["data"].([]interface{})); rows != test.rows {
+			t.Errorf("%q: got %d rows, want %d", test.args, rows, test.rows)
+		}
+		if page["page_size"] != float64(test.pageSize) || page["total_data"] != float64(constants.PAGE_DEFAULT_SIZE+5) {
+			t.Errorf("%q: page size %v of %v rows", test.args, page["page_size"], page["total_data"])
+		}
+	}
+}
+
+func TestGraphQLRelationRules(t *testing.T) {
+	a := newTestAPI(t)
+	a.createMembers(t)
+	a.createNotes(t, 4)
+
+	result := a.graphql(t, "USER", 2, "{ notes { data { id owner { id bio } } } }")
+	if result["errors"] != nil {
+		t.Fatal(result["errors"])
+	}
+
+	for _, row := range graphqlField(result, "notes").(map[string]interface{})["data"].([]interface{}) {
+		note := row.(map[string]interface{})
+		owner, _ := note["owner"].(map[string]interface{})
+		// odd notes are owned by the second member, the only profile the user may view
+		odd := int(note["id"].(float64))%2 == 1
+		if (owner != nil) != odd || owner != nil && owner["bio"] != "second" {
+			t.Errorf("owner of note %v: %v", note["id"], owner)
+		}
+	}
+
+	result = a.graphql(t, "USER", 2, `{ members_by_id(id: 1) { bio } }`)
+	if !graphqlRestricted(result) {
+		t.Errorf("profile of another member read: %v, errors %v", result["data"], result["errors"])
+	}
+}
+
+func TestGraphQLMutationRules(t *testing.T) {
+	a := newTestAPI(t)
+	a.createMembers(t)
+	a.createNotes(t, 2)
+
+	tests := []struct {
+		name     string
+		role     string
+		mutation string
+		allowed  bool
+	}{
+		{"insert for another member", "USER", `mutation { insert_notes(data: {body: "x", owner: 1}) { id } }`, false},
+		{"insert for themselves", "USER", `mutation { insert_notes(data: {body: "x", owner: 2}) { id } }`, true},
+		{"update of another member", "USER", `mutation { update_notes(id: 2, data: {body: "x"}) { id } }`, false},
+		{"update of their own", "USER", `mutation { update_notes(id: 1, data: {body: "x"}) { body } }`, true},
+		{"delete of another member", "USER", `mutation { delete_notes(id: [1, 2]) }`, false},
+		{"delete by a guest", "", `mutation { delete_notes(id: [1]) }`, false},
+		{"delete by an admin", "ADMIN", `mutation { delete_notes(id: [2]) }`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := a.graphql(t, test.role, 2, test.mutation)
+			if test.allowed && result["errors"] != nil {
+				t.Errorf("refused: %v", result["errors"])
+			}
+			if !test.allowed && !graphqlRestricted(result) {
+				t.Errorf("errors %v, want the request restricted", result["errors"])
+			}
+		})
+	}
+
+	var bodies []string
+	err := a.db.Table("notes").Order("id").Pluck("body", &bodies).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 || bodies[0] != "x" || bodies[1] != "x" {
+		t.Errorf("notes left %v", bodies)
+	}
+}
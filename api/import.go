@@ -0,0 +1,273 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"funcbase/model"
+	"funcbase/pkg/responses"
+	"funcbase/service"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	IMPORT_CSV    = "csv"
+	IMPORT_JSON   = "json"
+	IMPORT_NDJSON = "ndjson"
+)
+
+// Import
+//
+// Bulk write rows from a csv, json array or ndjson upload. The file is sent as the "file" field of a
+// multipart form, or as the request body with the matching content type
+func (d *DatabaseAPIImpl) Import(c echo.Context) error {
+	var (
+		tableName = c.Param("table_name")
+		userId    = c.Get("user_id")
+		roles     = c.Get("roles")
+	)
+
+	tableInfo, err := d.service.Table.Info(tableName, service.TABLE_INFO_AUTH, service.TABLE_INFO_TYPE)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	if tableInfo.IsView() {
+		return c.JSON(http.StatusMethodNotAllowed, responses.APIResponse{
+			Message: "View collection is read only",
+			Error:   "Table is read only",
+		})
+	}
+
+	if tableInfo.Auth {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": "Insertion to user type table can only be done through auth API",
+		})
+	}
+
+	params := service.ImportParams{
+		Table:  tableName,
+		Mode:   c.FormValue("mode"),
+		Coerce: c.FormValue("coerce") == "true",
+	}
+
+	if key := c.FormValue("key"); key != "" {
+		for _, column := range strings.Split(key, ",") {
+			params.Key = append(params.Key, strings.TrimSpace(column))
+		}
+	}
+
+	if mapping := c.FormValue("mapping"); mapping != "" {
+		err := json.Unmarshal([]byte(mapping), &params.Mapping)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, responses.APIResponse{
+				Message: "Invalid column mapping",
+				Error:   err.Error(),
+			})
+		}
+	}
+
+	if roles != "ADMIN" {
+		// replacing the whole table is reserved to admins
+		if params.Mode == service.IMPORT_REPLACE {
+			return ruleResponse(c, nil)
+		}
+
+		_, _, err = ruleCondition(d.service.Rule, c, tableName, model.RULE_CREATE)
+		if err != nil {
+			return ruleResponse(c, err)
+		}
+		params.Allow = func(row map[string]interface{}) error {
+			allowed, err := ruleMatch(d.service.Rule, c, d.db, tableName, model.RULE_CREATE, row)
+			if err == nil && !allowed {
+				err = service.ErrRuleDenied
+			}
+			return err
+		}
+
+		if params.Mode == service.IMPORT_UPSERT {
+			params.UpdateCondition, params.UpdateConditionArgs, err = ruleCondition(d.service.Rule, c, tableName, model.RULE_UPDATE)
+			if err != nil {
+				return ruleResponse(c, err)
+			}
+		}
+	}
+
+	reader, format, err := importSource(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to read import file",
+			Error:   err.Error(),
+		})
+	}
+	defer reader.Close()
+
+	if value := c.FormValue("format"); value != "" {
+		format = value
+	}
+
+	switch format {
+	case IMPORT_CSV:
+		params.Rows, err = parseCSV(reader)
+	case IMPORT_JSON:
+		err = json.NewDecoder(reader).Decode(&params.Rows)
+	case IMPORT_NDJSON:
+		params.Rows, err = parseNDJSON(reader)
+	default:
+		err = fmt.Errorf("unsupported import format %s", format)
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to parse import file",
+			Error:   err.Error(),
+		})
+	}
+
+	for _, row := range params.Rows {
+		for k, v := range row {
+			if v == "@user.id" {
+				if userId == nil {
+					return c.JSON(http.StatusBadRequest, map[string]interface{}{
+						"error": "User not authorized",
+					})
+				}
+				row[k] = userId
+			}
+		}
+	}
+
+	result, err := d.service.DB.Import(withActor(c, d.db), params)
+	if err != nil {
+		if errors.Is(err, service.ErrRuleDenied) {
+			return ruleResponse(c, err)
+		}
+		if errors.Is(err, service.ErrImportRejected) {
+			return c.JSON(http.StatusUnprocessableEntity, responses.APIResponse{
+				Data:    result,
+				Message: "failed to import data",
+				Error:   err.Error(),
+			})
+		}
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "failed to import data",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Data:    result,
+		Message: "success",
+	})
+}
+
+// importSource
+//
+// Uploaded file or request body, the format is guessed from the file extension or the content type
+func importSource(c echo.Context) (io.ReadCloser, string, error) {
+	contentType := c.Request().Header.Get("Content-Type")
+
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return nil, "", err
+		}
+
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, "", err
+		}
+
+		format := strings.TrimPrefix(strings.ToLower(filepath.Ext(fileHeader.Filename)), ".")
+		if format == "jsonl" {
+			format = IMPORT_NDJSON
+		}
+
+		return file, format, nil
+	}
+
+	format := ""
+	switch {
+	case strings.HasPrefix(contentType, "text/csv"):
+		format = IMPORT_CSV
+	case strings.HasPrefix(contentType, "application/x-ndjson"), strings.HasPrefix(contentType, "application/jsonl"):
+		format = IMPORT_NDJSON
+	case strings.HasPrefix(contentType, "application/json"):
+		format = IMPORT_JSON
+	}
+
+	return c.Request().Body, format, nil
+}
+
+// parseCSV
+//
+// The first record holds the column names, empty cells are imported as null
+func parseCSV(reader io.Reader) ([]map[string]interface{}, error) {
+	csvReader := csv.NewReader(bufio.NewReader(reader))
+	csvReader.TrimLeadingSpace = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, err
+	}
+	// excel adds a byte order mark in front of the file
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	rows := []map[string]interface{}{}
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := map[string]interface{}{}
+		for i, value := range record {
+			if i >= len(header) {
+				break
+			}
+			if value == "" {
+				row[header[i]] = nil
+				continue
+			}
+			row[header[i]] = value
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func parseNDJSON(reader io.Reader) ([]map[string]interface{}, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20) // 16 MB per line max
+
+	rows := []map[string]interface{}{}
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		row := map[string]interface{}{}
+		err := json.Unmarshal(scanner.Bytes(), &row)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
@@ -0,0 +1,310 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"funcbase/constants"
+	"funcbase/middleware"
+	"funcbase/model"
+	"funcbase/pkg/responses"
+	"funcbase/service"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sarulabs/di"
+	"gorm.io/gorm"
+)
+
+type RealtimeAPI interface {
+	Subscribe(c echo.Context) error
+}
+
+type RealtimeAPIImpl struct {
+	db      *gorm.DB
+	service *service.Service
+}
+
+func NewRealtimeAPI(ioc di.Container) RealtimeAPI {
+	return &RealtimeAPIImpl{
+		db:      ioc.Get(constants.CONTAINER_DB).(*gorm.DB),
+		service: ioc.Get(constants.CONTAINER_SERVICE).(*service.Service),
+	}
+}
+
+func (api *API) RealtimeAPI() {
+	api.router.GET("/realtime", api.Realtime.Subscribe, middleware.ValidateAPIKey, middleware.RequireAuth(false))
+}
+
+type realtimeParam struct {
+	Table string `query:"table"`
+	// a single record, every record of the table otherwise
+	ID     string `query:"id"`
+	Filter string `query:"filter"`
+	// resume after this event, the Last-Event-ID header sent by EventSource on reconnect is
+	// used when missing. A reset event is sent instead when the events since are no longer kept
+	LastEventID string `query:"last_event_id"`
+}
+
+type realtimeEvent struct {
+	ID        uint                   `json:"id"`
+	Action    string                 `json:"action"`
+	Table     string                 `json:"table"`
+	Record    map[string]interface{} `json:"record"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// Subscribe
+//
+// Stream the create, update and delete events of a table, a single record or the records
+// matching a filter as server-sent events. Every event is checked against the view rule of
+// the record, or the list rule of the table, for the requesting user. A client resuming after
+// an event that can no longer be followed is sent a reset event, upon which it reloads the records
+func (r *RealtimeAPIImpl) Subscribe(c echo.Context) error {
+	var (
+		params *realtimeParam = new(realtimeParam)
+		userId                = requestUserID(c)
+	)
+
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	if params.Table == "" {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "table is required",
+			Error:   "table not found",
+		})
+	}
+
+	tableInfo, err := r.service.Table.Info(params.Table, service.TABLE_INFO_TYPE, service.TABLE_INFO_SYSTEM)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "failed to get table info",
+			Error:   err.Error(),
+		})
+	}
+	if tableInfo.IsView() || tableInfo.System {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Only the changes of a collection are sent",
+			Error:   "invalid table",
+		})
+	}
+
+	// a rule reserved to admins denies every event
+	_, _, err = ruleCondition(r.service.Rule, c, params.Table, realtimeRule(params.ID))
+	if err != nil {
+		return ruleResponse(c, err)
+	}
+
+	if strings.Contains(params.Filter, "@user.id") {
+		if userId == "" {
+			return c.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error": "User ID is required",
+			})
+		}
+		params.Filter = strings.ReplaceAll(params.Filter, "@user.id", userFilterValue(c))
+	}
+	if params.Filter != "" {
+		_, err = r.service.DB.MatchEvent(withActor(c, r.db), model.Event{Table: params.Table, Data: "{}"}, params.Filter)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, responses.APIResponse{
+				Message: "Invalid filter",
+				Error:   err.Error(),
+			})
+		}
+	}
+
+	lastEventID := params.LastEventID
+	if lastEventID == "" {
+		lastEventID = c.Request().Header.Get("Last-Event-ID")
+	}
+	var lastSent uint64
+	if lastEventID != "" {
+		lastSent, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, responses.APIResponse{
+				Message: "Invalid last event id",
+				Error:   err.Error(),
+			})
+		}
+	}
+
+	// subscribe before the missed events are read, so that none is lost in between
+	subscription := r.service.Realtime.Subscribe()
+	defer r.service.Realtime.Unsubscribe(subscription)
+
+	var reset bool
+	if lastEventID != "" {
+		latest, err := r.service.Realtime.Resume(r.db, uint(lastSent))
+		if err != nil && !errors.Is(err, service.ErrEventsExpired) {
+			return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+				Message: "failed to resume",
+				Error:   err.Error(),
+			})
+		}
+		if err != nil {
+			// the client reloads the records, then follows the events after the latest one
+			reset = true
+			lastSent = uint64(latest)
+		}
+	}
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.Header().Set("Connection", "keep-alive")
+	response.Header().Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+	fmt.Fprint(response, ": connected\n\n")
+	if reset {
+		fmt.Fprintf(response, "id: %d\nevent: reset\ndata: {\"id\":%d}\n\n", lastSent, lastSent)
+	}
+	response.Flush()
+
+	send := func(event model.Event) error {
+		if uint64(event.ID) <= lastSent {
+			return nil
+		}
+		lastSent = uint64(event.ID)
+
+		if !r.deliverable(c, params, event) {
+			return nil
+		}
+
+		record := map[string]interface{}{}
+		json.Unmarshal([]byte(event.Data), &record)
+		err := r.readable(c, event.Table, record)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(realtimeEvent{
+			ID:        event.ID,
+			Action:    event.Action,
+			Table:     event.Table,
+			Record:    record,
+			CreatedAt: event.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(response, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Action, data)
+		if err != nil {
+			return err
+		}
+		response.Flush()
+
+		return nil
+	}
+
+	if lastEventID != "" && !reset {
+		for {
+			events, err := r.service.Realtime.Events(r.db, uint(lastSent), constants.REALTIME_BUFFER)
+			if err != nil {
+				return err
+			}
+
+			for _, event := range events {
+				if err := send(event); err != nil {
+					return err
+				}
+			}
+
+			if len(events) < constants.REALTIME_BUFFER {
+				break
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(constants.REALTIME_HEARTBEAT * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(response, ": heartbeat\n\n"); err != nil {
+				return nil
+			}
+			response.Flush()
+		case event, ok := <-subscription.Events:
+			if !ok {
+				// too slow to keep up, the client reconnects and resumes from its last event
+				return nil
+			}
+			if err := send(event); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// deliverable
+//
+// Check an event against the subscription and the access rule of the requesting user. The rule
+// is read again on each event, so that a change of the rules applies to open subscriptions
+func (r *RealtimeAPIImpl) deliverable(c echo.Context, params *realtimeParam, event model.Event) bool {
+	if event.Table != params.Table {
+		return false
+	}
+	if params.ID != "" && event.RecordID != params.ID {
+		return false
+	}
+
+	row := map[string]interface{}{}
+	json.Unmarshal([]byte(event.Data), &row)
+	allowed, err := ruleMatch(r.service.Rule, c, r.db, params.Table, realtimeRule(params.ID), row)
+	if err != nil || !allowed {
+		return false
+	}
+
+	if params.Filter != "" {
+		matched, err := r.service.DB.MatchEvent(withActor(c, r.db), event, params.Filter)
+		if err != nil || !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// readable
+//
+// Leave the hidden fields out of the record unless the requesting user is an admin
+func (r *RealtimeAPIImpl) readable(c echo.Context, tableName string, record map[string]interface{}) error {
+	if c.Get("roles") == "ADMIN" {
+		return nil
+	}
+
+	permissions, err := r.service.Table.Permissions(tableName)
+	if err != nil {
+		return err
+	}
+
+	for name, permission := range permissions {
+		if permission == model.FIELD_HIDDEN {
+			delete(record, name)
+		}
+	}
+
+	return nil
+}
+
+// realtimeRule
+//
+// View rule for a single record, list rule for the table
+func realtimeRule(id string) string {
+	if id != "" {
+		return model.RULE_VIEW
+	}
+
+	return model.RULE_LIST
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRealtimeHiddenFields(t *testing.T) {
+	a := newTestAPI(t)
+	a.createMembers(t)
+	realtime := a.Realtime.(*RealtimeAPIImpl)
+
+	tests := []struct {
+		role    string
+		balance bool
+	}{
+		{"", false},
+		{"USER", false},
+		{"ADMIN", true},
+	}
+
+	for _, test := range tests {
+		c, _ := a.context(http.MethodGet, nil, test.role, 1)
+		record := map[string]interface{}{"id": 1, "bio": "first", "balance": 5000}
+
+		err := realtime.readable(c, "members", record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := record["balance"]; ok != test.balance {
+			t.Errorf("role %q: balance sent %v, want %v", test.role, ok, test.balance)
+		}
+		if record["bio"] != "first" {
+			t.Errorf("role %q: bio left out", test.role)
+		}
+	}
+}
+
+func TestRealtimeFilter(t *testing.T) {
+	a := newTestAPI(t)
+	a.createMembers(t)
+
+	for _, filter := range []string{
+		"balance > 1000",
+		"(SELECT balance FROM members WHERE id = 1) > 1000",
+		"(SELECT substr(password, 1, 1) FROM members WHERE id = 1) = 'x'",
+	} {
+		c, recorder := a.context(http.MethodGet, nil, "USER", 2)
+		c.Request().URL.RawQuery = url.Values{"table": {"members"}, "filter": {filter}}.Encode()
+
+		// an accepted filter would keep the stream open until the client leaves
+		ctx, cancel := context.WithTimeout(c.Request().Context(), time.Second)
+		defer cancel()
+		c.SetRequest(c.Request().WithContext(ctx))
+
+		err := a.Realtime.Subscribe(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("filter %q: status %d, want %d", filter, recorder.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestRealtimeReset(t *testing.T) {
+	a := newTestAPI(t)
+	a.createMembers(t)
+
+	tests := []struct {
+		lastEventID string
+		reset       bool
+	}{
+		{"1", false},
+		{"99", true},
+	}
+
+	for _, test := range tests {
+		c, recorder := a.context(http.MethodGet, nil, "ADMIN", 1)
+		c.Request().URL.RawQuery = url.Values{"table": {"members"}, "last_event_id": {test.lastEventID}}.Encode()
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), 500*time.Millisecond)
+		defer cancel()
+		c.SetRequest(c.Request().WithContext(ctx))
+
+		err := a.Realtime.Subscribe(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body := recorder.Body.String()
+		if strings.Contains(body, "event: reset\n") != test.reset {
+			t.Errorf("last event %s: reset sent %v, want %v\n%s", test.lastEventID, !test.reset, test.reset, body)
+		}
+		// the second member is replayed unless the client was reset
+		if strings.Contains(body, "id: 2\nevent: create\n") == test.reset {
+			t.Errorf("last event %s: missed event sent %v\n%s", test.lastEventID, test.reset, body)
+		}
+	}
+}
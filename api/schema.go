@@ -0,0 +1,142 @@
+package api
+
+import (
+	"fmt"
+	"funcbase/constants"
+	"funcbase/middleware"
+	"funcbase/model"
+	"funcbase/pkg/responses"
+	"funcbase/service"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sarulabs/di"
+)
+
+type SchemaAPI interface {
+	Export(c echo.Context) error
+	Import(c echo.Context) error
+	Codegen(c echo.Context) error
+	OpenAPI(c echo.Context) error
+}
+
+type SchemaAPIImpl struct {
+	service *service.Service
+}
+
+func NewSchemaAPI(ioc di.Container) SchemaAPI {
+	return &SchemaAPIImpl{
+		service: ioc.Get(constants.CONTAINER_SERVICE).(*service.Service),
+	}
+}
+
+func (api *API) SchemaAPI() {
+	schemaRouter := api.router.Group("/main/schema", middleware.ValidateMainAPIKey, middleware.RequireAuth(true))
+
+	schemaRouter.GET("/export", api.Schema.Export)
+	schemaRouter.POST("/import", api.Schema.Import)
+	schemaRouter.GET("/codegen", api.Schema.Codegen)
+
+	api.router.GET("/openapi.json", api.Schema.OpenAPI, middleware.ValidateAPIKey)
+}
+
+func (s *SchemaAPIImpl) Export(c echo.Context) error {
+	schema, err := s.service.Schema.Export()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+			Message: "Failed to export schema",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, schema)
+}
+
+type importSchemaParam struct {
+	DryRun bool `query:"dry_run"`
+}
+
+// Import
+//
+// Apply an exported schema, body is the exported document as is.
+// With dry_run the plan is validated and returned without being applied
+func (s *SchemaAPIImpl) Import(c echo.Context) error {
+	var params *importSchemaParam = new(importSchemaParam)
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	var schema model.Schema
+	if err := (&echo.DefaultBinder{}).BindBody(c, &schema); err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to bind request body",
+			Error:   err.Error(),
+		})
+	}
+
+	plan, err := s.service.Schema.Import(schema, params.DryRun)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Data:    plan,
+			Message: "Failed to import schema",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, responses.APIResponse{
+		Data: map[string]interface{}{
+			"dry_run": params.DryRun,
+			"plan":    plan,
+		},
+		Message: "success",
+	})
+}
+
+type codegenParam struct {
+	Lang string `query:"lang"`
+}
+
+// Codegen
+//
+// Client types and helpers generated from the live schema, returned as a source file
+func (s *SchemaAPIImpl) Codegen(c echo.Context) error {
+	var params *codegenParam = new(codegenParam)
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, params); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	if params.Lang == "" {
+		params.Lang = service.CODEGEN_TS
+	}
+
+	code, err := s.service.Schema.Codegen(params.Lang)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, responses.APIResponse{
+			Message: "Failed to generate code",
+			Error:   err.Error(),
+		})
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`inline; filename="funcbase.%s"`, params.Lang))
+
+	return c.String(http.StatusOK, code)
+}
+
+// OpenAPI
+//
+// OpenAPI 3 document of the collections and functions, generated from the current schema
+func (s *SchemaAPIImpl) OpenAPI(c echo.Context) error {
+	document, err := s.service.Schema.OpenAPI(fmt.Sprintf("%s://%s", c.Scheme(), c.Request().Host))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, responses.APIResponse{
+			Message: "Failed to generate OpenAPI document",
+			Error:   err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, document)
+}
@@ -5,12 +5,15 @@ import (
 	"funcbase/constants"
 	"funcbase/pkg/logger"
 	"funcbase/service"
+	"time"
 
 	"github.com/robfig/cron/v3"
 	"github.com/sarulabs/di"
+	"gorm.io/gorm"
 )
 
 type Batch struct {
+	db       *gorm.DB
 	services *service.Service
 	configs  *config.Config
 	cron     *cron.Cron
@@ -20,6 +23,7 @@ var BatchRunner *Batch
 
 func RunBatch(ioc di.Container) {
 	BatchRunner = &Batch{
+		db:       ioc.Get(constants.CONTAINER_DB).(*gorm.DB),
 		services: ioc.Get(constants.CONTAINER_SERVICE).(*service.Service),
 		configs:  config.GetInstance(),
 		cron:     cron.New(),
@@ -40,6 +44,22 @@ func (b *Batch) startCron() {
 		logger.DeleteOldLog()
 	})
 
+	b.cron.AddFunc("*/10 * * * *", func() {
+		b.services.Realtime.Prune(b.db, time.Minute*constants.REALTIME_RETENTION)
+	})
+
+	b.cron.AddFunc("15 * * * *", func() {
+		b.services.DB.PruneChanges(b.db, time.Hour*time.Duration(b.configs.GetChangesRetention()))
+	})
+
+	b.cron.AddFunc("30 * * * *", func() {
+		retention := b.configs.GetTrashRetention()
+		if retention <= 0 {
+			return
+		}
+		b.services.DB.PurgeExpired(b.db, time.Hour*time.Duration(retention))
+	})
+
 	go func() {
 		b.cron.Start()
 		defer b.cron.Stop()
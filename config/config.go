@@ -24,6 +24,14 @@ type (
 	DBMaxLifetime       int
 
 	LogLifetime int
+
+	ExpandMaxDepth int
+
+	TrashRetention int
+
+	ChangesRetention int
+
+	SlowQueryThreshold int
 )
 type CallbackConfig interface {
 	OnUpdate()
@@ -40,6 +48,10 @@ type Config struct {
 	DBMaxIdleConnection `json:"db_max_idle_connection"`
 	DBMaxLifetime       `json:"db_max_lifetime"`
 	LogLifetime         `json:"log_lifetime"`
+	ExpandMaxDepth      `json:"expand_max_depth"`
+	TrashRetention      `json:"trash_retention"`
+	ChangesRetention    `json:"changes_retention"`
+	SlowQueryThreshold  `json:"slow_query_threshold"`
 }
 
 func (c *Config) GetAppName() string {
@@ -78,6 +90,31 @@ func (c *Config) GetDBMaxLifetime() int {
 	return int(c.DBMaxLifetime)
 }
 
+func (c *Config) GetExpandMaxDepth() int {
+	if c.ExpandMaxDepth <= 0 {
+		return constants.EXPAND_MAX_DEPTH
+	}
+	return int(c.ExpandMaxDepth)
+}
+
+func (c *Config) GetTrashRetention() int {
+	return int(c.TrashRetention)
+}
+
+func (c *Config) GetChangesRetention() int {
+	if c.ChangesRetention <= 0 {
+		return constants.CHANGES_RETENTION
+	}
+	return int(c.ChangesRetention)
+}
+
+func (c *Config) GetSlowQueryThreshold() int {
+	if c.SlowQueryThreshold <= 0 {
+		return constants.SLOW_QUERY_THRESHOLD
+	}
+	return int(c.SlowQueryThreshold)
+}
+
 var (
 	config *Config
 	once   sync.Once
@@ -111,6 +148,10 @@ func (c *Config) Load() error {
 			DBMaxIdleConnection: 5,
 			DBMaxLifetime:       2,
 			LogLifetime:         168, // hours
+			ExpandMaxDepth:      constants.EXPAND_MAX_DEPTH,
+			TrashRetention:      720, // hours, 0 keeps deleted rows until purged manually
+			ChangesRetention:    constants.CHANGES_RETENTION,
+			SlowQueryThreshold:  constants.SLOW_QUERY_THRESHOLD,
 		}
 		config.Save()
 
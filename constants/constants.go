@@ -24,4 +24,31 @@ const (
 
 	CACHE_TIME             = 120
 	CACHE_CLEANUP_INTERVAL = 240
+
+	EXPAND_MAX_DEPTH = 2
+
+	SLOW_QUERY_THRESHOLD = 200 // milliseconds
+	SLOW_QUERY_LIMIT     = 50
+
+	PAGE_DEFAULT_SIZE = 10
+	PAGE_MAX_SIZE     = 1000
+
+	CURSOR_DEFAULT_LIMIT = 20
+	CURSOR_MAX_LIMIT     = 1000
+
+	BATCH_MAX_OPERATIONS = 100
+
+	BULK_DEFAULT_MAX_AFFECTED = 1000
+	BULK_MAX_AFFECTED         = 10000
+
+	REALTIME_POLL_INTERVAL = 250 // milliseconds
+	REALTIME_HEARTBEAT     = 15  // seconds
+	REALTIME_BUFFER        = 256
+	// changes are still recorded this long after the last subscriber left, so that it can resume
+	REALTIME_RESUME_WINDOW = 5  // minutes
+	REALTIME_RETENTION     = 60 // minutes
+
+	CHANGES_DEFAULT_LIMIT = 100
+	CHANGES_MAX_LIMIT     = 1000
+	CHANGES_RETENTION     = 720 // hours
 )
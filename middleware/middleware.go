@@ -20,11 +20,14 @@ import (
 func UseMiddleware(app *echo.Echo) {
 	app.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: config.GetInstance().AllowedOrigins,
-		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAuthorization, "X-API-KEY"},
-		AllowMethods: []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete},
+		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAuthorization, "X-API-KEY", "If-Match", "If-None-Match"},
+		AllowMethods: []string{http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete},
+		// read by the client to send it back in If-Match
+		ExposeHeaders: []string{"ETag"},
 	}))
 
 	app.Use(middleware.Recover())
+	app.Use(middleware.RequestID())
 	app.Use(middleware.Secure())
 	app.Use(middleware.RemoveTrailingSlash())
 
@@ -59,11 +62,12 @@ func RequireAuth(required bool) echo.MiddlewareFunc {
 						return c.JSON(http.StatusUnauthorized, unauthorizedErr)
 					}
 
-					userID, ok := claims["sub"].(float64)
+					userID, ok := subject(claims)
 					userRole, ok2 := claims["roles"].(string)
 					if ok && ok2 {
-						c.Set("user_id", int(userID))
+						c.Set("user_id", userID)
 						c.Set("roles", userRole)
+						c.Set("collection", claims["collection"])
 						return next(c)
 					}
 				}
@@ -86,11 +90,12 @@ func RequireAuth(required bool) echo.MiddlewareFunc {
 							return c.JSON(http.StatusUnauthorized, unauthorizedErr)
 						}
 
-						userID, ok := claims["sub"].(float64)
+						userID, ok := subject(claims)
 						userRole, ok2 := claims["roles"].(string)
 						if ok && ok2 {
-							c.Set("user_id", int(userID))
+							c.Set("user_id", userID)
 							c.Set("roles", userRole)
+							c.Set("collection", claims["collection"])
 							return next(c)
 						}
 					}
@@ -112,6 +117,20 @@ func RequireAuth(required bool) echo.MiddlewareFunc {
 	}
 }
 
+// subject
+//
+// User id of the token, integer ids are decoded as float64 while text ids stay strings
+func subject(claims jwt.MapClaims) (interface{}, bool) {
+	switch sub := claims["sub"].(type) {
+	case float64:
+		return int(sub), true
+	case string:
+		return sub, sub != ""
+	}
+
+	return nil, false
+}
+
 func parseJWT(tokenStr string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -1,10 +1,13 @@
 package model
 
 import (
+	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Admin struct {
@@ -24,41 +27,210 @@ func (a *Admin) TableName() string {
 type Index struct {
 	Name    string   `json:"name"`
 	Indexes []string `json:"indexes"`
+	Unique  bool     `json:"unique,omitempty"`
+	// partial index condition
+	Where string `json:"where,omitempty"`
+}
+
+// Unique
+//
+// Named unique constraint over one or more columns
+type Unique struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+}
+
+// Check
+//
+// Named check constraint, expression is written in sql
+type Check struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+// Trigger
+//
+// Sql trigger of a table, body holds the statements run between BEGIN and END
+type Trigger struct {
+	Name string `json:"name"`
+	// BEFORE or AFTER
+	Timing string `json:"timing"`
+	// INSERT, UPDATE or DELETE
+	Event string `json:"event"`
+	// optional condition, NEW and OLD rows can be referenced
+	When string `json:"when,omitempty"`
+	Body string `json:"body"`
+}
+
+type Constraints struct {
+	Uniques []Unique `json:"uniques"`
+	Checks  []Check  `json:"checks"`
+}
+
+type Relation struct {
+	Field     string `json:"field"`
+	Reference string `json:"reference"`
+	Multiple  bool   `json:"multiple"`
+	OnDelete  string `json:"on_delete,omitempty"`
+	// junction table holding the ids of a multiple relation
+	Junction string `json:"junction,omitempty"`
 }
 
 type Tables struct {
-	Name        string  `json:"name,omitempty" gorm:"primaryKey"`
-	Auth        bool    `json:"auth,omitempty" gorm:"column:auth"`
-	System      bool    `json:"system,omitempty" gorm:"column:system"`
-	Indexes     string  `json:"indexes,omitempty" gorm:"column:indexes"`
-	SystemIndex []Index `json:"index,omitempty" gorm:"-"`
-	// 0 = admin only
-	// 1 = logged in
-	// 2 = public
-	// others, connected user table
-	Access Access `json:"access,omitempty" gorm:"column:access"`
+	Name           string     `json:"name,omitempty" gorm:"primaryKey"`
+	Auth           bool       `json:"auth,omitempty" gorm:"column:auth"`
+	System         bool       `json:"system,omitempty" gorm:"column:system"`
+	Indexes        string     `json:"indexes,omitempty" gorm:"column:indexes"`
+	SystemIndex    []Index    `json:"index,omitempty" gorm:"-"`
+	Relations      string     `json:"relations,omitempty" gorm:"column:relations"`
+	SystemRelation []Relation `json:"relation,omitempty" gorm:"-"`
+	// empty for regular table, view for collection backed by sql view
+	Type string `json:"type,omitempty" gorm:"column:type"`
+	// select statement of a view collection
+	Query string `json:"query,omitempty" gorm:"column:query"`
+	// deleted rows are kept with deleted_at filled until purged
+	SoftDelete bool `json:"soft_delete,omitempty" gorm:"column:soft_delete"`
+	// every change on the table is recorded on _history
+	History bool `json:"history,omitempty" gorm:"column:history"`
+	// rows hold a version column incremented on every write
+	Versioned bool `json:"versioned,omitempty" gorm:"column:versioned"`
+	// composite unique and check constraints
+	Constraints      string       `json:"constraints,omitempty" gorm:"column:constraints"`
+	SystemConstraint *Constraints `json:"constraint,omitempty" gorm:"-"`
+	// text fields indexed for full text search
+	Search       string   `json:"search,omitempty" gorm:"column:search"`
+	SystemSearch []string `json:"searchable,omitempty" gorm:"-"`
+	// integer, uuid, ulid or nanoid, empty is integer
+	IDType string `json:"id_type,omitempty" gorm:"column:id_type"`
+	// prefix of nanoid ids, eg. usr_
+	IDPrefix string `json:"id_prefix,omitempty" gorm:"column:id_prefix"`
+	// triggers defined by the admin, created again whenever the table is rebuilt
+	Triggers      string    `json:"triggers,omitempty" gorm:"column:triggers"`
+	SystemTrigger []Trigger `json:"trigger,omitempty" gorm:"-"`
+	// access rule of each operation, see Rules
+	Rules      string `json:"rules,omitempty" gorm:"column:rules"`
+	SystemRule *Rules `json:"rule,omitempty" gorm:"-"`
+	// field name to its permission for non-admins, see FIELD_HIDDEN
+	Permissions      string            `json:"permissions,omitempty" gorm:"column:permissions"`
+	SystemPermission map[string]string `json:"permission,omitempty" gorm:"-"`
+}
+
+const TABLE_TYPE_VIEW = "view"
+
+func (t *Tables) IsView() bool {
+	return t.Type == TABLE_TYPE_VIEW
+}
+
+// primary key strategies of a collection
+const (
+	ID_TYPE_INTEGER = "integer"
+	ID_TYPE_UUID    = "uuid"
+	ID_TYPE_ULID    = "ulid"
+	ID_TYPE_NANOID  = "nanoid"
+)
+
+var IDTypes = []string{ID_TYPE_INTEGER, ID_TYPE_UUID, ID_TYPE_ULID, ID_TYPE_NANOID}
+
+// TextID
+//
+// Every strategy but the integer autoincrement stores the id as text
+func TextID(idType string) bool {
+	return idType != "" && idType != ID_TYPE_INTEGER
+}
+
+func (t *Tables) TextID() bool {
+	return TextID(t.IDType)
 }
 
-type Access string
+const (
+	RULE_VIEW   = "view"
+	RULE_LIST   = "list"
+	RULE_CREATE = "create"
+	RULE_UPDATE = "update"
+	RULE_DELETE = "delete"
+)
 
-func (a *Access) View() string {
-	return strings.Split(string(*a), ";")[0]
+// Rules
+//
+// Access rule of every operation on a collection. A nil rule is admin only, an empty rule is
+// public and others are expressions the row and the requesting user must match, e.g.
+// owner = @request.auth.id || @request.auth.role = "editor"
+type Rules struct {
+	View   *string `json:"view"`
+	List   *string `json:"list"`
+	Create *string `json:"create"`
+	Update *string `json:"update"`
+	Delete *string `json:"delete"`
 }
 
-func (a *Access) List() string {
-	return strings.Split(string(*a), ";")[1]
+func (r *Rules) Get(operation string) *string {
+	switch operation {
+	case RULE_VIEW:
+		return r.View
+	case RULE_LIST:
+		return r.List
+	case RULE_CREATE:
+		return r.Create
+	case RULE_UPDATE:
+		return r.Update
+	case RULE_DELETE:
+		return r.Delete
+	}
+
+	return nil
 }
 
-func (a *Access) Create() string {
-	return strings.Split(string(*a), ";")[2]
+func (r *Rules) Set(operation string, rule *string) {
+	switch operation {
+	case RULE_VIEW:
+		r.View = rule
+	case RULE_LIST:
+		r.List = rule
+	case RULE_CREATE:
+		r.Create = rule
+	case RULE_UPDATE:
+		r.Update = rule
+	case RULE_DELETE:
+		r.Delete = rule
+	}
 }
 
-func (a *Access) Update() string {
-	return strings.Split(string(*a), ";")[3]
+var RuleOperations = []string{RULE_VIEW, RULE_LIST, RULE_CREATE, RULE_UPDATE, RULE_DELETE}
+
+// RulesFromAccess
+//
+// Rules of an access string of older versions, "view;list;create;update;delete" where each
+// slot is 0 for admin only, 1 for logged in, 2 for public and any other value the column
+// holding the id of the owner. The owner of a user collection row is the user itself
+func RulesFromAccess(access string, auth bool) Rules {
+	rules := Rules{}
+	for i, slot := range strings.Split(access, ";") {
+		if i >= len(RuleOperations) {
+			break
+		}
+
+		var rule *string
+		switch slot {
+		case "0", "":
+		case "1":
+			rule = RuleOf(`@request.auth.id != ""`)
+		case "2":
+			rule = RuleOf("")
+		default:
+			if auth {
+				rule = RuleOf("id = @request.auth.id")
+			} else if slot != "3" {
+				rule = RuleOf(slot + " = @request.auth.id")
+			}
+		}
+		rules.Set(RuleOperations[i], rule)
+	}
+
+	return rules
 }
 
-func (a *Access) Delete() string {
-	return strings.Split(string(*a), ";")[4]
+func RuleOf(rule string) *string {
+	return &rule
 }
 
 func (t *Tables) TableName() string {
@@ -75,6 +247,73 @@ func (q *QueryHistory) TableName() string {
 	return "_queryHistory"
 }
 
+const (
+	HISTORY_INSERT  = "insert"
+	HISTORY_UPDATE  = "update"
+	HISTORY_DELETE  = "delete"
+	HISTORY_RESTORE = "restore"
+)
+
+type History struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	Table     string `json:"table" gorm:"column:table_name;index:idx_history_record"`
+	RecordID  string `json:"record_id" gorm:"index:idx_history_record"`
+	Operation string `json:"operation"`
+	// changed fields only, full row on insert and delete
+	Before    string    `json:"before"`
+	After     string    `json:"after"`
+	ActorID   string    `json:"actor_id"`
+	ActorRole string    `json:"actor_role"`
+	RequestID string    `json:"request_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (h *History) TableName() string {
+	return "_history"
+}
+
+const (
+	EVENT_CREATE = "create"
+	EVENT_UPDATE = "update"
+	EVENT_DELETE = "delete"
+)
+
+// Event
+//
+// Change of a record sent to the realtime subscribers, the id is the id of the server-sent
+// event that a client resumes from
+type Event struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	Table    string `json:"table" gorm:"column:table_name"`
+	RecordID string `json:"record_id"`
+	Action   string `json:"action"`
+	// row after the change, the deleted row on delete
+	Data      string    `json:"-"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+func (e *Event) TableName() string {
+	return "_events"
+}
+
+// Change
+//
+// Entry of the append-only change log read by incremental sync, the sequence only goes up and
+// follows the commit order of the changes
+type Change struct {
+	Seq       uint   `json:"seq" gorm:"primaryKey"`
+	Table     string `json:"table" gorm:"column:table_name"`
+	RecordID  string `json:"record_id"`
+	Operation string `json:"operation"`
+	// deleted row, used to check the access to a row that no longer exists
+	Data      string    `json:"-"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+func (c *Change) TableName() string {
+	return "_changes"
+}
+
 type FunctionStored struct {
 	Name     string `json:"name" gorm:"primaryKey"`
 	Function string `json:"function" gorm:"column:function"`
@@ -85,7 +324,7 @@ func (f *FunctionStored) TableName() string {
 }
 
 func Migrate(db *gorm.DB) error {
-	err := db.AutoMigrate(&Admin{}, &Tables{}, &QueryHistory{}, &FunctionStored{})
+	err := db.AutoMigrate(&Admin{}, &Tables{}, &QueryHistory{}, &FunctionStored{}, &History{}, &Event{}, &Change{})
 	if err != nil {
 		return err
 	}
@@ -94,13 +333,17 @@ func Migrate(db *gorm.DB) error {
 		{Name: "_admin", Auth: true, System: true},
 		{Name: "_queryHistory", Auth: false, System: true},
 		{Name: "_function", Auth: false, System: true},
+		{Name: "_history", Auth: false, System: true},
+		{Name: "_events", Auth: false, System: true},
+		{Name: "_changes", Auth: false, System: true},
 	}
-	err = db.Model(&Tables{}).Create(databases).Error
+	// system tables registered by older version are kept as is
+	err = db.Model(&Tables{}).Clauses(clause.OnConflict{DoNothing: true}).Create(databases).Error
 	if err != nil {
 		return err
 	}
 
-	return err
+	return migrateAccess(db)
 }
 
 // OTHERS MODELS
@@ -121,6 +364,55 @@ type Field struct {
 	Nullable  bool   `json:"nullable"`
 	Reference string `json:"reference,omitempty"`
 	Unique    bool   `json:"unique"`
+	// only used by relation field
+	Multiple bool   `json:"multiple,omitempty"`
+	OnDelete string `json:"on_delete,omitempty"`
+	// only used by text field, indexed for full text search
+	Searchable bool `json:"searchable,omitempty"`
+	// read and write permission of non-admins, empty follows the rules of the row
+	Permission string `json:"permission,omitempty"`
+}
+
+const (
+	// never read nor written by non-admins
+	FIELD_HIDDEN = "hidden"
+	// read by non-admins but only written by admins
+	FIELD_READ_ONLY = "read_only"
+	// written by non-admins when the row is created, never changed after
+	FIELD_CREATE_ONLY = "create_only"
+
+	// password of an auth table, written on register and never read
+	FIELD_CREDENTIAL = "credential"
+	// salt of an auth table, like the password but never listed as an input either
+	FIELD_SECRET = "secret"
+)
+
+const (
+	ON_DELETE_CASCADE  = "cascade"
+	ON_DELETE_SET_NULL = "set null"
+	ON_DELETE_RESTRICT = "restrict"
+)
+
+// OnDeleteClause
+//
+// Convert the on_delete option of a relation field into sqlite clause.
+// Empty option keeps the default sqlite behavior (NO ACTION)
+func (f *Field) OnDeleteClause() (string, error) {
+	switch strings.ToLower(f.OnDelete) {
+	case "":
+		return "", nil
+	case ON_DELETE_CASCADE:
+		return " ON DELETE CASCADE", nil
+	case ON_DELETE_SET_NULL:
+		if !f.Nullable && !f.Multiple {
+			return "", fmt.Errorf("relation %s must be nullable to use on delete set null", f.Name)
+		}
+		return " ON DELETE SET NULL", nil
+	case ON_DELETE_RESTRICT:
+		return " ON DELETE RESTRICT", nil
+	default:
+		return "", fmt.Errorf("invalid on delete option %s on relation %s", f.OnDelete, f.Name)
+	}
 }
 
 func (f *Field) ConvertTypeToSQLiteType() string {
@@ -142,9 +434,111 @@ func (f *Field) ConvertTypeToSQLiteType() string {
 	}
 }
 
+type CreateView struct {
+	Name  string `json:"view_name"`
+	Query string `json:"query"`
+}
+
 type CreateTable struct {
-	Name    string  `json:"table_name"`
-	Fields  []Field `json:"fields"`
-	Indexes []Index `json:"indexes"`
-	Type    string  `json:"table_type"`
+	Name       string   `json:"table_name"`
+	Fields     []Field  `json:"fields"`
+	Indexes    []Index  `json:"indexes"`
+	Uniques    []Unique `json:"uniques"`
+	Checks     []Check  `json:"checks"`
+	Type       string   `json:"table_type"`
+	SoftDelete bool     `json:"soft_delete"`
+	History    bool     `json:"history"`
+	Versioned  bool     `json:"versioned"`
+	// primary key strategy, can't be changed once the table is created
+	IDType   string `json:"id_type"`
+	IDPrefix string `json:"id_prefix"`
+}
+
+// Schema
+//
+// Snapshot of every collection of a project, used to move a schema between instances
+type Schema struct {
+	Version int           `json:"version"`
+	Tables  []SchemaTable `json:"tables"`
+}
+
+const SCHEMA_VERSION = 2
+
+type SchemaTable struct {
+	Name string `json:"name"`
+	Auth bool   `json:"auth,omitempty"`
+	// empty for regular table, view for collection backed by sql view
+	Type     string    `json:"type,omitempty"`
+	IDType   string    `json:"id_type,omitempty"`
+	IDPrefix string    `json:"id_prefix,omitempty"`
+	Fields   []Field   `json:"fields,omitempty"`
+	Indexes  []Index   `json:"indexes,omitempty"`
+	Uniques  []Unique  `json:"uniques,omitempty"`
+	Checks   []Check   `json:"checks,omitempty"`
+	Triggers []Trigger `json:"triggers,omitempty"`
+	Query    string    `json:"query,omitempty"`
+	Rules    Rules     `json:"rules"`
+	// access string of version 1, read into rules
+	Access     string `json:"access,omitempty"`
+	SoftDelete bool   `json:"soft_delete,omitempty"`
+	History    bool   `json:"history,omitempty"`
+	Versioned  bool   `json:"versioned,omitempty"`
+}
+
+func (t *SchemaTable) IsView() bool {
+	return t.Type == TABLE_TYPE_VIEW
+}
+
+const (
+	SCHEMA_CREATE = "create"
+	SCHEMA_ALTER  = "alter"
+	SCHEMA_DROP   = "drop"
+)
+
+// SchemaChange
+//
+// Single step of a schema import plan, changes lists the altered parts of the table
+type SchemaChange struct {
+	Action  string   `json:"action"`
+	Table   string   `json:"table"`
+	Changes []string `json:"changes,omitempty"`
+}
+
+// migrateAccess
+//
+// Access strings of older versions are turned into rules once, the access column is dropped
+// afterwards
+func migrateAccess(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Tables{}, "access") {
+		return nil
+	}
+
+	var tables []struct {
+		Name   string
+		Auth   bool
+		Access string
+	}
+	err := db.Model(&Tables{}).
+		Select("name, auth, access").
+		Where("access IS NOT NULL AND access != ''").
+		Scan(&tables).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range tables {
+			rules, err := json.Marshal(RulesFromAccess(table.Access, table.Auth))
+			if err != nil {
+				return err
+			}
+
+			err = tx.Model(&Tables{}).Where("name = ?", table.Name).Update("rules", string(rules)).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Migrator().DropColumn(&Tables{}, "access")
+	})
 }
@@ -0,0 +1,722 @@
+package pkg_graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+type Params struct {
+	Schema        *Schema
+	Query         string
+	OperationName string
+	Variables     map[string]interface{}
+	Context       context.Context
+	// only query operations may run, used for GET requests
+	ReadOnly bool
+}
+
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+type Result struct {
+	Data   interface{} `json:"data"`
+	Errors []Error     `json:"errors,omitempty"`
+}
+
+// OrderedMap
+//
+// Object of the response, fields are written in the order of the query
+type OrderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newOrderedMap() *OrderedMap {
+	return &OrderedMap{values: map[string]interface{}{}}
+}
+
+func (m *OrderedMap) Set(key string, value interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+func (m *OrderedMap) Get(key string) interface{} {
+	return m.values[key]
+}
+
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		buffer.Write(name)
+		buffer.WriteByte(':')
+		value, err := json.Marshal(m.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+
+	return buffer.Bytes(), nil
+}
+
+// invalid marks a null value of a non null field, the nearest nullable parent becomes null
+type invalid struct{}
+
+type executor struct {
+	schema    *Schema
+	document  *Document
+	variables map[string]interface{}
+	context   context.Context
+	errors    []Error
+}
+
+// Do
+//
+// Parse, validate and execute a request. Fields are resolved level by level for every
+// object of the level at once so that batch resolvers load relations with a single query
+func Do(p Params) *Result {
+	if p.Context == nil {
+		p.Context = context.Background()
+	}
+
+	document, err := Parse(p.Query)
+	if err != nil {
+		return &Result{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	operation, err := selectOperation(document, p.OperationName)
+	if err != nil {
+		return &Result{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	e := &executor{
+		schema:   p.Schema,
+		document: document,
+		context:  p.Context,
+	}
+
+	if p.ReadOnly && operation.Kind != "query" {
+		return &Result{Errors: []Error{{Message: fmt.Sprintf("%s operation can't be run from a read only request", operation.Kind)}}}
+	}
+
+	var root *Object
+	switch operation.Kind {
+	case "query":
+		root = p.Schema.Query
+	case "mutation":
+		root = p.Schema.Mutation
+	}
+	if root == nil {
+		return &Result{Errors: []Error{{Message: fmt.Sprintf("schema does not support %s", operation.Kind)}}}
+	}
+
+	if errors := validate(p.Schema, document, operation, root); len(errors) > 0 {
+		return &Result{Errors: errors}
+	}
+
+	e.variables, err = coerceVariables(p.Schema, operation, p.Variables)
+	if err != nil {
+		return &Result{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	node := &FieldNode{Selections: operation.Selections}
+	data := e.completeObjects(root, []interface{}{map[string]interface{}{}}, []*FieldNode{node}, nil)
+
+	return &Result{Data: data[0], Errors: e.errors}
+}
+
+func selectOperation(document *Document, name string) (*Operation, error) {
+	if name == "" {
+		if len(document.Operations) > 1 {
+			return nil, fmt.Errorf("operation name is required when the document has several operations")
+		}
+		return document.Operations[0], nil
+	}
+
+	for _, operation := range document.Operations {
+		if operation.Name == name {
+			return operation, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown operation %s", name)
+}
+
+// collectFields
+//
+// Fields of the selections grouped by response key, fragments are merged and
+// the @skip and @include directives applied
+func (e *executor) collectFields(t *Object, selections []Selection, keys *[]string, fields map[string][]*FieldNode, visited map[string]bool) {
+	for _, selection := range selections {
+		switch selection := selection.(type) {
+		case *FieldNode:
+			if !e.included(selection.Directives) {
+				continue
+			}
+			key := selection.ResponseKey()
+			if _, ok := fields[key]; !ok {
+				*keys = append(*keys, key)
+			}
+			fields[key] = append(fields[key], selection)
+		case *InlineFragment:
+			if !e.included(selection.Directives) || selection.TypeCondition != "" && selection.TypeCondition != t.Name {
+				continue
+			}
+			e.collectFields(t, selection.Selections, keys, fields, visited)
+		case *FragmentSpread:
+			if !e.included(selection.Directives) || visited[selection.Name] {
+				continue
+			}
+			visited[selection.Name] = true
+
+			fragment := e.document.Fragments[selection.Name]
+			if fragment == nil || fragment.TypeCondition != t.Name {
+				continue
+			}
+			e.collectFields(t, fragment.Selections, keys, fields, visited)
+		}
+	}
+}
+
+func (e *executor) included(directives []*Directive) bool {
+	for _, directive := range directives {
+		if directive.Name != "skip" && directive.Name != "include" {
+			continue
+		}
+
+		condition := false
+		for _, argument := range directive.Arguments {
+			if argument.Name != "if" {
+				continue
+			}
+			value, err := coerceLiteral(&NonNull{Of: Boolean}, argument.Value, e.variables)
+			if err == nil {
+				condition, _ = value.(bool)
+			}
+		}
+
+		if directive.Name == "skip" && condition || directive.Name == "include" && !condition {
+			return false
+		}
+	}
+
+	return true
+}
+
+// completeObjects
+//
+// Resolve the selected fields of every source, one resolver call per field for batch resolvers
+func (e *executor) completeObjects(t *Object, sources []interface{}, nodes []*FieldNode, path []interface{}) []interface{} {
+	results := make([]interface{}, len(sources))
+
+	live := []interface{}{}
+	positions := []int{}
+	for i, source := range sources {
+		if source == nil {
+			continue
+		}
+		live = append(live, source)
+		positions = append(positions, i)
+		results[i] = newOrderedMap()
+	}
+	if len(live) == 0 {
+		return results
+	}
+
+	keys := []string{}
+	fields := map[string][]*FieldNode{}
+	for _, node := range nodes {
+		e.collectFields(t, node.Selections, &keys, fields, map[string]bool{})
+	}
+
+	broken := make([]bool, len(live))
+	for _, key := range keys {
+		node := fields[key][0]
+		fieldPath := append(append([]interface{}{}, path...), key)
+
+		if node.Name == "__typename" {
+			for _, position := range positions {
+				results[position].(*OrderedMap).Set(key, t.Name)
+			}
+			continue
+		}
+
+		field := e.fieldDefinition(t, node.Name)
+		values, err := e.resolve(field, live, node)
+		if err != nil {
+			e.errors = append(e.errors, Error{Message: err.Error(), Path: fieldPath})
+
+			_, required := field.Type.(*NonNull)
+			for i, position := range positions {
+				if required {
+					broken[i] = true
+					continue
+				}
+				results[position].(*OrderedMap).Set(key, nil)
+			}
+			continue
+		}
+
+		completed := e.completeValues(field.Type, values, fields[key], fieldPath)
+		for i, position := range positions {
+			if _, ok := completed[i].(invalid); ok {
+				broken[i] = true
+				continue
+			}
+			results[position].(*OrderedMap).Set(key, completed[i])
+		}
+	}
+
+	for i, position := range positions {
+		if broken[i] {
+			results[position] = nil
+		}
+	}
+
+	return results
+}
+
+// fieldDefinition
+//
+// Field of the type, __schema and __type are available on the query type
+func (e *executor) fieldDefinition(t *Object, name string) *Field {
+	if t == e.schema.Query {
+		switch name {
+		case "__schema":
+			return schemaMetaField
+		case "__type":
+			return typeMetaField
+		}
+	}
+
+	return t.Field(name)
+}
+
+func (e *executor) resolve(field *Field, sources []interface{}, node *FieldNode) ([]interface{}, error) {
+	args, err := coerceArguments(field.Args, node.Arguments, e.variables)
+	if err != nil {
+		return nil, err
+	}
+
+	if field.Batch != nil {
+		values, err := field.Batch(BatchParams{
+			Context: e.withSchema(),
+			Sources: sources,
+			Args:    args,
+			Field:   node,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != len(sources) {
+			return nil, fmt.Errorf("batch resolver of %s returned %d values for %d sources", field.Name, len(values), len(sources))
+		}
+		return values, nil
+	}
+
+	values := make([]interface{}, len(sources))
+	for i, source := range sources {
+		if field.Resolve == nil {
+			if row, ok := source.(map[string]interface{}); ok {
+				values[i] = row[field.Name]
+			}
+			continue
+		}
+
+		values[i], err = field.Resolve(ResolveParams{
+			Context: e.withSchema(),
+			Source:  source,
+			Args:    args,
+			Field:   node,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+func (e *executor) completeValues(t Type, values []interface{}, nodes []*FieldNode, path []interface{}) []interface{} {
+	switch t := t.(type) {
+	case *NonNull:
+		completed := e.completeValues(t.Of, values, nodes, path)
+		reported := false
+		for i, value := range completed {
+			if value != nil {
+				continue
+			}
+			// a value nulled while completing has already reported its error
+			if !reported && values[i] == nil {
+				e.errors = append(e.errors, Error{Message: "Cannot return null for non-nullable field", Path: path})
+				reported = true
+			}
+			completed[i] = invalid{}
+		}
+		return completed
+	case *List:
+		flat := []interface{}{}
+		sizes := make([]int, len(values))
+		for i, value := range values {
+			items, ok := toList(value)
+			if !ok {
+				sizes[i] = -1
+				continue
+			}
+			sizes[i] = len(items)
+			flat = append(flat, items...)
+		}
+
+		completed := e.completeValues(t.Of, flat, nodes, path)
+		results := make([]interface{}, len(values))
+		offset := 0
+		for i, size := range sizes {
+			if size < 0 {
+				continue
+			}
+			items := completed[offset : offset+size]
+			offset += size
+
+			valid := true
+			for _, item := range items {
+				if _, ok := item.(invalid); ok {
+					valid = false
+				}
+			}
+			if valid {
+				results[i] = items
+			}
+		}
+		return results
+	case *Scalar:
+		results := make([]interface{}, len(values))
+		for i, value := range values {
+			if value == nil {
+				continue
+			}
+			serialized, err := t.Serialize(value)
+			if err != nil {
+				e.errors = append(e.errors, Error{Message: err.Error(), Path: path})
+				continue
+			}
+			results[i] = serialized
+		}
+		return results
+	case *Enum:
+		results := make([]interface{}, len(values))
+		for i, value := range values {
+			if value != nil {
+				results[i] = fmt.Sprintf("%v", value)
+			}
+		}
+		return results
+	case *Object:
+		return e.completeObjects(t, values, nodes, path)
+	}
+
+	return make([]interface{}, len(values))
+}
+
+// toList
+//
+// Items of a list value of any slice type, nil is not a list
+func toList(value interface{}) ([]interface{}, bool) {
+	if value == nil {
+		return nil, false
+	}
+	if items, ok := value.([]interface{}); ok {
+		return items, true
+	}
+
+	reflected := reflect.ValueOf(value)
+	if reflected.Kind() != reflect.Slice && reflected.Kind() != reflect.Array {
+		return []interface{}{value}, true
+	}
+
+	items := make([]interface{}, reflected.Len())
+	for i := range items {
+		items[i] = reflected.Index(i).Interface()
+	}
+
+	return items, true
+}
+
+type schemaKey struct{}
+
+func (e *executor) withSchema() context.Context {
+	return context.WithValue(e.context, schemaKey{}, e.schema)
+}
+
+func coerceVariables(schema *Schema, operation *Operation, values map[string]interface{}) (map[string]interface{}, error) {
+	coerced := map[string]interface{}{}
+	for _, definition := range operation.Variables {
+		t, err := typeFromRef(schema, definition.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		value, ok := values[definition.Name]
+		if !ok {
+			if definition.Default != nil {
+				coerced[definition.Name], err = coerceLiteral(t, *definition.Default, nil)
+				if err != nil {
+					return nil, fmt.Errorf("variable $%s: %s", definition.Name, err.Error())
+				}
+				continue
+			}
+			if _, ok := t.(*NonNull); ok {
+				return nil, fmt.Errorf("variable $%s of required type %s was not provided", definition.Name, t.String())
+			}
+			continue
+		}
+
+		coerced[definition.Name], err = coerceValue(t, value)
+		if err != nil {
+			return nil, fmt.Errorf("variable $%s: %s", definition.Name, err.Error())
+		}
+	}
+
+	return coerced, nil
+}
+
+func typeFromRef(schema *Schema, ref *TypeRef) (Type, error) {
+	var t Type
+	if ref.Elem != nil {
+		elem, err := typeFromRef(schema, ref.Elem)
+		if err != nil {
+			return nil, err
+		}
+		t = &List{Of: elem}
+	} else {
+		named := schema.Type(ref.Name)
+		if named == nil {
+			return nil, fmt.Errorf("unknown type %s", ref.Name)
+		}
+		switch named.(type) {
+		case *Scalar, *Enum, *InputObject:
+		default:
+			return nil, fmt.Errorf("type %s can't be used as input", ref.Name)
+		}
+		t = named
+	}
+
+	if ref.NonNull {
+		t = &NonNull{Of: t}
+	}
+
+	return t, nil
+}
+
+func coerceArguments(definitions []*InputValue, arguments []*Argument, variables map[string]interface{}) (map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	for _, definition := range definitions {
+		var argument *Argument
+		for _, a := range arguments {
+			if a.Name == definition.Name {
+				argument = a
+			}
+		}
+
+		provided := argument != nil
+		if provided && argument.Value.Kind == VariableValue {
+			_, provided = variables[argument.Value.Raw]
+		}
+
+		if !provided {
+			if definition.Default != nil {
+				args[definition.Name] = definition.Default
+				continue
+			}
+			if _, ok := definition.Type.(*NonNull); ok {
+				return nil, fmt.Errorf("argument %s of type %s is required", definition.Name, definition.Type.String())
+			}
+			continue
+		}
+
+		value, err := coerceLiteral(definition.Type, argument.Value, variables)
+		if err != nil {
+			return nil, fmt.Errorf("argument %s: %s", definition.Name, err.Error())
+		}
+		args[definition.Name] = value
+	}
+
+	return args, nil
+}
+
+// coerceLiteral
+//
+// Input value written in the query, variables are already coerced
+func coerceLiteral(t Type, value Value, variables map[string]interface{}) (interface{}, error) {
+	if value.Kind == VariableValue {
+		variable := variables[value.Raw]
+		if _, ok := t.(*NonNull); ok && variable == nil {
+			return nil, fmt.Errorf("expected non null value of type %s", t.String())
+		}
+		return variable, nil
+	}
+
+	if nonNull, ok := t.(*NonNull); ok {
+		if value.Kind == NullValue {
+			return nil, fmt.Errorf("expected non null value of type %s", t.String())
+		}
+		return coerceLiteral(nonNull.Of, value, variables)
+	}
+
+	if value.Kind == NullValue {
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *List:
+		if value.Kind != ListValue {
+			item, err := coerceLiteral(t.Of, value, variables)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{item}, nil
+		}
+
+		items := make([]interface{}, len(value.List))
+		for i, item := range value.List {
+			coerced, err := coerceLiteral(t.Of, item, variables)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = coerced
+		}
+		return items, nil
+	case *InputObject:
+		if value.Kind != ObjectValue {
+			return nil, fmt.Errorf("expected object of type %s", t.Name)
+		}
+
+		object := map[string]interface{}{}
+		for _, field := range value.Fields {
+			definition := t.Field(field.Name)
+			if definition == nil {
+				return nil, fmt.Errorf("field %s is not defined by type %s", field.Name, t.Name)
+			}
+			if field.Value.Kind == VariableValue {
+				if _, ok := variables[field.Value.Raw]; !ok {
+					continue
+				}
+			}
+			coerced, err := coerceLiteral(definition.Type, field.Value, variables)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", field.Name, err.Error())
+			}
+			object[field.Name] = coerced
+		}
+		return completeInputObject(t, object)
+	case *Enum:
+		if value.Kind != EnumValue || !t.Has(value.Raw) {
+			return nil, fmt.Errorf("%s is not a value of enum %s", value.Raw, t.Name)
+		}
+		return value.Raw, nil
+	case *Scalar:
+		return t.ParseLiteral(value)
+	}
+
+	return nil, fmt.Errorf("type %s can't be used as input", t.String())
+}
+
+// coerceValue
+//
+// Input value coming from the json variables
+func coerceValue(t Type, value interface{}) (interface{}, error) {
+	if nonNull, ok := t.(*NonNull); ok {
+		if value == nil {
+			return nil, fmt.Errorf("expected non null value of type %s", t.String())
+		}
+		return coerceValue(nonNull.Of, value)
+	}
+
+	if value == nil {
+		return nil, nil
+	}
+
+	switch t := t.(type) {
+	case *List:
+		items, ok := value.([]interface{})
+		if !ok {
+			item, err := coerceValue(t.Of, value)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{item}, nil
+		}
+
+		coerced := make([]interface{}, len(items))
+		for i, item := range items {
+			var err error
+			coerced[i], err = coerceValue(t.Of, item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return coerced, nil
+	case *InputObject:
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected object of type %s", t.Name)
+		}
+
+		object := map[string]interface{}{}
+		for name, field := range fields {
+			definition := t.Field(name)
+			if definition == nil {
+				return nil, fmt.Errorf("field %s is not defined by type %s", name, t.Name)
+			}
+			coerced, err := coerceValue(definition.Type, field)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", name, err.Error())
+			}
+			object[name] = coerced
+		}
+		return completeInputObject(t, object)
+	case *Enum:
+		name, ok := value.(string)
+		if !ok || !t.Has(name) {
+			return nil, fmt.Errorf("%v is not a value of enum %s", value, t.Name)
+		}
+		return name, nil
+	case *Scalar:
+		return t.ParseValue(value)
+	}
+
+	return nil, fmt.Errorf("type %s can't be used as input", t.String())
+}
+
+// completeInputObject
+//
+// Fill the defaults of the missing fields and reject missing required fields. Fields left out
+// stay absent from the map, an explicit null is kept as nil
+func completeInputObject(t *InputObject, object map[string]interface{}) (map[string]interface{}, error) {
+	for _, field := range t.Fields {
+		if _, ok := object[field.Name]; ok {
+			continue
+		}
+		if field.Default != nil {
+			object[field.Name] = field.Default
+			continue
+		}
+		if _, ok := field.Type.(*NonNull); ok {
+			return nil, fmt.Errorf("field %s of type %s is required", field.Name, field.Type.String())
+		}
+	}
+
+	return object, nil
+}
@@ -0,0 +1,217 @@
+package pkg_graphql
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// testSchema
+//
+// Posts and their authors, the author of every post of a level is loaded by one batch call
+func testSchema(t *testing.T, batches *int) *Schema {
+	t.Helper()
+
+	authors := map[string]map[string]interface{}{
+		"1": {"id": "1", "name": "ann"},
+		"2": {"id": "2", "name": "bob"},
+	}
+	posts := []interface{}{
+		map[string]interface{}{"id": "1", "title": "first", "author": "1"},
+		map[string]interface{}{"id": "2", "title": "second", "author": "2"},
+		map[string]interface{}{"id": "3", "title": "third", "author": "1"},
+	}
+
+	author := &Object{Name: "Author", Fields: []*Field{
+		{Name: "id", Type: &NonNull{Of: ID}},
+		{Name: "name", Type: String},
+	}}
+	post := &Object{Name: "Post", Fields: []*Field{
+		{Name: "id", Type: &NonNull{Of: ID}},
+		{Name: "title", Type: String},
+		{Name: "author", Type: author, Batch: func(p BatchParams) ([]interface{}, error) {
+			*batches++
+			values := make([]interface{}, len(p.Sources))
+			for i, source := range p.Sources {
+				values[i] = authors[source.(map[string]interface{})["author"].(string)]
+			}
+			return values, nil
+		}},
+	}}
+
+	query := &Object{Name: "Query", Fields: []*Field{
+		{Name: "posts", Type: &NonNull{Of: &List{Of: &NonNull{Of: post}}}, Resolve: func(p ResolveParams) (interface{}, error) {
+			return posts, nil
+		}},
+		{Name: "post", Type: post, Args: []*InputValue{{Name: "id", Type: &NonNull{Of: ID}}}, Resolve: func(p ResolveParams) (interface{}, error) {
+			for _, row := range posts {
+				if row.(map[string]interface{})["id"] == p.Args["id"] {
+					return row, nil
+				}
+			}
+			return nil, nil
+		}},
+	}}
+	mutation := &Object{Name: "Mutation", Fields: []*Field{
+		{Name: "add_post", Type: post, Args: []*InputValue{{Name: "title", Type: &NonNull{Of: String}}}, Resolve: func(p ResolveParams) (interface{}, error) {
+			row := map[string]interface{}{"id": "4", "title": p.Args["title"], "author": "2"}
+			posts = append(posts, row)
+			return row, nil
+		}},
+	}}
+
+	schema, err := NewSchema(query, mutation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return schema
+}
+
+func resultJSON(t *testing.T, result *Result) string {
+	t.Helper()
+
+	if len(result.Errors) > 0 {
+		t.Fatalf("errors %v", result.Errors)
+	}
+	data, err := json.Marshal(result.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, query := range []string{
+		"{",
+		"{ posts { id }",
+		"{ post(id: ) { id } }",
+		`{ post(id: "1) { id } }`,
+		"query ($id ID!) { post(id: $id) { id } }",
+		"fragment on Post { id }",
+		"{ posts { ...on } }",
+	} {
+		_, err := Parse(query)
+		if err == nil {
+			t.Errorf("%q parsed", query)
+		}
+	}
+
+	document, err := Parse(`# comment
+		query Posts { posts { id, title } }
+		mutation { add_post(title: """block""") { id } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(document.Operations) != 2 {
+		t.Errorf("%d operations, want 2", len(document.Operations))
+	}
+}
+
+func TestVariables(t *testing.T) {
+	var batches int
+	schema := testSchema(t, &batches)
+	query := "query Post($id: ID!) { post(id: $id) { title } }"
+
+	result := Do(Params{Schema: schema, Query: query, Variables: map[string]interface{}{"id": "2"}})
+	if got := resultJSON(t, result); got != `{"post":{"title":"second"}}` {
+		t.Errorf("data %s", got)
+	}
+
+	result = Do(Params{Schema: schema, Query: query, Variables: map[string]interface{}{"id": 3}})
+	if got := resultJSON(t, result); got != `{"post":{"title":"third"}}` {
+		t.Errorf("data of an int id %s", got)
+	}
+
+	for name, variables := range map[string]map[string]interface{}{
+		"missing": {},
+		"null":    {"id": nil},
+		"object":  {"id": map[string]interface{}{}},
+	} {
+		result = Do(Params{Schema: schema, Query: query, Variables: variables})
+		if len(result.Errors) == 0 {
+			t.Errorf("%s variable accepted", name)
+		}
+	}
+
+	result = Do(Params{Schema: schema, Query: "query ($id: ID = \"1\") { post(id: $id) { title } }"})
+	if got := resultJSON(t, result); got != `{"post":{"title":"first"}}` {
+		t.Errorf("data of a default value %s", got)
+	}
+}
+
+func TestFragments(t *testing.T) {
+	var batches int
+	schema := testSchema(t, &batches)
+
+	result := Do(Params{Schema: schema, Query: `
+		query { post(id: "1") { ...post ... on Post { author { name } } } }
+		fragment post on Post { id title }`})
+	if got := resultJSON(t, result); got != `{"post":{"id":"1","title":"first","author":{"name":"ann"}}}` {
+		t.Errorf("data %s", got)
+	}
+
+	result = Do(Params{Schema: schema, Query: `
+		query { post(id: "1") { ...a } }
+		fragment a on Post { id ...b }
+		fragment b on Post { title ...a }`})
+	if len(result.Errors) == 0 {
+		t.Error("fragment cycle accepted")
+	}
+}
+
+func TestValidation(t *testing.T) {
+	var batches int
+	schema := testSchema(t, &batches)
+
+	for name, query := range map[string]string{
+		"unknown field":         "{ posts { body } }",
+		"unknown argument":      `{ post(id: "1", slug: "a") { id } }`,
+		"missing argument":      "{ post { id } }",
+		"wrong argument type":   "{ post(id: {a: 1}) { id } }",
+		"missing selection":     "{ posts }",
+		"selection on a scalar": "{ posts { title { id } } }",
+		"unknown fragment":      `{ post(id: "1") { ...missing } }`,
+		"undefined variable":    "{ post(id: $id) { id } }",
+		"unnamed operation":     "query A { posts { id } } query B { posts { id } }",
+		"subscription":          "subscription { posts { id } }",
+	} {
+		result := Do(Params{Schema: schema, Query: query})
+		if len(result.Errors) == 0 {
+			t.Errorf("%s accepted", name)
+		}
+		if batches != 0 {
+			t.Errorf("%s resolved", name)
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	var batches int
+	schema := testSchema(t, &batches)
+
+	result := Do(Params{Schema: schema, Query: "{ posts { title author { name } } }"})
+	want := `{"posts":[{"title":"first","author":{"name":"ann"}},{"title":"second","author":{"name":"bob"}},{"title":"third","author":{"name":"ann"}}]}`
+	if got := resultJSON(t, result); got != want {
+		t.Errorf("data %s", got)
+	}
+	if batches != 1 {
+		t.Errorf("authors loaded by %d calls, want 1", batches)
+	}
+}
+
+func TestMutation(t *testing.T) {
+	var batches int
+	schema := testSchema(t, &batches)
+	query := `mutation { add_post(title: "fourth") { id title } }`
+
+	result := Do(Params{Schema: schema, Query: query, ReadOnly: true})
+	if len(result.Errors) == 0 {
+		t.Error("mutation run from a read only request")
+	}
+
+	result = Do(Params{Schema: schema, Query: query})
+	if got := resultJSON(t, result); got != `{"add_post":{"id":"4","title":"fourth"}}` {
+		t.Errorf("data %s", got)
+	}
+}
@@ -0,0 +1,308 @@
+package pkg_graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type directiveDefinition struct {
+	Name        string
+	Description string
+	Locations   []string
+	Args        []*InputValue
+}
+
+var builtinDirectives = []*directiveDefinition{
+	{
+		Name:        "skip",
+		Description: "Skip the selection when the argument is true",
+		Locations:   []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+		Args:        []*InputValue{{Name: "if", Type: &NonNull{Of: Boolean}}},
+	},
+	{
+		Name:        "include",
+		Description: "Include the selection only when the argument is true",
+		Locations:   []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+		Args:        []*InputValue{{Name: "if", Type: &NonNull{Of: Boolean}}},
+	},
+}
+
+var (
+	introspectionSchema     = &Object{Name: "__Schema"}
+	introspectionType       = &Object{Name: "__Type"}
+	introspectionField      = &Object{Name: "__Field"}
+	introspectionInputValue = &Object{Name: "__InputValue"}
+	introspectionEnumValue  = &Object{Name: "__EnumValue"}
+	introspectionDirective  = &Object{Name: "__Directive"}
+
+	introspectionTypeKind = &Enum{
+		Name:   "__TypeKind",
+		Values: []string{"SCALAR", "OBJECT", "INTERFACE", "UNION", "ENUM", "INPUT_OBJECT", "LIST", "NON_NULL"},
+	}
+	introspectionDirectiveLocation = &Enum{
+		Name: "__DirectiveLocation",
+		Values: []string{"QUERY", "MUTATION", "SUBSCRIPTION", "FIELD", "FRAGMENT_DEFINITION", "FRAGMENT_SPREAD",
+			"INLINE_FRAGMENT", "VARIABLE_DEFINITION", "SCHEMA", "SCALAR", "OBJECT", "FIELD_DEFINITION", "ARGUMENT_DEFINITION",
+			"INTERFACE", "UNION", "ENUM", "ENUM_VALUE", "INPUT_OBJECT", "INPUT_FIELD_DEFINITION"},
+	}
+)
+
+// schemaMetaField and typeMetaField are only available on the query type
+var schemaMetaField = &Field{
+	Name: "__schema",
+	Type: &NonNull{Of: introspectionSchema},
+	Resolve: func(p ResolveParams) (interface{}, error) {
+		return p.Context.Value(schemaKey{}), nil
+	},
+}
+
+var typeMetaField = &Field{
+	Name: "__type",
+	Type: introspectionType,
+	Args: []*InputValue{{Name: "name", Type: &NonNull{Of: String}}},
+	Resolve: func(p ResolveParams) (interface{}, error) {
+		schema := p.Context.Value(schemaKey{}).(*Schema)
+		if named := schema.Type(p.Args["name"].(string)); named != nil {
+			return named, nil
+		}
+		return nil, nil
+	},
+}
+
+type enumValue struct {
+	name string
+}
+
+func init() {
+	nonNullString := &NonNull{Of: String}
+	nonNullBoolean := &NonNull{Of: Boolean}
+	deprecated := []*InputValue{{Name: "includeDeprecated", Type: Boolean, Default: false}}
+	nothing := func(p ResolveParams) (interface{}, error) { return nil, nil }
+	no := func(p ResolveParams) (interface{}, error) { return false, nil }
+
+	introspectionSchema.Fields = []*Field{
+		{Name: "description", Type: String, Resolve: nothing},
+		{Name: "types", Type: &NonNull{Of: &List{Of: &NonNull{Of: introspectionType}}}, Resolve: func(p ResolveParams) (interface{}, error) {
+			return p.Source.(*Schema).Types(), nil
+		}},
+		{Name: "queryType", Type: &NonNull{Of: introspectionType}, Resolve: func(p ResolveParams) (interface{}, error) {
+			return p.Source.(*Schema).Query, nil
+		}},
+		{Name: "mutationType", Type: introspectionType, Resolve: func(p ResolveParams) (interface{}, error) {
+			if mutation := p.Source.(*Schema).Mutation; mutation != nil {
+				return mutation, nil
+			}
+			return nil, nil
+		}},
+		{Name: "subscriptionType", Type: introspectionType, Resolve: nothing},
+		{Name: "directives", Type: &NonNull{Of: &List{Of: &NonNull{Of: introspectionDirective}}}, Resolve: func(p ResolveParams) (interface{}, error) {
+			return builtinDirectives, nil
+		}},
+	}
+
+	introspectionType.Fields = []*Field{
+		{Name: "kind", Type: &NonNull{Of: introspectionTypeKind}, Resolve: func(p ResolveParams) (interface{}, error) {
+			return typeKind(p.Source.(Type)), nil
+		}},
+		{Name: "name", Type: String, Resolve: func(p ResolveParams) (interface{}, error) {
+			if named, ok := p.Source.(Named); ok {
+				return named.TypeName(), nil
+			}
+			return nil, nil
+		}},
+		{Name: "description", Type: String, Resolve: func(p ResolveParams) (interface{}, error) {
+			if named, ok := p.Source.(Named); ok && named.TypeDescription() != "" {
+				return named.TypeDescription(), nil
+			}
+			return nil, nil
+		}},
+		{Name: "specifiedByURL", Type: String, Resolve: nothing},
+		{Name: "fields", Type: &List{Of: &NonNull{Of: introspectionField}}, Args: deprecated, Resolve: func(p ResolveParams) (interface{}, error) {
+			if object, ok := p.Source.(*Object); ok {
+				return object.Fields, nil
+			}
+			return nil, nil
+		}},
+		{Name: "interfaces", Type: &List{Of: &NonNull{Of: introspectionType}}, Resolve: func(p ResolveParams) (interface{}, error) {
+			if _, ok := p.Source.(*Object); ok {
+				return []interface{}{}, nil
+			}
+			return nil, nil
+		}},
+		{Name: "possibleTypes", Type: &List{Of: &NonNull{Of: introspectionType}}, Resolve: nothing},
+		{Name: "enumValues", Type: &List{Of: &NonNull{Of: introspectionEnumValue}}, Args: deprecated, Resolve: func(p ResolveParams) (interface{}, error) {
+			enum, ok := p.Source.(*Enum)
+			if !ok {
+				return nil, nil
+			}
+			values := []interface{}{}
+			for _, value := range enum.Values {
+				values = append(values, enumValue{name: value})
+			}
+			return values, nil
+		}},
+		{Name: "inputFields", Type: &List{Of: &NonNull{Of: introspectionInputValue}}, Args: deprecated, Resolve: func(p ResolveParams) (interface{}, error) {
+			if input, ok := p.Source.(*InputObject); ok {
+				return input.Fields, nil
+			}
+			return nil, nil
+		}},
+		{Name: "ofType", Type: introspectionType, Resolve: func(p ResolveParams) (interface{}, error) {
+			switch wrapper := p.Source.(type) {
+			case *List:
+				return wrapper.Of, nil
+			case *NonNull:
+				return wrapper.Of, nil
+			}
+			return nil, nil
+		}},
+		{Name: "isOneOf", Type: Boolean, Resolve: func(p ResolveParams) (interface{}, error) {
+			if _, ok := p.Source.(*InputObject); ok {
+				return false, nil
+			}
+			return nil, nil
+		}},
+	}
+
+	introspectionField.Fields = []*Field{
+		{Name: "name", Type: nonNullString, Resolve: func(p ResolveParams) (interface{}, error) {
+			return p.Source.(*Field).Name, nil
+		}},
+		{Name: "description", Type: String, Resolve: func(p ResolveParams) (interface{}, error) {
+			if description := p.Source.(*Field).Description; description != "" {
+				return description, nil
+			}
+			return nil, nil
+		}},
+		{Name: "args", Type: &NonNull{Of: &List{Of: &NonNull{Of: introspectionInputValue}}}, Args: deprecated, Resolve: func(p ResolveParams) (interface{}, error) {
+			if args := p.Source.(*Field).Args; args != nil {
+				return args, nil
+			}
+			return []interface{}{}, nil
+		}},
+		{Name: "type", Type: &NonNull{Of: introspectionType}, Resolve: func(p ResolveParams) (interface{}, error) {
+			return p.Source.(*Field).Type, nil
+		}},
+		{Name: "isDeprecated", Type: nonNullBoolean, Resolve: no},
+		{Name: "deprecationReason", Type: String, Resolve: nothing},
+	}
+
+	introspectionInputValue.Fields = []*Field{
+		{Name: "name", Type: nonNullString, Resolve: func(p ResolveParams) (interface{}, error) {
+			return p.Source.(*InputValue).Name, nil
+		}},
+		{Name: "description", Type: String, Resolve: func(p ResolveParams) (interface{}, error) {
+			if description := p.Source.(*InputValue).Description; description != "" {
+				return description, nil
+			}
+			return nil, nil
+		}},
+		{Name: "type", Type: &NonNull{Of: introspectionType}, Resolve: func(p ResolveParams) (interface{}, error) {
+			return p.Source.(*InputValue).Type, nil
+		}},
+		{Name: "defaultValue", Type: String, Resolve: func(p ResolveParams) (interface{}, error) {
+			input := p.Source.(*InputValue)
+			if input.Default == nil {
+				return nil, nil
+			}
+			return printValue(input.Type, input.Default), nil
+		}},
+		{Name: "isDeprecated", Type: nonNullBoolean, Resolve: no},
+		{Name: "deprecationReason", Type: String, Resolve: nothing},
+	}
+
+	introspectionEnumValue.Fields = []*Field{
+		{Name: "name", Type: nonNullString, Resolve: func(p ResolveParams) (interface{}, error) {
+			return p.Source.(enumValue).name, nil
+		}},
+		{Name: "description", Type: String, Resolve: nothing},
+		{Name: "isDeprecated", Type: nonNullBoolean, Resolve: no},
+		{Name: "deprecationReason", Type: String, Resolve: nothing},
+	}
+
+	introspectionDirective.Fields = []*Field{
+		{Name: "name", Type: nonNullString, Resolve: func(p ResolveParams) (interface{}, error) {
+			return p.Source.(*directiveDefinition).Name, nil
+		}},
+		{Name: "description", Type: String, Resolve: func(p ResolveParams) (interface{}, error) {
+			return p.Source.(*directiveDefinition).Description, nil
+		}},
+		{Name: "locations", Type: &NonNull{Of: &List{Of: &NonNull{Of: introspectionDirectiveLocation}}}, Resolve: func(p ResolveParams) (interface{}, error) {
+			return p.Source.(*directiveDefinition).Locations, nil
+		}},
+		{Name: "args", Type: &NonNull{Of: &List{Of: &NonNull{Of: introspectionInputValue}}}, Args: deprecated, Resolve: func(p ResolveParams) (interface{}, error) {
+			return p.Source.(*directiveDefinition).Args, nil
+		}},
+		{Name: "isRepeatable", Type: nonNullBoolean, Resolve: no},
+	}
+}
+
+func typeKind(t Type) string {
+	switch t.(type) {
+	case *Scalar:
+		return "SCALAR"
+	case *Object:
+		return "OBJECT"
+	case *Enum:
+		return "ENUM"
+	case *InputObject:
+		return "INPUT_OBJECT"
+	case *List:
+		return "LIST"
+	case *NonNull:
+		return "NON_NULL"
+	}
+
+	return ""
+}
+
+// printValue
+//
+// Default value written as a graphql literal
+func printValue(t Type, value interface{}) string {
+	if nonNull, ok := t.(*NonNull); ok {
+		t = nonNull.Of
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		if _, ok := t.(*Enum); ok {
+			return v
+		}
+		return strconv.Quote(v)
+	case []interface{}:
+		var elem Type = JSON
+		if list, ok := t.(*List); ok {
+			elem = list.Of
+		}
+		items := []string{}
+		for _, item := range v {
+			items = append(items, printValue(elem, item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		keys := []string{}
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fields := []string{}
+		for _, key := range keys {
+			var fieldType Type = JSON
+			if input, ok := t.(*InputObject); ok && input.Field(key) != nil {
+				fieldType = input.Field(key).Type
+			}
+			fields = append(fields, fmt.Sprintf("%s: %s", key, printValue(fieldType, v[key])))
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
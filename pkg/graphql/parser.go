@@ -0,0 +1,787 @@
+package pkg_graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type ValueKind int
+
+const (
+	VariableValue ValueKind = iota
+	IntValue
+	FloatValue
+	StringValue
+	BooleanValue
+	NullValue
+	EnumValue
+	ListValue
+	ObjectValue
+)
+
+// Value
+//
+// Literal of a query, Raw holds the variable name, the scalar text or the enum name
+type Value struct {
+	Kind   ValueKind
+	Raw    string
+	List   []Value
+	Fields []ObjectField
+}
+
+type ObjectField struct {
+	Name  string
+	Value Value
+}
+
+// TypeRef
+//
+// Type of a variable definition, either a named type or a list of Elem
+type TypeRef struct {
+	Name    string
+	Elem    *TypeRef
+	NonNull bool
+}
+
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+type Operation struct {
+	Kind       string
+	Name       string
+	Variables  []*VariableDefinition
+	Directives []*Directive
+	Selections []Selection
+}
+
+type VariableDefinition struct {
+	Name    string
+	Type    *TypeRef
+	Default *Value
+}
+
+type Directive struct {
+	Name      string
+	Arguments []*Argument
+}
+
+type Argument struct {
+	Name  string
+	Value Value
+}
+
+type Selection interface{}
+
+type FieldNode struct {
+	Alias      string
+	Name       string
+	Arguments  []*Argument
+	Directives []*Directive
+	Selections []Selection
+}
+
+// ResponseKey
+//
+// Key of the field in the result, the alias when there is one
+func (f *FieldNode) ResponseKey() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+
+	return f.Name
+}
+
+type FragmentSpread struct {
+	Name       string
+	Directives []*Directive
+}
+
+type InlineFragment struct {
+	TypeCondition string
+	Directives    []*Directive
+	Selections    []Selection
+}
+
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	Directives    []*Directive
+	Selections    []Selection
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunctuator
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+type parser struct {
+	source string
+	pos    int
+	token  token
+}
+
+// Parse
+//
+// Parse an executable document, type system definitions are not supported
+func Parse(source string) (*Document, error) {
+	p := &parser{source: source}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	document := &Document{Fragments: map[string]*Fragment{}}
+	for p.token.kind != tokenEOF {
+		switch {
+		case p.peek(tokenPunctuator, "{"):
+			selections, err := p.parseSelectionSet()
+			if err != nil {
+				return nil, err
+			}
+			document.Operations = append(document.Operations, &Operation{Kind: "query", Selections: selections})
+		case p.peek(tokenName, "query"), p.peek(tokenName, "mutation"), p.peek(tokenName, "subscription"):
+			operation, err := p.parseOperation()
+			if err != nil {
+				return nil, err
+			}
+			document.Operations = append(document.Operations, operation)
+		case p.peek(tokenName, "fragment"):
+			fragment, err := p.parseFragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := document.Fragments[fragment.Name]; ok {
+				return nil, fmt.Errorf("there can be only one fragment named %s", fragment.Name)
+			}
+			document.Fragments[fragment.Name] = fragment
+		default:
+			return nil, p.unexpected()
+		}
+	}
+
+	if len(document.Operations) == 0 {
+		return nil, fmt.Errorf("document has no operation")
+	}
+
+	return document, nil
+}
+
+func (p *parser) parseOperation() (*Operation, error) {
+	operation := &Operation{Kind: p.token.value}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	if p.token.kind == tokenName {
+		operation.Name = p.token.value
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek(tokenPunctuator, "(") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		for !p.peek(tokenPunctuator, ")") {
+			definition, err := p.parseVariableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			operation.Variables = append(operation.Variables, definition)
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	operation.Directives, err = p.parseDirectives()
+	if err != nil {
+		return nil, err
+	}
+
+	operation.Selections, err = p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+
+	return operation, nil
+}
+
+func (p *parser) parseVariableDefinition() (*VariableDefinition, error) {
+	if err := p.expect(tokenPunctuator, "$"); err != nil {
+		return nil, err
+	}
+	name, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenPunctuator, ":"); err != nil {
+		return nil, err
+	}
+
+	definition := &VariableDefinition{Name: name}
+	definition.Type, err = p.parseTypeRef()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek(tokenPunctuator, "=") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue(true)
+		if err != nil {
+			return nil, err
+		}
+		definition.Default = &value
+	}
+
+	// directives on variable definitions are accepted and ignored
+	if _, err := p.parseDirectives(); err != nil {
+		return nil, err
+	}
+
+	return definition, nil
+}
+
+func (p *parser) parseTypeRef() (*TypeRef, error) {
+	var ref *TypeRef
+	if p.peek(tokenPunctuator, "[") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		elem, err := p.parseTypeRef()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenPunctuator, "]"); err != nil {
+			return nil, err
+		}
+		ref = &TypeRef{Elem: elem}
+	} else {
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		ref = &TypeRef{Name: name}
+	}
+
+	if p.peek(tokenPunctuator, "!") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		ref.NonNull = true
+	}
+
+	return ref, nil
+}
+
+func (p *parser) parseFragment() (*Fragment, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	name, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, fmt.Errorf("fragment can't be named on")
+	}
+
+	if err := p.expect(tokenName, "on"); err != nil {
+		return nil, err
+	}
+	condition, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+
+	fragment := &Fragment{Name: name, TypeCondition: condition}
+	fragment.Directives, err = p.parseDirectives()
+	if err != nil {
+		return nil, err
+	}
+
+	fragment.Selections, err = p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+
+	return fragment, nil
+}
+
+func (p *parser) parseSelectionSet() ([]Selection, error) {
+	if err := p.expect(tokenPunctuator, "{"); err != nil {
+		return nil, err
+	}
+
+	selections := []Selection{}
+	for !p.peek(tokenPunctuator, "}") {
+		if p.token.kind == tokenEOF {
+			return nil, p.unexpected()
+		}
+
+		selection, err := p.parseSelection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, selection)
+	}
+
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("selection set can't be empty at %d", p.token.pos)
+	}
+
+	return selections, p.next()
+}
+
+func (p *parser) parseSelection() (Selection, error) {
+	if p.peek(tokenPunctuator, "...") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+
+		if p.token.kind == tokenName && p.token.value != "on" {
+			spread := &FragmentSpread{Name: p.token.value}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+
+			var err error
+			spread.Directives, err = p.parseDirectives()
+			return spread, err
+		}
+
+		fragment := &InlineFragment{}
+		if p.peek(tokenName, "on") {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			condition, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+			fragment.TypeCondition = condition
+		}
+
+		var err error
+		fragment.Directives, err = p.parseDirectives()
+		if err != nil {
+			return nil, err
+		}
+
+		fragment.Selections, err = p.parseSelectionSet()
+		return fragment, err
+	}
+
+	field := &FieldNode{}
+	name, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek(tokenPunctuator, ":") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		field.Alias = name
+		name, err = p.parseName()
+		if err != nil {
+			return nil, err
+		}
+	}
+	field.Name = name
+
+	field.Arguments, err = p.parseArguments(false)
+	if err != nil {
+		return nil, err
+	}
+
+	field.Directives, err = p.parseDirectives()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek(tokenPunctuator, "{") {
+		field.Selections, err = p.parseSelectionSet()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return field, nil
+}
+
+func (p *parser) parseArguments(constant bool) ([]*Argument, error) {
+	if !p.peek(tokenPunctuator, "(") {
+		return nil, nil
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	arguments := []*Argument{}
+	for !p.peek(tokenPunctuator, ")") {
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenPunctuator, ":"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue(constant)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, &Argument{Name: name, Value: value})
+	}
+
+	return arguments, p.next()
+}
+
+func (p *parser) parseDirectives() ([]*Directive, error) {
+	directives := []*Directive{}
+	for p.peek(tokenPunctuator, "@") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		arguments, err := p.parseArguments(false)
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, &Directive{Name: name, Arguments: arguments})
+	}
+
+	return directives, nil
+}
+
+func (p *parser) parseValue(constant bool) (Value, error) {
+	current := p.token
+
+	switch current.kind {
+	case tokenPunctuator:
+		switch current.value {
+		case "$":
+			if constant {
+				return Value{}, fmt.Errorf("unexpected variable at %d", current.pos)
+			}
+			if err := p.next(); err != nil {
+				return Value{}, err
+			}
+			name, err := p.parseName()
+			return Value{Kind: VariableValue, Raw: name}, err
+		case "[":
+			if err := p.next(); err != nil {
+				return Value{}, err
+			}
+			list := Value{Kind: ListValue, List: []Value{}}
+			for !p.peek(tokenPunctuator, "]") {
+				if p.token.kind == tokenEOF {
+					return Value{}, p.unexpected()
+				}
+				item, err := p.parseValue(constant)
+				if err != nil {
+					return Value{}, err
+				}
+				list.List = append(list.List, item)
+			}
+			return list, p.next()
+		case "{":
+			if err := p.next(); err != nil {
+				return Value{}, err
+			}
+			object := Value{Kind: ObjectValue, Fields: []ObjectField{}}
+			for !p.peek(tokenPunctuator, "}") {
+				name, err := p.parseName()
+				if err != nil {
+					return Value{}, err
+				}
+				if err := p.expect(tokenPunctuator, ":"); err != nil {
+					return Value{}, err
+				}
+				value, err := p.parseValue(constant)
+				if err != nil {
+					return Value{}, err
+				}
+				object.Fields = append(object.Fields, ObjectField{Name: name, Value: value})
+			}
+			return object, p.next()
+		}
+	case tokenInt:
+		return Value{Kind: IntValue, Raw: current.value}, p.next()
+	case tokenFloat:
+		return Value{Kind: FloatValue, Raw: current.value}, p.next()
+	case tokenString:
+		return Value{Kind: StringValue, Raw: current.value}, p.next()
+	case tokenName:
+		switch current.value {
+		case "true", "false":
+			return Value{Kind: BooleanValue, Raw: current.value}, p.next()
+		case "null":
+			return Value{Kind: NullValue}, p.next()
+		default:
+			return Value{Kind: EnumValue, Raw: current.value}, p.next()
+		}
+	}
+
+	return Value{}, p.unexpected()
+}
+
+func (p *parser) parseName() (string, error) {
+	if p.token.kind != tokenName {
+		return "", p.unexpected()
+	}
+
+	name := p.token.value
+	return name, p.next()
+}
+
+func (p *parser) peek(kind tokenKind, value string) bool {
+	return p.token.kind == kind && p.token.value == value
+}
+
+func (p *parser) expect(kind tokenKind, value string) error {
+	if !p.peek(kind, value) {
+		return p.unexpected()
+	}
+
+	return p.next()
+}
+
+func (p *parser) unexpected() error {
+	if p.token.kind == tokenEOF {
+		return fmt.Errorf("syntax error: unexpected end of document")
+	}
+
+	return fmt.Errorf("syntax error: unexpected %q at %d", p.token.value, p.token.pos)
+}
+
+// next
+//
+// Move to the next token, commas, white spaces and comments are ignored
+func (p *parser) next() error {
+	for p.pos < len(p.source) {
+		char := p.source[p.pos]
+		if char == ' ' || char == '\t' || char == '\n' || char == '\r' || char == ',' {
+			p.pos++
+			continue
+		}
+		if strings.HasPrefix(p.source[p.pos:], "\ufeff") {
+			p.pos += len("\ufeff")
+			continue
+		}
+		if char == '#' {
+			for p.pos < len(p.source) && p.source[p.pos] != '\n' && p.source[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		break
+	}
+
+	start := p.pos
+	if p.pos >= len(p.source) {
+		p.token = token{kind: tokenEOF, pos: start}
+		return nil
+	}
+
+	char := p.source[p.pos]
+	switch {
+	case strings.HasPrefix(p.source[p.pos:], "..."):
+		p.pos += 3
+		p.token = token{kind: tokenPunctuator, value: "...", pos: start}
+	case strings.IndexByte("!$()&:=@[]{}|", char) >= 0:
+		p.pos++
+		p.token = token{kind: tokenPunctuator, value: string(char), pos: start}
+	case char == '_' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z':
+		for p.pos < len(p.source) && isNameChar(p.source[p.pos]) {
+			p.pos++
+		}
+		p.token = token{kind: tokenName, value: p.source[start:p.pos], pos: start}
+	case char == '-' || char >= '0' && char <= '9':
+		return p.readNumber()
+	case char == '"':
+		if strings.HasPrefix(p.source[p.pos:], `"""`) {
+			return p.readBlockString()
+		}
+		return p.readString()
+	default:
+		return fmt.Errorf("syntax error: unexpected character %q at %d", char, start)
+	}
+
+	return nil
+}
+
+func isNameChar(char byte) bool {
+	return char == '_' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9'
+}
+
+func (p *parser) readNumber() error {
+	start := p.pos
+	digits := func() int {
+		from := p.pos
+		for p.pos < len(p.source) && p.source[p.pos] >= '0' && p.source[p.pos] <= '9' {
+			p.pos++
+		}
+		return p.pos - from
+	}
+
+	if p.source[p.pos] == '-' {
+		p.pos++
+	}
+	if digits() == 0 {
+		return fmt.Errorf("syntax error: invalid number at %d", start)
+	}
+
+	kind := tokenInt
+	if p.pos < len(p.source) && p.source[p.pos] == '.' {
+		p.pos++
+		kind = tokenFloat
+		if digits() == 0 {
+			return fmt.Errorf("syntax error: invalid number at %d", start)
+		}
+	}
+	if p.pos < len(p.source) && (p.source[p.pos] == 'e' || p.source[p.pos] == 'E') {
+		p.pos++
+		kind = tokenFloat
+		if p.pos < len(p.source) && (p.source[p.pos] == '+' || p.source[p.pos] == '-') {
+			p.pos++
+		}
+		if digits() == 0 {
+			return fmt.Errorf("syntax error: invalid number at %d", start)
+		}
+	}
+	if p.pos < len(p.source) && (isNameChar(p.source[p.pos]) || p.source[p.pos] == '.') {
+		return fmt.Errorf("syntax error: invalid number at %d", start)
+	}
+
+	p.token = token{kind: kind, value: p.source[start:p.pos], pos: start}
+	return nil
+}
+
+func (p *parser) readString() error {
+	start := p.pos
+	p.pos++
+
+	var value strings.Builder
+	for {
+		if p.pos >= len(p.source) || p.source[p.pos] == '\n' || p.source[p.pos] == '\r' {
+			return fmt.Errorf("syntax error: unterminated string at %d", start)
+		}
+
+		char := p.source[p.pos]
+		if char == '"' {
+			p.pos++
+			break
+		}
+
+		if char != '\\' {
+			r, size := utf8.DecodeRuneInString(p.source[p.pos:])
+			value.WriteRune(r)
+			p.pos += size
+			continue
+		}
+
+		if p.pos+1 >= len(p.source) {
+			return fmt.Errorf("syntax error: unterminated string at %d", start)
+		}
+		escape := p.source[p.pos+1]
+		p.pos += 2
+		switch escape {
+		case '"', '\\', '/':
+			value.WriteByte(escape)
+		case 'b':
+			value.WriteByte('\b')
+		case 'f':
+			value.WriteByte('\f')
+		case 'n':
+			value.WriteByte('\n')
+		case 'r':
+			value.WriteByte('\r')
+		case 't':
+			value.WriteByte('\t')
+		case 'u':
+			if p.pos+4 > len(p.source) {
+				return fmt.Errorf("syntax error: invalid unicode escape at %d", p.pos)
+			}
+			code, err := strconv.ParseUint(p.source[p.pos:p.pos+4], 16, 32)
+			if err != nil {
+				return fmt.Errorf("syntax error: invalid unicode escape at %d", p.pos)
+			}
+			value.WriteRune(rune(code))
+			p.pos += 4
+		default:
+			return fmt.Errorf("syntax error: invalid escape \\%c at %d", escape, p.pos-2)
+		}
+	}
+
+	p.token = token{kind: tokenString, value: value.String(), pos: start}
+	return nil
+}
+
+// readBlockString
+//
+// Triple quoted string, the common indentation and the blank first and last lines are removed
+func (p *parser) readBlockString() error {
+	start := p.pos
+	p.pos += 3
+
+	end := strings.Index(strings.ReplaceAll(p.source[p.pos:], `\"""`, "xxxx"), `"""`)
+	if end < 0 {
+		return fmt.Errorf("syntax error: unterminated string at %d", start)
+	}
+	raw := strings.ReplaceAll(p.source[p.pos:p.pos+end], `\"""`, `"""`)
+	p.pos += end + 3
+
+	lines := strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if size := len(line) - len(trimmed); indent < 0 || size < indent {
+			indent = size
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= indent {
+				lines[i] = lines[i][indent:]
+			} else {
+				lines[i] = strings.TrimLeft(lines[i], " \t")
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	p.token = token{kind: tokenString, value: strings.Join(lines, "\n"), pos: start}
+	return nil
+}
@@ -0,0 +1,502 @@
+package pkg_graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Type
+//
+// Named type or one of the List and NonNull wrappers
+type Type interface {
+	String() string
+}
+
+// Named
+//
+// Type declared in the schema and listed by introspection
+type Named interface {
+	Type
+	TypeName() string
+	TypeDescription() string
+}
+
+type Scalar struct {
+	Name        string
+	Description string
+	// output value of the scalar
+	Serialize func(value interface{}) (interface{}, error)
+	// input value coming from the json variables
+	ParseValue func(value interface{}) (interface{}, error)
+	// input value written in the query
+	ParseLiteral func(value Value) (interface{}, error)
+}
+
+type Enum struct {
+	Name        string
+	Description string
+	Values      []string
+}
+
+type Object struct {
+	Name        string
+	Description string
+	Fields      []*Field
+}
+
+type InputObject struct {
+	Name        string
+	Description string
+	Fields      []*InputValue
+}
+
+type List struct {
+	Of Type
+}
+
+type NonNull struct {
+	Of Type
+}
+
+type ResolveParams struct {
+	Context context.Context
+	Source  interface{}
+	Args    map[string]interface{}
+	Field   *FieldNode
+}
+
+// BatchParams
+//
+// Every non null source of a field on the same level, the resolver returns one value per source
+type BatchParams struct {
+	Context context.Context
+	Sources []interface{}
+	Args    map[string]interface{}
+	Field   *FieldNode
+}
+
+type Field struct {
+	Name        string
+	Description string
+	Type        Type
+	Args        []*InputValue
+	// resolve the field for a single source, a map source is read by field name when nil
+	Resolve func(p ResolveParams) (interface{}, error)
+	// resolve the field for every source of a level at once, takes over Resolve
+	Batch func(p BatchParams) ([]interface{}, error)
+}
+
+// InputValue
+//
+// Argument of a field or field of an input object
+type InputValue struct {
+	Name        string
+	Description string
+	Type        Type
+	Default     interface{}
+}
+
+func (t *Scalar) String() string          { return t.Name }
+func (t *Scalar) TypeName() string        { return t.Name }
+func (t *Scalar) TypeDescription() string { return t.Description }
+
+func (t *Enum) String() string          { return t.Name }
+func (t *Enum) TypeName() string        { return t.Name }
+func (t *Enum) TypeDescription() string { return t.Description }
+
+func (t *Object) String() string          { return t.Name }
+func (t *Object) TypeName() string        { return t.Name }
+func (t *Object) TypeDescription() string { return t.Description }
+
+func (t *InputObject) String() string          { return t.Name }
+func (t *InputObject) TypeName() string        { return t.Name }
+func (t *InputObject) TypeDescription() string { return t.Description }
+
+func (t *List) String() string    { return "[" + t.Of.String() + "]" }
+func (t *NonNull) String() string { return t.Of.String() + "!" }
+
+func (t *Object) Field(name string) *Field {
+	for _, field := range t.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+
+	return nil
+}
+
+func (t *InputObject) Field(name string) *InputValue {
+	for _, field := range t.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+
+	return nil
+}
+
+func (t *Enum) Has(value string) bool {
+	for _, v := range t.Values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// namedType
+//
+// Named type under the List and NonNull wrappers
+func namedType(t Type) Named {
+	for {
+		switch wrapper := t.(type) {
+		case *List:
+			t = wrapper.Of
+		case *NonNull:
+			t = wrapper.Of
+		default:
+			return t.(Named)
+		}
+	}
+}
+
+var nameRegex = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// ValidName
+//
+// Names of types, fields and arguments, names starting with __ are reserved to introspection
+func ValidName(name string) bool {
+	return nameRegex.MatchString(name) && !(len(name) > 1 && name[:2] == "__")
+}
+
+type Schema struct {
+	Query    *Object
+	Mutation *Object
+	types    map[string]Named
+	order    []string
+}
+
+// NewSchema
+//
+// Collect every type reachable from the root types, type names must be unique
+func NewSchema(query *Object, mutation *Object) (*Schema, error) {
+	schema := &Schema{
+		Query:    query,
+		Mutation: mutation,
+		types:    map[string]Named{},
+	}
+
+	roots := []Type{query, String, Boolean, introspectionSchema}
+	if mutation != nil {
+		roots = append(roots, mutation)
+	}
+
+	for _, root := range roots {
+		if err := schema.collect(root); err != nil {
+			return nil, err
+		}
+	}
+
+	return schema, nil
+}
+
+func (s *Schema) collect(t Type) error {
+	named := namedType(t)
+	if existing, ok := s.types[named.TypeName()]; ok {
+		if existing != named {
+			return fmt.Errorf("type %s is defined more than once", named.TypeName())
+		}
+		return nil
+	}
+
+	if !nameRegex.MatchString(named.TypeName()) {
+		return fmt.Errorf("invalid type name %s", named.TypeName())
+	}
+	s.types[named.TypeName()] = named
+	s.order = append(s.order, named.TypeName())
+
+	switch named := named.(type) {
+	case *Object:
+		for _, field := range named.Fields {
+			if !nameRegex.MatchString(field.Name) {
+				return fmt.Errorf("invalid field name %s.%s", named.Name, field.Name)
+			}
+			if err := s.collect(field.Type); err != nil {
+				return err
+			}
+			for _, arg := range field.Args {
+				if err := s.collect(arg.Type); err != nil {
+					return err
+				}
+			}
+		}
+	case *InputObject:
+		for _, field := range named.Fields {
+			if !nameRegex.MatchString(field.Name) {
+				return fmt.Errorf("invalid field name %s.%s", named.Name, field.Name)
+			}
+			if err := s.collect(field.Type); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) Type(name string) Named {
+	return s.types[name]
+}
+
+// Types
+//
+// Every type of the schema in discovery order
+func (s *Schema) Types() []Named {
+	types := make([]Named, 0, len(s.order))
+	for _, name := range s.order {
+		types = append(types, s.types[name])
+	}
+
+	return types
+}
+
+var Int = &Scalar{
+	Name:        "Int",
+	Description: "Signed integer",
+	Serialize: func(value interface{}) (interface{}, error) {
+		return toInt(value)
+	},
+	ParseValue: func(value interface{}) (interface{}, error) {
+		if _, ok := value.(string); ok {
+			return nil, fmt.Errorf("Int cannot represent a string value")
+		}
+		return toInt(value)
+	},
+	ParseLiteral: func(value Value) (interface{}, error) {
+		if value.Kind != IntValue {
+			return nil, fmt.Errorf("Int cannot represent %s", value.Raw)
+		}
+		return strconv.ParseInt(value.Raw, 10, 64)
+	},
+}
+
+var Float = &Scalar{
+	Name:        "Float",
+	Description: "Double precision floating point number",
+	Serialize: func(value interface{}) (interface{}, error) {
+		return toFloat(value)
+	},
+	ParseValue: func(value interface{}) (interface{}, error) {
+		if _, ok := value.(string); ok {
+			return nil, fmt.Errorf("Float cannot represent a string value")
+		}
+		return toFloat(value)
+	},
+	ParseLiteral: func(value Value) (interface{}, error) {
+		if value.Kind != IntValue && value.Kind != FloatValue {
+			return nil, fmt.Errorf("Float cannot represent %s", value.Raw)
+		}
+		return strconv.ParseFloat(value.Raw, 64)
+	},
+}
+
+var String = &Scalar{
+	Name:        "String",
+	Description: "UTF-8 text",
+	Serialize: func(value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case []byte:
+			return string(v), nil
+		case time.Time:
+			return v.Format(time.RFC3339Nano), nil
+		default:
+			return fmt.Sprintf("%v", v), nil
+		}
+	},
+	ParseValue: func(value interface{}) (interface{}, error) {
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("String cannot represent a non string value")
+	},
+	ParseLiteral: func(value Value) (interface{}, error) {
+		if value.Kind != StringValue {
+			return nil, fmt.Errorf("String cannot represent %s", value.Raw)
+		}
+		return value.Raw, nil
+	},
+}
+
+var Boolean = &Scalar{
+	Name:        "Boolean",
+	Description: "true or false",
+	Serialize: func(value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			return v != 0, nil
+		case int:
+			return v != 0, nil
+		case float64:
+			return v != 0, nil
+		}
+		return nil, fmt.Errorf("Boolean cannot represent %v", value)
+	},
+	ParseValue: func(value interface{}) (interface{}, error) {
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("Boolean cannot represent a non boolean value")
+	},
+	ParseLiteral: func(value Value) (interface{}, error) {
+		if value.Kind != BooleanValue {
+			return nil, fmt.Errorf("Boolean cannot represent %s", value.Raw)
+		}
+		return value.Raw == "true", nil
+	},
+}
+
+var ID = &Scalar{
+	Name:        "ID",
+	Description: "Unique identifier, serialized as a string",
+	Serialize: func(value interface{}) (interface{}, error) {
+		return fmt.Sprintf("%v", value), nil
+	},
+	ParseValue: func(value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64, json.Number, int, int64:
+			number, err := toInt(v)
+			if err != nil {
+				return nil, err
+			}
+			return strconv.FormatInt(number, 10), nil
+		}
+		return nil, fmt.Errorf("ID cannot represent %v", value)
+	},
+	ParseLiteral: func(value Value) (interface{}, error) {
+		if value.Kind != StringValue && value.Kind != IntValue {
+			return nil, fmt.Errorf("ID cannot represent %s", value.Raw)
+		}
+		return value.Raw, nil
+	},
+}
+
+// JSON
+//
+// Any json value, used for values without a known type
+var JSON = &Scalar{
+	Name:        "JSON",
+	Description: "Any JSON value",
+	Serialize: func(value interface{}) (interface{}, error) {
+		if v, ok := value.([]byte); ok {
+			return string(v), nil
+		}
+		return value, nil
+	},
+	ParseValue: func(value interface{}) (interface{}, error) {
+		return value, nil
+	},
+	ParseLiteral: func(value Value) (interface{}, error) {
+		return literalJSON(value)
+	},
+}
+
+func literalJSON(value Value) (interface{}, error) {
+	switch value.Kind {
+	case IntValue:
+		return strconv.ParseInt(value.Raw, 10, 64)
+	case FloatValue:
+		return strconv.ParseFloat(value.Raw, 64)
+	case StringValue, EnumValue:
+		return value.Raw, nil
+	case BooleanValue:
+		return value.Raw == "true", nil
+	case ListValue:
+		list := []interface{}{}
+		for _, item := range value.List {
+			v, err := literalJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case ObjectValue:
+		object := map[string]interface{}{}
+		for _, field := range value.Fields {
+			v, err := literalJSON(field.Value)
+			if err != nil {
+				return nil, err
+			}
+			object[field.Name] = v
+		}
+		return object, nil
+	}
+
+	return nil, nil
+}
+
+func toInt(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("Int cannot represent non integer value %v", v)
+		}
+		return int64(v), nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case json.Number:
+		return v.Int64()
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	}
+
+	return 0, fmt.Errorf("Int cannot represent %v", value)
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(v, 64)
+	case []byte:
+		return strconv.ParseFloat(string(v), 64)
+	}
+
+	return 0, fmt.Errorf("Float cannot represent %v", value)
+}
@@ -0,0 +1,183 @@
+package pkg_graphql
+
+import (
+	"fmt"
+)
+
+type validator struct {
+	schema    *Schema
+	document  *Document
+	variables map[string]bool
+	errors    []Error
+	// fragments being validated, a fragment spreading itself would never end
+	visiting map[string]bool
+}
+
+// validate
+//
+// Check the operation against the schema before anything is resolved: fields and arguments
+// must exist, leaf fields have no selection and object fields need one
+func validate(schema *Schema, document *Document, operation *Operation, root *Object) []Error {
+	v := &validator{
+		schema:    schema,
+		document:  document,
+		variables: map[string]bool{},
+		visiting:  map[string]bool{},
+	}
+
+	for _, definition := range operation.Variables {
+		if v.variables[definition.Name] {
+			v.fail("there can be only one variable named $%s", definition.Name)
+		}
+		v.variables[definition.Name] = true
+
+		if _, err := typeFromRef(schema, definition.Type); err != nil {
+			v.fail("variable $%s: %s", definition.Name, err.Error())
+		}
+	}
+
+	v.directives(operation.Directives)
+	v.selections(root, operation.Selections)
+
+	return v.errors
+}
+
+func (v *validator) fail(format string, args ...interface{}) {
+	v.errors = append(v.errors, Error{Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) selections(t *Object, selections []Selection) {
+	for _, selection := range selections {
+		switch selection := selection.(type) {
+		case *FieldNode:
+			v.field(t, selection)
+		case *InlineFragment:
+			v.directives(selection.Directives)
+			if selection.TypeCondition != "" && selection.TypeCondition != t.Name {
+				v.fail("fragment on %s can't be spread inside %s", selection.TypeCondition, t.Name)
+				continue
+			}
+			v.selections(t, selection.Selections)
+		case *FragmentSpread:
+			v.directives(selection.Directives)
+			fragment := v.document.Fragments[selection.Name]
+			if fragment == nil {
+				v.fail("unknown fragment %s", selection.Name)
+				continue
+			}
+			if fragment.TypeCondition != t.Name {
+				if v.schema.Type(fragment.TypeCondition) == nil {
+					v.fail("unknown type %s of fragment %s", fragment.TypeCondition, fragment.Name)
+				} else {
+					v.fail("fragment %s on %s can't be spread inside %s", fragment.Name, fragment.TypeCondition, t.Name)
+				}
+				continue
+			}
+			if v.visiting[fragment.Name] {
+				v.fail("fragment %s spreads itself", fragment.Name)
+				continue
+			}
+			v.visiting[fragment.Name] = true
+			v.directives(fragment.Directives)
+			v.selections(t, fragment.Selections)
+			delete(v.visiting, fragment.Name)
+		}
+	}
+}
+
+func (v *validator) field(t *Object, node *FieldNode) {
+	v.directives(node.Directives)
+
+	if node.Name == "__typename" {
+		if len(node.Selections) > 0 {
+			v.fail("field __typename of type String must not have a selection")
+		}
+		return
+	}
+
+	var field *Field
+	if t == v.schema.Query && node.Name == "__schema" {
+		field = schemaMetaField
+	} else if t == v.schema.Query && node.Name == "__type" {
+		field = typeMetaField
+	} else {
+		field = t.Field(node.Name)
+	}
+	if field == nil {
+		v.fail("cannot query field %s on type %s", node.Name, t.Name)
+		return
+	}
+
+	v.arguments(fmt.Sprintf("%s.%s", t.Name, field.Name), field.Args, node.Arguments)
+
+	switch named := namedType(field.Type).(type) {
+	case *Object:
+		if len(node.Selections) == 0 {
+			v.fail("field %s of type %s must have a selection of subfields", node.Name, field.Type.String())
+			return
+		}
+		v.selections(named, node.Selections)
+	default:
+		if len(node.Selections) > 0 {
+			v.fail("field %s of type %s must not have a selection", node.Name, field.Type.String())
+		}
+	}
+}
+
+func (v *validator) arguments(owner string, definitions []*InputValue, arguments []*Argument) {
+	seen := map[string]bool{}
+	for _, argument := range arguments {
+		if seen[argument.Name] {
+			v.fail("there can be only one argument named %s on %s", argument.Name, owner)
+		}
+		seen[argument.Name] = true
+
+		found := false
+		for _, definition := range definitions {
+			if definition.Name == argument.Name {
+				found = true
+			}
+		}
+		if !found {
+			v.fail("unknown argument %s on %s", argument.Name, owner)
+		}
+		v.value(argument.Value)
+	}
+
+	for _, definition := range definitions {
+		if _, ok := definition.Type.(*NonNull); ok && definition.Default == nil && !seen[definition.Name] {
+			v.fail("argument %s of type %s is required on %s", definition.Name, definition.Type.String(), owner)
+		}
+	}
+}
+
+// value
+//
+// Variables used in a value must be defined by the operation
+func (v *validator) value(value Value) {
+	switch value.Kind {
+	case VariableValue:
+		if !v.variables[value.Raw] {
+			v.fail("variable $%s is not defined", value.Raw)
+		}
+	case ListValue:
+		for _, item := range value.List {
+			v.value(item)
+		}
+	case ObjectValue:
+		for _, field := range value.Fields {
+			v.value(field.Value)
+		}
+	}
+}
+
+func (v *validator) directives(directives []*Directive) {
+	for _, directive := range directives {
+		switch directive.Name {
+		case "skip", "include":
+			v.arguments("@"+directive.Name, []*InputValue{{Name: "if", Type: &NonNull{Of: Boolean}}}, directive.Arguments)
+		default:
+			v.fail("unknown directive @%s", directive.Name)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package pkg_id
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UUIDv7
+//
+// Time ordered uuid, sorting the ids sorts the rows by creation
+func UUIDv7() (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+
+	return id.String(), nil
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var ulidMutex sync.Mutex
+var lastULIDTime uint64
+var lastULIDEntropy [10]byte
+
+// ULID
+//
+// 48 bits of milliseconds followed by 80 random bits, written as 26 crockford base32
+// characters. Ids of the same millisecond increment the random part so they stay ordered
+func ULID() (string, error) {
+	ulidMutex.Lock()
+	defer ulidMutex.Unlock()
+
+	now := uint64(time.Now().UnixMilli())
+	if now <= lastULIDTime {
+		now = lastULIDTime
+		for i := len(lastULIDEntropy) - 1; i >= 0; i-- {
+			lastULIDEntropy[i]++
+			if lastULIDEntropy[i] != 0 {
+				break
+			}
+		}
+	} else {
+		_, err := rand.Read(lastULIDEntropy[:])
+		if err != nil {
+			return "", err
+		}
+	}
+	lastULIDTime = now
+
+	var raw [16]byte
+	var timestamp [8]byte
+	binary.BigEndian.PutUint64(timestamp[:], now)
+	copy(raw[:6], timestamp[2:])
+	copy(raw[6:], lastULIDEntropy[:])
+
+	// 128 bits are read 5 bits at a time, the first character only holds 3 bits
+	encoded := make([]byte, 26)
+	high := binary.BigEndian.Uint64(raw[:8])
+	low := binary.BigEndian.Uint64(raw[8:])
+	for i := 25; i >= 0; i-- {
+		encoded[i] = crockford[low&31]
+		low = low>>5 | high<<59
+		high >>= 5
+	}
+
+	return string(encoded), nil
+}
+
+const nanoidAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz_-"
+
+const NANOID_LENGTH = 21
+
+// NanoID
+//
+// Random url safe id of 21 characters, 126 bits of randomness
+func NanoID(prefix string) (string, error) {
+	bytes := make([]byte, NANOID_LENGTH)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", err
+	}
+
+	id := make([]byte, NANOID_LENGTH)
+	for i, b := range bytes {
+		id[i] = nanoidAlphabet[b&63]
+	}
+
+	return prefix + string(id), nil
+}
@@ -36,7 +36,8 @@ func NewSQLiteClient(dbPath string, options ...SQLiteOption) (*gorm.DB, error) {
 		option = options[0]
 	}
 
-	conn, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+	// foreign keys has to be enabled per connection, so it is set through the dsn
+	conn, err = gorm.Open(sqlite.Open(dbPath+"?_foreign_keys=on"), &gorm.Config{
 		Logger: logger.Default.LogMode(option.LogMode),
 		NamingStrategy: schema.NamingStrategy{
 			SingularTable: true,
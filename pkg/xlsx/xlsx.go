@@ -0,0 +1,160 @@
+package pkg_xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writer
+//
+// Minimal xlsx writer with a single sheet. Rows are written to the zip as they come, cells
+// use inline strings so that nothing has to be kept in memory
+type Writer struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	row   int
+}
+
+var staticParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`},
+}
+
+func NewWriter(w io.Writer, sheetName string) (*Writer, error) {
+	writer := &Writer{zip: zip.NewWriter(w)}
+
+	for _, part := range staticParts {
+		err := writer.writePart(part.name, part.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := writer.writePart("xl/workbook.xml", fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`, escape(sheetName)))
+	if err != nil {
+		return nil, err
+	}
+
+	writer.sheet, err = writer.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.WriteString(writer.sheet, `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+func (w *Writer) writePart(name string, content string) error {
+	part, err := w.zip.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(part, content)
+	return err
+}
+
+// WriteRow
+//
+// Numbers and booleans are stored as such, every other value as text
+func (w *Writer) WriteRow(values []interface{}) error {
+	w.row++
+
+	_, err := fmt.Fprintf(w.sheet, `<row r="%d">`, w.row)
+	if err != nil {
+		return err
+	}
+
+	for i, value := range values {
+		ref := columnName(i) + strconv.Itoa(w.row)
+
+		var cell string
+		switch v := value.(type) {
+		case nil:
+			continue
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			cell = fmt.Sprintf(`<c r="%s"><v>%d</v></c>`, ref, v)
+		case float32, float64:
+			cell = fmt.Sprintf(`<c r="%s"><v>%v</v></c>`, ref, v)
+		case bool:
+			boolean := 0
+			if v {
+				boolean = 1
+			}
+			cell = fmt.Sprintf(`<c r="%s" t="b"><v>%d</v></c>`, ref, boolean)
+		case time.Time:
+			cell = fmt.Sprintf(`<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, v.Format(time.RFC3339))
+		default:
+			cell = fmt.Sprintf(`<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escape(fmt.Sprintf("%v", v)))
+		}
+
+		_, err = io.WriteString(w.sheet, cell)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(w.sheet, `</row>`)
+	return err
+}
+
+// Close
+//
+// Terminate the sheet and the zip, the underlying writer is left open
+func (w *Writer) Close() error {
+	_, err := io.WriteString(w.sheet, `</sheetData></worksheet>`)
+	if err != nil {
+		return err
+	}
+
+	return w.zip.Close()
+}
+
+// columnName
+//
+// Spreadsheet column of a zero based index, 0 is A and 26 is AA
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+
+	return name
+}
+
+func escape(value string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(value))
+
+	return escaped.String()
+}
@@ -22,17 +22,23 @@ func (s *BaseService) WithService() *Service {
 }
 
 type Service struct {
-	DB      DBService
-	Table   TableService
-	Storage StorageService
-	Backup  BackupService
+	DB       DBService
+	Table    TableService
+	Storage  StorageService
+	Backup   BackupService
+	Schema   SchemaService
+	Realtime RealtimeService
+	Rule     RuleService
 }
 
 func NewService(ioc di.Container) *Service {
 	return &Service{
-		DB:      NewDBService(ioc),
-		Table:   NewTableService(ioc),
-		Storage: NewStorageService(ioc),
-		Backup:  NewBackupService(ioc),
+		DB:       NewDBService(ioc),
+		Table:    NewTableService(ioc),
+		Storage:  NewStorageService(ioc),
+		Backup:   NewBackupService(ioc),
+		Schema:   NewSchemaService(ioc),
+		Realtime: NewRealtimeService(ioc),
+		Rule:     NewRuleService(ioc),
 	}
 }
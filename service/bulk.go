@@ -0,0 +1,216 @@
+package service
+
+import (
+	"errors"
+	"funcbase/model"
+
+	"gorm.io/gorm"
+)
+
+var ErrTooManyRows = errors.New("the filter matches more rows than max_affected")
+
+// BulkParams
+//
+// Rows reached by a bulk update or delete
+type BulkParams struct {
+	Table  string
+	Filter string
+	// condition the rows must also match, e.g. the access rule of the requesting user. It is
+	// kept in its own group next to the filter so that the filter can't widen it
+	Condition     string
+	ConditionArgs []interface{}
+	// nothing is written when more rows match
+	MaxAffected int64
+	// only count the matching rows
+	DryRun bool
+}
+
+// bulkQuery
+//
+// Rows matching the filter and the condition, in one query that is used for the count as well
+// as for the write
+func (s *DBServiceImpl) bulkQuery(db *gorm.DB, params *BulkParams) (*gorm.DB, error) {
+	condition, err := s.softDeleteCondition(params.Table, false)
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Table(params.Table)
+	if condition != "" {
+		query = query.Where(condition)
+	}
+	if params.Filter != "" {
+		query, err = s.applyFilter(db, query, params.Table, params.Filter)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if params.Condition != "" {
+		query = query.Where(params.Condition, params.ConditionArgs...)
+	}
+
+	return query, nil
+}
+
+// bulkTargets
+//
+// Number of rows matching the filter and the condition, with their ids when they are to be
+// written. ErrTooManyRows is returned when there are more than MaxAffected, before any id is read
+func (s *DBServiceImpl) bulkTargets(db *gorm.DB, params *BulkParams) ([]interface{}, int64, error) {
+	query, err := s.bulkQuery(db, params)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var count int64
+	err = query.Count(&count).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	if params.MaxAffected > 0 && count > params.MaxAffected {
+		return nil, count, ErrTooManyRows
+	}
+	if params.DryRun || count == 0 {
+		return nil, count, nil
+	}
+
+	query, err = s.bulkQuery(db, params)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// kept for the change log and the relations of each row
+	var ids []interface{}
+	err = query.Pluck("id", &ids).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return ids, count, nil
+}
+
+// BulkUpdate
+//
+// Apply the same change to every matching row in one statement, returns the number of rows
+// reached. Multiple relations are replaced on each row
+func (s *DBServiceImpl) BulkUpdate(db *gorm.DB, params *BulkParams, data map[string]interface{}) (int64, error) {
+	if _, ok := data["id"]; ok {
+		return 0, errors.New("id can't be changed by a bulk update")
+	}
+
+	table, err := s.service.WithService().Table.Info(params.Table, TABLE_INFO_VERSIONED)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.checkWrite(db, params.Table, data, false)
+	if err != nil {
+		return 0, err
+	}
+	if table.Versioned {
+		// the version of each row is incremented by the update trigger
+		delete(data, "version")
+	}
+
+	links, err := s.splitRelations(params.Table, data)
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		ids, count, err := s.bulkTargets(tx, params)
+		affected = count
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		before, err := s.beforeChange(tx, params.Table, ids)
+		if err != nil {
+			return err
+		}
+
+		if len(data) > 0 {
+			query, err := s.bulkQuery(tx, params)
+			if err != nil {
+				return err
+			}
+			err = query.Updates(&data).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, id := range ids {
+			err = s.writeRelations(tx, id, links)
+			if err != nil {
+				return err
+			}
+		}
+
+		return s.onChange(tx, params.Table, model.HISTORY_UPDATE, ids, before)
+	})
+
+	if !params.DryRun {
+		s.clearCount(params.Table)
+	}
+
+	return affected, err
+}
+
+// BulkDelete
+//
+// Delete every matching row in one statement, returns the number of rows reached. Rows of a
+// soft delete table are moved to the trash
+func (s *DBServiceImpl) BulkDelete(db *gorm.DB, params *BulkParams) (int64, error) {
+	table, err := s.service.WithService().Table.Info(params.Table, TABLE_INFO_SOFT_DELETE)
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		ids, count, err := s.bulkTargets(tx, params)
+		affected = count
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		before, err := s.beforeChange(tx, params.Table, ids)
+		if err != nil {
+			return err
+		}
+
+		query, err := s.bulkQuery(tx, params)
+		if err != nil {
+			return err
+		}
+
+		var cascaded []cascadeChange
+		if table.SoftDelete {
+			err = query.Update("deleted_at", gorm.Expr("CURRENT_TIMESTAMP")).Error
+		} else {
+			cascaded, err = s.cascades(tx, params.Table, ids)
+			if err != nil {
+				return err
+			}
+			err = query.Delete(nil).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		err = s.onChange(tx, params.Table, model.HISTORY_DELETE, ids, before)
+		if err != nil {
+			return err
+		}
+
+		return s.logCascades(tx, cascaded)
+	})
+
+	if !params.DryRun {
+		s.clearCount(params.Table)
+	}
+
+	return affected, err
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"errors"
+	"funcbase/model"
+	"testing"
+)
+
+func TestBulkUpdate(t *testing.T) {
+	svc, db := newTestService(t)
+	createTables(t, svc, db, model.CreateTable{Name: "notes", Fields: []model.Field{
+		{Type: "text", Name: "body"},
+		{Type: "number", Name: "score"},
+	}})
+	for score := 1; score <= 5; score++ {
+		insertRows(t, svc, db, "notes", map[string]interface{}{"body": "a", "score": score})
+	}
+
+	bodies := func() map[string]int64 {
+		t.Helper()
+		var rows []struct {
+			Body  string
+			Count int64
+		}
+		err := db.Table("notes").Select("body, COUNT(*) AS count").Group("body").Scan(&rows).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts := map[string]int64{}
+		for _, row := range rows {
+			counts[row.Body] = row.Count
+		}
+		return counts
+	}
+
+	affected, err := svc.DB.BulkUpdate(db, &BulkParams{Table: "notes", Filter: "score > 1", MaxAffected: 3}, map[string]interface{}{"body": "b"})
+	if !errors.Is(err, ErrTooManyRows) || affected != 4 {
+		t.Errorf("over max_affected: affected %d, error %v", affected, err)
+	}
+
+	affected, err = svc.DB.BulkUpdate(db, &BulkParams{Table: "notes", Filter: "score > 1", DryRun: true}, map[string]interface{}{"body": "b"})
+	if err != nil || affected != 4 {
+		t.Errorf("dry run: affected %d, error %v", affected, err)
+	}
+	if got := bodies(); got["a"] != 5 {
+		t.Fatalf("rows written without a write: %v", got)
+	}
+
+	// the condition holds however wide the filter is
+	affected, err = svc.DB.BulkUpdate(db, &BulkParams{
+		Table:         "notes",
+		Filter:        "score > 1 OR score <= 1",
+		Condition:     "score < ?",
+		ConditionArgs: []interface{}{3},
+		MaxAffected:   2,
+	}, map[string]interface{}{"body": "b"})
+	if err != nil || affected != 2 {
+		t.Errorf("update: affected %d, error %v", affected, err)
+	}
+	if got := bodies(); got["a"] != 3 || got["b"] != 2 {
+		t.Errorf("rows after the update: %v", got)
+	}
+
+	page, err := svc.DB.Changes(db, &ChangesParams{Since: 5, Limit: 10, Scopes: []ChangeScope{{Table: "notes"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := changeList(page.Changes); !equalList(got, []string{"notes update 1", "notes update 2"}) {
+		t.Errorf("changes %v", got)
+	}
+}
+
+func TestBulkDelete(t *testing.T) {
+	svc, db := newTestService(t)
+	createTables(t, svc, db,
+		model.CreateTable{Name: "notes", Fields: []model.Field{{Type: "number", Name: "score"}}},
+		model.CreateTable{Name: "drafts", SoftDelete: true, Fields: []model.Field{{Type: "number", Name: "score"}}},
+	)
+
+	for _, table := range []string{"notes", "drafts"} {
+		t.Run(table, func(t *testing.T) {
+			for score := 1; score <= 4; score++ {
+				insertRows(t, svc, db, table, map[string]interface{}{"score": score})
+			}
+
+			affected, err := svc.DB.BulkDelete(db, &BulkParams{Table: table, Filter: "score > 1", MaxAffected: 2})
+			if !errors.Is(err, ErrTooManyRows) || affected != 3 {
+				t.Errorf("over max_affected: affected %d, error %v", affected, err)
+			}
+
+			affected, err = svc.DB.BulkDelete(db, &BulkParams{Table: table, Filter: "score > 1", DryRun: true})
+			if err != nil || affected != 3 {
+				t.Errorf("dry run: affected %d, error %v", affected, err)
+			}
+
+			affected, err = svc.DB.BulkDelete(db, &BulkParams{Table: table, Filter: "score > 2", MaxAffected: 2})
+			if err != nil || affected != 2 {
+				t.Errorf("delete: affected %d, error %v", affected, err)
+			}
+
+			rows, err := svc.DB.Fetch(db, &FetchParams{Table: table})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 2 {
+				t.Errorf("%d rows left, want 2", len(rows))
+			}
+
+			// trashed rows are no longer reached
+			affected, err = svc.DB.BulkDelete(db, &BulkParams{Table: table, Filter: "score > 1", DryRun: true})
+			if err != nil || affected != 1 {
+				t.Errorf("dry run after the delete: affected %d, error %v", affected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"funcbase/model"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrChangesExpired = errors.New("the changes since the given sequence are no longer kept")
+
+// ChangeScope
+//
+// Changes of a table readable by the requesting user. Condition is checked against the
+// current row, or the row kept on the change once deleted, and DeletedCondition is the same
+// condition read on the kept row. Every change of the table is read when Condition is empty
+type ChangeScope struct {
+	Table                string
+	Condition            string
+	ConditionArgs        []interface{}
+	DeletedCondition     string
+	DeletedConditionArgs []interface{}
+}
+
+type ChangesParams struct {
+	Since  uint
+	Limit  int
+	Scopes []ChangeScope
+}
+
+// ChangesPage
+//
+// Next is the sequence to read from on the next call, it is past the last change of the page
+// and, once the log is read up to the end, past every change the user can't read
+type ChangesPage struct {
+	Changes []model.Change `json:"changes"`
+	Next    uint           `json:"next"`
+	HasMore bool           `json:"has_more"`
+}
+
+// Changes
+//
+// Read the change log after a sequence, oldest first. ErrChangesExpired is returned with the
+// latest sequence when the log no longer holds every change since, the client then reads
+// the whole data again and continues from that sequence
+func (s *DBServiceImpl) Changes(db *gorm.DB, params *ChangesParams) (ChangesPage, error) {
+	page := ChangesPage{Changes: []model.Change{}}
+
+	var bounds struct {
+		Oldest uint
+		Latest uint
+	}
+	err := db.Model(&model.Change{}).
+		Select("COALESCE(MIN(seq), 0) AS oldest, COALESCE(MAX(seq), 0) AS latest").
+		Scan(&bounds).Error
+	if err != nil {
+		return page, err
+	}
+
+	page.Next = bounds.Latest
+	if params.Since > bounds.Latest || bounds.Oldest > 0 && params.Since < bounds.Oldest-1 {
+		return page, ErrChangesExpired
+	}
+	if len(params.Scopes) == 0 || params.Since == bounds.Latest {
+		return page, nil
+	}
+
+	conditions := []string{}
+	args := []interface{}{}
+	for _, scope := range params.Scopes {
+		if scope.Condition == "" {
+			conditions = append(conditions, "table_name = ?")
+			args = append(args, scope.Table)
+			continue
+		}
+
+		// a deleted row is checked against the row kept on the change, others against the
+		// current row
+		conditions = append(conditions, fmt.Sprintf(`(table_name = ? AND CASE WHEN operation = ? THEN COALESCE(%s, 0) ELSE record_id IN (SELECT CAST(id AS TEXT) FROM "%s" WHERE %s) END)`, scope.DeletedCondition, scope.Table, scope.Condition))
+		args = append(args, scope.Table, model.HISTORY_DELETE)
+		args = append(args, scope.DeletedConditionArgs...)
+		args = append(args, scope.ConditionArgs...)
+	}
+
+	err = db.Model(&model.Change{}).
+		Where("seq > ? AND seq <= ?", params.Since, bounds.Latest).
+		Where("("+strings.Join(conditions, " OR ")+")", args...).
+		Order("seq").
+		Limit(params.Limit + 1).
+		Find(&page.Changes).Error
+	if err != nil {
+		return page, err
+	}
+
+	if len(page.Changes) > params.Limit {
+		page.Changes = page.Changes[:params.Limit]
+		page.Next = page.Changes[params.Limit-1].Seq
+		page.HasMore = true
+	}
+
+	return page, nil
+}
+
+// PruneChanges
+//
+// Delete the changes older than the retention, the latest one is kept so that the sequence
+// keeps going up
+func (s *DBServiceImpl) PruneChanges(db *gorm.DB, retention time.Duration) error {
+	return db.Where("created_at < ?", time.Now().Add(-retention)).
+		Where("seq < (SELECT MAX(seq) FROM _changes)").
+		Delete(&model.Change{}).Error
+}
+
+// recordChanges
+//
+// Append a change of every row reached to the log inside the transaction of the change, a
+// restored row is read as inserted again
+func (s *DBServiceImpl) recordChanges(db *gorm.DB, tableName string, operation string, ids []interface{}, before map[string]map[string]interface{}, after map[string]map[string]interface{}) error {
+	if operation == model.HISTORY_RESTORE {
+		operation = model.HISTORY_INSERT
+	}
+
+	changes := []model.Change{}
+	for _, id := range ids {
+		key := fmt.Sprintf("%v", id)
+		change := model.Change{
+			Table:     tableName,
+			RecordID:  key,
+			Operation: operation,
+		}
+
+		if operation == model.HISTORY_DELETE {
+			if before[key] == nil {
+				// row did not exist, nothing is deleted
+				continue
+			}
+
+			data, err := json.Marshal(historyValues(before[key]))
+			if err != nil {
+				return err
+			}
+			change.Data = string(data)
+		} else if after[key] == nil {
+			continue
+		}
+
+		changes = append(changes, change)
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	return db.Create(&changes).Error
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+	"funcbase/model"
+	"testing"
+	"time"
+)
+
+func changeList(changes []model.Change) []string {
+	list := []string{}
+	for _, change := range changes {
+		list = append(list, change.Table+" "+change.Operation+" "+change.RecordID)
+	}
+	return list
+}
+
+func equalList(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestChangesSince(t *testing.T) {
+	svc, db := newTestService(t)
+	createTables(t, svc, db, model.CreateTable{Name: "notes", Fields: []model.Field{{Type: "text", Name: "body"}}})
+	insertRows(t, svc, db, "notes", map[string]interface{}{"body": "a"}, map[string]interface{}{"body": "b"})
+
+	scopes := []ChangeScope{{Table: "notes"}}
+	page, err := svc.DB.Changes(db, &ChangesParams{Since: 0, Limit: 10, Scopes: scopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := changeList(page.Changes); !equalList(got, []string{"notes insert 1", "notes insert 2"}) {
+		t.Errorf("changes %v", got)
+	}
+
+	since := page.Next
+	err = svc.DB.Update(db, "notes", map[string]interface{}{"id": 1, "body": "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = svc.DB.BatchDelete(db, "notes", []string{"2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err = svc.DB.Changes(db, &ChangesParams{Since: since, Limit: 1, Scopes: scopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := changeList(page.Changes); !equalList(got, []string{"notes update 1"}) || !page.HasMore {
+		t.Errorf("first page %v, has more %v", got, page.HasMore)
+	}
+
+	page, err = svc.DB.Changes(db, &ChangesParams{Since: page.Next, Limit: 10, Scopes: scopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := changeList(page.Changes); !equalList(got, []string{"notes delete 2"}) || page.HasMore {
+		t.Errorf("second page %v, has more %v", got, page.HasMore)
+	}
+
+	page, err = svc.DB.Changes(db, &ChangesParams{Since: page.Next, Limit: 10, Scopes: scopes})
+	if err != nil || len(page.Changes) != 0 {
+		t.Errorf("read up to the end: %v, error %v", changeList(page.Changes), err)
+	}
+}
+
+func TestChangesExpired(t *testing.T) {
+	svc, db := newTestService(t)
+	createTables(t, svc, db, model.CreateTable{Name: "notes", Fields: []model.Field{{Type: "text", Name: "body"}}})
+	insertRows(t, svc, db, "notes", map[string]interface{}{"body": "a"}, map[string]interface{}{"body": "b"}, map[string]interface{}{"body": "c"})
+
+	err := db.Model(&model.Change{}).Where("seq < ?", 3).Update("created_at", time.Now().Add(-2*time.Hour)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = svc.DB.PruneChanges(db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scopes := []ChangeScope{{Table: "notes"}}
+	page, err := svc.DB.Changes(db, &ChangesParams{Since: 0, Limit: 10, Scopes: scopes})
+	if !errors.Is(err, ErrChangesExpired) || page.Next != 3 {
+		t.Errorf("since a pruned change: next %d, error %v", page.Next, err)
+	}
+
+	_, err = svc.DB.Changes(db, &ChangesParams{Since: 10, Limit: 10, Scopes: scopes})
+	if !errors.Is(err, ErrChangesExpired) {
+		t.Errorf("since a sequence not reached yet: error %v", err)
+	}
+
+	page, err = svc.DB.Changes(db, &ChangesParams{Since: 2, Limit: 10, Scopes: scopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := changeList(page.Changes); !equalList(got, []string{"notes insert 3"}) {
+		t.Errorf("since the last pruned change %v", got)
+	}
+}
+
+func TestChangesCascade(t *testing.T) {
+	svc, db := newTestService(t)
+	createTables(t, svc, db,
+		model.CreateTable{Name: "authors", Fields: []model.Field{{Type: "text", Name: "name"}}},
+		model.CreateTable{Name: "tags", Fields: []model.Field{{Type: "text", Name: "name"}}},
+		model.CreateTable{Name: "posts", History: true, Fields: []model.Field{
+			{Type: "text", Name: "title"},
+			{Type: "relation", Name: "author", Reference: "authors", OnDelete: "cascade"},
+			{Type: "relation", Name: "tags", Reference: "tags", Multiple: true},
+		}},
+		model.CreateTable{Name: "reviews", Fields: []model.Field{
+			{Type: "text", Name: "body"},
+			{Type: "relation", Name: "post", Reference: "posts", Nullable: true, OnDelete: "set null"},
+		}},
+	)
+	insertRows(t, svc, db, "authors", map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"})
+	insertRows(t, svc, db, "tags", map[string]interface{}{"name": "x"})
+	insertRows(t, svc, db, "posts",
+		map[string]interface{}{"title": "p1", "author": 1, "tags": []interface{}{1}},
+		map[string]interface{}{"title": "p2", "author": 2, "tags": []interface{}{1}},
+	)
+	insertRows(t, svc, db, "reviews", map[string]interface{}{"body": "r1", "post": 1})
+
+	var since uint
+	err := db.Model(&model.Change{}).Select("MAX(seq)").Scan(&since).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = svc.DB.BatchDelete(db, "authors", []string{"1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = svc.DB.BatchDelete(db, "tags", []string{"1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scopes := []ChangeScope{{Table: "authors"}, {Table: "tags"}, {Table: "posts"}, {Table: "reviews"}}
+	page, err := svc.DB.Changes(db, &ChangesParams{Since: since, Limit: 10, Scopes: scopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"authors delete 1", "posts delete 1", "reviews update 1", "tags delete 1", "posts update 2"}
+	if got := changeList(page.Changes); !equalList(got, want) {
+		t.Errorf("changes %v, want %v", got, want)
+	}
+
+	histories, err := svc.DB.History(db, "posts", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histories) == 0 || histories[0].Operation != model.HISTORY_DELETE {
+		t.Errorf("history of the cascaded post: %v", histories)
+	}
+}
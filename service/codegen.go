@@ -0,0 +1,767 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"funcbase/model"
+	"go/format"
+	"sort"
+	"strings"
+)
+
+const (
+	CODEGEN_TS = "ts"
+	CODEGEN_GO = "go"
+)
+
+type codegenColumn struct {
+	Name     string
+	Type     string
+	Nullable bool
+	// filled by the database when left out
+	Default  bool
+	Multiple bool
+	// relation to a table with uuid, ulid or nanoid ids
+	TextID bool
+}
+
+type codegenTable struct {
+	Name    string
+	Auth    bool
+	View    bool
+	TextID  bool
+	Columns []codegenColumn
+}
+
+type codegenStep struct {
+	Name     string
+	Action   string
+	Table    string
+	Multiple bool
+	Inputs   []codegenColumn
+}
+
+type codegenFunction struct {
+	Name  string
+	Steps []codegenStep
+}
+
+// Codegen
+//
+// Typed client for the live schema, records of every collection with list/view/insert/update
+// helpers and the inputs of every stored function
+func (s *SchemaServiceImpl) Codegen(lang string) (string, error) {
+	tables, err := s.codegenTables()
+	if err != nil {
+		return "", err
+	}
+
+	functions, err := s.codegenFunctions(tables)
+	if err != nil {
+		return "", err
+	}
+
+	switch lang {
+	case CODEGEN_TS:
+		return renderTypeScript(tables, functions), nil
+	case CODEGEN_GO:
+		return renderGo(tables, functions), nil
+	default:
+		return "", fmt.Errorf("unsupported language %s", lang)
+	}
+}
+
+func (s *SchemaServiceImpl) codegenTables() ([]codegenTable, error) {
+	tableService := s.service.WithService().Table
+
+	var names []string
+	err := s.db.Model(&model.Tables{}).
+		Where("system = ?", false).
+		Order("name").
+		Pluck("name", &names).Error
+	if err != nil {
+		return nil, err
+	}
+
+	tables := []codegenTable{}
+	for _, name := range names {
+		info, err := tableService.Info(name, TABLE_INFO_AUTH, TABLE_INFO_TYPE, TABLE_INFO_ID_TYPE)
+		if err != nil {
+			return nil, err
+		}
+
+		// password and salt of auth tables are never returned
+		columns, err := tableService.Columns(name, false, false)
+		if err != nil {
+			return nil, err
+		}
+
+		table := codegenTable{
+			Name:   name,
+			Auth:   info.Auth,
+			View:   info.IsView(),
+			TextID: info.TextID(),
+		}
+
+		for _, column := range columns {
+			columnName := fmt.Sprintf("%v", ColumnValue(column, "name"))
+			if info.Auth && (columnName == "password" || columnName == "salt") {
+				continue
+			}
+
+			columnType := fmt.Sprintf("%v", ColumnValue(column, "type"))
+			if ColumnValue(column, "type") == nil {
+				columnType = ""
+			}
+
+			table.Columns = append(table.Columns, codegenColumn{
+				Name:     columnName,
+				Type:     strings.ToUpper(columnType),
+				Nullable: fmt.Sprintf("%v", ColumnValue(column, "notnull")) != "1",
+				Default:  ColumnValue(column, "dflt_value") != nil || fmt.Sprintf("%v", ColumnValue(column, "pk")) == "1",
+				Multiple: column["multiple"] == true,
+				TextID:   column["text_id"] == true,
+			})
+		}
+
+		tables = append(tables, table)
+	}
+
+	return tables, nil
+}
+
+// codegenFunctions
+//
+// Inputs of every step of the stored functions. Values bound with @ are filled by the server,
+// the others are sent by the caller and typed after the column of the step table
+func (s *SchemaServiceImpl) codegenFunctions(tables []codegenTable) ([]codegenFunction, error) {
+	var stored []model.FunctionStored
+	err := s.db.Model(&model.FunctionStored{}).Order("name").Find(&stored).Error
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]map[string]codegenColumn{}
+	for _, table := range tables {
+		columns[table.Name] = map[string]codegenColumn{}
+		for _, column := range table.Columns {
+			columns[table.Name][column.Name] = column
+		}
+	}
+
+	functions := []codegenFunction{}
+	for _, function := range stored {
+		var steps []struct {
+			Name     string                 `json:"name"`
+			Action   string                 `json:"action"`
+			Table    string                 `json:"table"`
+			Multiple bool                   `json:"multiple"`
+			Values   map[string]interface{} `json:"values"`
+		}
+		err := json.Unmarshal([]byte(function.Function), &steps)
+		if err != nil {
+			return nil, fmt.Errorf("invalid function %s: %s", function.Name, err.Error())
+		}
+
+		codegen := codegenFunction{Name: function.Name}
+		for _, step := range steps {
+			codegenStep := codegenStep{
+				Name:     step.Name,
+				Action:   step.Action,
+				Table:    step.Table,
+				Multiple: step.Multiple,
+			}
+
+			switch step.Action {
+			case "insert", "update":
+				keys := []string{}
+				for key, value := range step.Values {
+					if text, ok := value.(string); ok && strings.HasPrefix(text, "@") {
+						continue
+					}
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+
+				if step.Action == "update" {
+					keys = append([]string{"id"}, keys...)
+				}
+
+				for _, key := range keys {
+					column, ok := columns[step.Table][key]
+					if !ok {
+						column = codegenColumn{Name: key, Nullable: true}
+					}
+					// steps only bind the values sent, update id excepted
+					column.Default = column.Default || step.Action == "update" && key != "id"
+					codegenStep.Inputs = append(codegenStep.Inputs, column)
+				}
+			case "delete":
+				codegenStep.Inputs = []codegenColumn{{Name: "filter", Type: "TEXT"}}
+			default:
+				continue
+			}
+
+			codegen.Steps = append(codegen.Steps, codegenStep)
+		}
+
+		functions = append(functions, codegen)
+	}
+
+	return functions, nil
+}
+
+// pascalCase
+//
+// Exported identifier of a table or column name, id becomes ID as go lint expects
+func pascalCase(name string) string {
+	result := ""
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		if strings.ToLower(part) == "id" {
+			result += "ID"
+			continue
+		}
+		result += strings.ToUpper(part[:1]) + part[1:]
+	}
+
+	if result == "" || result[0] >= '0' && result[0] <= '9' {
+		result = "X" + result
+	}
+
+	return result
+}
+
+func camelCase(name string) string {
+	pascal := pascalCase(name)
+	if strings.HasPrefix(pascal, "ID") {
+		return "id" + pascal[2:]
+	}
+
+	return strings.ToLower(pascal[:1]) + pascal[1:]
+}
+
+func tsType(column codegenColumn) string {
+	tsType := "unknown"
+	switch column.Type {
+	case "INTEGER", "REAL", "RELATION":
+		tsType = "number"
+	case "TEXT", "DATETIME", "TIMESTAMP", "BLOB":
+		tsType = "string"
+	case "BOOLEAN":
+		tsType = "boolean"
+	}
+	if column.TextID {
+		tsType = "string"
+	}
+
+	if column.Multiple {
+		return tsType + "[]"
+	}
+	if column.Nullable && tsType != "unknown" {
+		return tsType + " | null"
+	}
+
+	return tsType
+}
+
+func tsProperty(name string) string {
+	if identifierRegex.MatchString(name) {
+		return name
+	}
+
+	return fmt.Sprintf("%q", name)
+}
+
+// writable
+//
+// Columns set by the caller on insert and update, the timestamps are maintained by the database
+func writable(column codegenColumn) bool {
+	switch column.Name {
+	case "id", "created_at", "updated_at", "deleted_at":
+		return false
+	}
+
+	return true
+}
+
+func renderTypeScript(tables []codegenTable, functions []codegenFunction) string {
+	var code strings.Builder
+
+	code.WriteString(`// Code generated by funcbase from the live schema. DO NOT EDIT.
+
+export interface ListParams {
+  filter?: string;
+  sort?: string;
+  page?: number;
+  page_size?: number;
+  get_count?: boolean;
+  count?: "exact" | "approximate";
+  after?: string;
+  before?: string;
+  limit?: number;
+  expand?: string;
+  search?: string;
+}
+
+export interface ListResult<T> {
+  data: T[];
+  page: number;
+  page_size: number;
+  total_data: number;
+  limit?: number;
+  next_cursor?: string;
+  prev_cursor?: string;
+}
+
+export interface APIResponse<T> {
+  data: T;
+  message: string;
+  error: unknown;
+}
+`)
+
+	for _, table := range tables {
+		typeName := pascalCase(table.Name)
+
+		fmt.Fprintf(&code, "\n// %s", table.Name)
+		if table.Auth {
+			code.WriteString(", auth collection")
+		}
+		if table.View {
+			code.WriteString(", read only view")
+		}
+		fmt.Fprintf(&code, "\nexport interface %s {\n", typeName)
+		for _, column := range table.Columns {
+			fmt.Fprintf(&code, "  %s: %s;\n", tsProperty(column.Name), tsType(column))
+		}
+		code.WriteString("}\n")
+
+		if table.View {
+			continue
+		}
+
+		fmt.Fprintf(&code, "\nexport interface %sInsert {\n", typeName)
+		for _, column := range table.Columns {
+			if !writable(column) {
+				continue
+			}
+			optional := ""
+			if column.Nullable || column.Default {
+				optional = "?"
+			}
+			fmt.Fprintf(&code, "  %s%s: %s;\n", tsProperty(column.Name), optional, tsType(column))
+		}
+		code.WriteString("}\n")
+
+		fmt.Fprintf(&code, "\nexport type %sUpdate = Partial<%sInsert> & { id: %s };\n", typeName, typeName, tsIDType(table))
+	}
+
+	for _, function := range functions {
+		typeName := pascalCase(function.Name) + "Input"
+
+		fmt.Fprintf(&code, "\n// input of the %s function\nexport interface %s {\n", function.Name, typeName)
+		for _, step := range function.Steps {
+			fmt.Fprintf(&code, "  %s: {\n", tsProperty(step.Name))
+			for _, input := range step.Inputs {
+				optional := ""
+				if input.Default {
+					optional = "?"
+				}
+				fmt.Fprintf(&code, "    %s%s: %s;\n", tsProperty(input.Name), optional, tsType(input))
+			}
+			code.WriteString("  }")
+			if step.Multiple {
+				code.WriteString("[]")
+			}
+			code.WriteString(";\n")
+		}
+		code.WriteString("}\n")
+	}
+
+	code.WriteString(`
+export class FuncbaseClient {
+  constructor(
+    private baseURL: string,
+    private apiKey: string,
+    private token?: string,
+  ) {}
+
+  setToken(token?: string) {
+    this.token = token;
+  }
+
+  private async request<T>(method: string, path: string, body?: unknown, query?: object): Promise<T> {
+    const url = new URL(path, this.baseURL);
+    for (const [key, value] of Object.entries(query ?? {})) {
+      if (value !== undefined) url.searchParams.set(key, String(value));
+    }
+
+    const headers: Record<string, string> = { "X-API-KEY": this.apiKey };
+    if (this.token) headers["Authorization"] = "Bearer " + this.token;
+    if (body !== undefined) headers["Content-Type"] = "application/json";
+
+    const response = await fetch(url, {
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    const result = await response.json();
+    if (!response.ok) {
+      throw new Error(typeof result?.error === "string" ? result.error : response.statusText);
+    }
+
+    return result as T;
+  }
+`)
+
+	for _, table := range tables {
+		typeName := pascalCase(table.Name)
+
+		fmt.Fprintf(&code, "\n  %s = {\n", tsProperty(camelCase(table.Name)))
+		fmt.Fprintf(&code, "    list: (params?: ListParams) => this.request<ListResult<%s>>(\"GET\", \"/api/main/%s/rows\", undefined, params),\n", typeName, table.Name)
+		fmt.Fprintf(&code, "    view: (id: %s) => this.request<%s>(\"GET\", `/api/main/%s/${id}`),\n", tsIDType(table), typeName, table.Name)
+		if !table.View {
+			// auth collections are created through the auth api
+			if !table.Auth {
+				fmt.Fprintf(&code, "    insert: (data: %sInsert) => this.request<APIResponse<%s>>(\"POST\", \"/api/main/%s/insert\", data),\n", typeName, typeName, table.Name)
+			}
+			fmt.Fprintf(&code, "    update: (data: %sUpdate) => this.request<APIResponse<%sUpdate>>(\"PUT\", \"/api/main/%s/update\", data),\n", typeName, typeName, table.Name)
+		}
+		code.WriteString("  };\n")
+	}
+
+	code.WriteString("\n  functions = {\n")
+	for _, function := range functions {
+		fmt.Fprintf(&code, "    %s: (data: %sInput) => this.request<Record<string, unknown>>(\"POST\", \"/api/%s\", { data }),\n", tsProperty(camelCase(function.Name)), pascalCase(function.Name), function.Name)
+	}
+	code.WriteString("  };\n}\n")
+
+	return code.String()
+}
+
+func tsIDType(table codegenTable) string {
+	if table.TextID {
+		return "string"
+	}
+
+	return "number"
+}
+
+func goIDType(table codegenTable) string {
+	if table.TextID {
+		return "string"
+	}
+
+	return "int64"
+}
+
+func goType(column codegenColumn) string {
+	goType := "interface{}"
+	switch column.Type {
+	case "INTEGER", "RELATION":
+		goType = "int64"
+	case "REAL":
+		goType = "float64"
+	case "TEXT", "BLOB":
+		goType = "string"
+	case "DATETIME", "TIMESTAMP":
+		goType = "time.Time"
+	case "BOOLEAN":
+		goType = "bool"
+	}
+	if column.TextID {
+		goType = "string"
+	}
+
+	if column.Multiple {
+		return "[]" + goType
+	}
+	if column.Nullable && goType != "interface{}" {
+		return "*" + goType
+	}
+
+	return goType
+}
+
+// goField
+//
+// Struct field of a column, optional fields are pointers left out of the json when nil
+func goField(code *strings.Builder, column codegenColumn, optional bool) {
+	fieldType := goType(column)
+	tag := column.Name
+	if optional {
+		if !strings.HasPrefix(fieldType, "*") && !strings.HasPrefix(fieldType, "[]") && fieldType != "interface{}" {
+			fieldType = "*" + fieldType
+		}
+		tag += ",omitempty"
+	}
+
+	fmt.Fprintf(code, "\t%s %s `json:\"%s\"`\n", pascalCase(column.Name), fieldType, tag)
+}
+
+func renderGo(tables []codegenTable, functions []codegenFunction) string {
+	var code strings.Builder
+
+	code.WriteString(`type ListParams struct {
+	Filter   string
+	Sort     string
+	Page     int
+	PageSize int
+	GetCount bool
+	// exact or approximate
+	Count  string
+	After  string
+	Before string
+	Limit  int
+	Expand string
+	Search string
+}
+
+type ListResult[T any] struct {
+	Data       []T    ` + "`json:\"data\"`" + `
+	Page       int    ` + "`json:\"page\"`" + `
+	PageSize   int    ` + "`json:\"page_size\"`" + `
+	TotalData  int64  ` + "`json:\"total_data\"`" + `
+	Limit      int    ` + "`json:\"limit,omitempty\"`" + `
+	NextCursor string ` + "`json:\"next_cursor,omitempty\"`" + `
+	PrevCursor string ` + "`json:\"prev_cursor,omitempty\"`" + `
+}
+
+type APIResponse[T any] struct {
+	Data    T           ` + "`json:\"data\"`" + `
+	Message string      ` + "`json:\"message\"`" + `
+	Error   interface{} ` + "`json:\"error\"`" + `
+}
+`)
+
+	for _, table := range tables {
+		typeName := pascalCase(table.Name)
+
+		fmt.Fprintf(&code, "\n// %s", typeName)
+		fmt.Fprintf(&code, "\n//\n// Record of %s", table.Name)
+		if table.Auth {
+			code.WriteString(", auth collection")
+		}
+		if table.View {
+			code.WriteString(", read only view")
+		}
+		fmt.Fprintf(&code, "\ntype %s struct {\n", typeName)
+		for _, column := range table.Columns {
+			goField(&code, column, false)
+		}
+		code.WriteString("}\n")
+
+		if table.View {
+			continue
+		}
+
+		fmt.Fprintf(&code, "\ntype %sInsert struct {\n", typeName)
+		for _, column := range table.Columns {
+			if writable(column) {
+				goField(&code, column, column.Nullable || column.Default)
+			}
+		}
+		code.WriteString("}\n")
+
+		fmt.Fprintf(&code, "\ntype %sUpdate struct {\n\tID %s `json:\"id\"`\n", typeName, goIDType(table))
+		for _, column := range table.Columns {
+			if writable(column) {
+				goField(&code, column, true)
+			}
+		}
+		code.WriteString("}\n")
+	}
+
+	for _, function := range functions {
+		typeName := pascalCase(function.Name) + "Input"
+
+		fmt.Fprintf(&code, "\n// %s\n//\n// Input of the %s function\ntype %s struct {\n", typeName, function.Name, typeName)
+		for _, step := range function.Steps {
+			slice := ""
+			if step.Multiple {
+				slice = "[]"
+			}
+			fmt.Fprintf(&code, "\t%s %sstruct {\n", pascalCase(step.Name), slice)
+			for _, input := range step.Inputs {
+				code.WriteString("\t")
+				goField(&code, input, input.Default)
+			}
+			fmt.Fprintf(&code, "\t} `json:\"%s\"`\n", step.Name)
+		}
+		code.WriteString("}\n")
+	}
+
+	code.WriteString(`
+type Client struct {
+	BaseURL    string
+	APIKey     string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func NewClient(baseURL string, apiKey string) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		APIKey:     apiKey,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}, out interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	endpoint := c.BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-API-KEY", c.APIKey)
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		var failure struct {
+			Error interface{} ` + "`json:\"error\"`" + `
+		}
+		json.NewDecoder(res.Body).Decode(&failure)
+		return fmt.Errorf("%s %s: %d %v", method, path, res.StatusCode, failure.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (p ListParams) values() url.Values {
+	query := url.Values{}
+	if p.Filter != "" {
+		query.Set("filter", p.Filter)
+	}
+	if p.Sort != "" {
+		query.Set("sort", p.Sort)
+	}
+	if p.Page > 0 {
+		query.Set("page", strconv.Itoa(p.Page))
+	}
+	if p.PageSize > 0 {
+		query.Set("page_size", strconv.Itoa(p.PageSize))
+	}
+	if p.GetCount {
+		query.Set("get_count", "true")
+	}
+	if p.Count != "" {
+		query.Set("count", p.Count)
+	}
+	if p.After != "" {
+		query.Set("after", p.After)
+	}
+	if p.Before != "" {
+		query.Set("before", p.Before)
+	}
+	if p.Limit > 0 {
+		query.Set("limit", strconv.Itoa(p.Limit))
+	}
+	if p.Expand != "" {
+		query.Set("expand", p.Expand)
+	}
+	if p.Search != "" {
+		query.Set("search", p.Search)
+	}
+
+	return query
+}
+`)
+
+	for _, table := range tables {
+		typeName := pascalCase(table.Name)
+
+		fmt.Fprintf(&code, `
+func (c *Client) List%s(ctx context.Context, params ListParams) (*ListResult[%s], error) {
+	result := new(ListResult[%s])
+	return result, c.do(ctx, http.MethodGet, "/api/main/%s/rows", params.values(), nil, result)
+}
+
+func (c *Client) View%s(ctx context.Context, id %s) (*%s, error) {
+	result := new(%s)
+	return result, c.do(ctx, http.MethodGet, fmt.Sprintf("/api/main/%s/%%v", id), nil, nil, result)
+}
+`, typeName, typeName, typeName, table.Name, typeName, goIDType(table), typeName, typeName, table.Name)
+
+		if table.View {
+			continue
+		}
+
+		if !table.Auth {
+			fmt.Fprintf(&code, `
+func (c *Client) Insert%s(ctx context.Context, data %sInsert) (map[string]interface{}, error) {
+	result := new(APIResponse[map[string]interface{}])
+	err := c.do(ctx, http.MethodPost, "/api/main/%s/insert", nil, data, result)
+	return result.Data, err
+}
+`, typeName, typeName, table.Name)
+		}
+
+		fmt.Fprintf(&code, `
+func (c *Client) Update%s(ctx context.Context, data %sUpdate) error {
+	return c.do(ctx, http.MethodPut, "/api/main/%s/update", nil, data, nil)
+}
+`, typeName, typeName, table.Name)
+	}
+
+	for _, function := range functions {
+		name := pascalCase(function.Name)
+
+		fmt.Fprintf(&code, `
+func (c *Client) %s(ctx context.Context, input %sInput) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	err := c.do(ctx, http.MethodPost, "/api/%s", nil, map[string]interface{}{"data": input}, &result)
+	return result, err
+}
+`, name, name, function.Name)
+	}
+
+	imports := []string{"bytes", "context", "encoding/json", "fmt", "net/http", "net/url", "strconv"}
+	if strings.Contains(code.String(), "time.Time") {
+		imports = append(imports, "time")
+	}
+
+	source := "// Code generated by funcbase from the live schema. DO NOT EDIT.\n\npackage funcbase\n\nimport (\n"
+	for _, path := range imports {
+		source += fmt.Sprintf("\t%q\n", path)
+	}
+	source += ")\n\n" + code.String()
+
+	formatted, err := format.Source([]byte(source))
+	if err != nil {
+		return source
+	}
+
+	return string(formatted)
+}
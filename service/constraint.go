@@ -0,0 +1,228 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"funcbase/model"
+	"funcbase/utils"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var identifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+const (
+	CONSTRAINT_UNIQUE      = "unique"
+	CONSTRAINT_CHECK       = "check"
+	CONSTRAINT_NOT_NULL    = "not_null"
+	CONSTRAINT_FOREIGN_KEY = "foreign_key"
+	// raised by a trigger, Constraint holds the raised message
+	CONSTRAINT_TRIGGER = "trigger"
+)
+
+// ConstraintViolation
+//
+// Write rejected by a constraint of the table, Constraint holds the name given on the
+// table definition when it can be resolved
+type ConstraintViolation struct {
+	Kind       string `json:"kind"`
+	Table      string `json:"table,omitempty"`
+	Constraint string `json:"constraint,omitempty"`
+	err        error
+}
+
+func (e *ConstraintViolation) Error() string {
+	if e.Kind == CONSTRAINT_TRIGGER {
+		return e.Constraint
+	}
+
+	if e.Constraint == "" {
+		return fmt.Sprintf("%s constraint failed", strings.ReplaceAll(e.Kind, "_", " "))
+	}
+
+	return fmt.Sprintf("%s constraint %s failed", strings.ReplaceAll(e.Kind, "_", " "), e.Constraint)
+}
+
+func (e *ConstraintViolation) Unwrap() error {
+	return e.err
+}
+
+// Conflict
+//
+// Unique violation means the row already exists, others mean the row itself is invalid
+func (e *ConstraintViolation) Conflict() bool {
+	return e.Kind == CONSTRAINT_UNIQUE
+}
+
+func parseConstraints(constraintJson string) (model.Constraints, error) {
+	constraints := model.Constraints{
+		Uniques: []model.Unique{},
+		Checks:  []model.Check{},
+	}
+
+	if constraintJson == "" {
+		return constraints, nil
+	}
+
+	err := json.Unmarshal([]byte(constraintJson), &constraints)
+	if err != nil {
+		return constraints, err
+	}
+
+	if constraints.Uniques == nil {
+		constraints.Uniques = []model.Unique{}
+	}
+	if constraints.Checks == nil {
+		constraints.Checks = []model.Check{}
+	}
+
+	return constraints, nil
+}
+
+// constraintDefinitions
+//
+// Table level clauses of the composite unique and check constraints
+func constraintDefinitions(params model.CreateTable) ([]string, error) {
+	definitions := []string{}
+	names := map[string]bool{}
+
+	validateName := func(name string) error {
+		if !identifierRegex.MatchString(name) {
+			return fmt.Errorf("invalid constraint name %s", name)
+		}
+		if names[name] {
+			return fmt.Errorf("constraint %s is defined more than once", name)
+		}
+		names[name] = true
+
+		return nil
+	}
+
+	for _, unique := range params.Uniques {
+		if err := validateName(unique.Name); err != nil {
+			return nil, err
+		}
+
+		if len(unique.Columns) == 0 {
+			return nil, fmt.Errorf("unique constraint %s requires at least one column", unique.Name)
+		}
+
+		for _, column := range unique.Columns {
+			if !identifierRegex.MatchString(column) {
+				return nil, fmt.Errorf("invalid column %s on unique constraint %s", column, unique.Name)
+			}
+		}
+
+		definitions = append(definitions, fmt.Sprintf("CONSTRAINT %s UNIQUE (%s)", unique.Name, strings.Join(unique.Columns, ", ")))
+	}
+
+	for _, check := range params.Checks {
+		if err := validateName(check.Name); err != nil {
+			return nil, err
+		}
+
+		expression := strings.TrimSpace(check.Expression)
+		if expression == "" {
+			return nil, fmt.Errorf("check constraint %s requires an expression", check.Name)
+		}
+
+		definitions = append(definitions, fmt.Sprintf("CONSTRAINT %s CHECK (%s)", check.Name, expression))
+	}
+
+	return definitions, nil
+}
+
+// Violation
+//
+// Convert a sqlite constraint error into a ConstraintViolation naming the failed constraint.
+// Sqlite only reports the columns of a failed unique constraint, they are matched against
+// the constraints and unique indexes of the table to find its name
+func (s *TableServiceImpl) Violation(err error) (*ConstraintViolation, bool) {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code != sqlite3.ErrConstraint {
+		return nil, false
+	}
+
+	message := sqliteErr.Error()
+	detail := ""
+	if i := strings.Index(message, ": "); i >= 0 {
+		detail = strings.TrimSpace(message[i+2:])
+	}
+
+	violation := &ConstraintViolation{err: err}
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		violation.Kind = CONSTRAINT_UNIQUE
+		violation.Table, violation.Constraint = s.uniqueConstraint(detail)
+	case sqlite3.ErrConstraintCheck:
+		violation.Kind = CONSTRAINT_CHECK
+		violation.Constraint = detail
+	case sqlite3.ErrConstraintNotNull:
+		violation.Kind = CONSTRAINT_NOT_NULL
+		violation.Table, violation.Constraint, _ = strings.Cut(detail, ".")
+	case sqlite3.ErrConstraintForeignKey:
+		violation.Kind = CONSTRAINT_FOREIGN_KEY
+	case sqlite3.ErrConstraintTrigger:
+		violation.Kind = CONSTRAINT_TRIGGER
+		violation.Constraint = message
+	default:
+		return nil, false
+	}
+
+	return violation, true
+}
+
+// uniqueConstraint
+//
+// Resolve "table.col1, table.col2" or "index 'name'" into the table and constraint name
+func (s *TableServiceImpl) uniqueConstraint(detail string) (string, string) {
+	if strings.HasPrefix(detail, "index ") {
+		return "", strings.Trim(strings.TrimPrefix(detail, "index "), "'")
+	}
+
+	tableName := ""
+	columns := []string{}
+	for _, column := range strings.Split(detail, ",") {
+		table, name, found := strings.Cut(strings.TrimSpace(column), ".")
+		if !found {
+			return "", detail
+		}
+		tableName = table
+		columns = append(columns, name)
+	}
+
+	table, err := s.Info(tableName, TABLE_INFO_CONSTRAINTS, TABLE_INFO_INDEXES)
+	if err != nil {
+		return tableName, strings.Join(columns, ", ")
+	}
+
+	sameColumns := func(other []string) bool {
+		if len(other) != len(columns) {
+			return false
+		}
+		for _, column := range other {
+			if !utils.ArrayContains(columns, strings.TrimSpace(column)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, unique := range table.SystemConstraint.Uniques {
+		if sameColumns(unique.Columns) {
+			return tableName, unique.Name
+		}
+	}
+
+	for _, index := range table.SystemIndex {
+		if index.Unique && sameColumns(index.Indexes) {
+			return tableName, index.Name
+		}
+	}
+
+	// unique flag of a single field
+	return tableName, strings.Join(columns, ", ")
+}
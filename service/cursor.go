@@ -0,0 +1,337 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PageCursors
+//
+// Cursors of the pages around the fetched one, empty when there is no such page
+type PageCursors struct {
+	Next string
+	Prev string
+}
+
+type sortKey struct {
+	column string
+	desc   bool
+	// time columns are read as stored, the driver would parse them into time.Time
+	raw bool
+}
+
+// cursor
+//
+// Sort the cursor was made for and the sort key values of its row
+type cursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+func cursorAlias(i int) string {
+	return fmt.Sprintf("_cursor_%d", i)
+}
+
+// sortKeys
+//
+// Parse a sort made of columns followed by asc or desc, the id is added as the last key so
+// that every row has its own position
+func (s *DBServiceImpl) sortKeys(tableName string, order string) ([]sortKey, error) {
+	columns, err := s.service.WithService().Table.Columns(tableName, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	types := map[string]string{}
+	for _, column := range columns {
+		if column["multiple"] == true {
+			continue
+		}
+		types[fmt.Sprintf("%v", ColumnValue(column, "name"))] = strings.ToUpper(fmt.Sprintf("%v", ColumnValue(column, "type")))
+	}
+
+	keys := []sortKey{}
+	hasID := false
+	for _, term := range strings.Split(order, ",") {
+		parts := strings.Fields(term)
+		if len(parts) == 0 {
+			continue
+		}
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("%w: sort %s must be a column followed by asc or desc", ErrInvalidCursor, strings.TrimSpace(term))
+		}
+
+		key := sortKey{column: parts[0]}
+		if len(parts) == 2 {
+			switch strings.ToLower(parts[1]) {
+			case "asc":
+			case "desc":
+				key.desc = true
+			default:
+				return nil, fmt.Errorf("%w: sort %s must be a column followed by asc or desc", ErrInvalidCursor, strings.TrimSpace(term))
+			}
+		}
+
+		columnType, ok := types[key.column]
+		if !ok {
+			return nil, fmt.Errorf("%w: sort column %s does not exist", ErrInvalidCursor, key.column)
+		}
+		switch columnType {
+		case "DATE", "DATETIME", "TIMESTAMP":
+			key.raw = true
+		}
+
+		if key.column == "id" {
+			hasID = true
+		}
+		keys = append(keys, key)
+	}
+
+	if !hasID {
+		desc := len(keys) > 0 && keys[len(keys)-1].desc
+		keys = append(keys, sortKey{column: "id", desc: desc})
+	}
+
+	return keys, nil
+}
+
+func sortString(keys []sortKey) string {
+	terms := []string{}
+	for _, key := range keys {
+		if key.desc {
+			terms = append(terms, key.column+" desc")
+		} else {
+			terms = append(terms, key.column+" asc")
+		}
+	}
+
+	return strings.Join(terms, ", ")
+}
+
+func encodeCursor(keys []sortKey, row map[string]interface{}) string {
+	values := make([]interface{}, len(keys))
+	for i := range keys {
+		values[i] = row[cursorAlias(i)]
+		if value, ok := values[i].([]byte); ok {
+			values[i] = string(value)
+		}
+	}
+
+	encoded, _ := json.Marshal(cursor{Sort: sortString(keys), Values: values})
+
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeCursor(keys []sortKey, value string) ([]interface{}, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	decoder := json.NewDecoder(bytes.NewReader(decoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.Sort != sortString(keys) || len(c.Values) != len(keys) {
+		return nil, fmt.Errorf("%w: the cursor was made for another sort", ErrInvalidCursor)
+	}
+
+	for i, v := range c.Values {
+		number, ok := v.(json.Number)
+		if !ok {
+			continue
+		}
+		if integer, err := number.Int64(); err == nil {
+			c.Values[i] = integer
+		} else if float, err := number.Float64(); err == nil {
+			c.Values[i] = float
+		}
+	}
+
+	return c.Values, nil
+}
+
+// keysetCondition
+//
+// Rows coming after the cursor values in the order of the keys. Sqlite puts null first in
+// ascending order, a null value is only followed by the non null values
+func keysetCondition(tableName string, keys []sortKey, values []interface{}) (string, []interface{}) {
+	or := []string{}
+	args := []interface{}{}
+	for i, key := range keys {
+		and := []string{}
+		andArgs := []interface{}{}
+		for j := 0; j < i; j++ {
+			column := tableName + "." + keys[j].column
+			if values[j] == nil {
+				and = append(and, column+" IS NULL")
+			} else {
+				and = append(and, column+" = ?")
+				andArgs = append(andArgs, values[j])
+			}
+		}
+
+		column := tableName + "." + key.column
+		switch {
+		case values[i] == nil && key.desc:
+			// nothing comes after null in descending order
+			continue
+		case values[i] == nil:
+			and = append(and, column+" IS NOT NULL")
+		case key.desc:
+			and = append(and, fmt.Sprintf("(%s < ? OR %s IS NULL)", column, column))
+			andArgs = append(andArgs, values[i])
+		default:
+			and = append(and, column+" > ?")
+			andArgs = append(andArgs, values[i])
+		}
+
+		or = append(or, "("+strings.Join(and, " AND ")+")")
+		args = append(args, andArgs...)
+	}
+
+	if len(or) == 0 {
+		return "0", nil
+	}
+
+	return "(" + strings.Join(or, " OR ") + ")", args
+}
+
+// FetchPage
+//
+// Keyset pagination on the order of the params plus the id. Rows are read after the After
+// cursor, or before the Before cursor, so that rows added or removed meanwhile don't shift
+// the pages
+func (s *DBServiceImpl) FetchPage(db *gorm.DB, option *FetchParams) ([]map[string]interface{}, PageCursors, error) {
+	var cursors PageCursors
+
+	if option.After != "" && option.Before != "" {
+		return nil, cursors, fmt.Errorf("%w: after and before can't be used together", ErrInvalidCursor)
+	}
+	if option.Search != "" {
+		return nil, cursors, fmt.Errorf("%w: search results are ranked, use page instead", ErrInvalidCursor)
+	}
+
+	err := s.checkReadable(db, option.Table, option.Order)
+	if err != nil {
+		return nil, cursors, err
+	}
+
+	keys, err := s.sortKeys(option.Table, option.Order)
+	if err != nil {
+		return nil, cursors, err
+	}
+
+	backward := option.Before != ""
+	var values []interface{}
+	if option.After != "" {
+		values, err = decodeCursor(keys, option.After)
+	} else if backward {
+		values, err = decodeCursor(keys, option.Before)
+	}
+	if err != nil {
+		return nil, cursors, err
+	}
+
+	// the rows before the cursor are the rows after it in the reverse order
+	queryKeys := keys
+	if backward {
+		queryKeys = make([]sortKey, len(keys))
+		for i, key := range keys {
+			key.desc = !key.desc
+			queryKeys[i] = key
+		}
+	}
+
+	selects := []string{}
+	orders := []string{}
+	for i, key := range queryKeys {
+		column := option.Table + "." + key.column
+		if key.raw {
+			selects = append(selects, fmt.Sprintf("CAST(%s AS TEXT) AS %s", column, cursorAlias(i)))
+		} else {
+			selects = append(selects, fmt.Sprintf("%s AS %s", column, cursorAlias(i)))
+		}
+
+		if key.desc {
+			orders = append(orders, column+" DESC")
+		} else {
+			orders = append(orders, column+" ASC")
+		}
+	}
+
+	pageOption := *option
+	pageOption.Order = ""
+	pageOption.Limit = 0
+	pageOption.Offset = 0
+	pageOption.extraColumns = selects
+	query, err := s.fetchQuery(db, &pageOption)
+	if err != nil {
+		return nil, cursors, err
+	}
+
+	if values != nil {
+		condition, args := keysetCondition(option.Table, queryKeys, values)
+		query = query.Where(condition, args...)
+	}
+
+	limit := option.Limit
+	query = query.Order(strings.Join(orders, ", ")).Limit(limit + 1)
+
+	var data []map[string]interface{}
+	start := time.Now()
+	err = query.Find(&data).Error
+	if err != nil {
+		return nil, cursors, err
+	}
+	s.recordSlowQuery(query, option, time.Since(start))
+
+	more := len(data) > limit
+	if more {
+		data = data[:limit]
+	}
+
+	if backward {
+		for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+		}
+	}
+
+	if len(data) > 0 {
+		first, last := data[0], data[len(data)-1]
+		if backward {
+			// the keys of the rows were selected in the reverse order, their values are the same
+			if more {
+				cursors.Prev = encodeCursor(keys, first)
+			}
+			cursors.Next = encodeCursor(keys, last)
+		} else {
+			if more {
+				cursors.Next = encodeCursor(keys, last)
+			}
+			if option.After != "" {
+				cursors.Prev = encodeCursor(keys, first)
+			}
+		}
+	}
+
+	for _, row := range data {
+		for i := range keys {
+			delete(row, cursorAlias(i))
+		}
+	}
+
+	return data, cursors, s.attachRelations(db.Session(&gorm.Session{NewDB: true}), option.Table, data, option.Columns)
+}
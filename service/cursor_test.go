@@ -0,0 +1,67 @@
+package service
+
+import (
+	"errors"
+	"funcbase/model"
+	"testing"
+)
+
+func TestFetchPage(t *testing.T) {
+	svc, db := newTestService(t)
+	createTables(t, svc, db, model.CreateTable{Name: "notes", Fields: []model.Field{{Type: "number", Name: "score"}}})
+	for _, score := range []int{3, 1, 3, 2, 2, 3, 1} {
+		insertRows(t, svc, db, "notes", map[string]interface{}{"score": score})
+	}
+
+	page := func(after string, before string) ([]map[string]interface{}, PageCursors) {
+		t.Helper()
+		rows, cursors, err := svc.DB.FetchPage(db, &FetchParams{Table: "notes", Order: "score desc", Limit: 3, After: after, Before: before})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows, cursors
+	}
+
+	// ties on the score are sorted by id in the same direction
+	rows, first := page("", "")
+	if got := rowIDs(rows); got != "[6 3 1]" || first.Prev != "" || first.Next == "" {
+		t.Errorf("first page %s, cursors %+v", got, first)
+	}
+
+	// a row added before the cursor doesn't shift the next pages
+	insertRows(t, svc, db, "notes", map[string]interface{}{"score": 3})
+
+	rows, second := page(first.Next, "")
+	if got := rowIDs(rows); got != "[5 4 7]" || second.Prev == "" || second.Next == "" {
+		t.Errorf("second page %s, cursors %+v", got, second)
+	}
+	rows, third := page(second.Next, "")
+	if got := rowIDs(rows); got != "[2]" || third.Next != "" {
+		t.Errorf("last page %s, cursors %+v", got, third)
+	}
+
+	rows, back := page("", third.Prev)
+	if got := rowIDs(rows); got != "[5 4 7]" || back.Prev == "" || back.Next == "" {
+		t.Errorf("second page backward %s, cursors %+v", got, back)
+	}
+	rows, back = page("", back.Prev)
+	if got := rowIDs(rows); got != "[6 3 1]" || back.Prev == "" {
+		t.Errorf("first page backward %s, cursors %+v", got, back)
+	}
+	rows, back = page("", back.Prev)
+	if got := rowIDs(rows); got != "[8]" || back.Prev != "" {
+		t.Errorf("added row backward %s, cursors %+v", got, back)
+	}
+
+	for name, params := range map[string]FetchParams{
+		"after and before": {Table: "notes", Limit: 3, After: first.Next, Before: first.Next},
+		"malformed cursor": {Table: "notes", Limit: 3, After: "x"},
+		"other order":      {Table: "notes", Order: "score asc, created_at desc", Limit: 3, After: first.Next},
+		"search":           {Table: "notes", Limit: 3, Search: "a"},
+	} {
+		_, _, err := svc.DB.FetchPage(db, &params)
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: error %v, want ErrInvalidCursor", name, err)
+		}
+	}
+}
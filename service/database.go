@@ -1,9 +1,13 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"funcbase/constants"
+	"funcbase/model"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/patrickmn/go-cache"
 	"github.com/sarulabs/di"
@@ -11,6 +15,8 @@ import (
 	"gorm.io/gorm/clause"
 )
 
+var ErrInvalidFilter = errors.New("invalid filter")
+
 type FetchParams struct {
 	Table   string
 	Filter  string
@@ -18,20 +24,66 @@ type FetchParams struct {
 	Limit   int
 	Offset  int
 	Columns []string
+	IDs     []interface{}
+	// full text search on the searchable fields, ranked by relevance
+	Search string
+	// only fetch soft deleted rows
+	Trashed bool
+	// cursors of FetchPage, Limit rows are read after or before the cursor
+	After  string
+	Before string
+	// count from the cache, it may lag behind the writes made outside of the service
+	Approximate bool
+	// condition the rows must also match, e.g. the access rule of the requesting user
+	Condition     string
+	ConditionArgs []interface{}
+
+	// selected next to the columns, used for the sort keys of FetchPage
+	extraColumns []string
+	// hidden fields are read whoever the actor is, used for the snapshots of the changes
+	all bool
 }
 
 type DBService interface {
 	Fetch(db *gorm.DB, option *FetchParams) ([]map[string]interface{}, error)
+	FetchPage(db *gorm.DB, option *FetchParams) ([]map[string]interface{}, PageCursors, error)
+	Projection(db *gorm.DB, tableName string, fields string, exclude string) (*Projection, error)
+	Expand(db *gorm.DB, tableName string, data []map[string]interface{}, params *ExpandParams) error
+	Lookup(db *gorm.DB, tableName string, key []string, data map[string]interface{}) (map[string]interface{}, error)
+	ETags(db *gorm.DB, tableName string, ids []interface{}) (map[string]string, error)
+	MatchEvent(db *gorm.DB, event model.Event, filter string) (bool, error)
+	JSONRow(tableName string, source string) (string, error)
 	Count(db *gorm.DB, option *FetchParams) (int64, error)
 	Insert(db *gorm.DB, tableName string, data map[string]interface{}) error
 	Update(db *gorm.DB, tableName string, data map[string]interface{}) error
 	Delete(db *gorm.DB, tableName string, data map[string]interface{}) error
 	BatchDelete(db *gorm.DB, tableName string, data []string) error
+	DeleteByFilter(db *gorm.DB, tableName string, filter string, args ...interface{}) (int64, error)
+	BulkUpdate(db *gorm.DB, params *BulkParams, data map[string]interface{}) (int64, error)
+	BulkDelete(db *gorm.DB, params *BulkParams) (int64, error)
+	Restore(db *gorm.DB, tableName string, data []string) error
+	Purge(db *gorm.DB, tableName string, data []string) error
+	PurgeExpired(db *gorm.DB, retention time.Duration) error
+
+	Changes(db *gorm.DB, params *ChangesParams) (ChangesPage, error)
+	PruneChanges(db *gorm.DB, retention time.Duration) error
+
+	History(db *gorm.DB, tableName string, id string) ([]model.History, error)
+	Revert(db *gorm.DB, tableName string, id string, historyID uint) (map[string]interface{}, error)
+
+	Import(db *gorm.DB, params ImportParams) (ImportResult, error)
+	Stream(db *gorm.DB, option *FetchParams, writer RowWriter) error
+
+	SlowQueries() []SlowQuery
+	DiagnoseSlowQueries(db *gorm.DB) ([]QueryDiagnostic, error)
 }
 
 type DBServiceImpl struct {
 	cache   *cache.Cache
 	service *BaseService
+
+	slowMutex   sync.Mutex
+	slowQueries []SlowQuery
 }
 
 func NewDBService(ioc di.Container) DBService {
@@ -42,6 +94,35 @@ func NewDBService(ioc di.Container) DBService {
 }
 
 func (s *DBServiceImpl) Fetch(db *gorm.DB, option *FetchParams) ([]map[string]interface{}, error) {
+	query, err := s.fetchQuery(db, option)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []map[string]interface{}
+	start := time.Now()
+	err = query.Find(&data).Error
+	if err != nil {
+		return data, err
+	}
+
+	if option.Table == "_log" {
+		return data, nil
+	}
+
+	if len(option.IDs) == 0 {
+		s.recordSlowQuery(query, option, time.Since(start))
+	}
+
+	// conditions scoping the rows, like an owner filter, don't apply to the junction tables
+	return data, s.attachRelations(db.Session(&gorm.Session{NewDB: true}), option.Table, data, option.Columns)
+}
+
+// fetchQuery
+//
+// Select query of the rows matching the fetch params, the fields the actor of the query can't
+// read are left out
+func (s *DBServiceImpl) fetchQuery(db *gorm.DB, option *FetchParams) (*gorm.DB, error) {
 	var (
 		columns   string
 		query     *gorm.DB
@@ -52,64 +133,129 @@ func (s *DBServiceImpl) Fetch(db *gorm.DB, option *FetchParams) ([]map[string]in
 	columns = "*"
 
 	if tableName != "_log" {
-		table, err := s.service.WithService().Table.Info(tableName, TABLE_INFO_AUTH)
+		hidden, err := s.hiddenFields(tableName, restricted(db) && !option.all)
 		if err != nil {
 			return nil, err
 		}
 
-		if table.Auth {
-			columnsArr, err := s.service.WithService().Table.Columns(tableName, false, false)
+		// the columns are listed when some of them can't be read
+		var readable []string
+		for _, isHidden := range hidden {
+			if !isHidden {
+				continue
+			}
 
+			columnsArr, err := s.service.WithService().Table.Columns(tableName, false, false)
 			if err != nil {
 				return nil, err
 			}
 
-			columns = ""
-
+			readable = []string{}
 			for _, column := range columnsArr {
-				col := column["name"].(*interface{})
-				if *col == "password" || *col == "salt" {
+				col := fmt.Sprintf("%v", ColumnValue(column, "name"))
+				if hidden[col] || column["multiple"] == true {
 					continue
 				}
+				readable = append(readable, col)
+			}
+			break
+		}
+
+		if len(option.Columns) == 0 && readable != nil {
+			columns = strings.Join(readable, ", ")
+		} else if len(option.Columns) > 0 {
+			relations, err := s.service.WithService().Table.Relations(tableName)
+			if err != nil {
+				return nil, err
+			}
 
-				if columns != "" {
-					columns = fmt.Sprintf("%s, %s", columns, *col)
+			selected := []string{}
+			for _, column := range option.Columns {
+				column = strings.TrimSpace(column)
+				if hidden[column] {
+					continue
+				}
+				if column == "*" && readable != nil {
+					selected = append(selected, readable...)
 					continue
 				}
-				columns = fmt.Sprintf("%s", *col)
+
+				isMultiple := false
+				for _, relation := range relations {
+					if relation.Multiple && relation.Field == column {
+						isMultiple = true
+					}
+				}
+				if !isMultiple {
+					selected = append(selected, column)
+				}
 			}
-		} else {
-			if len(option.Columns) > 0 {
-				columns = strings.Join(option.Columns, ", ")
+
+			// id is needed to fetch the linked relation
+			if (len(selected) < len(option.Columns) || len(selected) == 0) && !containsColumn(selected, "id") {
+				selected = append(selected, "id")
 			}
+			columns = strings.Join(selected, ", ")
 		}
 	}
 
+	if option.Search != "" {
+		if columns == "*" {
+			columns = tableName + ".*"
+		}
+		columns += ", _search.search_rank, _search.search_snippet"
+
+		var err error
+		query, err = s.applySearch(query, tableName, option.Search)
+		if err != nil {
+			return nil, err
+		}
+
+	}
+
+	if len(option.extraColumns) > 0 {
+		if columns == "*" {
+			columns = tableName + ".*"
+		}
+		columns += ", " + strings.Join(option.extraColumns, ", ")
+	}
+
 	query = query.Select(columns)
 
-	if option.Filter != "" {
-		// convert the @user.id to userID on api package
-		if isSQLTerm(option.Filter) {
-			query = query.Where(option.Filter)
-		} else {
-			columns, err := s.service.WithService().Table.Columns(tableName, false, false)
-			if err != nil {
-				return nil, err
-			}
+	if len(option.IDs) > 0 {
+		query = query.Where("id IN ?", option.IDs)
+	}
 
-			for i, column := range columns {
-				cName := column["name"].(*interface{})
-				if i == 0 {
-					query = query.Where(fmt.Sprintf("%s LIKE ('%%%s%%')", *cName, option.Filter))
-				} else {
-					query = query.Or(fmt.Sprintf("%s LIKE ('%%%s%%')", *cName, option.Filter))
-				}
-			}
+	if option.Condition != "" {
+		query = query.Where(option.Condition, option.ConditionArgs...)
+	}
+
+	if tableName != "_log" {
+		condition, err := s.softDeleteCondition(tableName, option.Trashed)
+		if err != nil {
+			return nil, err
+		}
+		if condition != "" {
+			query = query.Where(condition)
+		}
+	}
+
+	if option.Filter != "" {
+		var err error
+		query, err = s.applyFilter(db, query, tableName, option.Filter)
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	if option.Order != "" {
+		err := s.checkReadable(db, tableName, option.Order)
+		if err != nil {
+			return nil, err
+		}
 		query = query.Order(option.Order)
+	} else if option.Search != "" {
+		query = query.Order("_search.search_rank")
 	}
 
 	if option.Limit > 0 {
@@ -120,47 +266,234 @@ func (s *DBServiceImpl) Fetch(db *gorm.DB, option *FetchParams) ([]map[string]in
 		query = query.Offset(option.Offset)
 	}
 
-	var data []map[string]interface{}
-	err := query.Find(&data).Error
+	return query, nil
+}
+
+// Lookup
+//
+// Row whose key columns hold the values of the data, nil when there is none. Trashed rows
+// are not matched
+func (s *DBServiceImpl) Lookup(db *gorm.DB, tableName string, key []string, data map[string]interface{}) (map[string]interface{}, error) {
+	columns, err := s.service.WithService().Table.Columns(tableName, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, column := range columns {
+		if column["multiple"] != true {
+			known[fmt.Sprintf("%v", ColumnValue(column, "name"))] = true
+		}
+	}
 
-	return data, err
+	query := db.Table(tableName)
+	for _, column := range key {
+		if !known[column] {
+			return nil, fmt.Errorf("invalid key column %s", column)
+		}
+		if data[column] == nil {
+			// null never equals a stored value
+			return nil, nil
+		}
+		query = query.Where(column+" = ?", data[column])
+	}
+
+	condition, err := s.softDeleteCondition(tableName, false)
+	if err != nil {
+		return nil, err
+	}
+	if condition != "" {
+		query = query.Where(condition)
+	}
+
+	var ids []interface{}
+	err = query.Limit(1).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	rows, err := s.Fetch(db.Session(&gorm.Session{NewDB: true}), &FetchParams{
+		Table: tableName,
+		IDs:   ids,
+		Limit: 1,
+	})
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	return rows[0], nil
 }
 
+// Count
+//
+// Number of rows matching the filter and search of the params. The count is exact unless an
+// approximate count is asked, which is served from the cache while no write clears it
 func (s *DBServiceImpl) Count(db *gorm.DB, option *FetchParams) (int64, error) {
 	tableName := option.Table
-	cacheKey := "count_" + tableName
-	if storedCache, ok := s.cache.Get(cacheKey); ok {
-		return storedCache.(int64), nil
+	cacheKey := countCacheKey(option)
+	if option.Approximate {
+		if storedCache, ok := s.cache.Get(cacheKey); ok {
+			return storedCache.(int64), nil
+		}
 	}
 
 	query := db.Table(tableName)
 	var count int64
+
+	if option.Search != "" {
+		var err error
+		query, err = s.applySearch(query, tableName, option.Search)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	condition, err := s.softDeleteCondition(tableName, option.Trashed)
+	if err != nil {
+		return 0, err
+	}
+	if condition != "" {
+		query = query.Where(condition)
+	}
+
+	if option.Condition != "" {
+		query = query.Where(option.Condition, option.ConditionArgs...)
+	}
+
 	if option.Filter != "" {
-		// convert the @user.id to userID on api package
-		if isSQLTerm(option.Filter) {
-			query = query.Where(option.Filter)
+		query, err = s.applyFilter(db, query, tableName, option.Filter)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = query.Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if option.Approximate {
+		s.cache.Set(cacheKey, count, cache.DefaultExpiration)
+	}
+
+	return count, nil
+}
+
+func countCacheKey(option *FetchParams) string {
+	return fmt.Sprintf("count_%s\x00%t\x00%s\x00%s\x00%s\x00%v", option.Table, option.Trashed, option.Filter, option.Search, option.Condition, option.ConditionArgs)
+}
+
+// applyFilter
+//
+// Filter written as sql condition is used as is, otherwise it is searched on every column
+func (s *DBServiceImpl) applyFilter(db *gorm.DB, query *gorm.DB, tableName string, filter string) (*gorm.DB, error) {
+	// convert the @user.id to userID on api package
+	if isSQLTerm(filter) {
+		err := checkFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.checkReadable(db, tableName, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		// grouped so that the filter can't reach past the other conditions of the query
+		return query.Where("(" + filter + ")"), nil
+	}
+
+	columns, err := s.service.WithService().Table.Columns(tableName, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden, err := s.hiddenFields(tableName, restricted(db))
+	if err != nil {
+		return nil, err
+	}
+
+	search := db.Session(&gorm.Session{NewDB: true})
+	first := true
+	for _, column := range columns {
+		if column["multiple"] == true || hidden[fmt.Sprintf("%v", ColumnValue(column, "name"))] {
+			continue
+		}
+
+		cName := ColumnValue(column, "name")
+		if first {
+			search = search.Where(fmt.Sprintf("%s.%s LIKE ?", tableName, cName), "%"+filter+"%")
+			first = false
 		} else {
-			columns, err := s.service.WithService().Table.Columns(tableName, false, false)
-			if err != nil {
-				return 0, err
+			search = search.Or(fmt.Sprintf("%s.%s LIKE ?", tableName, cName), "%"+filter+"%")
+		}
+	}
+
+	return query.Where(search), nil
+}
+
+// softDeleteCondition
+//
+// Soft deleted rows are hidden unless the trash is requested
+func (s *DBServiceImpl) softDeleteCondition(tableName string, trashed bool) (string, error) {
+	table, err := s.service.WithService().Table.Info(tableName, TABLE_INFO_SOFT_DELETE)
+	if err != nil {
+		return "", err
+	}
+
+	if !table.SoftDelete {
+		if trashed {
+			return "", fmt.Errorf("soft delete is not enabled on %s", tableName)
+		}
+		return "", nil
+	}
+
+	if trashed {
+		return "deleted_at IS NOT NULL", nil
+	}
+
+	return "deleted_at IS NULL", nil
+}
+
+// checkFilter
+//
+// A filter written in sql must keep to a single condition, its parentheses are balanced and it
+// holds no comment nor statement separator outside of its quoted text
+func checkFilter(filter string) error {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(filter); i++ {
+		char := filter[i]
+		if quote != 0 {
+			if char == quote {
+				quote = 0
 			}
+			continue
+		}
 
-			for i, column := range columns {
-				cName := column["name"].(*interface{})
-				if i == 0 {
-					query = query.Where(fmt.Sprintf("%s LIKE ('%%%s%%')", *cName, option.Filter))
-				} else {
-					query = query.Or(fmt.Sprintf("%s LIKE ('%%%s%%')", *cName, option.Filter))
-				}
+		switch {
+		case char == '\'' || char == '"' || char == '`':
+			quote = char
+		case char == '(':
+			depth++
+		case char == ')':
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("%w: unbalanced parentheses", ErrInvalidFilter)
 			}
+		case char == ';', strings.HasPrefix(filter[i:], "--"), strings.HasPrefix(filter[i:], "/*"):
+			return fmt.Errorf("%w: %q is not allowed", ErrInvalidFilter, filter[i:min(i+2, len(filter))])
 		}
 	}
 
-	err := query.Count(&count).Error
-
-	s.cache.Set(cacheKey, count, cache.DefaultExpiration)
+	if quote != 0 {
+		return fmt.Errorf("%w: unterminated text", ErrInvalidFilter)
+	}
+	if depth != 0 {
+		return fmt.Errorf("%w: unbalanced parentheses", ErrInvalidFilter)
+	}
 
-	return count, err
+	return nil
 }
 
 var sqlTerms = []string{"LIKE", "=", ">=", "<=", ">", "<", "!=", "AND", "OR", "NOT"}
@@ -179,39 +512,420 @@ func isSQLTerm(term string) bool {
 }
 
 func (s *DBServiceImpl) Insert(db *gorm.DB, tableName string, data map[string]interface{}) error {
-	err := db.Table(tableName).Clauses(
-		clause.Returning{Columns: []clause.Column{{Name: "id"}}},
-	).Create(&data).Error
+	table, err := s.service.WithService().Table.Info(tableName, TABLE_INFO_VERSIONED)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkWrite(db, tableName, data, true)
+	if err != nil {
+		return err
+	}
+	if table.Versioned {
+		// every row starts at the first version
+		delete(data, "version")
+	}
 
-	cacheKey := "count_" + tableName
-	s.cache.Delete(cacheKey)
+	links, err := s.splitRelations(tableName, data)
+	if err != nil {
+		return err
+	}
+
+	err = s.assignID(tableName, data)
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(tableName).Clauses(
+			clause.Returning{Columns: []clause.Column{{Name: "id"}}},
+		).Create(&data).Error
+		if err != nil {
+			return err
+		}
+
+		err = s.writeRelations(tx, data["id"], links)
+		if err != nil {
+			return err
+		}
+
+		for relation, ids := range links {
+			data[relation.Field] = ids
+		}
+
+		return s.onChange(tx, tableName, model.HISTORY_INSERT, []interface{}{data["id"]}, nil)
+	})
+
+	s.clearCount(tableName)
 
 	return err
 }
 
+// Update
+//
+// Write the given fields of a row. The version of a versioned table is only written by its
+// trigger, a version given with the data is the one the row must still have
 func (s *DBServiceImpl) Update(db *gorm.DB, tableName string, data map[string]interface{}) error {
-	err := db.Table(tableName).
-		Where("id = ?", data["id"]).
-		Updates(&data).Error
+	table, err := s.service.WithService().Table.Info(tableName, TABLE_INFO_VERSIONED)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkWrite(db, tableName, data, false)
+	if err != nil {
+		return err
+	}
+
+	var version interface{}
+	if table.Versioned {
+		version = data["version"]
+		delete(data, "version")
+	}
+
+	links, err := s.splitRelations(tableName, data)
+	if err != nil {
+		return err
+	}
+
+	condition, err := s.softDeleteCondition(tableName, false)
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		before, err := s.beforeChange(tx, tableName, []interface{}{data["id"]})
+		if err != nil {
+			return err
+		}
+
+		query := tx.Table(tableName).Where("id = ?", data["id"])
+		if condition != "" {
+			query = query.Where(condition)
+		}
+
+		ifMatch, args, _, err := s.precondition(tx, tableName, []interface{}{data["id"]})
+		if err != nil {
+			return err
+		}
+		if ifMatch != "" {
+			query = query.Where(ifMatch, args...)
+		}
+		if version != nil {
+			query = query.Where("version = ?", version)
+		}
+
+		result := query.Updates(&data)
+		if result.Error != nil {
+			return result.Error
+		}
+		if (ifMatch != "" || version != nil) && result.RowsAffected == 0 {
+			return ErrPreconditionFailed
+		}
+
+		err = s.writeRelations(tx, data["id"], links)
+		if err != nil {
+			return err
+		}
+
+		for relation, ids := range links {
+			data[relation.Field] = ids
+		}
+
+		return s.onChange(tx, tableName, model.HISTORY_UPDATE, []interface{}{data["id"]}, before)
+	})
+
+	// filtered counts depend on the updated values
+	s.clearCount(tableName)
 
 	return err
 }
 
 func (s *DBServiceImpl) Delete(db *gorm.DB, tableName string, data map[string]interface{}) error {
-	err := db.Table(tableName).
-		Where("id = ?", data["id"]).
-		Delete(&data).Error
+	return s.BatchDelete(db, tableName, []string{fmt.Sprintf("%v", data["id"])})
+}
 
-	cacheKey := "count_" + tableName
-	s.cache.Delete(cacheKey)
+func (s *DBServiceImpl) BatchDelete(db *gorm.DB, tableName string, data []string) error {
+	table, err := s.service.WithService().Table.Info(tableName, TABLE_INFO_SOFT_DELETE)
+	if err != nil {
+		return err
+	}
+
+	ids := []interface{}{}
+	for _, id := range data {
+		ids = append(ids, id)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		before, err := s.beforeChange(tx, tableName, ids)
+		if err != nil {
+			return err
+		}
+
+		ifMatch, args, expected, err := s.precondition(tx, tableName, ids)
+		if err != nil {
+			return err
+		}
+
+		query := tx.Table(tableName).Where("id IN ?", data)
+		if ifMatch != "" {
+			query = query.Where(ifMatch, args...)
+		}
+
+		var (
+			result   *gorm.DB
+			cascaded []cascadeChange
+		)
+		if table.SoftDelete {
+			result = query.
+				Where("deleted_at IS NULL").
+				Update("deleted_at", gorm.Expr("CURRENT_TIMESTAMP"))
+		} else {
+			cascaded, err = s.cascades(tx, tableName, ids)
+			if err != nil {
+				return err
+			}
+			result = query.Delete(&data)
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		if ifMatch != "" && result.RowsAffected != expected {
+			return ErrPreconditionFailed
+		}
+
+		err = s.onChange(tx, tableName, model.HISTORY_DELETE, ids, before)
+		if err != nil {
+			return err
+		}
+
+		return s.logCascades(tx, cascaded)
+	})
+
+	s.clearCount(tableName)
 
 	return err
 }
 
-func (s *DBServiceImpl) BatchDelete(db *gorm.DB, tableName string, data []string) error {
-	err := db.Table(tableName).
-		Where("id IN ?", data).
-		Delete(&data).Error
+// DeleteByFilter
+//
+// Delete every row matching the sql condition, returns the number of deleted rows
+func (s *DBServiceImpl) DeleteByFilter(db *gorm.DB, tableName string, filter string, args ...interface{}) (int64, error) {
+	condition, err := s.softDeleteCondition(tableName, false)
+	if err != nil {
+		return 0, err
+	}
+
+	err = checkFilter(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.checkReadable(db, tableName, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	query := db.Table(tableName).Where("("+filter+")", args...)
+	if condition != "" {
+		query = query.Where(condition)
+	}
+
+	var ids []interface{}
+	err = query.Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	data := []string{}
+	for _, id := range ids {
+		data = append(data, fmt.Sprintf("%v", id))
+	}
+
+	return int64(len(data)), s.BatchDelete(db, tableName, data)
+}
+
+// Restore
+//
+// Move soft deleted rows out of the trash
+func (s *DBServiceImpl) Restore(db *gorm.DB, tableName string, data []string) error {
+	if _, err := s.softDeleteCondition(tableName, true); err != nil {
+		return err
+	}
+
+	ids := []interface{}{}
+	for _, id := range data {
+		ids = append(ids, id)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(tableName).
+			Where("id IN ?", data).
+			Where("deleted_at IS NOT NULL").
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+
+		return s.onChange(tx, tableName, model.HISTORY_RESTORE, ids, nil)
+	})
+
+	s.clearCount(tableName)
 
 	return err
 }
+
+// beforeChange
+//
+// Keep the rows before they are changed, every user collection needs them for the change log.
+// A system table only needs them when tracked or sent to the realtime subscribers
+func (s *DBServiceImpl) beforeChange(db *gorm.DB, tableName string, ids []interface{}) (map[string]map[string]interface{}, error) {
+	table, err := s.service.WithService().Table.Info(tableName, TABLE_INFO_HISTORY, TABLE_INFO_SYSTEM)
+	if err != nil {
+		return nil, err
+	}
+	if table.System && !table.History && !s.service.WithService().Realtime.Active() {
+		return nil, nil
+	}
+
+	return s.snapshot(db, tableName, ids)
+}
+
+// onChange
+//
+// Called inside the transaction of every insert, update, delete and restore
+func (s *DBServiceImpl) onChange(db *gorm.DB, tableName string, operation string, ids []interface{}, before map[string]map[string]interface{}) error {
+	table, err := s.service.WithService().Table.Info(tableName, TABLE_INFO_HISTORY, TABLE_INFO_SYSTEM)
+	if err != nil {
+		return err
+	}
+	// every change of a user collection goes to the change log
+	logged := !table.System
+	realtime := s.service.WithService().Realtime.Active()
+	if !table.History && !realtime && !logged {
+		return nil
+	}
+
+	after := map[string]map[string]interface{}{}
+	if operation != model.HISTORY_DELETE {
+		after, err = s.snapshot(db, tableName, ids)
+		if err != nil {
+			return err
+		}
+	}
+
+	if logged {
+		err = s.recordChanges(db, tableName, operation, ids, before, after)
+		if err != nil {
+			return err
+		}
+	}
+	if realtime {
+		err = s.recordEvents(db, tableName, operation, ids, before, after)
+		if err != nil {
+			return err
+		}
+	}
+	if !table.History {
+		return nil
+	}
+
+	for _, id := range ids {
+		key := fmt.Sprintf("%v", id)
+		if operation == model.HISTORY_DELETE && before[key] == nil {
+			// row did not exist, nothing is deleted
+			continue
+		}
+
+		err = s.recordHistory(db, tableName, operation, id, before[key], after[key])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Purge
+//
+// Permanently delete soft deleted rows, the whole trash is emptied when no id is given
+func (s *DBServiceImpl) Purge(db *gorm.DB, tableName string, data []string) error {
+	if _, err := s.softDeleteCondition(tableName, true); err != nil {
+		return err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Table(tableName).Where("deleted_at IS NOT NULL")
+		if len(data) > 0 {
+			query = query.Where("id IN ?", data)
+		}
+
+		return s.purgeRows(tx, tableName, query)
+	})
+
+	s.clearCount(tableName)
+
+	return err
+}
+
+// purgeRows
+//
+// Delete the trashed rows of the query for good, the rows referencing them are still changed
+// through their foreign keys
+func (s *DBServiceImpl) purgeRows(tx *gorm.DB, tableName string, query *gorm.DB) error {
+	var ids []interface{}
+	err := query.Session(&gorm.Session{}).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+
+	cascaded, err := s.cascades(tx, tableName, ids)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Table(tableName).Where("id IN ?", ids).Delete(nil).Error
+	if err != nil {
+		return err
+	}
+
+	return s.logCascades(tx, cascaded)
+}
+
+// PurgeExpired
+//
+// Permanently delete rows that have been in the trash longer than the retention
+func (s *DBServiceImpl) PurgeExpired(db *gorm.DB, retention time.Duration) error {
+	var tables []string
+	err := db.Model(&model.Tables{}).Where("soft_delete = ?", true).Pluck("name", &tables).Error
+	if err != nil {
+		return err
+	}
+
+	for _, tableName := range tables {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return s.purgeRows(tx, tableName, tx.Table(tableName).
+				Where("deleted_at IS NOT NULL").
+				Where("deleted_at < ?", time.Now().UTC().Add(-retention).Format("2006-01-02 15:04:05")))
+		})
+		if err != nil {
+			return err
+		}
+
+		s.clearCount(tableName)
+	}
+
+	return nil
+}
+
+func (s *DBServiceImpl) clearCount(tableName string) {
+	prefix := "count_" + tableName + "\x00"
+	for key := range s.cache.Items() {
+		if strings.HasPrefix(key, prefix) {
+			s.cache.Delete(key)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var ErrPreconditionFailed = errors.New("the data has been changed since it was read")
+
+type ifMatchKey struct{}
+
+// WithIfMatch
+//
+// Entity tags of an If-Match header, the writes made with the context only apply to rows
+// still holding one of them. * matches any existing row
+func WithIfMatch(ctx context.Context, tags []string) context.Context {
+	return context.WithValue(ctx, ifMatchKey{}, tags)
+}
+
+func ifMatchFromContext(ctx context.Context) []string {
+	if ctx == nil {
+		return nil
+	}
+
+	tags, _ := ctx.Value(ifMatchKey{}).([]string)
+	return tags
+}
+
+type rowTag struct {
+	value interface{}
+	etag  string
+}
+
+// rowTags
+//
+// Value the entity tag of each row is made from, with the sql expression reading it. The
+// version is used on versioned tables and updated_at on the others, which the update trigger
+// moves forward on every write
+func (s *DBServiceImpl) rowTags(db *gorm.DB, tableName string, ids []interface{}) (map[string]rowTag, string, error) {
+	table, err := s.service.WithService().Table.Info(tableName, TABLE_INFO_VERSIONED, TABLE_INFO_TYPE)
+	if err != nil {
+		return nil, "", err
+	}
+	if table.IsView() {
+		return map[string]rowTag{}, "", nil
+	}
+
+	expression := "CAST(updated_at AS TEXT)"
+	if table.Versioned {
+		expression = "version"
+	}
+
+	query := db.Table(tableName).Select("id, "+expression+" AS _etag").Where("id IN ?", ids)
+
+	condition, err := s.softDeleteCondition(tableName, false)
+	if err != nil {
+		return nil, "", err
+	}
+	if condition != "" {
+		query = query.Where(condition)
+	}
+
+	var rows []map[string]interface{}
+	err = query.Find(&rows).Error
+	if err != nil {
+		return nil, "", err
+	}
+
+	tags := map[string]rowTag{}
+	for _, row := range rows {
+		value := ColumnValue(row, "_etag")
+		if text, ok := value.([]byte); ok {
+			value = string(text)
+		}
+
+		etag := fmt.Sprintf(`"v%v"`, value)
+		if !table.Versioned {
+			hash := fnv.New64a()
+			hash.Write([]byte(fmt.Sprintf("%v", value)))
+			etag = fmt.Sprintf(`"t%x"`, hash.Sum64())
+		}
+
+		tags[fmt.Sprintf("%v", ColumnValue(row, "id"))] = rowTag{value: value, etag: etag}
+	}
+
+	return tags, expression, nil
+}
+
+// ETags
+//
+// Entity tag of each row by id, it changes whenever the row is written. Missing and trashed
+// rows are left out
+func (s *DBServiceImpl) ETags(db *gorm.DB, tableName string, ids []interface{}) (map[string]string, error) {
+	tags, _, err := s.rowTags(db, tableName, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	etags := map[string]string{}
+	for id, tag := range tags {
+		etags[id] = tag.etag
+	}
+
+	return etags, nil
+}
+
+// precondition
+//
+// Where clause applying a write only to the rows still matching the If-Match tags of the
+// context, with the number of rows the write must reach. The condition is empty when the write
+// is unconditional, ErrPreconditionFailed is returned when a row is missing or has changed
+func (s *DBServiceImpl) precondition(db *gorm.DB, tableName string, ids []interface{}) (string, []interface{}, int64, error) {
+	ifMatch := ifMatchFromContext(db.Statement.Context)
+	if ifMatch == nil || len(ids) == 0 {
+		return "", nil, 0, nil
+	}
+
+	tags, expression, err := s.rowTags(db, tableName, ids)
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	conditions := []string{}
+	args := []interface{}{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		key := fmt.Sprintf("%v", id)
+		tag, ok := tags[key]
+		if !ok || !matchETag(ifMatch, tag.etag) {
+			return "", nil, 0, ErrPreconditionFailed
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		conditions = append(conditions, fmt.Sprintf("(id = ? AND %s = ?)", expression))
+		args = append(args, id, tag.value)
+	}
+
+	return "(" + strings.Join(conditions, " OR ") + ")", args, int64(len(seen)), nil
+}
+
+// matchETag
+//
+// Strong comparison of If-Match, weak tags never match
+func matchETag(tags []string, etag string) bool {
+	for _, tag := range tags {
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
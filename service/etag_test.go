@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"funcbase/model"
+	"testing"
+)
+
+func TestETags(t *testing.T) {
+	svc, db := newTestService(t)
+	createTables(t, svc, db,
+		model.CreateTable{Name: "notes", Fields: []model.Field{{Type: "text", Name: "body"}}},
+		model.CreateTable{Name: "drafts", Versioned: true, Fields: []model.Field{{Type: "text", Name: "body"}}},
+	)
+
+	for _, table := range []string{"notes", "drafts"} {
+		t.Run(table, func(t *testing.T) {
+			insertRows(t, svc, db, table, map[string]interface{}{"body": "a"})
+
+			tag := func() string {
+				t.Helper()
+				tags, err := svc.DB.ETags(db, table, []interface{}{1})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return tags["1"]
+			}
+
+			// writes within the same second, and likely the same millisecond
+			seen := map[string]bool{tag(): true}
+			for _, body := range []string{"b", "c", "c"} {
+				err := svc.DB.Update(db, table, map[string]interface{}{"id": 1, "body": body})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				current := tag()
+				if seen[current] {
+					t.Fatalf("tag %s given again after writing %q", current, body)
+				}
+				seen[current] = true
+			}
+
+			stale := db.WithContext(WithIfMatch(db.Statement.Context, []string{`"stale"`}))
+			err := svc.DB.Update(stale, table, map[string]interface{}{"id": 1, "body": "d"})
+			if !errors.Is(err, ErrPreconditionFailed) {
+				t.Errorf("update with a stale tag: error %v, want ErrPreconditionFailed", err)
+			}
+
+			current := db.WithContext(WithIfMatch(db.Statement.Context, []string{tag()}))
+			err = svc.DB.Update(current, table, map[string]interface{}{"id": 1, "body": "d"})
+			if err != nil {
+				t.Errorf("update with the current tag: %v", err)
+			}
+			err = svc.DB.Update(current, table, map[string]interface{}{"id": 1, "body": "e"})
+			if !errors.Is(err, ErrPreconditionFailed) {
+				t.Errorf("second update with the same tag: error %v, want ErrPreconditionFailed", err)
+			}
+		})
+	}
+}
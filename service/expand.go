@@ -0,0 +1,152 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type ExpandParams struct {
+	// relation paths to expand, nested relation is separated by dot. ex: author, comments.author
+	Expand   []string
+	MaxDepth int
+	// ViewCondition is the condition of the rows of a table the requester may view, checked by
+	// the query reading the referenced rows. Every row is left out on ErrRuleDenied
+	ViewCondition func(tableName string) (string, []interface{}, error)
+}
+
+// Expand
+//
+// Embed the rows referenced by relation fields under the "expand" key of each row.
+// Referenced rows are fetched with one query per relation on each level
+func (s *DBServiceImpl) Expand(db *gorm.DB, tableName string, data []map[string]interface{}, params *ExpandParams) error {
+	if len(data) == 0 || len(params.Expand) == 0 {
+		return nil
+	}
+
+	fields := []string{}
+	nested := map[string][]string{}
+	for _, path := range params.Expand {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+
+		if strings.Count(path, ".")+1 > params.MaxDepth {
+			return fmt.Errorf("expand %s exceeds the maximum depth of %d", path, params.MaxDepth)
+		}
+
+		parts := strings.SplitN(path, ".", 2)
+		if _, ok := nested[parts[0]]; !ok {
+			fields = append(fields, parts[0])
+			nested[parts[0]] = []string{}
+		}
+		if len(parts) > 1 {
+			nested[parts[0]] = append(nested[parts[0]], parts[1])
+		}
+	}
+
+	relations, err := s.service.WithService().Table.Relations(tableName)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		found := false
+		for _, relation := range relations {
+			if relation.Field != field {
+				continue
+			}
+			found = true
+
+			ids := []interface{}{}
+			seen := map[string]bool{}
+			for _, row := range data {
+				for _, id := range relationIDs(row[field]) {
+					key := fmt.Sprintf("%v", id)
+					if !seen[key] {
+						seen[key] = true
+						ids = append(ids, id)
+					}
+				}
+			}
+
+			fetch := &FetchParams{
+				Table: relation.Reference,
+				IDs:   ids,
+			}
+			if params.ViewCondition != nil && len(ids) > 0 {
+				fetch.Condition, fetch.ConditionArgs, err = params.ViewCondition(relation.Reference)
+				if errors.Is(err, ErrRuleDenied) {
+					ids = nil
+				} else if err != nil {
+					return err
+				}
+			}
+
+			records := []map[string]interface{}{}
+			if len(ids) > 0 {
+				records, err = s.Fetch(db, fetch)
+				if err != nil {
+					return err
+				}
+
+				err = s.Expand(db, relation.Reference, records, &ExpandParams{
+					Expand:        nested[field],
+					MaxDepth:      params.MaxDepth - 1,
+					ViewCondition: params.ViewCondition,
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			recordByID := map[string]map[string]interface{}{}
+			for _, record := range records {
+				recordByID[fmt.Sprintf("%v", record["id"])] = record
+			}
+
+			for _, row := range data {
+				expand, ok := row["expand"].(map[string]interface{})
+				if !ok {
+					expand = map[string]interface{}{}
+					row["expand"] = expand
+				}
+
+				if relation.Multiple {
+					linked := []map[string]interface{}{}
+					for _, id := range relationIDs(row[field]) {
+						if record, ok := recordByID[fmt.Sprintf("%v", id)]; ok {
+							linked = append(linked, record)
+						}
+					}
+					expand[field] = linked
+					continue
+				}
+
+				if record, ok := recordByID[fmt.Sprintf("%v", row[field])]; ok {
+					expand[field] = record
+				}
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("%s is not a relation field of %s", field, tableName)
+		}
+	}
+
+	return nil
+}
+
+func relationIDs(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExpandViewCondition(t *testing.T) {
+	svc, db := newTestService(t)
+	createMembers(t, svc, db)
+
+	errRule := errors.New("rule failed")
+	tests := []struct {
+		name      string
+		condition func(tableName string) (string, []interface{}, error)
+		authors   []interface{}
+		err       error
+	}{
+		{"no rule", nil, []interface{}{"first", "second"}, nil},
+		{"rule on the member", func(tableName string) (string, []interface{}, error) {
+			return "id = ?", []interface{}{1}, nil
+		}, []interface{}{"first", nil}, nil},
+		{"denied", func(tableName string) (string, []interface{}, error) {
+			return "", nil, ErrRuleDenied
+		}, []interface{}{nil, nil}, nil},
+		{"failed", func(tableName string) (string, []interface{}, error) {
+			return "", nil, errRule
+		}, nil, errRule},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows, err := svc.DB.Fetch(db, &FetchParams{Table: "posts", Order: "id"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = svc.DB.Expand(db, "posts", rows, &ExpandParams{
+				Expand:        []string{"author"},
+				MaxDepth:      2,
+				ViewCondition: test.condition,
+			})
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+
+			for i, row := range rows {
+				var bio interface{}
+				if author, ok := row["expand"].(map[string]interface{})["author"].(map[string]interface{}); ok {
+					bio = author["bio"]
+				}
+				if bio != test.authors[i] {
+					t.Errorf("author of post %v: %v, want %v", row["id"], bio, test.authors[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"gorm.io/gorm"
+)
+
+// RowWriter
+//
+// Destination of streamed rows, the header is written once before the first row
+type RowWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []interface{}) error
+}
+
+// Stream
+//
+// Read the rows matching the fetch params from a cursor and hand them to the writer one by one,
+// so that large tables are exported without being loaded in memory. Multiple relations are not included
+func (s *DBServiceImpl) Stream(db *gorm.DB, option *FetchParams, writer RowWriter) error {
+	query, err := s.fetchQuery(db, option)
+	if err != nil {
+		return err
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteHeader(columns)
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return err
+		}
+
+		for i, value := range values {
+			if bytes, ok := value.([]byte); ok {
+				values[i] = string(bytes)
+			}
+		}
+
+		err = writer.WriteRow(values)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"funcbase/model"
+
+	"gorm.io/gorm"
+)
+
+type actorKey struct{}
+
+// Actor
+//
+// The user or admin making a change, carried on the db context so the change can be traced
+type Actor struct {
+	ID        string
+	Role      string
+	RequestID string
+}
+
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func ActorFromContext(ctx context.Context) Actor {
+	if ctx == nil {
+		return Actor{}
+	}
+
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// snapshot
+//
+// Fetch the current rows of the given ids, keyed by id. Hidden fields are kept whoever makes
+// the change
+func (s *DBServiceImpl) snapshot(db *gorm.DB, tableName string, ids []interface{}) (map[string]map[string]interface{}, error) {
+	rows := map[string]map[string]interface{}{}
+	if len(ids) == 0 {
+		return rows, nil
+	}
+
+	data, err := s.Fetch(db, &FetchParams{
+		Table: tableName,
+		IDs:   ids,
+		all:   true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range data {
+		rows[fmt.Sprintf("%v", row["id"])] = row
+	}
+
+	return rows, nil
+}
+
+// recordHistory
+//
+// Write a history row of a single record. Update only keeps the changed fields,
+// timestamps and authentication fields are never recorded
+func (s *DBServiceImpl) recordHistory(db *gorm.DB, tableName string, operation string, id interface{}, before map[string]interface{}, after map[string]interface{}) error {
+	before = historyValues(before)
+	after = historyValues(after)
+
+	if operation == model.HISTORY_UPDATE {
+		changedBefore := map[string]interface{}{}
+		changedAfter := map[string]interface{}{}
+		for k, v := range after {
+			old, err := json.Marshal(before[k])
+			if err != nil {
+				return err
+			}
+			current, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+
+			if string(old) != string(current) {
+				changedBefore[k] = before[k]
+				changedAfter[k] = v
+			}
+		}
+
+		if len(changedAfter) == 0 {
+			return nil
+		}
+
+		before = changedBefore
+		after = changedAfter
+	}
+
+	beforeJson, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+
+	afterJson, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	actor := ActorFromContext(db.Statement.Context)
+
+	return db.Session(&gorm.Session{NewDB: true}).Create(&model.History{
+		Table:     tableName,
+		RecordID:  fmt.Sprintf("%v", id),
+		Operation: operation,
+		Before:    string(beforeJson),
+		After:     string(afterJson),
+		ActorID:   actor.ID,
+		ActorRole: actor.Role,
+		RequestID: actor.RequestID,
+	}).Error
+}
+
+func historyValues(row map[string]interface{}) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+
+	values := map[string]interface{}{}
+	for k, v := range row {
+		switch k {
+		case "password", "salt", "created_at", "updated_at", "deleted_at", "expand":
+			continue
+		}
+		values[k] = v
+	}
+
+	return values
+}
+
+func (s *DBServiceImpl) History(db *gorm.DB, tableName string, id string) ([]model.History, error) {
+	histories := []model.History{}
+	err := db.Model(&model.History{}).
+		Where("table_name = ?", tableName).
+		Where("record_id = ?", id).
+		Order("id DESC").
+		Find(&histories).Error
+
+	return histories, err
+}
+
+// Revert
+//
+// Bring a record back to its state right after the given history. The state is rebuilt by
+// undoing every newer change, the record is inserted back when it has been deleted. A record
+// removed without history, eg. while the history was turned off, can't be rebuilt
+func (s *DBServiceImpl) Revert(db *gorm.DB, tableName string, id string, historyID uint) (map[string]interface{}, error) {
+	var target model.History
+	err := db.Model(&model.History{}).
+		Where("id = ?", historyID).
+		Where("table_name = ?", tableName).
+		Where("record_id = ?", id).
+		First(&target).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if target.Operation == model.HISTORY_DELETE {
+		return nil, errors.New("cannot revert to a deleted version")
+	}
+
+	newer := []model.History{}
+	err = db.Model(&model.History{}).
+		Where("table_name = ?", tableName).
+		Where("record_id = ?", id).
+		Where("id > ?", historyID).
+		Order("id DESC").
+		Find(&newer).Error
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := s.snapshot(db, tableName, []interface{}{id})
+	if err != nil {
+		return nil, err
+	}
+
+	state, exists := current[id]
+	state = historyValues(state)
+	for _, history := range newer {
+		before := map[string]interface{}{}
+		if history.Before != "" && history.Before != "null" {
+			err = json.Unmarshal([]byte(history.Before), &before)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if state == nil && history.Operation != model.HISTORY_DELETE {
+			// the row went away without a delete of its own, like a delete made while the
+			// history was turned off, the changes before it can't be undone
+			return nil, errors.New("record was removed without history, it can't be reverted")
+		}
+
+		switch history.Operation {
+		case model.HISTORY_DELETE:
+			state = before
+		case model.HISTORY_INSERT, model.HISTORY_RESTORE:
+			// the record did not exist before
+			state = nil
+		default:
+			for k, v := range before {
+				state[k] = v
+			}
+		}
+	}
+
+	if state == nil {
+		return nil, errors.New("record does not exist on the given version")
+	}
+	state["id"] = id
+
+	table, err := s.service.WithService().Table.Info(tableName, TABLE_INFO_SOFT_DELETE, TABLE_INFO_VERSIONED)
+	if err != nil {
+		return nil, err
+	}
+	if table.Versioned {
+		// the version keeps going up, an old one would be taken as the expected version
+		delete(state, "version")
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if !exists && table.SoftDelete {
+			// deleted record might still be on the trash
+			var trashed int64
+			err := tx.Table(tableName).Where("id = ?", id).Count(&trashed).Error
+			if err != nil {
+				return err
+			}
+
+			if trashed > 0 {
+				err = s.Restore(tx, tableName, []string{id})
+				if err != nil {
+					return err
+				}
+				exists = true
+			}
+		}
+
+		if exists {
+			return s.Update(tx, tableName, state)
+		}
+
+		return s.Insert(tx, tableName, state)
+	})
+
+	return state, err
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"funcbase/model"
+	"testing"
+)
+
+func TestRevert(t *testing.T) {
+	svc, db := newTestService(t)
+	createTables(t, svc, db, model.CreateTable{Name: "notes", History: true, Fields: []model.Field{{Type: "text", Name: "body"}}})
+	insertRows(t, svc, db, "notes", map[string]interface{}{"body": "a"})
+	for _, body := range []string{"b", "c"} {
+		err := svc.DB.Update(db, "notes", map[string]interface{}{"id": 1, "body": body})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	histories, err := svc.DB.History(db, "notes", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histories) != 3 || histories[2].Operation != model.HISTORY_INSERT {
+		t.Fatalf("histories %v", histories)
+	}
+	inserted, updated := histories[2].ID, histories[1].ID
+
+	body := func() interface{} {
+		t.Helper()
+		rows, err := svc.DB.Fetch(db, &FetchParams{Table: "notes", IDs: []interface{}{1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return rows[0]["body"]
+	}
+
+	_, err = svc.DB.Revert(db, "notes", "1", inserted)
+	if err != nil || body() != "a" {
+		t.Errorf("revert to the insert: body %v, error %v", body(), err)
+	}
+
+	// a deleted record is inserted back
+	err = svc.DB.BatchDelete(db, "notes", []string{"1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = svc.DB.Revert(db, "notes", "1", updated)
+	if err != nil || body() != "b" {
+		t.Errorf("revert of a deleted record: body %v, error %v", body(), err)
+	}
+
+	// the insert made by the revert is undone as well
+	_, err = svc.DB.Revert(db, "notes", "1", inserted)
+	if err != nil || body() != "a" {
+		t.Errorf("revert past an earlier revert: body %v, error %v", body(), err)
+	}
+
+	histories, err = svc.DB.History(db, "notes", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = svc.DB.BatchDelete(db, "notes", []string{"1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := svc.DB.History(db, "notes", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = svc.DB.Revert(db, "notes", "1", deleted[0].ID)
+	if err == nil {
+		t.Error("reverted to a deleted version")
+	}
+
+	// a record removed without history can't be rebuilt
+	_, err = svc.DB.Revert(db, "notes", "1", histories[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Exec("DELETE FROM notes WHERE id = 1").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = svc.DB.Revert(db, "notes", "1", updated)
+	if err == nil || body() != nil {
+		t.Errorf("revert of a record removed without history: body %v, error %v", body(), err)
+	}
+}
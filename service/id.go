@@ -0,0 +1,46 @@
+package service
+
+import (
+	"funcbase/model"
+	pkg_id "funcbase/pkg/id"
+)
+
+// newID
+//
+// Id of a new row following the strategy of the table, nil for integer ids which are
+// assigned by sqlite
+func (s *DBServiceImpl) newID(tableName string) (interface{}, error) {
+	table, err := s.service.WithService().Table.Info(tableName, TABLE_INFO_ID_TYPE, TABLE_INFO_ID_PREFIX)
+	if err != nil {
+		return nil, err
+	}
+
+	switch table.IDType {
+	case model.ID_TYPE_UUID:
+		return pkg_id.UUIDv7()
+	case model.ID_TYPE_ULID:
+		return pkg_id.ULID()
+	case model.ID_TYPE_NANOID:
+		return pkg_id.NanoID(table.IDPrefix)
+	}
+
+	return nil, nil
+}
+
+// assignID
+//
+// Fill the id of a row about to be inserted unless it is already given
+func (s *DBServiceImpl) assignID(tableName string, data map[string]interface{}) error {
+	if id, ok := data["id"]; ok && id != nil && id != "" {
+		return nil
+	}
+
+	id, err := s.newID(tableName)
+	if err != nil || id == nil {
+		return err
+	}
+
+	data["id"] = id
+
+	return nil
+}
@@ -0,0 +1,485 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"funcbase/model"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	IMPORT_INSERT = "insert"
+	// update the rows matching the key columns, insert the others
+	IMPORT_UPSERT = "upsert"
+	// delete every existing row before inserting
+	IMPORT_REPLACE = "replace"
+
+	// stop checking the rows once this many errors are collected
+	IMPORT_MAX_ERRORS = 100
+	// sqlite limit of bound parameters per statement
+	IMPORT_MAX_VARIABLES = 32766
+)
+
+var ErrImportRejected = errors.New("import rejected, no row has been written")
+
+type ImportParams struct {
+	Table string
+	Mode  string
+	// columns identifying an existing row on upsert, they must be covered by a unique constraint
+	Key []string
+	// source column to field name, source columns mapped to an empty name are skipped
+	Mapping map[string]string
+	// convert text values to the type of their field, used for csv
+	Coerce bool
+	Rows   []map[string]interface{}
+	// check of each row before it is written, e.g. the create rule of the requesting user.
+	// A row it rejects is reported with the row errors
+	Allow func(row map[string]interface{}) error
+	// condition the rows replaced by an upsert must match, e.g. the update rule of the
+	// requesting user. Nothing is written when one of them doesn't
+	UpdateCondition     string
+	UpdateConditionArgs []interface{}
+}
+
+type ImportError struct {
+	Row       int                  `json:"row"`
+	Error     string               `json:"error"`
+	Violation *ConstraintViolation `json:"violation,omitempty"`
+}
+
+type ImportResult struct {
+	Total    int           `json:"total"`
+	Inserted int           `json:"inserted"`
+	Updated  int           `json:"updated"`
+	Deleted  int64         `json:"deleted"`
+	Errors   []ImportError `json:"errors"`
+}
+
+type importRow struct {
+	number  int
+	data    map[string]interface{}
+	columns []string
+	links   map[model.Relation][]interface{}
+}
+
+// Import
+//
+// Write all the rows in batches inside a single transaction. Every row is checked and the
+// errors are reported per row, nothing is written when a single row is rejected
+func (s *DBServiceImpl) Import(db *gorm.DB, params ImportParams) (ImportResult, error) {
+	result := ImportResult{
+		Total:  len(params.Rows),
+		Errors: []ImportError{},
+	}
+
+	switch params.Mode {
+	case "":
+		params.Mode = IMPORT_INSERT
+	case IMPORT_INSERT, IMPORT_REPLACE:
+	case IMPORT_UPSERT:
+		if len(params.Key) == 0 {
+			params.Key = []string{"id"}
+		}
+	default:
+		return result, fmt.Errorf("invalid import mode %s", params.Mode)
+	}
+
+	columns, err := s.service.WithService().Table.Columns(params.Table, false, false)
+	if err != nil {
+		return result, err
+	}
+
+	types := map[string]string{}
+	for _, column := range columns {
+		columnType := fmt.Sprintf("%v", ColumnValue(column, "type"))
+		if column["multiple"] == true {
+			columnType = "MULTIPLE"
+		} else if column["text_id"] == true {
+			columnType = "TEXT"
+		}
+		types[fmt.Sprintf("%v", ColumnValue(column, "name"))] = columnType
+	}
+
+	for _, key := range params.Key {
+		if types[key] == "" || types[key] == "MULTIPLE" {
+			return result, fmt.Errorf("invalid key column %s", key)
+		}
+	}
+
+	rows := []importRow{}
+	for i, source := range params.Rows {
+		row, err := s.importRow(params, types, source)
+		if err == nil {
+			// an upserted row may replace an existing one, its fields are checked as updated
+			err = s.checkWrite(db, params.Table, row.data, params.Mode != IMPORT_UPSERT)
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, ImportError{Row: i + 1, Error: err.Error()})
+			if len(result.Errors) >= IMPORT_MAX_ERRORS {
+				break
+			}
+			continue
+		}
+
+		row.number = i + 1
+		rows = append(rows, row)
+	}
+
+	if len(result.Errors) > 0 {
+		return result, ErrImportRejected
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if params.Mode == IMPORT_REPLACE {
+			deleted, err := s.clearTable(tx, params.Table)
+			if err != nil {
+				return err
+			}
+			result.Deleted = deleted
+		}
+
+		batchSize := tx.CreateBatchSize
+		if batchSize <= 0 {
+			batchSize = len(rows)
+		}
+
+		for len(rows) > 0 && len(result.Errors) < IMPORT_MAX_ERRORS {
+			batch := nextImportBatch(rows, batchSize)
+			rows = rows[len(batch):]
+
+			err := s.importBatch(tx, params, batch, &result)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(result.Errors) > 0 {
+			return ErrImportRejected
+		}
+
+		return nil
+	})
+
+	s.clearCount(params.Table)
+
+	if err != nil {
+		result.Inserted, result.Updated, result.Deleted = 0, 0, 0
+	}
+
+	return result, err
+}
+
+// importRow
+//
+// Map the source columns to the fields of the table and coerce their values
+func (s *DBServiceImpl) importRow(params ImportParams, types map[string]string, source map[string]interface{}) (importRow, error) {
+	row := importRow{data: map[string]interface{}{}}
+
+	for column, value := range source {
+		field := column
+		if mapped, ok := params.Mapping[column]; ok {
+			if mapped == "" {
+				continue
+			}
+			field = mapped
+		}
+
+		fieldType, ok := types[field]
+		if !ok {
+			return row, fmt.Errorf("unknown field %s", field)
+		}
+
+		if params.Coerce {
+			coerced, err := coerceValue(fieldType, value)
+			if err != nil {
+				return row, fmt.Errorf("invalid value for %s: %s", field, err.Error())
+			}
+			value = coerced
+		}
+
+		row.data[field] = value
+	}
+
+	if len(row.data) == 0 {
+		return row, errors.New("row is empty")
+	}
+
+	// a key matching an existing row keeps its id, see importStatement
+	err := s.assignID(params.Table, row.data)
+	if err != nil {
+		return row, err
+	}
+
+	for _, key := range params.Key {
+		if row.data[key] == nil {
+			return row, fmt.Errorf("key %s is missing", key)
+		}
+	}
+
+	if params.Allow != nil {
+		err = params.Allow(row.data)
+		if err != nil {
+			return row, err
+		}
+	}
+
+	links, err := s.splitRelations(params.Table, row.data)
+	if err != nil {
+		return row, err
+	}
+	row.links = links
+
+	for column := range row.data {
+		row.columns = append(row.columns, column)
+	}
+	sort.Strings(row.columns)
+
+	return row, nil
+}
+
+func coerceValue(fieldType string, value interface{}) (interface{}, error) {
+	text, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+
+	switch fieldType {
+	case "INTEGER", "RELATION":
+		return strconv.ParseInt(text, 10, 64)
+	case "REAL":
+		return strconv.ParseFloat(text, 64)
+	case "BOOLEAN":
+		return strconv.ParseBool(text)
+	default:
+		return text, nil
+	}
+}
+
+// nextImportBatch
+//
+// Consecutive rows setting the same columns, they are written by a single statement
+func nextImportBatch(rows []importRow, batchSize int) []importRow {
+	columns := strings.Join(rows[0].columns, ",")
+	if limit := IMPORT_MAX_VARIABLES / (len(rows[0].columns) + 1); batchSize > limit {
+		batchSize = limit
+	}
+
+	size := 1
+	for size < len(rows) && size < batchSize {
+		if strings.Join(rows[size].columns, ",") != columns {
+			break
+		}
+		size++
+	}
+
+	return rows[:size]
+}
+
+// importBatch
+//
+// Insert or upsert a batch with one statement. When the statement fails, the rows are
+// written one by one to find which of them are rejected
+func (s *DBServiceImpl) importBatch(tx *gorm.DB, params ImportParams, batch []importRow, result *ImportResult) error {
+	columns := batch[0].columns
+
+	existing := map[string]bool{}
+	before := map[string]map[string]interface{}{}
+	if params.Mode == IMPORT_UPSERT {
+		ids, err := s.existingIDs(tx, params.Table, params.Key, batch)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			existing[fmt.Sprintf("%v", id)] = true
+		}
+
+		if params.UpdateCondition != "" && len(ids) > 0 {
+			var denied int64
+			err = tx.Table(params.Table).
+				Where("id IN ?", ids).
+				Where("NOT COALESCE("+params.UpdateCondition+", 0)", params.UpdateConditionArgs...).
+				Count(&denied).Error
+			if err != nil {
+				return err
+			}
+			if denied > 0 {
+				return ErrRuleDenied
+			}
+		}
+
+		before, err = s.beforeChange(tx, params.Table, ids)
+		if err != nil {
+			return err
+		}
+	}
+
+	ids, err := importStatement(tx, params, columns, batch)
+	if err != nil {
+		return s.importErrors(tx, params, columns, batch, existing, before, result)
+	}
+
+	return s.importWritten(tx, params, batch, ids, existing, before, result)
+}
+
+// importWritten
+//
+// Link the relations of the written rows and record their changes, ids are returned in the
+// order of the rows. A key repeated in the file updates the row its first occurrence wrote
+func (s *DBServiceImpl) importWritten(tx *gorm.DB, params ImportParams, rows []importRow, ids []interface{}, existing map[string]bool, before map[string]map[string]interface{}, result *ImportResult) error {
+	inserted, updated := []interface{}{}, []interface{}{}
+	seen := map[string]bool{}
+	for i, id := range ids {
+		key := fmt.Sprintf("%v", id)
+		switch {
+		case seen[key]:
+			// the change of the row is already recorded with its final state
+			result.Updated++
+		case existing[key]:
+			updated = append(updated, id)
+			result.Updated++
+		default:
+			inserted = append(inserted, id)
+			result.Inserted++
+		}
+		seen[key] = true
+
+		if i < len(rows) && len(rows[i].links) > 0 {
+			err := s.writeRelations(tx, id, rows[i].links)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := s.onChange(tx, params.Table, model.HISTORY_INSERT, inserted, nil)
+	if err != nil {
+		return err
+	}
+
+	return s.onChange(tx, params.Table, model.HISTORY_UPDATE, updated, before)
+}
+
+func importStatement(tx *gorm.DB, params ImportParams, columns []string, batch []importRow) ([]interface{}, error) {
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+
+	values := []string{}
+	vars := []interface{}{}
+	for _, row := range batch {
+		values = append(values, placeholders)
+		for _, column := range columns {
+			vars = append(vars, row.data[column])
+		}
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", params.Table, strings.Join(columns, ", "), strings.Join(values, ", "))
+
+	if params.Mode == IMPORT_UPSERT {
+		updates := []string{}
+		for _, column := range columns {
+			// rows keep their id, new rows might come with a generated one
+			if !containsColumn(params.Key, column) && column != "id" {
+				updates = append(updates, fmt.Sprintf("%s = excluded.%s", column, column))
+			}
+		}
+		if len(updates) == 0 {
+			// returning skips the rows left untouched by DO NOTHING
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", params.Key[0], params.Key[0]))
+		}
+
+		query += fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(params.Key, ", "), strings.Join(updates, ", "))
+	}
+
+	var ids []interface{}
+	err := tx.Raw(query+" RETURNING id", vars...).Scan(&ids).Error
+
+	return ids, err
+}
+
+// importErrors
+//
+// Write the rows of a failed batch one at a time inside a savepoint to report the rejected ones
+func (s *DBServiceImpl) importErrors(tx *gorm.DB, params ImportParams, columns []string, batch []importRow, existing map[string]bool, before map[string]map[string]interface{}, result *ImportResult) error {
+	written := []importRow{}
+	writtenIDs := []interface{}{}
+	for _, row := range batch {
+		err := tx.SavePoint("import_row").Error
+		if err != nil {
+			return err
+		}
+
+		ids, err := importStatement(tx, params, columns, []importRow{row})
+		if err == nil {
+			written = append(written, row)
+			writtenIDs = append(writtenIDs, ids...)
+			continue
+		}
+
+		importError := ImportError{Row: row.number, Error: err.Error()}
+		if violation, ok := s.service.WithService().Table.Violation(err); ok {
+			importError.Error = violation.Error()
+			importError.Violation = violation
+		}
+		result.Errors = append(result.Errors, importError)
+
+		err = tx.RollbackTo("import_row").Error
+		if err != nil {
+			return err
+		}
+
+		if len(result.Errors) >= IMPORT_MAX_ERRORS {
+			break
+		}
+	}
+
+	return s.importWritten(tx, params, written, writtenIDs, existing, before, result)
+}
+
+// existingIDs
+//
+// IDs of the rows already stored with the key of a row of the batch
+func (s *DBServiceImpl) existingIDs(tx *gorm.DB, tableName string, key []string, batch []importRow) ([]interface{}, error) {
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(key)), ", ") + ")"
+
+	values := []string{}
+	vars := []interface{}{}
+	for _, row := range batch {
+		values = append(values, placeholders)
+		for _, column := range key {
+			vars = append(vars, row.data[column])
+		}
+	}
+
+	ids := []interface{}{}
+	err := tx.Table(tableName).
+		Where(fmt.Sprintf("(%s) IN (VALUES %s)", strings.Join(key, ", "), strings.Join(values, ", ")), vars...).
+		Pluck("id", &ids).Error
+
+	return ids, err
+}
+
+// clearTable
+//
+// Delete every row of the table, trashed rows included
+func (s *DBServiceImpl) clearTable(tx *gorm.DB, tableName string) (int64, error) {
+	deleted, err := s.DeleteByFilter(tx, tableName, "1 = 1")
+	if err != nil {
+		return 0, err
+	}
+
+	condition, err := s.softDeleteCondition(tableName, false)
+	if err != nil || condition == "" {
+		return deleted, err
+	}
+
+	return deleted, s.Purge(tx, tableName, nil)
+}
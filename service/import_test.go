@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"funcbase/model"
+	"testing"
+)
+
+func TestImportUpsert(t *testing.T) {
+	svc, db := newTestService(t)
+	createTables(t, svc, db, model.CreateTable{Name: "items", Fields: []model.Field{
+		{Type: "text", Name: "sku", Unique: true},
+		{Type: "number", Name: "qty"},
+	}})
+	insertRows(t, svc, db, "items", map[string]interface{}{"sku": "a", "qty": 1}, map[string]interface{}{"sku": "b", "qty": 2})
+
+	stock := func() string {
+		t.Helper()
+		var rows []struct {
+			Sku string
+			Qty int
+		}
+		err := db.Table("items").Order("id").Find(&rows).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(rows)
+	}
+
+	// the repeated key updates the row its first occurrence inserted
+	result, err := svc.DB.Import(db, ImportParams{
+		Table:  "items",
+		Mode:   IMPORT_UPSERT,
+		Key:    []string{"sku"},
+		Coerce: true,
+		Rows: []map[string]interface{}{
+			{"sku": "a", "qty": "10"},
+			{"sku": "c", "qty": "3"},
+			{"sku": "c", "qty": "4"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 3 || result.Inserted != 1 || result.Updated != 2 {
+		t.Errorf("result %+v, want 1 inserted and 2 updated of 3", result)
+	}
+	if got := stock(); got != "[{a 10} {b 2} {c 4}]" {
+		t.Errorf("items %s", got)
+	}
+
+	tests := []struct {
+		name   string
+		params ImportParams
+		err    error
+	}{
+		{"unknown field", ImportParams{Table: "items", Mode: IMPORT_UPSERT, Key: []string{"sku"}, Rows: []map[string]interface{}{
+			{"sku": "d", "qty": 1},
+			{"sku": "a", "price": 1},
+		}}, ErrImportRejected},
+		{"duplicate key on insert", ImportParams{Table: "items", Rows: []map[string]interface{}{
+			{"sku": "d", "qty": 1},
+			{"sku": "a", "qty": 1},
+		}}, ErrImportRejected},
+		{"update denied", ImportParams{Table: "items", Mode: IMPORT_UPSERT, Key: []string{"sku"}, UpdateCondition: "qty < ?", UpdateConditionArgs: []interface{}{5}, Rows: []map[string]interface{}{
+			{"sku": "d", "qty": 1},
+			{"sku": "b", "qty": 1},
+			{"sku": "a", "qty": 1},
+		}}, ErrRuleDenied},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := svc.DB.Import(db, test.params)
+			if !errors.Is(err, test.err) {
+				t.Errorf("error %v, want %v", err, test.err)
+			}
+			if result.Inserted != 0 || result.Updated != 0 {
+				t.Errorf("result %+v of a rejected import", result)
+			}
+			if got := stock(); got != "[{a 10} {b 2} {c 4}]" {
+				t.Errorf("items %s", got)
+			}
+		})
+	}
+
+	result, err = svc.DB.Import(db, ImportParams{Table: "items", Mode: IMPORT_REPLACE, Rows: []map[string]interface{}{{"sku": "e", "qty": 5}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Deleted != 3 || result.Inserted != 1 {
+		t.Errorf("result %+v, want 3 deleted and 1 inserted", result)
+	}
+}
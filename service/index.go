@@ -0,0 +1,290 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"funcbase/config"
+	"funcbase/constants"
+	"funcbase/model"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateIndex
+//
+// Add a single index to an existing table without rebuilding it. Indexed columns
+// can be sql expressions, eg. lower(email)
+func (s *TableServiceImpl) CreateIndex(tx *gorm.DB, tableName string, index model.Index) error {
+	table, indexes, err := s.indexedTable(tx, tableName)
+	if err != nil {
+		return err
+	}
+
+	if !identifierRegex.MatchString(index.Name) {
+		return fmt.Errorf("invalid index name %s", index.Name)
+	}
+
+	if len(index.Indexes) == 0 {
+		return fmt.Errorf("index %s requires at least one column", index.Name)
+	}
+
+	var exist int64
+	err = tx.Table("sqlite_master").Where("name = ?", index.Name).Count(&exist).Error
+	if err != nil {
+		return err
+	}
+
+	if exist > 0 {
+		return fmt.Errorf("%s already exists", index.Name)
+	}
+
+	err = createIndexes(tx, table.Name, []model.Index{index})
+	if err != nil {
+		return err
+	}
+
+	return s.saveIndexes(tx, tableName, append(indexes, index))
+}
+
+// DropIndex
+//
+// Drop an index created through the table definition or CreateIndex
+func (s *TableServiceImpl) DropIndex(tx *gorm.DB, tableName string, indexName string) error {
+	_, indexes, err := s.indexedTable(tx, tableName)
+	if err != nil {
+		return err
+	}
+
+	remaining := []model.Index{}
+	for _, index := range indexes {
+		if index.Name != indexName {
+			remaining = append(remaining, index)
+		}
+	}
+
+	if len(remaining) == len(indexes) {
+		return fmt.Errorf("index %s does not exist on %s", indexName, tableName)
+	}
+
+	err = tx.Exec(fmt.Sprintf("DROP INDEX IF EXISTS %s", indexName)).Error
+	if err != nil {
+		return err
+	}
+
+	return s.saveIndexes(tx, tableName, remaining)
+}
+
+func (s *TableServiceImpl) indexedTable(tx *gorm.DB, tableName string) (model.Tables, []model.Index, error) {
+	var table model.Tables
+	err := tx.Model(&model.Tables{}).Where("name = ?", tableName).First(&table).Error
+	if err != nil {
+		return table, nil, err
+	}
+
+	if table.IsView() || table.System {
+		return table, nil, fmt.Errorf("index is not supported on %s", tableName)
+	}
+
+	indexes := []model.Index{}
+	if table.Indexes != "" {
+		err = json.Unmarshal([]byte(table.Indexes), &indexes)
+		if err != nil {
+			return table, nil, err
+		}
+	}
+
+	return table, indexes, nil
+}
+
+func (s *TableServiceImpl) saveIndexes(tx *gorm.DB, tableName string, indexes []model.Index) error {
+	indexJson, err := json.Marshal(indexes)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&model.Tables{}).Where("name = ?", tableName).Update("indexes", string(indexJson)).Error
+	if err != nil {
+		return err
+	}
+
+	s.clearCache(tableName)
+
+	return nil
+}
+
+// SlowQuery
+//
+// List query taking longer than the configured slow_query_threshold
+type SlowQuery struct {
+	Table    string        `json:"table"`
+	Filter   string        `json:"filter,omitempty"`
+	Order    string        `json:"order,omitempty"`
+	SQL      string        `json:"sql"`
+	Vars     []interface{} `json:"vars,omitempty"`
+	Duration float64       `json:"duration"` // milliseconds
+	At       time.Time     `json:"at"`
+}
+
+type QueryDiagnostic struct {
+	SlowQuery
+	Plan        []string      `json:"plan"`
+	Suggestions []model.Index `json:"suggestions"`
+}
+
+// recordSlowQuery
+//
+// Keep the latest slow list queries in memory so that they can be diagnosed. Gorm resets the
+// statement once executed, the sql is built again in dry run mode
+func (s *DBServiceImpl) recordSlowQuery(query *gorm.DB, option *FetchParams, duration time.Duration) {
+	threshold := time.Duration(config.GetInstance().GetSlowQueryThreshold()) * time.Millisecond
+	if duration < threshold {
+		return
+	}
+
+	var data []map[string]interface{}
+	statement := query.Session(&gorm.Session{DryRun: true}).Find(&data).Statement
+
+	slowQuery := SlowQuery{
+		Table:    option.Table,
+		Filter:   option.Filter,
+		Order:    option.Order,
+		SQL:      statement.SQL.String(),
+		Vars:     statement.Vars,
+		Duration: float64(duration.Microseconds()) / 1000,
+		At:       time.Now(),
+	}
+
+	s.slowMutex.Lock()
+	defer s.slowMutex.Unlock()
+
+	s.slowQueries = append(s.slowQueries, slowQuery)
+	if len(s.slowQueries) > constants.SLOW_QUERY_LIMIT {
+		s.slowQueries = s.slowQueries[len(s.slowQueries)-constants.SLOW_QUERY_LIMIT:]
+	}
+}
+
+func (s *DBServiceImpl) SlowQueries() []SlowQuery {
+	s.slowMutex.Lock()
+	defer s.slowMutex.Unlock()
+
+	queries := make([]SlowQuery, len(s.slowQueries))
+	copy(queries, s.slowQueries)
+
+	return queries
+}
+
+// DiagnoseSlowQueries
+//
+// Run EXPLAIN QUERY PLAN on the recent slow queries, newest first. A full table scan or
+// a temporary b-tree for sorting suggests an index on the filtered and sorted columns
+func (s *DBServiceImpl) DiagnoseSlowQueries(db *gorm.DB) ([]QueryDiagnostic, error) {
+	queries := s.SlowQueries()
+	diagnostics := []QueryDiagnostic{}
+
+	for i := len(queries) - 1; i >= 0; i-- {
+		query := queries[i]
+
+		var plan []struct {
+			Detail string
+		}
+		err := db.Raw("EXPLAIN QUERY PLAN "+query.SQL, query.Vars...).Scan(&plan).Error
+		if err != nil {
+			// table might have been changed or dropped since
+			continue
+		}
+
+		diagnostic := QueryDiagnostic{
+			SlowQuery:   query,
+			Plan:        []string{},
+			Suggestions: []model.Index{},
+		}
+
+		needIndex := false
+		for _, step := range plan {
+			diagnostic.Plan = append(diagnostic.Plan, step.Detail)
+
+			fullScan := strings.HasPrefix(step.Detail, "SCAN "+query.Table) && !strings.Contains(step.Detail, "INDEX")
+			if fullScan || strings.Contains(step.Detail, "USE TEMP B-TREE FOR ORDER BY") {
+				needIndex = true
+			}
+		}
+
+		if needIndex {
+			suggestion, err := s.suggestIndex(query)
+			if err != nil {
+				return nil, err
+			}
+			if suggestion != nil {
+				diagnostic.Suggestions = append(diagnostic.Suggestions, *suggestion)
+			}
+		}
+
+		diagnostics = append(diagnostics, diagnostic)
+	}
+
+	return diagnostics, nil
+}
+
+var filterColumnRegex = regexp.MustCompile(`(?i)([A-Za-z_][A-Za-z0-9_]*)\s*(=|==|!=|<>|>=|<=|>|<|\sLIKE\s|\sIN\s|\sIS\s|\sBETWEEN\s)`)
+
+// suggestIndex
+//
+// Index on the columns used by the filter followed by the sorted columns,
+// nothing is suggested when an existing index already starts with the same column
+func (s *DBServiceImpl) suggestIndex(query SlowQuery) (*model.Index, error) {
+	table, err := s.service.WithService().Table.Info(query.Table, TABLE_INFO_INDEXES)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := s.service.WithService().Table.Columns(query.Table, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	tableColumns := []string{}
+	for _, column := range columns {
+		if column["multiple"] != true {
+			tableColumns = append(tableColumns, fmt.Sprintf("%v", ColumnValue(column, "name")))
+		}
+	}
+
+	indexed := []string{}
+	add := func(column string) {
+		column = strings.TrimSpace(column)
+		if containsColumn(tableColumns, column) && !containsColumn(indexed, column) {
+			indexed = append(indexed, column)
+		}
+	}
+
+	if isSQLTerm(query.Filter) {
+		for _, match := range filterColumnRegex.FindAllStringSubmatch(query.Filter, -1) {
+			add(match[1])
+		}
+	}
+
+	for _, order := range strings.Split(query.Order, ",") {
+		fields := strings.Fields(order)
+		if len(fields) > 0 {
+			add(fields[0])
+		}
+	}
+
+	if len(indexed) == 0 {
+		return nil, nil
+	}
+
+	for _, index := range table.SystemIndex {
+		if len(index.Indexes) > 0 && strings.TrimSpace(index.Indexes[0]) == indexed[0] {
+			return nil, nil
+		}
+	}
+
+	return &model.Index{
+		Name:    fmt.Sprintf("idx_%s_%s", query.Table, strings.Join(indexed, "_")),
+		Indexes: indexed,
+	}, nil
+}
@@ -0,0 +1,675 @@
+package service
+
+import (
+	"fmt"
+)
+
+const OPENAPI_VERSION = "3.0.3"
+
+// OpenAPI
+//
+// OpenAPI 3 document of the live schema: the CRUD routes of every collection, the register and
+// login routes of auth collections and one operation per stored function. It is built on each call
+// so that it always follows the schema
+func (s *SchemaServiceImpl) OpenAPI(serverURL string) (map[string]interface{}, error) {
+	tables, err := s.codegenTables()
+	if err != nil {
+		return nil, err
+	}
+
+	functions, err := s.codegenFunctions(tables)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := map[string]interface{}{}
+	schemas := map[string]interface{}{
+		"ErrorResponse": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"message": map[string]interface{}{"type": "string"},
+				"error":   map[string]interface{}{},
+				"data":    map[string]interface{}{},
+			},
+		},
+	}
+
+	for _, table := range tables {
+		openapiTable(paths, schemas, table)
+	}
+
+	for _, function := range functions {
+		openapiFunction(paths, schemas, function)
+	}
+
+	if len(tables) > 0 {
+		openapiBatch(paths, schemas)
+		openapiRealtime(paths, schemas)
+		openapiChanges(paths, schemas)
+	}
+
+	document := map[string]interface{}{
+		"openapi": OPENAPI_VERSION,
+		"info": map[string]interface{}{
+			"title":   "funcbase",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{
+					"type": "apiKey",
+					"in":   "header",
+					"name": "X-API-KEY",
+				},
+				"bearerAuth": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"apiKey": []string{}},
+		},
+	}
+
+	if serverURL != "" {
+		document["servers"] = []interface{}{
+			map[string]interface{}{"url": serverURL},
+		}
+	}
+
+	return document, nil
+}
+
+// openapiTable
+//
+// Record, insert and update schemas of a collection with its routes, views are read only and auth
+// collections are inserted through register
+func openapiTable(paths map[string]interface{}, schemas map[string]interface{}, table codegenTable) {
+	typeName := pascalCase(table.Name)
+	tag := []string{table.Name}
+
+	record := map[string]interface{}{}
+	for _, column := range table.Columns {
+		record[column.Name] = openapiType(column)
+	}
+	schemas[typeName] = map[string]interface{}{
+		"type":       "object",
+		"properties": record,
+	}
+
+	schemas[typeName+"List"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"data":        map[string]interface{}{"type": "array", "items": openapiRef(typeName)},
+			"page":        map[string]interface{}{"type": "integer"},
+			"page_size":   map[string]interface{}{"type": "integer"},
+			"total_data":  map[string]interface{}{"type": "integer", "format": "int64"},
+			"limit":       map[string]interface{}{"type": "integer"},
+			"next_cursor": map[string]interface{}{"type": "string"},
+			"prev_cursor": map[string]interface{}{"type": "string"},
+		},
+	}
+
+	rows := map[string]interface{}{
+		"get": map[string]interface{}{
+			"operationId": "list" + typeName,
+			"summary":     "List " + table.Name,
+			"tags":        tag,
+			"security":    openapiUserSecurity(),
+			"parameters": []interface{}{
+				openapiQuery("filter", "string", "Filter expression, @user.id is replaced by the requesting user"),
+				openapiQuery("sort", "string", "Order by clause, e.g. created_at desc"),
+				openapiQuery("page", "integer", ""),
+				openapiQuery("page_size", "integer", ""),
+				openapiQuery("get_count", "boolean", "Fill total_data"),
+				openapiQuery("count", "string", "exact or approximate, fill total_data"),
+				openapiQuery("after", "string", "Cursor of the next page, read from next_cursor"),
+				openapiQuery("before", "string", "Cursor of the previous page, read from prev_cursor"),
+				openapiQuery("limit", "integer", "Rows per page of the cursor pagination"),
+				openapiQuery("expand", "string", "Comma separated relations to expand"),
+				openapiQuery("fields", "string", "Comma separated fields to return, e.g. id,author.name,length(body) as body_len"),
+				openapiQuery("exclude", "string", "Comma separated fields to leave out"),
+				openapiQuery("search", "string", "Full text search"),
+				openapiHeader("If-None-Match", "ETag of a previous response, 304 is returned when the page has not changed"),
+			},
+			"responses": openapiConditional(openapiResponses("200", openapiRef(typeName+"List")), "304"),
+		},
+	}
+	paths[fmt.Sprintf("/api/main/%s/rows", table.Name)] = rows
+
+	paths[fmt.Sprintf("/api/main/%s/{id}", table.Name)] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"operationId": "view" + typeName,
+			"summary":     "View a row of " + table.Name,
+			"tags":        tag,
+			"security":    openapiUserSecurity(),
+			"parameters": []interface{}{
+				map[string]interface{}{
+					"name":     "id",
+					"in":       "path",
+					"required": true,
+					"schema":   openapiID(table.TextID),
+				},
+				openapiQuery("expand", "string", "Comma separated relations to expand"),
+				openapiQuery("fields", "string", "Comma separated fields to return, e.g. id,author.name,length(body) as body_len"),
+				openapiQuery("exclude", "string", "Comma separated fields to leave out"),
+				openapiHeader("If-None-Match", "ETag of a previous response, 304 is returned when the row has not changed"),
+			},
+			"responses": openapiConditional(openapiResponses("200", openapiRef(typeName)), "304"),
+		},
+	}
+
+	if table.View {
+		return
+	}
+
+	insert := map[string]interface{}{}
+	update := map[string]interface{}{
+		"id": openapiID(table.TextID),
+	}
+	required := []string{}
+	for _, column := range table.Columns {
+		if !writable(column) {
+			continue
+		}
+		insert[column.Name] = openapiType(column)
+		update[column.Name] = openapiType(column)
+		if !column.Nullable && !column.Default {
+			required = append(required, column.Name)
+		}
+	}
+
+	insertSchema := map[string]interface{}{
+		"type":       "object",
+		"properties": insert,
+	}
+	if len(required) > 0 {
+		insertSchema["required"] = required
+	}
+	schemas[typeName+"Insert"] = insertSchema
+	schemas[typeName+"Update"] = map[string]interface{}{
+		"type":       "object",
+		"properties": update,
+		"required":   []string{"id"},
+	}
+
+	bulkParameters := []interface{}{
+		openapiQuery("filter", "string", "Rows to write, @user.id is replaced by the requesting user"),
+		openapiQuery("max_affected", "integer", "Nothing is written when more rows match, 1000 by default"),
+		openapiQuery("dry_run", "boolean", "Only count the matching rows"),
+	}
+	bulkResponse := openapiData(map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"affected": map[string]interface{}{"type": "integer"},
+			"dry_run":  map[string]interface{}{"type": "boolean"},
+		},
+	})
+
+	// the ids of the body are deleted unless a filter is given
+	deleteBody := openapiBody(map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	})
+	deleteBody["required"] = false
+
+	rows["delete"] = map[string]interface{}{
+		"operationId": "delete" + typeName,
+		"summary":     "Delete rows of " + table.Name + " by id or by filter",
+		"tags":        tag,
+		"security":    openapiUserSecurity(),
+		"requestBody": deleteBody,
+		"parameters": append([]interface{}{
+			openapiHeader("If-Match", "ETags the rows must still hold, 412 is returned when one has changed"),
+		}, bulkParameters...),
+		"responses": openapiConditional(openapiResponses("200", bulkResponse), "412"),
+	}
+	rows["patch"] = map[string]interface{}{
+		"operationId": "bulkUpdate" + typeName,
+		"summary":     "Update the rows of " + table.Name + " matching a filter",
+		"tags":        tag,
+		"security":    openapiUserSecurity(),
+		"requestBody": openapiBody(map[string]interface{}{
+			"type":       "object",
+			"properties": insert,
+		}),
+		"parameters": bulkParameters,
+		"responses":  openapiResponses("200", bulkResponse),
+	}
+
+	paths[fmt.Sprintf("/api/main/%s/update", table.Name)] = map[string]interface{}{
+		"put": map[string]interface{}{
+			"operationId": "update" + typeName,
+			"summary":     "Update a row of " + table.Name,
+			"tags":        tag,
+			"security":    openapiUserSecurity(),
+			"requestBody": openapiBody(openapiRef(typeName + "Update")),
+			"parameters": []interface{}{
+				openapiHeader("If-Match", "ETag the row must still hold, 412 is returned when it has changed"),
+			},
+			"responses": openapiConditional(openapiResponses("200", openapiData(openapiRef(typeName+"Update"))), "412"),
+		},
+	}
+
+	if !table.Auth {
+		paths[fmt.Sprintf("/api/main/%s/insert", table.Name)] = map[string]interface{}{
+			"post": map[string]interface{}{
+				"operationId": "insert" + typeName,
+				"summary":     "Insert a row in " + table.Name,
+				"tags":        tag,
+				"security":    openapiUserSecurity(),
+				"requestBody": openapiBody(openapiRef(typeName + "Insert")),
+				"responses":   openapiResponses("201", openapiData(openapiRef(typeName))),
+			},
+		}
+		return
+	}
+
+	register := map[string]interface{}{
+		"email":    map[string]interface{}{"type": "string", "format": "email"},
+		"password": map[string]interface{}{"type": "string", "format": "password"},
+	}
+	for name, property := range insert {
+		if name != "email" {
+			register[name] = property
+		}
+	}
+
+	paths[fmt.Sprintf("/api/auth/%s/register", table.Name)] = map[string]interface{}{
+		"post": map[string]interface{}{
+			"operationId": "register" + typeName,
+			"summary":     "Register a user in " + table.Name,
+			"tags":        tag,
+			"requestBody": openapiBody(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"data": map[string]interface{}{
+						"type":       "object",
+						"properties": register,
+						"required":   []string{"email", "password"},
+					},
+					"returns_token": map[string]interface{}{"type": "boolean"},
+				},
+				"required": []string{"data"},
+			}),
+			"responses": openapiResponses("200", openapiData(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"user":  openapiRef(typeName),
+					"token": map[string]interface{}{"type": "string"},
+				},
+			})),
+		},
+	}
+
+	paths[fmt.Sprintf("/api/auth/%s/login", table.Name)] = map[string]interface{}{
+		"post": map[string]interface{}{
+			"operationId": "login" + typeName,
+			"summary":     "Log in a user of " + table.Name,
+			"tags":        tag,
+			"requestBody": openapiBody(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"data": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"email":    map[string]interface{}{"type": "string", "format": "email"},
+							"password": map[string]interface{}{"type": "string", "format": "password"},
+						},
+						"required": []string{"email", "password"},
+					},
+				},
+				"required": []string{"data"},
+			}),
+			"responses": openapiResponses("200", map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"token": map[string]interface{}{"type": "string"},
+				},
+			}),
+		},
+	}
+}
+
+func openapiFunction(paths map[string]interface{}, schemas map[string]interface{}, function codegenFunction) {
+	typeName := pascalCase(function.Name) + "Input"
+
+	properties := map[string]interface{}{}
+	required := []string{}
+	for _, step := range function.Steps {
+		inputs := map[string]interface{}{}
+		inputsRequired := []string{}
+		for _, input := range step.Inputs {
+			inputs[input.Name] = openapiType(input)
+			if !input.Default {
+				inputsRequired = append(inputsRequired, input.Name)
+			}
+		}
+
+		stepSchema := map[string]interface{}{
+			"type":       "object",
+			"properties": inputs,
+		}
+		if len(inputsRequired) > 0 {
+			stepSchema["required"] = inputsRequired
+		}
+		if step.Multiple {
+			stepSchema = map[string]interface{}{"type": "array", "items": stepSchema}
+		}
+
+		properties[step.Name] = stepSchema
+		required = append(required, step.Name)
+	}
+
+	input := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		input["required"] = required
+	}
+	schemas[typeName] = input
+
+	paths["/api/"+function.Name] = map[string]interface{}{
+		"post": map[string]interface{}{
+			"operationId": camelCase(function.Name),
+			"summary":     "Run the " + function.Name + " function",
+			"tags":        []string{"functions"},
+			"security":    openapiUserSecurity(),
+			"requestBody": openapiBody(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"data": openapiRef(typeName),
+				},
+				"required": []string{"data"},
+			}),
+			"responses": openapiResponses("200", map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": true,
+			}),
+		},
+	}
+}
+
+// openapiType
+//
+// Schema of a column after its sqlite type, untyped columns of views accept anything
+func openapiType(column codegenColumn) map[string]interface{} {
+	if column.Multiple {
+		return map[string]interface{}{
+			"type":  "array",
+			"items": openapiID(column.TextID),
+		}
+	}
+
+	schema := map[string]interface{}{}
+	switch {
+	case column.TextID:
+		schema["type"] = "string"
+	case column.Type == "INTEGER", column.Type == "RELATION":
+		schema["type"] = "integer"
+		schema["format"] = "int64"
+	case column.Type == "REAL":
+		schema["type"] = "number"
+	case column.Type == "TEXT", column.Type == "BLOB":
+		schema["type"] = "string"
+	case column.Type == "DATETIME", column.Type == "TIMESTAMP":
+		schema["type"] = "string"
+		schema["format"] = "date-time"
+	case column.Type == "BOOLEAN":
+		schema["type"] = "boolean"
+	default:
+		return schema
+	}
+
+	if column.Nullable {
+		schema["nullable"] = true
+	}
+
+	return schema
+}
+
+// openapiID
+//
+// Schema of an id, uuid, ulid and nanoid ids are strings
+// openapiBatch
+//
+// Transactional batch of writes across the collections
+func openapiBatch(paths map[string]interface{}, schemas map[string]interface{}) {
+	schemas["BatchOperation"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"op":    map[string]interface{}{"type": "string", "enum": []string{"insert", "update", "delete", "upsert"}},
+			"table": map[string]interface{}{"type": "string"},
+			"data": map[string]interface{}{
+				"type":        "object",
+				"description": "Row data, @ops.<index>.<field> is replaced by the value written by an earlier operation",
+			},
+			"id": map[string]interface{}{"type": "array", "items": map[string]interface{}{}, "description": "Rows removed by a delete"},
+			"on": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "description": "Columns identifying the row of an upsert, id by default"},
+		},
+		"required": []string{"op", "table"},
+	}
+	schemas["BatchResult"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"op":     map[string]interface{}{"type": "string"},
+			"table":  map[string]interface{}{"type": "string"},
+			"action": map[string]interface{}{"type": "string", "description": "insert or update, the write an upsert turned into"},
+			"data":   map[string]interface{}{"type": "object"},
+			"id":     map[string]interface{}{"type": "array", "items": map[string]interface{}{}},
+		},
+	}
+
+	paths["/api/main/batch"] = map[string]interface{}{
+		"post": map[string]interface{}{
+			"operationId": "batch",
+			"summary":     "Run writes in a single transaction, nothing is written when one of them fails",
+			"tags":        []string{"batch"},
+			"security":    openapiUserSecurity(),
+			"requestBody": openapiBody(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"operations": map[string]interface{}{"type": "array", "items": openapiRef("BatchOperation")},
+				},
+				"required": []string{"operations"},
+			}),
+			"responses": openapiResponses("200", openapiData(map[string]interface{}{"type": "array", "items": openapiRef("BatchResult")})),
+		},
+	}
+}
+
+// openapiRealtime
+//
+// Server-sent events stream of the record changes
+func openapiRealtime(paths map[string]interface{}, schemas map[string]interface{}) {
+	schemas["RealtimeEvent"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id":         map[string]interface{}{"type": "integer", "description": "Id of the event, sent back as Last-Event-ID to resume"},
+			"action":     map[string]interface{}{"type": "string", "enum": []string{"create", "update", "delete"}},
+			"table":      map[string]interface{}{"type": "string"},
+			"record":     map[string]interface{}{"type": "object", "description": "Row after the change, the deleted row on delete"},
+			"created_at": map[string]interface{}{"type": "string", "format": "date-time"},
+		},
+	}
+
+	paths["/api/realtime"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"operationId": "realtime",
+			"summary":     "Subscribe to the changes of a collection, a record or the records matching a filter",
+			"tags":        []string{"realtime"},
+			"security":    openapiUserSecurity(),
+			"parameters": []interface{}{
+				openapiQuery("table", "string", ""),
+				openapiQuery("id", "string", "Only the changes of this record"),
+				openapiQuery("filter", "string", "Only the changes of the records matching the filter"),
+				openapiQuery("last_event_id", "integer", "Resume after this event"),
+				openapiHeader("Last-Event-ID", "Resume after this event, sent by EventSource on reconnect"),
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "stream of events, the data of each is a RealtimeEvent",
+					"content": map[string]interface{}{
+						"text/event-stream": map[string]interface{}{"schema": openapiRef("RealtimeEvent")},
+					},
+				},
+			},
+		},
+	}
+}
+
+// openapiChanges
+//
+// Change log read by incremental sync
+func openapiChanges(paths map[string]interface{}, schemas map[string]interface{}) {
+	schemas["Change"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"seq":        map[string]interface{}{"type": "integer"},
+			"table":      map[string]interface{}{"type": "string"},
+			"record_id":  map[string]interface{}{"type": "string"},
+			"operation":  map[string]interface{}{"type": "string", "enum": []string{"insert", "update", "delete"}},
+			"created_at": map[string]interface{}{"type": "string", "format": "date-time"},
+		},
+	}
+	schemas["ChangesPage"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"changes":  map[string]interface{}{"type": "array", "items": openapiRef("Change")},
+			"next":     map[string]interface{}{"type": "integer", "description": "Sequence to read from on the next call"},
+			"has_more": map[string]interface{}{"type": "boolean"},
+		},
+	}
+
+	responses := openapiResponses("200", openapiData(openapiRef("ChangesPage")))
+	responses["410"] = map[string]interface{}{
+		"description": "changes since are no longer kept, read the data again and continue from next",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": openapiData(openapiRef("ChangesPage"))},
+		},
+	}
+
+	paths["/api/main/changes"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"operationId": "changes",
+			"summary":     "Read the changes of the collections after a sequence",
+			"tags":        []string{"changes"},
+			"security":    openapiUserSecurity(),
+			"parameters": []interface{}{
+				openapiQuery("since", "integer", "Sequence of the last change read, 0 to read from the start"),
+				openapiQuery("tables", "string", "Comma separated collections, every collection when empty"),
+				openapiQuery("limit", "integer", ""),
+			},
+			"responses": responses,
+		},
+	}
+}
+
+func openapiID(textID bool) map[string]interface{} {
+	if textID {
+		return map[string]interface{}{"type": "string"}
+	}
+
+	return map[string]interface{}{"type": "integer", "format": "int64"}
+}
+
+func openapiRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// openapiUserSecurity
+//
+// Routes taking an optional user token on top of the api key
+func openapiUserSecurity() []interface{} {
+	return []interface{}{
+		map[string]interface{}{"apiKey": []string{}, "bearerAuth": []string{}},
+		map[string]interface{}{"apiKey": []string{}},
+	}
+}
+
+func openapiQuery(name string, kind string, description string) map[string]interface{} {
+	parameter := map[string]interface{}{
+		"name":   name,
+		"in":     "query",
+		"schema": map[string]interface{}{"type": kind},
+	}
+	if description != "" {
+		parameter["description"] = description
+	}
+
+	return parameter
+}
+
+func openapiHeader(name string, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "header",
+		"description": description,
+		"schema":      map[string]interface{}{"type": "string"},
+	}
+}
+
+func openapiBody(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"required": true,
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schema},
+		},
+	}
+}
+
+// openapiData
+//
+// Response wrapped in the data field of APIResponse
+func openapiData(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"data":    schema,
+			"message": map[string]interface{}{"type": "string"},
+		},
+	}
+}
+
+// openapiResponses
+//
+// Success response with the given schema, nil when the route returns no body
+// openapiConditional
+//
+// Responses of an operation honoring the If-Match or If-None-Match headers
+func openapiConditional(responses map[string]interface{}, status string) map[string]interface{} {
+	switch status {
+	case "304":
+		responses[status] = map[string]interface{}{"description": "not modified"}
+	case "412":
+		responses[status] = map[string]interface{}{"description": "the data has been changed since it was read"}
+	}
+
+	return responses
+}
+
+func openapiResponses(status string, schema map[string]interface{}) map[string]interface{} {
+	success := map[string]interface{}{"description": "success"}
+	if schema != nil {
+		success["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": schema},
+		}
+	}
+
+	return map[string]interface{}{
+		status: success,
+		"default": map[string]interface{}{
+			"description": "error",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": openapiRef("ErrorResponse")},
+			},
+		},
+	}
+}
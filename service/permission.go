@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"funcbase/model"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var ErrFieldForbidden = errors.New("the field can't be written")
+
+// permissionFields
+//
+// Permission of the fields that have one, a hidden field can't be searched since the search
+// snippet would show it
+func permissionFields(fields []model.Field) (map[string]string, error) {
+	permissions := map[string]string{}
+	for _, field := range fields {
+		switch field.Permission {
+		case "":
+			continue
+		case model.FIELD_HIDDEN, model.FIELD_READ_ONLY, model.FIELD_CREATE_ONLY:
+		default:
+			return nil, fmt.Errorf("invalid permission %s on field %s", field.Permission, field.Name)
+		}
+
+		if field.Permission == model.FIELD_HIDDEN && field.Searchable {
+			return nil, fmt.Errorf("hidden field %s can't be searchable", field.Name)
+		}
+
+		permissions[field.Name] = field.Permission
+	}
+
+	return permissions, nil
+}
+
+// Permissions
+//
+// Permission of every restricted field of a table, the password and salt of an auth table
+// are credentials
+func (s *TableServiceImpl) Permissions(tableName string) (map[string]string, error) {
+	table, err := s.Info(tableName, TABLE_INFO_AUTH, TABLE_INFO_PERMISSIONS)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions := map[string]string{}
+	for name, permission := range table.SystemPermission {
+		permissions[name] = permission
+	}
+	if table.Auth {
+		permissions["password"] = model.FIELD_CREDENTIAL
+		permissions["salt"] = model.FIELD_SECRET
+	}
+
+	return permissions, nil
+}
+
+type checkedKey struct{}
+
+// WithCheckedFields
+//
+// The fields written by the query were checked by an earlier write of the same request, like
+// the names of the files stored once the row is inserted
+func WithCheckedFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, checkedKey{}, true)
+}
+
+func checkedFromContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+
+	checked, _ := ctx.Value(checkedKey{}).(bool)
+	return checked
+}
+
+// restricted
+//
+// Field permissions apply to every actor but admins, a query without actor is read as a guest
+func restricted(db *gorm.DB) bool {
+	return ActorFromContext(db.Statement.Context).Role != "ADMIN"
+}
+
+// hiddenFields
+//
+// Fields of a table left out of the rows read, credentials are never read and hidden fields
+// are only read by admins
+func (s *DBServiceImpl) hiddenFields(tableName string, restrict bool) (map[string]bool, error) {
+	hidden := map[string]bool{}
+	if tableName == "_log" {
+		// the request log is not a collection
+		return hidden, nil
+	}
+
+	permissions, err := s.service.WithService().Table.Permissions(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, permission := range permissions {
+		switch permission {
+		case model.FIELD_CREDENTIAL, model.FIELD_SECRET:
+			hidden[name] = true
+		case model.FIELD_HIDDEN:
+			hidden[name] = restrict
+		}
+	}
+
+	return hidden, nil
+}
+
+// checkWrite
+//
+// Check the fields of the data written by the actor of the query. Credentials are only set
+// by the auth api when the user registers
+func (s *DBServiceImpl) checkWrite(db *gorm.DB, tableName string, data map[string]interface{}, create bool) error {
+	if checkedFromContext(db.Statement.Context) || !restricted(db) {
+		return nil
+	}
+
+	permissions, err := s.service.WithService().Table.Permissions(tableName)
+	if err != nil {
+		return err
+	}
+
+	for name := range data {
+		switch permissions[name] {
+		case model.FIELD_HIDDEN, model.FIELD_READ_ONLY:
+			return fmt.Errorf("%w: %s", ErrFieldForbidden, name)
+		case model.FIELD_CREATE_ONLY, model.FIELD_CREDENTIAL, model.FIELD_SECRET:
+			if !create {
+				return fmt.Errorf("%w: %s", ErrFieldForbidden, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// filterKeywords
+//
+// Sql words allowed in a filter or a sort besides the fields of the table and the functions
+// of the computed fields
+var filterKeywords = map[string]bool{
+	"and": true, "or": true, "not": true, "like": true, "glob": true, "in": true, "is": true,
+	"isnull": true, "notnull": true, "null": true, "between": true, "escape": true, "true": true,
+	"false": true, "collate": true, "nocase": true, "binary": true, "case": true, "when": true,
+	"then": true, "else": true, "end": true, "cast": true, "as": true, "integer": true, "text": true,
+	"real": true, "numeric": true, "current_timestamp": true, "current_date": true,
+	"current_time": true, "asc": true, "desc": true, "nulls": true, "first": true, "last": true,
+}
+
+// checkReadable
+//
+// A filter or a sort of the actor can only read the fields it can see on the queried table, the
+// rows it matches would tell the value of the others. Subqueries would reach the other tables
+// past their rules and are refused
+func (s *DBServiceImpl) checkReadable(db *gorm.DB, tableName string, expression string) error {
+	if expression == "" || !restricted(db) {
+		return nil
+	}
+
+	columns, err := s.service.WithService().Table.Columns(tableName, false, false)
+	if err != nil {
+		return err
+	}
+
+	hidden, err := s.hiddenFields(tableName, true)
+	if err != nil {
+		return err
+	}
+
+	readable := map[string]bool{}
+	for _, column := range columns {
+		name := fmt.Sprintf("%v", ColumnValue(column, "name"))
+		if !hidden[name] && column["multiple"] != true {
+			readable[name] = true
+		}
+	}
+
+	return checkIdentifiers(expression, tableName, readable)
+}
+
+// checkIdentifiers
+//
+// Fail when the expression names anything but a readable field, an allowed function or a sql
+// keyword. Quoted text and numbers are skipped, quoted identifiers are read as fields and a
+// field may be prefixed with the name of the table
+func checkIdentifiers(expression string, tableName string, readable map[string]bool) error {
+	isLetter := func(char byte) bool {
+		return char == '_' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z'
+	}
+	isDigit := func(char byte) bool {
+		return char >= '0' && char <= '9'
+	}
+	next := func(i int) byte {
+		for i < len(expression) && (expression[i] == ' ' || expression[i] == '\t' || expression[i] == '\n') {
+			i++
+		}
+		if i < len(expression) {
+			return expression[i]
+		}
+		return 0
+	}
+
+	for i := 0; i < len(expression); {
+		char := expression[i]
+		var (
+			name   string
+			quoted bool
+		)
+		switch {
+		case char == '\'':
+			end := strings.IndexByte(expression[i+1:], '\'')
+			if end < 0 {
+				return fmt.Errorf("%w: unterminated text", ErrInvalidFilter)
+			}
+			i += end + 2
+			continue
+		case isDigit(char):
+			for i < len(expression) && (isLetter(expression[i]) || isDigit(expression[i]) || expression[i] == '.') {
+				i++
+			}
+			continue
+		case char == '"' || char == '`':
+			end := strings.IndexByte(expression[i+1:], char)
+			if end < 0 {
+				return fmt.Errorf("%w: unterminated identifier", ErrInvalidFilter)
+			}
+			name, quoted = expression[i+1:i+1+end], true
+			i += end + 2
+		case isLetter(char):
+			start := i
+			for i < len(expression) && (isLetter(expression[i]) || isDigit(expression[i])) {
+				i++
+			}
+			name = expression[start:i]
+		default:
+			i++
+			continue
+		}
+
+		switch lower := strings.ToLower(name); {
+		case next(i) == '.':
+			if name != tableName {
+				return fmt.Errorf("%w: only the fields of %s can be read", ErrInvalidFilter, tableName)
+			}
+			i = strings.IndexByte(expression[i:], '.') + i + 1
+		case !quoted && (lower == "select" || lower == "exists" || lower == "values" || lower == "with"):
+			return fmt.Errorf("%w: subqueries are not allowed", ErrInvalidFilter)
+		case !quoted && next(i) == '(':
+			if _, ok := projectionFunctions[lower]; !ok && !filterKeywords[lower] {
+				return fmt.Errorf("%w: function %s is not allowed", ErrInvalidFilter, name)
+			}
+		case !quoted && filterKeywords[lower]:
+		case !readable[name]:
+			return fmt.Errorf("%w: %s is not a field of %s", ErrInvalidFilter, name, tableName)
+		}
+	}
+
+	return nil
+}
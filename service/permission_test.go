@@ -0,0 +1,226 @@
+package service
+
+import (
+	"errors"
+	"funcbase/model"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestCheckIdentifiers(t *testing.T) {
+	readable := map[string]bool{"id": true, "title": true, "author": true}
+
+	tests := []struct {
+		expression string
+		valid      bool
+	}{
+		{"title = 'hello'", true},
+		{"posts.title LIKE '%a%' AND id > 10", true},
+		{`"title" IS NOT NULL`, true},
+		{"lower(title) = 'select' OR author IN (1, 2)", true},
+		{"id DESC, title", true},
+		{"balance > 10", false},
+		{`"balance" > 10`, false},
+		{"members.balance > 10", false},
+		{"(SELECT balance FROM members WHERE id = 1) > 1000", false},
+		{"(SELECT substr(password, 1, 1) FROM members WHERE id = 1) = 'a'", false},
+		{"EXISTS (SELECT 1 FROM members)", false},
+		{"author IN (WITH m AS (SELECT 1) SELECT * FROM m)", false},
+		{"load_extension('x') = 1", false},
+		{"title = 'unterminated", false},
+	}
+
+	for _, test := range tests {
+		err := checkIdentifiers(test.expression, "posts", readable)
+		if test.valid && err != nil {
+			t.Errorf("%q refused: %v", test.expression, err)
+		}
+		if !test.valid && !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("%q: error %v, want ErrInvalidFilter", test.expression, err)
+		}
+	}
+}
+
+func TestFetchFilter(t *testing.T) {
+	svc, db := newTestService(t)
+	createMembers(t, svc, db)
+
+	user := asActor(db, "2", "USER")
+	admin := asActor(db, "1", "ADMIN")
+
+	tests := []struct {
+		name   string
+		params FetchParams
+	}{
+		{"hidden field", FetchParams{Table: "members", Filter: "balance > 1000"}},
+		{"credential", FetchParams{Table: "members", Filter: "password = 'x'"}},
+		{"hidden field through a subquery", FetchParams{Table: "members", Filter: "(SELECT balance FROM members WHERE id = 1) > 1000"}},
+		{"credential through a subquery", FetchParams{Table: "posts", Filter: "(SELECT substr(password, 1, 1) FROM members WHERE id = 1) = 'x'"}},
+		{"other table through a subquery", FetchParams{Table: "members", Filter: "(SELECT count(*) FROM posts WHERE title LIKE 'secret%') > 0"}},
+		{"sort on a hidden field", FetchParams{Table: "members", Order: "balance DESC"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params := test.params
+			_, err := svc.DB.Fetch(user, &params)
+			if !errors.Is(err, ErrInvalidFilter) {
+				t.Errorf("error %v, want ErrInvalidFilter", err)
+			}
+		})
+	}
+
+	rows, err := svc.DB.Fetch(user, &FetchParams{Table: "posts", Filter: "title LIKE 'secret%' AND author = 1"})
+	if err != nil || len(rows) != 1 {
+		t.Errorf("filter on readable fields: %v, error %v", rows, err)
+	}
+
+	rows, err = svc.DB.Fetch(admin, &FetchParams{Table: "members", Filter: "balance > 1000"})
+	if err != nil || len(rows) != 1 {
+		t.Errorf("admin filter on a hidden field: %v, error %v", rows, err)
+	}
+
+	_, err = svc.DB.DeleteByFilter(user, "members", "(SELECT balance FROM members WHERE id = 1) > 1000")
+	if !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("delete by filter: error %v, want ErrInvalidFilter", err)
+	}
+}
+
+func TestFetchHiddenFields(t *testing.T) {
+	svc, db := newTestService(t)
+	createMembers(t, svc, db)
+
+	tests := []struct {
+		name    string
+		role    string
+		balance bool
+	}{
+		{"user", "USER", false},
+		{"admin", "ADMIN", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows, err := svc.DB.Fetch(asActor(db, "1", test.role), &FetchParams{Table: "members"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 2 {
+				t.Fatalf("got %d rows, want 2", len(rows))
+			}
+
+			for _, row := range rows {
+				if _, ok := row["balance"]; ok != test.balance {
+					t.Errorf("balance read %v, want %v", ok, test.balance)
+				}
+				if _, ok := row["password"]; ok {
+					t.Error("password read")
+				}
+				if _, ok := row["salt"]; ok {
+					t.Error("salt read")
+				}
+			}
+		})
+	}
+
+	rows, err := svc.DB.Fetch(db, &FetchParams{Table: "members"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rows[0]["balance"]; ok {
+		t.Error("balance read without actor")
+	}
+}
+
+type rowRecorder struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+func (r *rowRecorder) WriteHeader(columns []string) error {
+	r.columns = columns
+	return nil
+}
+
+func (r *rowRecorder) WriteRow(values []interface{}) error {
+	r.rows = append(r.rows, append([]interface{}{}, values...))
+	return nil
+}
+
+func TestStreamHiddenFields(t *testing.T) {
+	svc, db := newTestService(t)
+	createMembers(t, svc, db)
+
+	tests := []struct {
+		role    string
+		balance bool
+	}{
+		{"USER", false},
+		{"ADMIN", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.role, func(t *testing.T) {
+			recorder := &rowRecorder{}
+			err := svc.DB.Stream(asActor(db, "1", test.role), &FetchParams{Table: "members"}, recorder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recorder.rows) != 2 {
+				t.Fatalf("got %d rows, want 2", len(recorder.rows))
+			}
+
+			columns := map[string]bool{}
+			for _, column := range recorder.columns {
+				columns[column] = true
+			}
+			if columns["balance"] != test.balance {
+				t.Errorf("balance exported %v, want %v", columns["balance"], test.balance)
+			}
+			if columns["password"] || columns["salt"] {
+				t.Errorf("credentials exported: %v", recorder.columns)
+			}
+		})
+	}
+
+	err := svc.DB.Stream(asActor(db, "2", "USER"), &FetchParams{Table: "members", Filter: "(SELECT balance FROM members WHERE id = 1) > 1000"}, &rowRecorder{})
+	if !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("export filter: error %v, want ErrInvalidFilter", err)
+	}
+}
+
+func TestViewHiddenFields(t *testing.T) {
+	svc, db := newTestService(t)
+	createMembers(t, svc, db)
+
+	createView := func(name string, query string) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			return svc.Table.CreateView(tx, model.CreateView{Name: name, Query: query})
+		})
+	}
+
+	err := createView("balances", "SELECT id, balance FROM members")
+	if err == nil {
+		t.Error("view of a hidden field created")
+	}
+	err = createView("bios", "SELECT id, bio FROM members")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a field read by a view can't be hidden afterwards
+	err = svc.Table.Alter(func(tx *gorm.DB) error {
+		return svc.Table.Rebuild(tx, model.CreateTable{
+			Name: "members",
+			Type: "users",
+			Fields: []model.Field{
+				{Type: "number", Name: "balance", Nullable: true, Permission: model.FIELD_HIDDEN},
+				{Type: "text", Name: "bio", Nullable: true, Permission: model.FIELD_HIDDEN},
+			},
+		})
+	})
+	if err == nil {
+		t.Error("field read by a view hidden")
+	}
+}
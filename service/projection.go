@@ -0,0 +1,532 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidProjection = errors.New("invalid fields")
+
+// projectionFunctions
+//
+// Sql functions allowed in a computed field with their minimum and maximum number of
+// arguments, -1 is unbounded
+var projectionFunctions = map[string][2]int{
+	"abs":               {1, 1},
+	"coalesce":          {2, -1},
+	"date":              {1, -1},
+	"datetime":          {1, -1},
+	"ifnull":            {2, 2},
+	"instr":             {2, 2},
+	"json_array_length": {1, 2},
+	"json_extract":      {2, -1},
+	"julianday":         {1, -1},
+	"length":            {1, 1},
+	"lower":             {1, 1},
+	"ltrim":             {1, 2},
+	"max":               {2, -1},
+	"min":               {2, -1},
+	"nullif":            {2, 2},
+	"replace":           {3, 3},
+	"round":             {1, 2},
+	"rtrim":             {1, 2},
+	"strftime":          {2, -1},
+	"substr":            {2, 3},
+	"time":              {1, -1},
+	"trim":              {1, 2},
+	"typeof":            {1, 1},
+	"unixepoch":         {1, -1},
+	"upper":             {1, 1},
+}
+
+// Projection
+//
+// Fields of the rows returned to the client. Columns are selected on the table, dotted fields
+// are read on the expanded relations and computed fields are compiled to sql
+type Projection struct {
+	// select expressions of the table, empty selects every column
+	Columns []string
+	// relations expanded for the dotted fields
+	Expand []string
+
+	known   map[string]bool
+	keep    map[string]bool
+	exclude map[string]bool
+	nested  map[string]*Projection
+}
+
+func splitFields(value string) []string {
+	fields := []string{}
+	depth := 0
+	quoted := false
+	start := 0
+	for i, char := range value {
+		switch {
+		case char == '\'':
+			quoted = !quoted
+		case quoted:
+		case char == '(':
+			depth++
+		case char == ')':
+			depth--
+		case char == ',' && depth == 0:
+			fields = append(fields, strings.TrimSpace(value[start:i]))
+			start = i + 1
+		}
+	}
+	fields = append(fields, strings.TrimSpace(value[start:]))
+
+	result := []string{}
+	for _, field := range fields {
+		if field != "" {
+			result = append(result, field)
+		}
+	}
+
+	return result
+}
+
+// Projection
+//
+// Compile the fields and exclude params of a read, both are comma separated. Fields are
+// columns, relation.column paths or computed fields like length(body) as body_len. Fields the
+// actor of the query can't read are not fields of the table
+func (s *DBServiceImpl) Projection(db *gorm.DB, tableName string, fields string, exclude string) (*Projection, error) {
+	return s.projection(restricted(db), tableName, splitFields(fields), splitFields(exclude), true)
+}
+
+func (s *DBServiceImpl) projection(restrict bool, tableName string, fields []string, exclude []string, root bool) (*Projection, error) {
+	tableService := s.service.WithService().Table
+
+	columns, err := tableService.Columns(tableName, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden, err := s.hiddenFields(tableName, restrict)
+	if err != nil {
+		return nil, err
+	}
+
+	columnNames := []string{}
+	known := map[string]bool{}
+	for _, column := range columns {
+		name := fmt.Sprintf("%v", ColumnValue(column, "name"))
+		if hidden[name] {
+			continue
+		}
+		columnNames = append(columnNames, name)
+		known[name] = true
+	}
+
+	relations, err := tableService.Relations(tableName)
+	if err != nil {
+		return nil, err
+	}
+	isRelation := map[string]bool{}
+	references := map[string]string{}
+	for _, relation := range relations {
+		isRelation[relation.Field] = true
+		references[relation.Field] = relation.Reference
+	}
+
+	projection := &Projection{
+		known:   known,
+		exclude: map[string]bool{},
+		nested:  map[string]*Projection{},
+	}
+
+	selected := []string{}
+	selectColumn := func(name string) {
+		if !containsColumn(selected, name) {
+			selected = append(selected, name)
+		}
+	}
+
+	nestedFields := map[string][]string{}
+	nestedExclude := map[string][]string{}
+	relationOrder := []string{}
+	addRelation := func(field string) error {
+		if !isRelation[field] {
+			return fmt.Errorf("%w: %s is not a relation field of %s", ErrInvalidProjection, field, tableName)
+		}
+		if _, ok := nestedFields[field]; !ok {
+			nestedFields[field] = []string{}
+			relationOrder = append(relationOrder, field)
+		}
+		return nil
+	}
+
+	if len(fields) > 0 {
+		projection.keep = map[string]bool{}
+	}
+
+	for _, field := range fields {
+		switch {
+		case strings.Contains(field, "("):
+			if !root {
+				return nil, fmt.Errorf("%w: computed field %s is only available on the table itself", ErrInvalidProjection, field)
+			}
+
+			expression, alias, err := compileComputed(tableName, field, known)
+			if err != nil {
+				return nil, err
+			}
+			if known[alias] || projection.keep[alias] || alias == "expand" {
+				return nil, fmt.Errorf("%w: %s is already a field", ErrInvalidProjection, alias)
+			}
+
+			selected = append(selected, fmt.Sprintf("%s AS %s", expression, alias))
+			projection.keep[alias] = true
+		case strings.Contains(field, "."):
+			parts := strings.SplitN(field, ".", 2)
+			err := addRelation(parts[0])
+			if err != nil {
+				return nil, err
+			}
+
+			// the relation value is needed to expand it
+			selectColumn(parts[0])
+			nestedFields[parts[0]] = append(nestedFields[parts[0]], parts[1])
+		default:
+			if !known[field] {
+				return nil, fmt.Errorf("%w: %s is not a field of %s", ErrInvalidProjection, field, tableName)
+			}
+
+			selectColumn(field)
+			projection.keep[field] = true
+		}
+	}
+
+	for _, field := range exclude {
+		if strings.Contains(field, ".") {
+			parts := strings.SplitN(field, ".", 2)
+			if !isRelation[parts[0]] {
+				return nil, fmt.Errorf("%w: %s is not a relation field of %s", ErrInvalidProjection, parts[0], tableName)
+			}
+			nestedExclude[parts[0]] = append(nestedExclude[parts[0]], parts[1])
+			continue
+		}
+
+		if !known[field] {
+			return nil, fmt.Errorf("%w: %s is not a field of %s", ErrInvalidProjection, field, tableName)
+		}
+		projection.exclude[field] = true
+	}
+
+	if len(fields) == 0 && len(projection.exclude) > 0 {
+		for _, name := range columnNames {
+			if !projection.exclude[name] {
+				selected = append(selected, name)
+			}
+		}
+	}
+
+	for field, excluded := range nestedExclude {
+		if _, ok := nestedFields[field]; !ok {
+			// only applied when the relation is expanded
+			nested, err := s.projection(restrict, references[field], nil, excluded, false)
+			if err != nil {
+				return nil, err
+			}
+			projection.nested[field] = nested
+		}
+	}
+
+	for _, field := range relationOrder {
+		nested, err := s.projection(restrict, references[field], nestedFields[field], nestedExclude[field], false)
+		if err != nil {
+			return nil, err
+		}
+		projection.nested[field] = nested
+
+		if len(nested.Expand) == 0 {
+			projection.Expand = append(projection.Expand, field)
+		}
+		for _, path := range nested.Expand {
+			projection.Expand = append(projection.Expand, field+"."+path)
+		}
+	}
+
+	projection.Columns = selected
+
+	return projection, nil
+}
+
+// Include
+//
+// Select a column needed by the server without returning it, e.g. the owner of a row. Names
+// that are not columns of the table are ignored
+func (p *Projection) Include(column string) {
+	column = strings.TrimSpace(column)
+	if len(p.Columns) == 0 || !p.known[column] || containsColumn(p.Columns, column) {
+		return
+	}
+
+	p.Columns = append(p.Columns, column)
+}
+
+// ExpandPaths
+//
+// Expanded paths of the request merged with the ones needed by the dotted fields
+func (p *Projection) ExpandPaths(expand []string) []string {
+	paths := []string{}
+	for _, path := range append(expand, p.Expand...) {
+		path = strings.TrimSpace(path)
+		if path != "" && !containsColumn(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
+
+// Apply
+//
+// Trim the fetched rows, and their expanded rows, down to the projected fields
+func (p *Projection) Apply(data []map[string]interface{}) []map[string]interface{} {
+	result := make([]map[string]interface{}, len(data))
+	for i, row := range data {
+		result[i] = p.applyRow(row)
+	}
+
+	return result
+}
+
+func (p *Projection) applyRow(row map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	for key, value := range row {
+		if key == "expand" {
+			continue
+		}
+		if p.exclude[key] || p.keep != nil && !p.keep[key] {
+			continue
+		}
+		result[key] = value
+	}
+
+	expand, ok := row["expand"].(map[string]interface{})
+	if !ok {
+		return result
+	}
+
+	projected := map[string]interface{}{}
+	for field, value := range expand {
+		nested, ok := p.nested[field]
+		if !ok {
+			projected[field] = value
+			continue
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			projected[field] = nested.applyRow(v)
+		case []map[string]interface{}:
+			projected[field] = nested.Apply(v)
+		default:
+			projected[field] = value
+		}
+	}
+	result["expand"] = projected
+
+	return result
+}
+
+// compileComputed
+//
+// Compile a computed field to sql. Only whitelisted functions, columns of the table and
+// literals are accepted, the alias defaults to the function followed by its first column
+func compileComputed(tableName string, field string, known map[string]bool) (string, string, error) {
+	parser := &computedParser{input: field, tableName: tableName, known: known}
+
+	expression, err := parser.expression()
+	if err != nil {
+		return "", "", err
+	}
+
+	parser.skipSpaces()
+	alias := ""
+	if parser.keyword("as") {
+		alias = parser.identifier()
+		if alias == "" {
+			return "", "", fmt.Errorf("%w: alias of %s is missing", ErrInvalidProjection, field)
+		}
+	}
+
+	parser.skipSpaces()
+	if parser.position < len(parser.input) {
+		return "", "", fmt.Errorf("%w: unexpected %s in %s", ErrInvalidProjection, parser.input[parser.position:], field)
+	}
+
+	if alias == "" {
+		alias = parser.firstFunction
+		if parser.firstColumn != "" {
+			alias += "_" + parser.firstColumn
+		}
+	}
+	if !identifierRegex.MatchString(alias) {
+		return "", "", fmt.Errorf("%w: invalid alias %s", ErrInvalidProjection, alias)
+	}
+
+	return expression, alias, nil
+}
+
+type computedParser struct {
+	input     string
+	position  int
+	tableName string
+	known     map[string]bool
+
+	firstFunction string
+	firstColumn   string
+}
+
+func (p *computedParser) skipSpaces() {
+	for p.position < len(p.input) && (p.input[p.position] == ' ' || p.input[p.position] == '\t') {
+		p.position++
+	}
+}
+
+func (p *computedParser) identifier() string {
+	p.skipSpaces()
+	start := p.position
+	for p.position < len(p.input) {
+		char := p.input[p.position]
+		if char == '_' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || p.position > start && char >= '0' && char <= '9' {
+			p.position++
+			continue
+		}
+		break
+	}
+
+	return p.input[start:p.position]
+}
+
+func (p *computedParser) keyword(word string) bool {
+	start := p.position
+	if strings.EqualFold(p.identifier(), word) {
+		return true
+	}
+	p.position = start
+
+	return false
+}
+
+func (p *computedParser) peek() byte {
+	p.skipSpaces()
+	if p.position < len(p.input) {
+		return p.input[p.position]
+	}
+
+	return 0
+}
+
+func (p *computedParser) expression() (string, error) {
+	switch char := p.peek(); {
+	case char == '\'':
+		return p.text()
+	case char == '-' || char >= '0' && char <= '9':
+		return p.number()
+	}
+
+	name := p.identifier()
+	if name == "" {
+		return "", fmt.Errorf("%w: expected a function, column or literal in %s", ErrInvalidProjection, p.input)
+	}
+
+	if p.peek() != '(' {
+		if !p.known[name] {
+			return "", fmt.Errorf("%w: %s is not a field of %s", ErrInvalidProjection, name, p.tableName)
+		}
+		if p.firstColumn == "" {
+			p.firstColumn = name
+		}
+		return p.tableName + "." + name, nil
+	}
+
+	function := strings.ToLower(name)
+	arity, ok := projectionFunctions[function]
+	if !ok {
+		return "", fmt.Errorf("%w: function %s is not allowed", ErrInvalidProjection, name)
+	}
+	if p.firstFunction == "" {
+		p.firstFunction = function
+	}
+	p.position++
+
+	args := []string{}
+	if p.peek() == ')' {
+		p.position++
+	} else {
+		for {
+			arg, err := p.expression()
+			if err != nil {
+				return "", err
+			}
+			args = append(args, arg)
+
+			char := p.peek()
+			p.position++
+			if char == ')' {
+				break
+			}
+			if char != ',' {
+				return "", fmt.Errorf("%w: expected , or ) in %s", ErrInvalidProjection, p.input)
+			}
+		}
+	}
+
+	if len(args) < arity[0] || arity[1] != -1 && len(args) > arity[1] {
+		return "", fmt.Errorf("%w: wrong number of arguments for %s", ErrInvalidProjection, function)
+	}
+
+	return fmt.Sprintf("%s(%s)", function, strings.Join(args, ", ")), nil
+}
+
+func (p *computedParser) text() (string, error) {
+	start := p.position
+	p.position++
+	for p.position < len(p.input) {
+		if p.input[p.position] == '\'' {
+			// a doubled quote is an escaped quote
+			if p.position+1 < len(p.input) && p.input[p.position+1] == '\'' {
+				p.position += 2
+				continue
+			}
+			p.position++
+			return p.input[start:p.position], nil
+		}
+		p.position++
+	}
+
+	return "", fmt.Errorf("%w: unterminated text in %s", ErrInvalidProjection, p.input)
+}
+
+func (p *computedParser) number() (string, error) {
+	start := p.position
+	if p.input[p.position] == '-' {
+		p.position++
+	}
+	digits := 0
+	dot := false
+	for p.position < len(p.input) {
+		char := p.input[p.position]
+		if char >= '0' && char <= '9' {
+			digits++
+		} else if char == '.' && !dot {
+			dot = true
+		} else {
+			break
+		}
+		p.position++
+	}
+
+	if digits == 0 {
+		return "", fmt.Errorf("%w: invalid number in %s", ErrInvalidProjection, p.input)
+	}
+
+	return p.input[start:p.position], nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestProjectionHiddenFields(t *testing.T) {
+	svc, db := newTestService(t)
+	createMembers(t, svc, db)
+
+	tests := []struct {
+		name   string
+		table  string
+		fields string
+		role   string
+		valid  bool
+	}{
+		{"readable field", "members", "id,bio", "USER", true},
+		{"hidden field", "members", "id,balance", "USER", false},
+		{"hidden field in a computed field", "members", "id,abs(balance) as b", "USER", false},
+		{"credential in a computed field", "members", "id,length(password) as p", "USER", false},
+		{"nested readable field", "posts", "title,author.bio", "USER", true},
+		{"nested hidden field", "posts", "title,author.balance", "USER", false},
+		{"admin hidden field", "members", "id,abs(balance) as b", "ADMIN", true},
+		{"admin credential", "members", "id,password", "ADMIN", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := svc.DB.Projection(asActor(db, "1", test.role), test.table, test.fields, "")
+			if test.valid && err != nil {
+				t.Errorf("fields %q refused: %v", test.fields, err)
+			}
+			if !test.valid && err == nil {
+				t.Errorf("fields %q accepted", test.fields)
+			}
+		})
+	}
+
+	projection, err := svc.DB.Projection(asActor(db, "2", "USER"), "members", "", "bio")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := svc.DB.Fetch(asActor(db, "2", "USER"), &FetchParams{Table: "members", Columns: projection.Columns})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if _, ok := row["balance"]; ok {
+			t.Errorf("balance read through the projection: %v", row)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"funcbase/constants"
+	"funcbase/model"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sarulabs/di"
+	"gorm.io/gorm"
+)
+
+var ErrEventsExpired = errors.New("the events after the given id are no longer kept")
+
+// realtimeBatch
+//
+// Events read from _events per query
+const realtimeBatch = 500
+
+type RealtimeService interface {
+	Subscribe() *Subscription
+	Unsubscribe(subscription *Subscription)
+	Active() bool
+	Events(db *gorm.DB, after uint, limit int) ([]model.Event, error)
+	Resume(db *gorm.DB, after uint) (uint, error)
+	Prune(db *gorm.DB, retention time.Duration) error
+}
+
+// Subscription
+//
+// Every committed event is sent on Events. The channel is closed when the subscriber can't
+// keep up, it then resumes from the last event it has read
+type Subscription struct {
+	Events chan model.Event
+}
+
+type RealtimeServiceImpl struct {
+	service *BaseService
+	db      *gorm.DB
+
+	mutex       sync.Mutex
+	subscribers map[*Subscription]bool
+	running     bool
+	// last time a subscriber left, changes are recorded for a while after so that it can resume
+	left time.Time
+	// a change was made while no event was recorded
+	unrecorded bool
+	// latest event before recording started again, there is no resuming from it or earlier
+	resumed *uint
+}
+
+func NewRealtimeService(ioc di.Container) RealtimeService {
+	return &RealtimeServiceImpl{
+		service:     NewBaseService(ioc),
+		db:          ioc.Get(constants.CONTAINER_DB).(*gorm.DB),
+		subscribers: map[*Subscription]bool{},
+		// clients connected before a restart reconnect and resume
+		left: time.Now(),
+	}
+}
+
+// Subscribe
+//
+// Start receiving the events committed from now on, the events are read from _events while
+// there are subscribers
+func (s *RealtimeServiceImpl) Subscribe() *Subscription {
+	subscription := &Subscription{
+		Events: make(chan model.Event, constants.REALTIME_BUFFER),
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.subscribers[subscription] = true
+	if s.unrecorded {
+		var latest uint
+		s.db.Model(&model.Event{}).Select("COALESCE(MAX(id), 0)").Scan(&latest)
+		s.resumed = &latest
+		s.unrecorded = false
+	}
+	if !s.running {
+		s.running = true
+
+		var cursor uint
+		s.db.Model(&model.Event{}).Select("COALESCE(MAX(id), 0)").Scan(&cursor)
+		go s.run(cursor)
+	}
+
+	return subscription
+}
+
+func (s *RealtimeServiceImpl) Unsubscribe(subscription *Subscription) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.drop(subscription)
+}
+
+// drop
+//
+// Remove a subscriber, the mutex must be held
+func (s *RealtimeServiceImpl) drop(subscription *Subscription) {
+	if !s.subscribers[subscription] {
+		return
+	}
+
+	delete(s.subscribers, subscription)
+	close(subscription.Events)
+	s.left = time.Now()
+}
+
+// Active
+//
+// Changes are only recorded as events while realtime is in use
+func (s *RealtimeServiceImpl) Active() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	active := len(s.subscribers) > 0 || time.Since(s.left) < constants.REALTIME_RESUME_WINDOW*time.Minute
+	if !active {
+		// only asked on a change
+		s.unrecorded = true
+	}
+
+	return active
+}
+
+// run
+//
+// Send the events committed after the cursor to every subscriber until none is left. Events
+// are written inside the transaction of the change, so a rolled back change is never sent
+func (s *RealtimeServiceImpl) run(cursor uint) {
+	ticker := time.NewTicker(constants.REALTIME_POLL_INTERVAL * time.Millisecond)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		events, err := s.Events(s.db, cursor, realtimeBatch)
+
+		s.mutex.Lock()
+		if len(s.subscribers) == 0 {
+			s.running = false
+			s.mutex.Unlock()
+			return
+		}
+
+		if err == nil {
+			for _, event := range events {
+				cursor = event.ID
+				for subscription := range s.subscribers {
+					select {
+					case subscription.Events <- event:
+					default:
+						s.drop(subscription)
+					}
+				}
+			}
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// Events
+//
+// Events committed after the given event id, oldest first
+func (s *RealtimeServiceImpl) Events(db *gorm.DB, after uint, limit int) ([]model.Event, error) {
+	var events []model.Event
+	err := db.Where("id > ?", after).Order("id").Limit(limit).Find(&events).Error
+
+	return events, err
+}
+
+// Resume
+//
+// Latest event id, ErrEventsExpired is returned with it when the changes committed after the
+// given event can't all be sent: their events were pruned, or not recorded at all
+func (s *RealtimeServiceImpl) Resume(db *gorm.DB, after uint) (uint, error) {
+	var bounds struct {
+		Oldest uint
+		Latest uint
+	}
+	err := db.Model(&model.Event{}).
+		Select("COALESCE(MIN(id), 0) AS oldest, COALESCE(MAX(id), 0) AS latest").
+		Scan(&bounds).Error
+	if err != nil {
+		return 0, err
+	}
+
+	s.mutex.Lock()
+	unrecorded := s.resumed != nil && after <= *s.resumed
+	s.mutex.Unlock()
+
+	if unrecorded || after > bounds.Latest || bounds.Oldest > 0 && after < bounds.Oldest-1 {
+		return bounds.Latest, ErrEventsExpired
+	}
+
+	return bounds.Latest, nil
+}
+
+// Prune
+//
+// Delete the events older than the retention, the latest one is kept so that event ids keep
+// going up
+func (s *RealtimeServiceImpl) Prune(db *gorm.DB, retention time.Duration) error {
+	return db.Where("created_at < ?", time.Now().Add(-retention)).
+		Where("id < (SELECT MAX(id) FROM _events)").
+		Delete(&model.Event{}).Error
+}
+
+// MatchEvent
+//
+// Check the filter of a subscription against the row of an event. The row is read as the table
+// of the event, so that a deleted row can be matched as well
+func (s *DBServiceImpl) MatchEvent(db *gorm.DB, event model.Event, filter string) (bool, error) {
+	row, err := s.JSONRow(event.Table, "?")
+	if err != nil {
+		return false, err
+	}
+
+	query, err := s.applyFilter(db, db.Table(row, event.Data), event.Table, filter)
+	if err != nil {
+		return false, err
+	}
+
+	var count int64
+	err = query.Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// JSONRow
+//
+// Row of the table read from a json object, source is the sql expression of the object. The
+// row is named as the table so that conditions on the table apply to it
+func (s *DBServiceImpl) JSONRow(tableName string, source string) (string, error) {
+	columns, err := s.service.WithService().Table.Columns(tableName, false, false)
+	if err != nil {
+		return "", err
+	}
+
+	selects := []string{}
+	for _, column := range columns {
+		name := ColumnValue(column, "name")
+		selects = append(selects, fmt.Sprintf(`json_extract(_data, '$."%s"') AS "%s"`, name, name))
+	}
+
+	return fmt.Sprintf(`(SELECT %s FROM (SELECT %s AS _data)) AS "%s"`, strings.Join(selects, ", "), source, tableName), nil
+}
+
+// recordEvents
+//
+// Write the realtime events of a change inside its transaction, they are sent once it commits
+func (s *DBServiceImpl) recordEvents(db *gorm.DB, tableName string, operation string, ids []interface{}, before map[string]map[string]interface{}, after map[string]map[string]interface{}) error {
+	action := model.EVENT_UPDATE
+	switch operation {
+	case model.HISTORY_INSERT, model.HISTORY_RESTORE:
+		action = model.EVENT_CREATE
+	case model.HISTORY_DELETE:
+		action = model.EVENT_DELETE
+	}
+
+	events := []model.Event{}
+	for _, id := range ids {
+		key := fmt.Sprintf("%v", id)
+		row := after[key]
+		if action == model.EVENT_DELETE {
+			row = before[key]
+		}
+		if row == nil {
+			// row did not exist, nothing is changed
+			continue
+		}
+
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+
+		events = append(events, model.Event{
+			Table:    tableName,
+			RecordID: key,
+			Action:   action,
+			Data:     string(data),
+		})
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	return db.Create(&events).Error
+}
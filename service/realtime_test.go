@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"funcbase/model"
+	"testing"
+	"time"
+)
+
+func TestRealtimeResume(t *testing.T) {
+	svc, db := newTestService(t)
+	createTables(t, svc, db, model.CreateTable{Name: "notes", Fields: []model.Field{{Type: "text", Name: "body"}}})
+	insertRows(t, svc, db, "notes", map[string]interface{}{"body": "a"}, map[string]interface{}{"body": "b"}, map[string]interface{}{"body": "c"})
+
+	latest, err := svc.Realtime.Resume(db, 0)
+	if err != nil || latest != 3 {
+		t.Errorf("from the first event: latest %d, error %v", latest, err)
+	}
+	_, err = svc.Realtime.Resume(db, 10)
+	if !errors.Is(err, ErrEventsExpired) {
+		t.Errorf("from an event not reached yet: error %v", err)
+	}
+
+	err = db.Model(&model.Event{}).Where("id < ?", 3).Update("created_at", time.Now().Add(-2*time.Hour)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = svc.Realtime.Prune(db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = svc.Realtime.Resume(db, 1)
+	if !errors.Is(err, ErrEventsExpired) {
+		t.Errorf("from a pruned event: error %v", err)
+	}
+	_, err = svc.Realtime.Resume(db, 2)
+	if err != nil {
+		t.Errorf("from the last pruned event: error %v", err)
+	}
+
+	// the resume window is over, the next change is not recorded
+	svc.Realtime.(*RealtimeServiceImpl).left = time.Now().Add(-time.Hour)
+	insertRows(t, svc, db, "notes", map[string]interface{}{"body": "d"})
+
+	subscription := svc.Realtime.Subscribe()
+	defer svc.Realtime.Unsubscribe(subscription)
+
+	_, err = svc.Realtime.Resume(db, 3)
+	if !errors.Is(err, ErrEventsExpired) {
+		t.Errorf("from the event before the unrecorded change: error %v", err)
+	}
+
+	insertRows(t, svc, db, "notes", map[string]interface{}{"body": "e"})
+	latest, err = svc.Realtime.Resume(db, 4)
+	if err != nil || latest != 4 {
+		t.Errorf("from an event recorded again: latest %d, error %v", latest, err)
+	}
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"funcbase/model"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// splitRelations
+//
+// Remove multiple relation values from the data since they are not a column of the table.
+// Returns the ids to be linked, keyed by the relation
+func (s *DBServiceImpl) splitRelations(tableName string, data map[string]interface{}) (map[model.Relation][]interface{}, error) {
+	links := map[model.Relation][]interface{}{}
+
+	relations, err := s.service.WithService().Table.Relations(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, relation := range relations {
+		if !relation.Multiple {
+			continue
+		}
+
+		value, ok := data[relation.Field]
+		if !ok {
+			continue
+		}
+		delete(data, relation.Field)
+
+		ids, err := ParseIDList(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for relation %s: %s", relation.Field, err.Error())
+		}
+		links[relation] = ids
+	}
+
+	return links, nil
+}
+
+// writeRelations
+//
+// Replace the linked ids of multiple relations of a single row
+func (s *DBServiceImpl) writeRelations(db *gorm.DB, id interface{}, links map[model.Relation][]interface{}) error {
+	for relation, ids := range links {
+		err := db.Table(relation.Junction).Where("source_id = ?", id).Delete(nil).Error
+		if err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			continue
+		}
+
+		rows := []map[string]interface{}{}
+		for _, target := range ids {
+			rows = append(rows, map[string]interface{}{
+				"source_id": id,
+				"target_id": target,
+			})
+		}
+
+		err = db.Table(relation.Junction).Create(&rows).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cascadeChange
+//
+// Rows of another table sqlite deletes or rewrites through a foreign key when rows they
+// reference are deleted, kept as they were before the delete
+type cascadeChange struct {
+	table     string
+	operation string
+	ids       []interface{}
+	before    map[string]map[string]interface{}
+}
+
+// cascades
+//
+// Rows reached by the foreign keys of the tables referencing the rows about to be deleted. A
+// cascade deletes the row, which may reach further tables, set null and the removed links of
+// a multiple relation update it. They go through onChange once the rows are deleted, so the
+// change log, the realtime events and the history see them like any other change
+func (s *DBServiceImpl) cascades(db *gorm.DB, tableName string, ids []interface{}) ([]cascadeChange, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var tables []model.Tables
+	err := db.Model(&model.Tables{}).Select("name", "relations").Where("relations NOT IN ?", []string{"", "[]"}).Find(&tables).Error
+	if err != nil {
+		return nil, err
+	}
+
+	type pending struct {
+		table string
+		ids   []interface{}
+	}
+
+	deleted := map[string]bool{}
+	for _, id := range ids {
+		deleted[tableName+"\x00"+fmt.Sprintf("%v", id)] = true
+	}
+
+	deletes := []cascadeChange{}
+	updates := []cascadeChange{}
+	queue := []pending{{table: tableName, ids: ids}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, table := range tables {
+			relations := []model.Relation{}
+			err = json.Unmarshal([]byte(table.Relations), &relations)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, relation := range relations {
+				if relation.Reference != current.table {
+					continue
+				}
+
+				condition, err := s.softDeleteCondition(table.Name, false)
+				if err != nil {
+					return nil, err
+				}
+
+				var query *gorm.DB
+				operation := model.HISTORY_UPDATE
+				switch {
+				case relation.Multiple && junctionOnDelete(relation) == "CASCADE":
+					query = db.Table(table.Name).
+						Where(fmt.Sprintf("id IN (SELECT source_id FROM %s WHERE target_id IN ?)", relation.Junction), current.ids)
+				case !relation.Multiple && relation.OnDelete == model.ON_DELETE_SET_NULL:
+					query = db.Table(table.Name).Where(fmt.Sprintf("%s IN ?", relation.Field), current.ids)
+				case !relation.Multiple && relation.OnDelete == model.ON_DELETE_CASCADE:
+					query = db.Table(table.Name).Where(fmt.Sprintf("%s IN ?", relation.Field), current.ids)
+					operation = model.HISTORY_DELETE
+				default:
+					// the delete fails while the row is referenced
+					continue
+				}
+				if condition != "" {
+					// trashed rows were logged as deleted already
+					query = query.Where(condition)
+				}
+
+				var reached []interface{}
+				err = query.Pluck("id", &reached).Error
+				if err != nil {
+					return nil, err
+				}
+
+				targets := []interface{}{}
+				for _, id := range reached {
+					key := table.Name + "\x00" + fmt.Sprintf("%v", id)
+					if deleted[key] {
+						continue
+					}
+					if operation == model.HISTORY_DELETE {
+						deleted[key] = true
+					}
+					targets = append(targets, id)
+				}
+				if len(targets) == 0 {
+					continue
+				}
+
+				before, err := s.beforeChange(db, table.Name, targets)
+				if err != nil {
+					return nil, err
+				}
+
+				change := cascadeChange{table: table.Name, operation: operation, ids: targets, before: before}
+				if operation == model.HISTORY_DELETE {
+					deletes = append(deletes, change)
+					queue = append(queue, pending{table: table.Name, ids: targets})
+				} else {
+					updates = append(updates, change)
+				}
+			}
+		}
+	}
+
+	// a row both rewritten and deleted is only logged as deleted
+	for i, update := range updates {
+		ids := []interface{}{}
+		for _, id := range update.ids {
+			if !deleted[update.table+"\x00"+fmt.Sprintf("%v", id)] {
+				ids = append(ids, id)
+			}
+		}
+		updates[i].ids = ids
+	}
+
+	return append(deletes, updates...), nil
+}
+
+// logCascades
+//
+// Record the changes of the rows reached by the foreign keys, once the delete is done
+func (s *DBServiceImpl) logCascades(db *gorm.DB, changes []cascadeChange) error {
+	for _, change := range changes {
+		if len(change.ids) == 0 {
+			continue
+		}
+
+		err := s.onChange(db, change.table, change.operation, change.ids, change.before)
+		if err != nil {
+			return err
+		}
+
+		s.clearCount(change.table)
+	}
+
+	return nil
+}
+
+// attachRelations
+//
+// Fill multiple relation fields of the fetched rows with the linked ids, one query per relation
+func (s *DBServiceImpl) attachRelations(db *gorm.DB, tableName string, data []map[string]interface{}, columns []string) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	relations, err := s.service.WithService().Table.Relations(tableName)
+	if err != nil {
+		return err
+	}
+
+	ids := []interface{}{}
+	for _, row := range data {
+		if row["id"] != nil {
+			ids = append(ids, row["id"])
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	for _, relation := range relations {
+		if !relation.Multiple {
+			continue
+		}
+		if len(columns) > 0 && !containsColumn(columns, relation.Field) {
+			continue
+		}
+
+		var links []map[string]interface{}
+		err := db.Table(relation.Junction).
+			Select("source_id, target_id").
+			Where("source_id IN ?", ids).
+			Order("rowid").
+			Find(&links).Error
+		if err != nil {
+			return err
+		}
+
+		linked := map[string][]interface{}{}
+		for _, link := range links {
+			key := fmt.Sprintf("%v", link["source_id"])
+			linked[key] = append(linked[key], link["target_id"])
+		}
+
+		for _, row := range data {
+			targets, ok := linked[fmt.Sprintf("%v", row["id"])]
+			if !ok {
+				targets = []interface{}{}
+			}
+			row[relation.Field] = targets
+		}
+	}
+
+	return nil
+}
+
+func containsColumn(columns []string, column string) bool {
+	for _, c := range columns {
+		if strings.TrimSpace(c) == column || strings.TrimSpace(c) == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseIDList
+//
+// Accept id array from json body, or a comma separated / json array string from form data
+func ParseIDList(value interface{}) ([]interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return []interface{}{}, nil
+	case []interface{}:
+		return v, nil
+	case []string:
+		ids := []interface{}{}
+		for _, id := range v {
+			ids = append(ids, id)
+		}
+		return ids, nil
+	case string:
+		v = strings.TrimSpace(v)
+		if v == "" {
+			return []interface{}{}, nil
+		}
+		if strings.HasPrefix(v, "[") {
+			ids := []interface{}{}
+			err := json.Unmarshal([]byte(v), &ids)
+			return ids, err
+		}
+
+		ids := []interface{}{}
+		for _, id := range strings.Split(v, ",") {
+			ids = append(ids, strings.TrimSpace(id))
+		}
+		return ids, nil
+	case float64, int, int64:
+		return []interface{}{v}, nil
+	default:
+		return nil, fmt.Errorf("expected an array of id")
+	}
+}
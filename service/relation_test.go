@@ -0,0 +1,62 @@
+package service
+
+import (
+	"fmt"
+	"funcbase/model"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestMultipleRelationOnDelete(t *testing.T) {
+	svc, db := newTestService(t)
+
+	posts := func(onDelete string) model.CreateTable {
+		return model.CreateTable{Name: "posts", Fields: []model.Field{
+			{Type: "text", Name: "title"},
+			{Type: "relation", Name: "tags", Reference: "tags", Multiple: true, OnDelete: onDelete},
+		}}
+	}
+	createTables(t, svc, db,
+		model.CreateTable{Name: "tags", Fields: []model.Field{{Type: "text", Name: "name"}}},
+		posts(model.ON_DELETE_RESTRICT),
+	)
+	insertRows(t, svc, db, "tags", map[string]interface{}{"name": "x"}, map[string]interface{}{"name": "y"})
+	insertRows(t, svc, db, "posts", map[string]interface{}{"title": "a", "tags": []interface{}{1, 2}})
+
+	tags := func() string {
+		t.Helper()
+		rows, err := svc.DB.Fetch(db, &FetchParams{Table: "posts"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(rows[0]["tags"])
+	}
+	if got := tags(); got != "[1 2]" {
+		t.Fatalf("tags %s", got)
+	}
+
+	err := svc.DB.BatchDelete(db, "tags", []string{"1"})
+	if err == nil {
+		t.Error("linked tag deleted through a restricted relation")
+	}
+
+	// the junction is created again with the new on delete, the links are kept
+	err = svc.Table.Alter(func(tx *gorm.DB) error {
+		return svc.Table.Rebuild(tx, posts(model.ON_DELETE_CASCADE))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tags(); got != "[1 2]" {
+		t.Fatalf("tags after the rebuild %s", got)
+	}
+
+	err = svc.DB.BatchDelete(db, "tags", []string{"1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tags(); got != "[2]" {
+		t.Errorf("tags after the delete %s", got)
+	}
+}
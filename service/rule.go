@@ -0,0 +1,520 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"funcbase/model"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/sarulabs/di"
+	"gorm.io/gorm"
+)
+
+var ErrRuleDenied = errors.New("the rule of the operation denies the request")
+
+// Auth
+//
+// Requesting user a rule is checked against. A guest has an empty id, the collection is the
+// user collection the token was issued by
+type Auth struct {
+	ID         interface{}
+	Collection string
+}
+
+type RuleService interface {
+	Validate(tableName string, rules model.Rules) error
+	Condition(tableName string, operation string, auth Auth) (string, []interface{}, error)
+	RowCondition(tableName string, operation string, auth Auth, source string) (string, []interface{}, error)
+	Allowed(db *gorm.DB, tableName string, operation string, auth Auth, ids []interface{}) (bool, error)
+	Match(db *gorm.DB, tableName string, operation string, auth Auth, row map[string]interface{}) (bool, error)
+}
+
+type RuleServiceImpl struct {
+	service *BaseService
+}
+
+func NewRuleService(ioc di.Container) RuleService {
+	return &RuleServiceImpl{
+		service: NewBaseService(ioc),
+	}
+}
+
+// Validate
+//
+// Check the syntax of every rule and the fields they read
+func (s *RuleServiceImpl) Validate(tableName string, rules model.Rules) error {
+	columns, err := s.columns(tableName)
+	if err != nil {
+		return err
+	}
+
+	for _, operation := range model.RuleOperations {
+		rule := rules.Get(operation)
+		if rule == nil {
+			continue
+		}
+
+		node, err := parseRule(*rule)
+		if err != nil {
+			return fmt.Errorf("%s rule: %s", operation, err.Error())
+		}
+
+		if node == nil {
+			continue
+		}
+		for _, field := range node.fields() {
+			if !columns[field] {
+				return fmt.Errorf("%s rule: unknown field %s", operation, field)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Condition
+//
+// Sql condition the rows of the table must match for the operation, empty when every row
+// is allowed. ErrRuleDenied is returned when only the admin may run the operation
+func (s *RuleServiceImpl) Condition(tableName string, operation string, auth Auth) (string, []interface{}, error) {
+	table, err := s.service.WithService().Table.Info(tableName, TABLE_INFO_RULES)
+	if err != nil {
+		return "", nil, err
+	}
+
+	rule := table.SystemRule.Get(operation)
+	if rule == nil {
+		return "", nil, ErrRuleDenied
+	}
+
+	node, err := parseRule(*rule)
+	if err != nil {
+		return "", nil, err
+	}
+	if node == nil {
+		return "", nil, nil
+	}
+
+	columns, err := s.columns(tableName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	compiler := &ruleCompiler{service: s, table: tableName, columns: columns, auth: auth}
+	query := compiler.compile(node)
+	if compiler.err != nil {
+		return "", nil, compiler.err
+	}
+
+	return "(" + query + ")", compiler.args, nil
+}
+
+// RowCondition
+//
+// Condition of the operation checked against a row read from a json object instead of the
+// table, source is the sql expression of the object
+func (s *RuleServiceImpl) RowCondition(tableName string, operation string, auth Auth, source string) (string, []interface{}, error) {
+	condition, args, err := s.Condition(tableName, operation, auth)
+	if err != nil || condition == "" {
+		return condition, args, err
+	}
+
+	row, err := s.service.WithService().DB.JSONRow(tableName, source)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s)", row, condition), args, nil
+}
+
+// Allowed
+//
+// Check the rule of the operation against stored rows, ids that don't exist are left to the
+// caller
+func (s *RuleServiceImpl) Allowed(db *gorm.DB, tableName string, operation string, auth Auth, ids []interface{}) (bool, error) {
+	condition, args, err := s.Condition(tableName, operation, auth)
+	if errors.Is(err, ErrRuleDenied) {
+		return false, nil
+	}
+	if err != nil || condition == "" {
+		return err == nil, err
+	}
+
+	var denied int64
+	err = db.Table(tableName).
+		Where("id IN ?", ids).
+		Where("NOT COALESCE("+condition+", 0)", args...).
+		Count(&denied).Error
+	if err != nil {
+		return false, err
+	}
+
+	return denied == 0, nil
+}
+
+// Match
+//
+// Check the rule of the operation against a row that is not stored, e.g. the data of an insert
+// or a deleted row
+func (s *RuleServiceImpl) Match(db *gorm.DB, tableName string, operation string, auth Auth, row map[string]interface{}) (bool, error) {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return false, err
+	}
+
+	condition, args, err := s.RowCondition(tableName, operation, auth, "?")
+	if errors.Is(err, ErrRuleDenied) {
+		return false, nil
+	}
+	if err != nil || condition == "" {
+		return err == nil, err
+	}
+
+	var matched bool
+	err = db.Raw("SELECT "+condition, append([]interface{}{string(data)}, args...)...).Scan(&matched).Error
+
+	return matched, err
+}
+
+func (s *RuleServiceImpl) columns(tableName string) (map[string]bool, error) {
+	columns, err := s.service.WithService().Table.Columns(tableName, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string]bool{}
+	for _, column := range columns {
+		if column["multiple"] != true {
+			names[fmt.Sprintf("%v", ColumnValue(column, "name"))] = true
+		}
+	}
+
+	return names, nil
+}
+
+// ruleNode
+//
+// Parsed rule, either a logical operation on two nodes or a comparison of two operands
+type ruleNode struct {
+	operator string
+	left     *ruleNode
+	right    *ruleNode
+
+	operands [2]ruleOperand
+}
+
+const (
+	RULE_OPERAND_FIELD = iota
+	RULE_OPERAND_AUTH
+	RULE_OPERAND_VALUE
+	RULE_OPERAND_NULL
+)
+
+type ruleOperand struct {
+	kind  int
+	name  string
+	value interface{}
+}
+
+func (n *ruleNode) fields() []string {
+	if n.left != nil {
+		return append(n.left.fields(), n.right.fields()...)
+	}
+
+	fields := []string{}
+	for _, operand := range n.operands {
+		if operand.kind == RULE_OPERAND_FIELD {
+			fields = append(fields, operand.name)
+		}
+	}
+
+	return fields
+}
+
+var ruleComparisons = []string{"!=", ">=", "<=", "!~", "=", ">", "<", "~"}
+
+// parseRule
+//
+// Parse a rule made of comparisons joined by && and ||, grouped with parentheses. An operand
+// is a field of the row, @request.auth.id, @request.auth.collection, any other field of the
+// requesting user as @request.auth.<field>, a quoted text, a number, true, false or null.
+// Comparisons are = != > >= < <=, ~ for contains and !~ for not contains. An empty rule is nil
+func parseRule(rule string) (*ruleNode, error) {
+	parser := &ruleParser{input: rule}
+	if parser.skip(); parser.position == len(parser.input) {
+		return nil, nil
+	}
+
+	node, err := parser.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.skip(); parser.position < len(parser.input) {
+		return nil, parser.errorf("unexpected %q", parser.input[parser.position:])
+	}
+
+	return node, nil
+}
+
+type ruleParser struct {
+	input    string
+	position int
+}
+
+func (p *ruleParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid rule at %d: %s", p.position, fmt.Sprintf(format, args...))
+}
+
+func (p *ruleParser) skip() {
+	for p.position < len(p.input) && unicode.IsSpace(rune(p.input[p.position])) {
+		p.position++
+	}
+}
+
+func (p *ruleParser) consume(token string) bool {
+	p.skip()
+	if strings.HasPrefix(p.input[p.position:], token) {
+		p.position += len(token)
+		return true
+	}
+
+	return false
+}
+
+func (p *ruleParser) or() (*ruleNode, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consume("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &ruleNode{operator: "OR", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *ruleParser) and() (*ruleNode, error) {
+	left, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consume("&&") {
+		right, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		left = &ruleNode{operator: "AND", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *ruleParser) primary() (*ruleNode, error) {
+	if p.consume("(") {
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, p.errorf("missing )")
+		}
+
+		return node, nil
+	}
+
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	operator := ""
+	for _, comparison := range ruleComparisons {
+		if p.consume(comparison) {
+			operator = comparison
+			break
+		}
+	}
+	if operator == "" {
+		return nil, p.errorf("comparison expected")
+	}
+
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ruleNode{operator: operator, operands: [2]ruleOperand{left, right}}, nil
+}
+
+func (p *ruleParser) operand() (ruleOperand, error) {
+	p.skip()
+	if p.position == len(p.input) {
+		return ruleOperand{}, p.errorf("operand expected")
+	}
+
+	switch quote := p.input[p.position]; {
+	case quote == '"' || quote == '\'':
+		end := strings.IndexByte(p.input[p.position+1:], quote)
+		if end < 0 {
+			return ruleOperand{}, p.errorf("unterminated text")
+		}
+
+		value := p.input[p.position+1 : p.position+1+end]
+		p.position += end + 2
+
+		return ruleOperand{kind: RULE_OPERAND_VALUE, value: value}, nil
+	}
+
+	start := p.position
+	for p.position < len(p.input) {
+		char := rune(p.input[p.position])
+		if !unicode.IsLetter(char) && !unicode.IsDigit(char) && char != '_' && char != '.' && char != '@' && char != '-' {
+			break
+		}
+		p.position++
+	}
+	word := p.input[start:p.position]
+
+	switch {
+	case word == "":
+		return ruleOperand{}, p.errorf("operand expected")
+	case word == "null":
+		return ruleOperand{kind: RULE_OPERAND_NULL}, nil
+	case word == "true":
+		return ruleOperand{kind: RULE_OPERAND_VALUE, value: true}, nil
+	case word == "false":
+		return ruleOperand{kind: RULE_OPERAND_VALUE, value: false}, nil
+	case strings.HasPrefix(word, "@request.auth."):
+		name := strings.TrimPrefix(word, "@request.auth.")
+		if !validIdentifier(name) {
+			return ruleOperand{}, p.errorf("invalid %s", word)
+		}
+
+		return ruleOperand{kind: RULE_OPERAND_AUTH, name: name}, nil
+	case validIdentifier(word):
+		return ruleOperand{kind: RULE_OPERAND_FIELD, name: word}, nil
+	}
+
+	if number, err := strconv.ParseFloat(word, 64); err == nil {
+		return ruleOperand{kind: RULE_OPERAND_VALUE, value: number}, nil
+	}
+
+	return ruleOperand{}, p.errorf("invalid operand %s", word)
+}
+
+func validIdentifier(name string) bool {
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		return false
+	}
+
+	for _, char := range name {
+		if !unicode.IsLetter(char) && !unicode.IsDigit(char) && char != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ruleCompiler
+//
+// Write a parsed rule as a sql condition on the table, every value is bound as an argument
+type ruleCompiler struct {
+	service *RuleServiceImpl
+	table   string
+	columns map[string]bool
+	auth    Auth
+	args    []interface{}
+	err     error
+}
+
+func (c *ruleCompiler) compile(node *ruleNode) string {
+	if node.left != nil {
+		return fmt.Sprintf("(%s %s %s)", c.compile(node.left), node.operator, c.compile(node.right))
+	}
+
+	left, right := node.operands[0], node.operands[1]
+	if right.kind == RULE_OPERAND_NULL && left.kind != RULE_OPERAND_NULL {
+		left, right = right, left
+	}
+	if left.kind == RULE_OPERAND_NULL {
+		switch node.operator {
+		case "=":
+			return fmt.Sprintf("(%s IS NULL)", c.operand(right))
+		case "!=":
+			return fmt.Sprintf("(%s IS NOT NULL)", c.operand(right))
+		}
+	}
+
+	switch node.operator {
+	case "~":
+		return fmt.Sprintf("(%s LIKE '%%' || %s || '%%')", c.operand(left), c.operand(right))
+	case "!~":
+		return fmt.Sprintf("(%s NOT LIKE '%%' || %s || '%%')", c.operand(left), c.operand(right))
+	}
+
+	return fmt.Sprintf("(%s %s %s)", c.operand(left), node.operator, c.operand(right))
+}
+
+func (c *ruleCompiler) operand(operand ruleOperand) string {
+	switch operand.kind {
+	case RULE_OPERAND_FIELD:
+		if !c.columns[operand.name] {
+			c.err = fmt.Errorf("unknown field %s on rule of %s", operand.name, c.table)
+		}
+		return fmt.Sprintf(`"%s"."%s"`, c.table, operand.name)
+	case RULE_OPERAND_NULL:
+		return "NULL"
+	case RULE_OPERAND_VALUE:
+		c.args = append(c.args, operand.value)
+		return "?"
+	}
+
+	return c.authOperand(operand.name)
+}
+
+// authOperand
+//
+// Field of the requesting user, a guest has an empty id and null on every other field
+func (c *ruleCompiler) authOperand(name string) string {
+	switch name {
+	case "id":
+		if c.auth.ID == nil {
+			c.args = append(c.args, "")
+		} else {
+			c.args = append(c.args, c.auth.ID)
+		}
+		return "?"
+	case "collection":
+		c.args = append(c.args, c.auth.Collection)
+		return "?"
+	case "password", "salt":
+		return "NULL"
+	}
+
+	if c.auth.ID == nil || c.auth.Collection == "" {
+		return "NULL"
+	}
+
+	table, err := c.service.service.WithService().Table.Info(c.auth.Collection, TABLE_INFO_AUTH)
+	if err != nil || !table.Auth {
+		return "NULL"
+	}
+	columns, err := c.service.columns(c.auth.Collection)
+	if err != nil || !columns[name] {
+		return "NULL"
+	}
+
+	c.args = append(c.args, c.auth.ID)
+	return fmt.Sprintf(`(SELECT "%s" FROM "%s" WHERE id = ?)`, name, c.auth.Collection)
+}
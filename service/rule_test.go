@@ -0,0 +1,93 @@
+package service
+
+import (
+	"errors"
+	"funcbase/model"
+	"testing"
+)
+
+func rule(value string) *string {
+	return &value
+}
+
+func TestRuleValidate(t *testing.T) {
+	svc, db := newTestService(t)
+	createMembers(t, svc, db)
+
+	tests := []struct {
+		name  string
+		rule  string
+		valid bool
+	}{
+		{"empty", "", true},
+		{"field against auth", "@request.auth.id = author", true},
+		{"logical operators", `title = "hello" || (@request.auth.id != "" && author = @request.auth.id)`, true},
+		{"unknown field", "owner = @request.auth.id", false},
+		{"unclosed group", "(author = @request.auth.id", false},
+		{"sql", "author IN (SELECT id FROM members)", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := svc.Rule.Validate("posts", model.Rules{List: rule(test.rule)})
+			if test.valid && err != nil {
+				t.Errorf("rule %q refused: %v", test.rule, err)
+			}
+			if !test.valid && err == nil {
+				t.Errorf("rule %q accepted", test.rule)
+			}
+		})
+	}
+}
+
+func TestRuleCondition(t *testing.T) {
+	svc, db := newTestService(t)
+	createMembers(t, svc, db)
+
+	err := svc.Table.SetRules(db, "posts", model.Rules{
+		List:   rule(""),
+		Update: rule("@request.auth.id = author"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	condition, _, err := svc.Rule.Condition("posts", model.RULE_LIST, Auth{})
+	if err != nil || condition != "" {
+		t.Errorf("empty rule: condition %q, error %v", condition, err)
+	}
+
+	_, _, err = svc.Rule.Condition("posts", model.RULE_DELETE, Auth{ID: 1, Collection: "members"})
+	if !errors.Is(err, ErrRuleDenied) {
+		t.Errorf("missing rule: error %v, want ErrRuleDenied", err)
+	}
+
+	tests := []struct {
+		name    string
+		auth    Auth
+		ids     []interface{}
+		allowed bool
+	}{
+		{"author", Auth{ID: 1, Collection: "members"}, []interface{}{1}, true},
+		{"other member", Auth{ID: 2, Collection: "members"}, []interface{}{1}, false},
+		{"one of the rows denied", Auth{ID: 1, Collection: "members"}, []interface{}{1, 2}, false},
+		{"guest", Auth{}, []interface{}{1}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allowed, err := svc.Rule.Allowed(db, "posts", model.RULE_UPDATE, test.auth, test.ids)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != test.allowed {
+				t.Errorf("allowed %v, want %v", allowed, test.allowed)
+			}
+		})
+	}
+
+	matched, err := svc.Rule.Match(db, "posts", model.RULE_UPDATE, Auth{ID: 2, Collection: "members"}, map[string]interface{}{"title": "new", "author": 2})
+	if err != nil || !matched {
+		t.Errorf("match of an unsaved row: %v, error %v", matched, err)
+	}
+}
@@ -0,0 +1,615 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"funcbase/constants"
+	"funcbase/model"
+	"funcbase/utils"
+	"strings"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/sarulabs/di"
+	"gorm.io/gorm"
+)
+
+type SchemaService interface {
+	Export() (model.Schema, error)
+	Table(tableName string) (model.SchemaTable, error)
+	Plan(schema model.Schema) ([]model.SchemaChange, error)
+	Import(schema model.Schema, dryRun bool) ([]model.SchemaChange, error)
+	Codegen(lang string) (string, error)
+	OpenAPI(serverURL string) (map[string]interface{}, error)
+}
+
+type SchemaServiceImpl struct {
+	service *BaseService
+	db      *gorm.DB
+	cache   *cache.Cache
+}
+
+func NewSchemaService(ioc di.Container) SchemaService {
+	return &SchemaServiceImpl{
+		service: NewBaseService(ioc),
+		db:      ioc.Get(constants.CONTAINER_DB).(*gorm.DB),
+		cache:   ioc.Get(constants.CONTAINER_CACHE).(*cache.Cache),
+	}
+}
+
+// rolls back the import transaction once every step has been checked
+var errSchemaDryRun = errors.New("schema dry run")
+
+// Export
+//
+// Dump every non system collection, fields are reconstructed from the live columns
+func (s *SchemaServiceImpl) Export() (model.Schema, error) {
+	schema := model.Schema{
+		Version: model.SCHEMA_VERSION,
+		Tables:  []model.SchemaTable{},
+	}
+
+	var names []string
+	err := s.db.Model(&model.Tables{}).
+		Where("system = ?", false).
+		Order("rowid").
+		Pluck("name", &names).Error
+	if err != nil {
+		return schema, err
+	}
+
+	for _, name := range names {
+		table, err := s.Table(name)
+		if err != nil {
+			return schema, err
+		}
+
+		schema.Tables = append(schema.Tables, table)
+	}
+
+	return schema, nil
+}
+
+// Table
+//
+// Definition of a single collection as it would be exported
+func (s *SchemaServiceImpl) Table(tableName string) (model.SchemaTable, error) {
+	tableService := s.service.WithService().Table
+
+	info, err := tableService.Info(tableName)
+	if err != nil {
+		return model.SchemaTable{}, err
+	}
+
+	table := model.SchemaTable{
+		Name:       info.Name,
+		Auth:       info.Auth,
+		Type:       info.Type,
+		Indexes:    info.SystemIndex,
+		Rules:      *info.SystemRule,
+		Triggers:   info.SystemTrigger,
+		SoftDelete: info.SoftDelete,
+		History:    info.History,
+		Versioned:  info.Versioned,
+	}
+
+	// integer ids are left out so that older exports stay the same
+	if info.TextID() {
+		table.IDType = info.IDType
+		table.IDPrefix = info.IDPrefix
+	}
+
+	if info.SystemConstraint != nil {
+		table.Uniques = info.SystemConstraint.Uniques
+		table.Checks = info.SystemConstraint.Checks
+	}
+
+	if info.IsView() {
+		var query string
+		err = s.db.Model(&model.Tables{}).Where("name = ?", tableName).Pluck("query", &query).Error
+		if err != nil {
+			return table, err
+		}
+
+		table.Query = query
+		table.Indexes = nil
+		table.Uniques = nil
+		table.Checks = nil
+		table.Triggers = nil
+
+		return table, nil
+	}
+
+	columns, err := tableService.Columns(tableName, false, false)
+	if err != nil {
+		return table, err
+	}
+
+	uniques, err := s.uniqueColumns(tableName)
+	if err != nil {
+		return table, err
+	}
+
+	// single column named constraint is not a unique flag of the field
+	for _, unique := range table.Uniques {
+		if len(unique.Columns) == 1 {
+			delete(uniques, unique.Columns[0])
+		}
+	}
+
+	relations := map[string]model.Relation{}
+	for _, relation := range info.SystemRelation {
+		relations[relation.Field] = relation
+	}
+
+	for _, column := range columns {
+		name := fmt.Sprintf("%v", ColumnValue(column, "name"))
+		switch name {
+		case "id", "created_at", "updated_at", "deleted_at":
+			continue
+		case "version":
+			if info.Versioned {
+				continue
+			}
+		case "email", "password", "salt":
+			if info.Auth {
+				continue
+			}
+		}
+
+		field := model.Field{
+			Name:     name,
+			Type:     fieldType(fmt.Sprintf("%v", ColumnValue(column, "type"))),
+			Nullable: fmt.Sprintf("%v", ColumnValue(column, "notnull")) == "0",
+			Unique:   uniques[name],
+		}
+		if column["searchable"] == true {
+			field.Searchable = true
+		}
+		if permission, ok := column["permission"].(string); ok {
+			field.Permission = permission
+		}
+
+		if relation, ok := relations[name]; ok {
+			field.Type = "relation"
+			field.Reference = relation.Reference
+			field.Multiple = relation.Multiple
+			field.OnDelete = relation.OnDelete
+		}
+
+		table.Fields = append(table.Fields, normalizeField(field))
+	}
+
+	return table, nil
+}
+
+// uniqueColumns
+//
+// Columns having their own unique constraint, as created by the unique flag of a field
+func (s *SchemaServiceImpl) uniqueColumns(tableName string) (map[string]bool, error) {
+	var columns []string
+	err := s.db.Raw(`
+		SELECT MIN(info.name)
+		FROM pragma_index_list(?) AS list, pragma_index_info(list.name) AS info
+		WHERE list.origin = 'u'
+		GROUP BY list.name
+		HAVING COUNT(*) = 1
+	`, tableName).Scan(&columns).Error
+	if err != nil {
+		return nil, err
+	}
+
+	uniques := map[string]bool{}
+	for _, column := range columns {
+		uniques[column] = true
+	}
+
+	return uniques, nil
+}
+
+// fieldType
+//
+// Reverse of Field.ConvertTypeToSQLiteType
+func fieldType(sqliteType string) string {
+	switch strings.ToUpper(sqliteType) {
+	case "TEXT":
+		return "text"
+	case "REAL":
+		return "number"
+	case "BOOLEAN":
+		return "boolean"
+	case "DATETIME":
+		return "datetime"
+	case "BLOB":
+		return "file"
+	case "RELATION":
+		return "relation"
+	default:
+		return strings.ToLower(sqliteType)
+	}
+}
+
+func normalizeField(field model.Field) model.Field {
+	field.Type = fieldType(field.ConvertTypeToSQLiteType())
+	field.OnDelete = strings.ToLower(field.OnDelete)
+
+	if field.Type != "relation" {
+		field.Reference = ""
+		field.Multiple = false
+		field.OnDelete = ""
+	}
+
+	if field.Type != "text" {
+		field.Searchable = false
+	}
+
+	// multiple relation lives on a junction table, it has no column constraint
+	if field.Multiple {
+		field.Nullable = true
+		field.Unique = false
+	}
+
+	return field
+}
+
+// normalizeSchema
+//
+// Validate an imported snapshot and bring it to the same shape as Export
+func normalizeSchema(schema model.Schema) (model.Schema, error) {
+	if schema.Version > model.SCHEMA_VERSION {
+		return schema, fmt.Errorf("schema version %d is not supported", schema.Version)
+	}
+
+	names := map[string]bool{}
+	for i, table := range schema.Tables {
+		if table.Name == "" {
+			return schema, errors.New("table name is required")
+		}
+
+		if strings.HasPrefix(table.Name, "_") {
+			return schema, fmt.Errorf("system table %s cannot be imported", table.Name)
+		}
+
+		if names[table.Name] {
+			return schema, fmt.Errorf("table %s is defined more than once", table.Name)
+		}
+		names[table.Name] = true
+
+		if table.Access != "" {
+			if len(strings.Split(table.Access, ";")) != 5 {
+				return schema, fmt.Errorf("invalid access %s on table %s", table.Access, table.Name)
+			}
+			table.Rules = model.RulesFromAccess(table.Access, table.Auth)
+			table.Access = ""
+		}
+		for _, operation := range model.RuleOperations {
+			if rule := table.Rules.Get(operation); rule != nil {
+				if _, err := parseRule(*rule); err != nil {
+					return schema, fmt.Errorf("invalid %s rule on table %s: %s", operation, table.Name, err.Error())
+				}
+			}
+		}
+
+		if table.IsView() {
+			table.Query = strings.TrimSuffix(strings.TrimSpace(table.Query), ";")
+			if table.Query == "" {
+				return schema, fmt.Errorf("view %s requires a query", table.Name)
+			}
+
+			table.Auth = false
+			table.IDType = ""
+			table.IDPrefix = ""
+			table.Fields = nil
+			table.Indexes = nil
+			table.Uniques = nil
+			table.Checks = nil
+			table.Triggers = nil
+			table.SoftDelete = false
+			table.History = false
+			table.Versioned = false
+			schema.Tables[i] = table
+			continue
+		}
+
+		if table.Type != "" {
+			return schema, fmt.Errorf("invalid type %s on table %s", table.Type, table.Name)
+		}
+		table.Query = ""
+
+		if table.IDType == model.ID_TYPE_INTEGER {
+			table.IDType = ""
+		}
+		if table.IDType != "" && !utils.ArrayContains(model.IDTypes, table.IDType) {
+			return schema, fmt.Errorf("invalid id type %s on table %s", table.IDType, table.Name)
+		}
+		if table.IDPrefix != "" && table.IDType != model.ID_TYPE_NANOID {
+			return schema, fmt.Errorf("id prefix of table %s requires the nanoid id type", table.Name)
+		}
+
+		for j, field := range table.Fields {
+			if field.ConvertTypeToSQLiteType() == "" {
+				return schema, fmt.Errorf("unsupported type %s on field %s.%s", field.Type, table.Name, field.Name)
+			}
+
+			if _, err := field.OnDeleteClause(); err != nil {
+				return schema, err
+			}
+
+			table.Fields[j] = normalizeField(field)
+		}
+
+		for j, trigger := range table.Triggers {
+			trigger, err := normalizeTrigger(trigger)
+			if err != nil {
+				return schema, err
+			}
+
+			table.Triggers[j] = trigger
+		}
+
+		schema.Tables[i] = table
+	}
+
+	for _, table := range schema.Tables {
+		for _, field := range table.Fields {
+			if field.Type == "relation" && !names[field.Reference] {
+				return schema, fmt.Errorf("relation %s.%s references unknown table %s", table.Name, field.Name, field.Reference)
+			}
+		}
+	}
+
+	return schema, nil
+}
+
+// sameList
+//
+// Compare two lists by their json, nil and empty list are the same
+func sameList[T any](a []T, b []T) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+
+	aJson, _ := json.Marshal(a)
+	bJson, _ := json.Marshal(b)
+
+	return string(aJson) == string(bJson)
+}
+
+// Plan
+//
+// Diff a snapshot against the live database. Views are dropped first and created last
+// so that they always see the tables they select from
+func (s *SchemaServiceImpl) Plan(schema model.Schema) ([]model.SchemaChange, error) {
+	schema, err := normalizeSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := s.Export()
+	if err != nil {
+		return nil, err
+	}
+
+	liveTables := map[string]model.SchemaTable{}
+	for _, table := range live.Tables {
+		liveTables[table.Name] = table
+	}
+
+	wanted := map[string]bool{}
+	tableChanges := []model.SchemaChange{}
+	viewChanges := []model.SchemaChange{}
+	for _, table := range schema.Tables {
+		wanted[table.Name] = true
+
+		var change *model.SchemaChange
+		current, exists := liveTables[table.Name]
+		if !exists {
+			change = &model.SchemaChange{Action: model.SCHEMA_CREATE, Table: table.Name}
+		} else {
+			if current.Auth != table.Auth || current.IsView() != table.IsView() {
+				return nil, fmt.Errorf("type of %s cannot be changed, drop it first", table.Name)
+			}
+			if current.IDType != table.IDType || current.IDPrefix != table.IDPrefix {
+				return nil, fmt.Errorf("id type of %s cannot be changed, drop it first", table.Name)
+			}
+
+			changes := []string{}
+			if !sameList(current.Fields, table.Fields) {
+				changes = append(changes, "fields")
+			}
+			if !sameList(current.Indexes, table.Indexes) {
+				changes = append(changes, "indexes")
+			}
+			if !sameList(current.Uniques, table.Uniques) ||
+				!sameList(current.Checks, table.Checks) {
+				changes = append(changes, "constraints")
+			}
+			if !sameList(current.Triggers, table.Triggers) {
+				changes = append(changes, "triggers")
+			}
+			if current.Query != table.Query {
+				changes = append(changes, "query")
+			}
+			if !sameList([]model.Rules{current.Rules}, []model.Rules{table.Rules}) {
+				changes = append(changes, "rules")
+			}
+			if current.SoftDelete != table.SoftDelete {
+				changes = append(changes, "soft_delete")
+			}
+			if current.History != table.History {
+				changes = append(changes, "history")
+			}
+			if current.Versioned != table.Versioned {
+				changes = append(changes, "versioned")
+			}
+
+			if len(changes) > 0 {
+				change = &model.SchemaChange{Action: model.SCHEMA_ALTER, Table: table.Name, Changes: changes}
+			}
+		}
+
+		if change == nil {
+			continue
+		}
+
+		if table.IsView() {
+			viewChanges = append(viewChanges, *change)
+		} else {
+			tableChanges = append(tableChanges, *change)
+		}
+	}
+
+	plan := []model.SchemaChange{}
+	droppedTables := []model.SchemaChange{}
+	for _, table := range live.Tables {
+		if wanted[table.Name] {
+			continue
+		}
+
+		change := model.SchemaChange{Action: model.SCHEMA_DROP, Table: table.Name}
+		if table.IsView() {
+			plan = append(plan, change)
+		} else {
+			droppedTables = append(droppedTables, change)
+		}
+	}
+
+	plan = append(plan, tableChanges...)
+	plan = append(plan, viewChanges...)
+	plan = append(plan, droppedTables...)
+
+	return plan, nil
+}
+
+// Import
+//
+// Apply a snapshot in a single transaction. On dry run every step is still executed
+// so that failing steps are reported, then the transaction is rolled back
+func (s *SchemaServiceImpl) Import(schema model.Schema, dryRun bool) ([]model.SchemaChange, error) {
+	plan, err := s.Plan(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(plan) == 0 {
+		return plan, nil
+	}
+
+	schema, _ = normalizeSchema(schema)
+	tables := map[string]model.SchemaTable{}
+	for _, table := range schema.Tables {
+		tables[table.Name] = table
+	}
+
+	tableService := s.service.WithService().Table
+	err = tableService.Alter(func(tx *gorm.DB) error {
+		for _, change := range plan {
+			err := s.apply(tx, tableService, change, tables[change.Table])
+			if err != nil {
+				return fmt.Errorf("failed to %s %s: %w", change.Action, change.Table, err)
+			}
+		}
+
+		// trigger bodies can use any table of the snapshot, they come once every table exists
+		for _, change := range plan {
+			table := tables[change.Table]
+			setTriggers := change.Action == model.SCHEMA_CREATE && len(table.Triggers) > 0 ||
+				change.Action == model.SCHEMA_ALTER && utils.ArrayContains(change.Changes, "triggers")
+			if !setTriggers {
+				continue
+			}
+
+			err := tableService.SetTriggers(tx, table.Name, table.Triggers)
+			if err != nil {
+				return fmt.Errorf("failed to %s %s: %w", change.Action, change.Table, err)
+			}
+		}
+
+		if dryRun {
+			return errSchemaDryRun
+		}
+
+		return nil
+	})
+
+	for _, change := range plan {
+		clearTableCache(s.cache, change.Table)
+	}
+
+	if errors.Is(err, errSchemaDryRun) {
+		return plan, nil
+	}
+
+	return plan, err
+}
+
+func (s *SchemaServiceImpl) apply(tx *gorm.DB, tableService TableService, change model.SchemaChange, table model.SchemaTable) error {
+	var err error
+	switch change.Action {
+	case model.SCHEMA_DROP:
+		return tableService.Drop(tx, change.Table)
+	case model.SCHEMA_CREATE:
+		if table.IsView() {
+			err = tableService.CreateView(tx, model.CreateView{Name: table.Name, Query: table.Query})
+		} else {
+			err = tableService.Create(tx, createTableParams(table))
+		}
+		if err != nil {
+			return err
+		}
+
+		return tableService.SetRules(tx, table.Name, table.Rules)
+	}
+
+	for _, part := range change.Changes {
+		switch part {
+		case "soft_delete":
+			// rebuild below relies on the deleted_at column being known
+			err = tableService.SetSoftDelete(tx, table.Name, table.SoftDelete)
+		case "history":
+			err = tableService.SetHistory(tx, table.Name, table.History)
+		case "versioned":
+			// like soft delete, the rebuild keeps the version column once it is known
+			err = tableService.SetVersioned(tx, table.Name, table.Versioned)
+		case "query":
+			err = tableService.UpdateView(tx, model.CreateView{Name: table.Name, Query: table.Query})
+		case "rules":
+			err = tableService.SetRules(tx, table.Name, table.Rules)
+		case "triggers":
+			// old triggers could use dropped columns, the new ones are set after every change
+			err = tableService.SetTriggers(tx, table.Name, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, part := range change.Changes {
+		if part == "fields" || part == "indexes" || part == "constraints" {
+			return tableService.Rebuild(tx, createTableParams(table))
+		}
+	}
+
+	return nil
+}
+
+func createTableParams(table model.SchemaTable) model.CreateTable {
+	// empty instead of nil, rebuild keeps what is left out
+	params := model.CreateTable{
+		Name:       table.Name,
+		Fields:     table.Fields,
+		Indexes:    append([]model.Index{}, table.Indexes...),
+		Uniques:    append([]model.Unique{}, table.Uniques...),
+		Checks:     append([]model.Check{}, table.Checks...),
+		SoftDelete: table.SoftDelete,
+		History:    table.History,
+		Versioned:  table.Versioned,
+		IDType:     table.IDType,
+		IDPrefix:   table.IDPrefix,
+	}
+	if table.Auth {
+		params.Type = "users"
+	}
+
+	return params
+}
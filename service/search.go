@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"funcbase/model"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// searchTableName
+//
+// FTS5 table indexing the searchable fields of a table, its content is read from the table itself
+func searchTableName(tableName string) string {
+	return "_fts_" + tableName
+}
+
+// searchFields
+//
+// Names of the fields marked as searchable, only text fields can be searched
+func searchFields(fields []model.Field) ([]string, error) {
+	searchable := []string{}
+	for _, field := range fields {
+		if !field.Searchable {
+			continue
+		}
+
+		if field.ConvertTypeToSQLiteType() != "TEXT" {
+			return nil, fmt.Errorf("field %s must be a text field to be searchable", field.Name)
+		}
+
+		searchable = append(searchable, field.Name)
+	}
+
+	return searchable, nil
+}
+
+func dropSearch(tx *gorm.DB, tableName string) error {
+	for _, trigger := range []string{"insert", "delete", "update"} {
+		err := tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS search_%s_%s", trigger, tableName)).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", searchTableName(tableName))).Error
+}
+
+// syncSearch
+//
+// Recreate the full text index of a table and the triggers keeping it in sync,
+// the index is filled with the existing rows. No index is kept without searchable field
+func syncSearch(tx *gorm.DB, tableName string, fields []string) error {
+	err := dropSearch(tx, tableName)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	ftsTable := searchTableName(tableName)
+	columns := strings.Join(fields, ", ")
+	newValues := "new." + strings.Join(fields, ", new.")
+	oldValues := "old." + strings.Join(fields, ", old.")
+
+	err = tx.Exec(fmt.Sprintf(
+		"CREATE VIRTUAL TABLE %s USING fts5(%s, content='%s')",
+		ftsTable, columns, tableName,
+	)).Error
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			return errors.New("full text search is not available, build with the sqlite_fts5 tag")
+		}
+		return err
+	}
+
+	// rows are indexed by their rowid, the id itself when it is an integer
+	triggers := []string{
+		fmt.Sprintf(`
+			CREATE TRIGGER search_insert_%s AFTER INSERT ON %s BEGIN
+				INSERT INTO %s (rowid, %s) VALUES (new.rowid, %s);
+			END
+		`, tableName, tableName, ftsTable, columns, newValues),
+		fmt.Sprintf(`
+			CREATE TRIGGER search_delete_%s AFTER DELETE ON %s BEGIN
+				INSERT INTO %s (%s, rowid, %s) VALUES ('delete', old.rowid, %s);
+			END
+		`, tableName, tableName, ftsTable, ftsTable, columns, oldValues),
+		// only fired by the searchable fields, updated_at changes don't touch the index
+		fmt.Sprintf(`
+			CREATE TRIGGER search_update_%s AFTER UPDATE OF %s ON %s BEGIN
+				INSERT INTO %s (%s, rowid, %s) VALUES ('delete', old.rowid, %s);
+				INSERT INTO %s (rowid, %s) VALUES (new.rowid, %s);
+			END
+		`, tableName, columns, tableName, ftsTable, ftsTable, columns, oldValues, ftsTable, columns, newValues),
+	}
+
+	for _, trigger := range triggers {
+		err = tx.Exec(trigger).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES ('rebuild')", ftsTable, ftsTable)).Error
+}
+
+// searchQuery
+//
+// Convert user input into a fts5 query. Every word is quoted so that it can't be read
+// as fts5 syntax, and matched as prefix
+func searchQuery(term string) (string, error) {
+	words := []string{}
+	for _, word := range strings.Fields(term) {
+		word = strings.ReplaceAll(word, `"`, "")
+		if word == "" {
+			continue
+		}
+
+		words = append(words, fmt.Sprintf(`"%s"*`, word))
+	}
+
+	if len(words) == 0 {
+		return "", errors.New("search term is empty")
+	}
+
+	return strings.Join(words, " "), nil
+}
+
+// applySearch
+//
+// Join the rows matching the search term, each row gets its rank and a highlighted
+// snippet of the best matching field
+func (s *DBServiceImpl) applySearch(query *gorm.DB, tableName string, term string) (*gorm.DB, error) {
+	table, err := s.service.WithService().Table.Info(tableName, TABLE_INFO_SEARCH)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(table.SystemSearch) == 0 {
+		return nil, fmt.Errorf("%s has no searchable field", tableName)
+	}
+
+	match, err := searchQuery(term)
+	if err != nil {
+		return nil, err
+	}
+
+	ftsTable := searchTableName(tableName)
+
+	return query.Joins(fmt.Sprintf(`
+		JOIN (
+			SELECT
+				rowid AS search_id,
+				rank AS search_rank,
+				snippet(%s, -1, '<mark>', '</mark>', '...', 16) AS search_snippet
+			FROM %s
+			WHERE %s MATCH ?
+		) AS _search ON _search.search_id = %s.rowid
+	`, ftsTable, ftsTable, ftsTable, tableName), match), nil
+}
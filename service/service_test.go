@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"funcbase/constants"
+	"funcbase/model"
+	"funcbase/pkg/cache"
+	pkg_sqlite "funcbase/pkg/sqlite"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sarulabs/di"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestService
+//
+// Services on a fresh database, run from a data directory removed once the test ends
+func newTestService(t *testing.T) (*Service, *gorm.DB) {
+	t.Helper()
+
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, constants.DATA_PATH), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, constants.DATA_PATH, constants.CONFIG_PATH), []byte{}, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+
+	builder, err := di.NewBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = builder.Add(
+		di.Def{
+			Name: constants.CONTAINER_DB,
+			Build: func(ctn di.Container) (interface{}, error) {
+				return pkg_sqlite.NewSQLiteClient(filepath.Join(dir, constants.DATA_PATH, "database.sqlite"), pkg_sqlite.SQLiteOption{Migrate: true, LogMode: logger.Silent})
+			},
+		},
+		di.Def{
+			Name: constants.CONTAINER_CACHE,
+			Build: func(ctn di.Container) (interface{}, error) {
+				return cache.NewCache()
+			},
+		},
+		di.Def{
+			Name: constants.CONTAINER_SERVICE,
+			Build: func(ctn di.Container) (interface{}, error) {
+				return NewService(ctn), nil
+			},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ioc := builder.Build()
+	db := ioc.Get(constants.CONTAINER_DB).(*gorm.DB)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return ioc.Get(constants.CONTAINER_SERVICE).(*Service), db
+}
+
+func asActor(db *gorm.DB, id string, role string) *gorm.DB {
+	return db.WithContext(WithActor(context.Background(), Actor{ID: id, Role: role}))
+}
+
+// createMembers
+//
+// Auth table members with a hidden balance, and posts written by the members
+func createMembers(t *testing.T, svc *Service, db *gorm.DB) {
+	t.Helper()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := svc.Table.Create(tx, model.CreateTable{
+			Name: "members",
+			Type: "users",
+			Fields: []model.Field{
+				{Type: "number", Name: "balance", Nullable: true, Permission: model.FIELD_HIDDEN},
+				{Type: "text", Name: "bio", Nullable: true},
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		return svc.Table.Create(tx, model.CreateTable{
+			Name: "posts",
+			Fields: []model.Field{
+				{Type: "text", Name: "title"},
+				{Type: "relation", Name: "author", Reference: "members", Nullable: true},
+			},
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := asActor(db, "1", "ADMIN")
+	rows := []struct {
+		table string
+		data  map[string]interface{}
+	}{
+		{"members", map[string]interface{}{"email": "a@a", "password": "x", "salt": "y", "balance": 5000, "bio": "first"}},
+		{"members", map[string]interface{}{"email": "b@b", "password": "x", "salt": "y", "balance": 10, "bio": "second"}},
+		{"posts", map[string]interface{}{"title": "secret plan", "author": 1}},
+		{"posts", map[string]interface{}{"title": "hello", "author": 2}},
+	}
+	for _, row := range rows {
+		err = svc.DB.Insert(admin, row.table, row.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// createTables
+//
+// Create the tables in order, in one transaction
+func createTables(t *testing.T, svc *Service, db *gorm.DB, tables ...model.CreateTable) {
+	t.Helper()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range tables {
+			err := svc.Table.Create(tx, table)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// insertRows
+//
+// Insert the rows one by one, ids are given in order from 1
+func insertRows(t *testing.T, svc *Service, db *gorm.DB, tableName string, rows ...map[string]interface{}) {
+	t.Helper()
+
+	for _, row := range rows {
+		err := svc.DB.Insert(db, tableName, row)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// rowIDs
+//
+// Ids of the rows in their order, printed as a list
+func rowIDs(rows []map[string]interface{}) string {
+	ids := []interface{}{}
+	for _, row := range rows {
+		ids = append(ids, row["id"])
+	}
+	return fmt.Sprint(ids)
+}
@@ -17,13 +17,35 @@ import (
 type TableService interface {
 	Info(tableName string, infoNeeded ...string) (model.Tables, error)
 	Create(tx *gorm.DB, params model.CreateTable) error
+	Rebuild(tx *gorm.DB, params model.CreateTable) error
+	SetSoftDelete(tx *gorm.DB, tableName string, enabled bool) error
+	SetHistory(tx *gorm.DB, tableName string, enabled bool) error
+	SetVersioned(tx *gorm.DB, tableName string, enabled bool) error
+	SetRules(tx *gorm.DB, tableName string, rules model.Rules) error
+	CreateView(tx *gorm.DB, params model.CreateView) error
+	UpdateView(tx *gorm.DB, params model.CreateView) error
 	Rename(tx *gorm.DB, tableName string, newName string) error
 	Drop(tx *gorm.DB, tableName string) error
+	Alter(fn func(tx *gorm.DB) error) error
+
+	Relations(tableName string) ([]model.Relation, error)
+
+	Permissions(tableName string) (map[string]string, error)
 
 	Columns(tableName string, fetchAuthColumn bool, fetchTableType bool) ([]map[string]interface{}, error)
 
 	Indexes(tableName string) ([]string, error)
 	DropIndexes(tx *gorm.DB, indexes []string) error
+	CreateIndex(tx *gorm.DB, tableName string, index model.Index) error
+	DropIndex(tx *gorm.DB, tableName string, indexName string) error
+
+	Triggers(tableName string) ([]model.Trigger, error)
+	CreateTrigger(tx *gorm.DB, tableName string, trigger model.Trigger) error
+	UpdateTrigger(tx *gorm.DB, tableName string, triggerName string, trigger model.Trigger) error
+	DropTrigger(tx *gorm.DB, tableName string, triggerName string) error
+	SetTriggers(tx *gorm.DB, tableName string, triggers []model.Trigger) error
+
+	Violation(err error) (*ConstraintViolation, bool)
 }
 
 type TableServiceImpl struct {
@@ -49,11 +71,22 @@ const TABLE_INFO_NAME = "name"
 const TABLE_INFO_AUTH = "auth"
 const TABLE_INFO_SYSTEM = "system"
 const TABLE_INFO_INDEXES = "indexes"
-const TABLE_INFO_ACCESS = "access"
+const TABLE_INFO_RULES = "rules"
+const TABLE_INFO_PERMISSIONS = "permissions"
+const TABLE_INFO_RELATIONS = "relations"
+const TABLE_INFO_TYPE = "type"
+const TABLE_INFO_SOFT_DELETE = "soft_delete"
+const TABLE_INFO_HISTORY = "history"
+const TABLE_INFO_VERSIONED = "versioned"
+const TABLE_INFO_SEARCH = "search"
+const TABLE_INFO_CONSTRAINTS = "constraints"
+const TABLE_INFO_TRIGGERS = "triggers"
+const TABLE_INFO_ID_TYPE = "id_type"
+const TABLE_INFO_ID_PREFIX = "id_prefix"
 
 func (s *TableServiceImpl) Info(tableName string, infoNeeded ...string) (model.Tables, error) {
 	if len(infoNeeded) == 0 {
-		infoNeeded = []string{TABLE_INFO_NAME, TABLE_INFO_AUTH, TABLE_INFO_INDEXES, TABLE_INFO_SYSTEM, TABLE_INFO_ACCESS}
+		infoNeeded = []string{TABLE_INFO_NAME, TABLE_INFO_AUTH, TABLE_INFO_INDEXES, TABLE_INFO_SYSTEM, TABLE_INFO_RULES, TABLE_INFO_RELATIONS, TABLE_INFO_TYPE, TABLE_INFO_SOFT_DELETE, TABLE_INFO_HISTORY, TABLE_INFO_VERSIONED, TABLE_INFO_SEARCH, TABLE_INFO_CONSTRAINTS, TABLE_INFO_TRIGGERS, TABLE_INFO_ID_TYPE, TABLE_INFO_ID_PREFIX, TABLE_INFO_PERMISSIONS}
 	}
 
 	var tableInfo model.Tables
@@ -80,9 +113,53 @@ func (s *TableServiceImpl) Info(tableName string, infoNeeded ...string) (model.T
 				if cachedIndexes, ok := storedCache.(string); ok {
 					tableInfo.Indexes = cachedIndexes
 				}
-			case TABLE_INFO_ACCESS:
-				if cachedAccess, ok := storedCache.(model.Access); ok {
-					tableInfo.Access = cachedAccess
+			case TABLE_INFO_RULES:
+				if cachedRules, ok := storedCache.(string); ok {
+					tableInfo.Rules = cachedRules
+				}
+			case TABLE_INFO_RELATIONS:
+				if cachedRelations, ok := storedCache.(string); ok {
+					tableInfo.Relations = cachedRelations
+				}
+			case TABLE_INFO_TYPE:
+				if cachedType, ok := storedCache.(string); ok {
+					tableInfo.Type = cachedType
+				}
+			case TABLE_INFO_SOFT_DELETE:
+				if cachedSoftDelete, ok := storedCache.(bool); ok {
+					tableInfo.SoftDelete = cachedSoftDelete
+				}
+			case TABLE_INFO_HISTORY:
+				if cachedHistory, ok := storedCache.(bool); ok {
+					tableInfo.History = cachedHistory
+				}
+			case TABLE_INFO_VERSIONED:
+				if cachedVersioned, ok := storedCache.(bool); ok {
+					tableInfo.Versioned = cachedVersioned
+				}
+			case TABLE_INFO_SEARCH:
+				if cachedSearch, ok := storedCache.(string); ok {
+					tableInfo.Search = cachedSearch
+				}
+			case TABLE_INFO_PERMISSIONS:
+				if cachedPermissions, ok := storedCache.(string); ok {
+					tableInfo.Permissions = cachedPermissions
+				}
+			case TABLE_INFO_CONSTRAINTS:
+				if cachedConstraints, ok := storedCache.(string); ok {
+					tableInfo.Constraints = cachedConstraints
+				}
+			case TABLE_INFO_TRIGGERS:
+				if cachedTriggers, ok := storedCache.(string); ok {
+					tableInfo.Triggers = cachedTriggers
+				}
+			case TABLE_INFO_ID_TYPE:
+				if cachedIDType, ok := storedCache.(string); ok {
+					tableInfo.IDType = cachedIDType
+				}
+			case TABLE_INFO_ID_PREFIX:
+				if cachedIDPrefix, ok := storedCache.(string); ok {
+					tableInfo.IDPrefix = cachedIDPrefix
 				}
 			}
 		} else {
@@ -109,6 +186,76 @@ func (s *TableServiceImpl) Info(tableName string, infoNeeded ...string) (model.T
 		tableInfo.SystemIndex = index
 	}
 
+	if utils.ArrayContains[string](infoNeeded, TABLE_INFO_RELATIONS) {
+		relations := []model.Relation{}
+
+		if tableInfo.Relations != "" {
+			err = json.Unmarshal([]byte(tableInfo.Relations), &relations)
+			if err != nil {
+				return tableInfo, err
+			}
+		}
+
+		tableInfo.SystemRelation = relations
+	}
+
+	if utils.ArrayContains[string](infoNeeded, TABLE_INFO_CONSTRAINTS) {
+		constraints, err := parseConstraints(tableInfo.Constraints)
+		if err != nil {
+			return tableInfo, err
+		}
+
+		tableInfo.SystemConstraint = &constraints
+	}
+
+	if utils.ArrayContains[string](infoNeeded, TABLE_INFO_RULES) {
+		rules := model.Rules{}
+
+		if tableInfo.Rules != "" {
+			err = json.Unmarshal([]byte(tableInfo.Rules), &rules)
+			if err != nil {
+				return tableInfo, err
+			}
+		}
+
+		tableInfo.SystemRule = &rules
+	}
+
+	if utils.ArrayContains[string](infoNeeded, TABLE_INFO_SEARCH) {
+		search := []string{}
+
+		if tableInfo.Search != "" {
+			err = json.Unmarshal([]byte(tableInfo.Search), &search)
+			if err != nil {
+				return tableInfo, err
+			}
+		}
+
+		tableInfo.SystemSearch = search
+	}
+
+	if utils.ArrayContains[string](infoNeeded, TABLE_INFO_PERMISSIONS) {
+		permissions := map[string]string{}
+
+		if tableInfo.Permissions != "" {
+			err = json.Unmarshal([]byte(tableInfo.Permissions), &permissions)
+			if err != nil {
+				return tableInfo, err
+			}
+		}
+
+		tableInfo.SystemPermission = permissions
+	}
+
+	if utils.ArrayContains[string](infoNeeded, TABLE_INFO_TRIGGERS) {
+		triggers, err := parseTriggers(tableInfo.Triggers)
+		if err != nil {
+			return tableInfo, err
+		}
+
+		tableInfo.SystemTrigger = triggers
+	}
+
 	for _, info := range unfoundData {
 		cacheKey := "tableInfo:" + tableName + ":" + info
 		switch info {
@@ -120,8 +267,30 @@ func (s *TableServiceImpl) Info(tableName string, infoNeeded ...string) (model.T
 			s.cache.Set(cacheKey, tableInfo.System, cache.DefaultExpiration)
 		case TABLE_INFO_INDEXES:
 			s.cache.Set(cacheKey, tableInfo.Indexes, cache.DefaultExpiration)
-		case TABLE_INFO_ACCESS:
-			s.cache.Set(cacheKey, tableInfo.Access, cache.DefaultExpiration)
+		case TABLE_INFO_RULES:
+			s.cache.Set(cacheKey, tableInfo.Rules, cache.DefaultExpiration)
+		case TABLE_INFO_RELATIONS:
+			s.cache.Set(cacheKey, tableInfo.Relations, cache.DefaultExpiration)
+		case TABLE_INFO_TYPE:
+			s.cache.Set(cacheKey, tableInfo.Type, cache.DefaultExpiration)
+		case TABLE_INFO_SOFT_DELETE:
+			s.cache.Set(cacheKey, tableInfo.SoftDelete, cache.DefaultExpiration)
+		case TABLE_INFO_HISTORY:
+			s.cache.Set(cacheKey, tableInfo.History, cache.DefaultExpiration)
+		case TABLE_INFO_VERSIONED:
+			s.cache.Set(cacheKey, tableInfo.Versioned, cache.DefaultExpiration)
+		case TABLE_INFO_SEARCH:
+			s.cache.Set(cacheKey, tableInfo.Search, cache.DefaultExpiration)
+		case TABLE_INFO_PERMISSIONS:
+			s.cache.Set(cacheKey, tableInfo.Permissions, cache.DefaultExpiration)
+		case TABLE_INFO_CONSTRAINTS:
+			s.cache.Set(cacheKey, tableInfo.Constraints, cache.DefaultExpiration)
+		case TABLE_INFO_TRIGGERS:
+			s.cache.Set(cacheKey, tableInfo.Triggers, cache.DefaultExpiration)
+		case TABLE_INFO_ID_TYPE:
+			s.cache.Set(cacheKey, tableInfo.IDType, cache.DefaultExpiration)
+		case TABLE_INFO_ID_PREFIX:
+			s.cache.Set(cacheKey, tableInfo.IDPrefix, cache.DefaultExpiration)
 		}
 
 	}
@@ -130,57 +299,37 @@ func (s *TableServiceImpl) Info(tableName string, infoNeeded ...string) (model.T
 }
 
 func (s *TableServiceImpl) Create(tx *gorm.DB, params model.CreateTable) error {
-	fields := []string{
-		"id INTEGER PRIMARY KEY",
-	}
-
-	isAuth := false
-	if params.Type == "users" {
-		authFields := []string{
-			"email TEXT NOT NULL",
-			"password TEXT NOT NULL",
-			"salt TEXT NOT NULL",
-		}
-		isAuth = true
+	isAuth := params.Type == "users"
 
-		fields = append(fields, authFields...)
+	if params.IDType == "" {
+		params.IDType = model.ID_TYPE_INTEGER
+	}
+	if !utils.ArrayContains(model.IDTypes, params.IDType) {
+		return fmt.Errorf("id type must be one of %s", strings.Join(model.IDTypes, ", "))
+	}
+	if params.IDPrefix != "" && (params.IDType != model.ID_TYPE_NANOID || !identifierRegex.MatchString(params.IDPrefix)) {
+		return errors.New("id prefix is only available on nanoid ids and must be made of letters, digits and _")
 	}
 
-	foreignKeys := []string{}
-	uniques := []string{}
-
-	for i := 0; i < len(params.Fields); i++ {
-		dtype := params.Fields[i].ConvertTypeToSQLiteType()
-		// IGNORE UNSUPPORTED DATATYPES FOR NOW
-		if dtype == "" {
-			continue
-		}
-
-		var field string
-		if dtype == "RELATION" {
-			field = fmt.Sprintf("%s %s", params.Fields[i].Name, "REAL")
-			foreignKeys = append(foreignKeys, fmt.Sprintf("FOREIGN KEY(%s) REFERENCES %s(id) ON UPDATE CASCADE", params.Fields[i].Name, params.Fields[i].Reference))
-		} else {
-			field = fmt.Sprintf("%s %s", params.Fields[i].Name, dtype)
-		}
-
-		if !params.Fields[i].Nullable {
-			field += " NOT NULL"
-		}
-
-		if params.Fields[i].Unique {
-			uniques = append(uniques, fmt.Sprintf("UNIQUE (%s)", params.Fields[i].Name))
-		}
+	textIDs, err := textIDTables(tx, params)
+	if err != nil {
+		return err
+	}
 
-		fields = append(fields, field)
+	fields, relations, err := columnDefinitions(params, isAuth, params.SoftDelete, params.Versioned, textIDs)
+	if err != nil {
+		return err
 	}
 
-	fields = append(fields, []string{
-		"created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP",
-		"updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP",
-	}...)
+	search, err := searchFields(params.Fields)
+	if err != nil {
+		return err
+	}
 
-	fields = append(append(fields, uniques...), foreignKeys...)
+	permissions, err := permissionFields(params.Fields)
+	if err != nil {
+		return err
+	}
 
 	query := `
 		CREATE TABLE %s (
@@ -191,43 +340,31 @@ func (s *TableServiceImpl) Create(tx *gorm.DB, params model.CreateTable) error {
 	query = fmt.Sprintf(query, params.Name, strings.Join(fields, ","))
 	fmt.Println(query)
 
-	err := tx.Exec(query).Error
+	err = tx.Exec(query).Error
 	if err != nil {
 		return err
 	}
 
 	// add index
-	for _, index := range params.Indexes {
-		err = tx.Exec(fmt.Sprintf("CREATE INDEX %s ON %s (%s)", index.Name, params.Name, strings.Join(index.Indexes, ","))).Error
-		if err != nil {
-			return err
-		}
+	err = createIndexes(tx, params.Name, params.Indexes)
+	if err != nil {
+		return err
 	}
 
-	// check if trigger already exist
-	var triggerHolder int64
-	err = tx.Table("sqlite_master").
-		Select("*").
-		Where("type = ?", "trigger").
-		Where("name = ?", fmt.Sprintf("updated_timestamp_%s", params.Name)).
-		Count(&triggerHolder).Error
+	// add trigger to update updated_at value on update
+	err = createTimestampTrigger(tx, params.Name, params.Versioned)
 	if err != nil {
 		return err
 	}
 
-	// add trigger to update updated_at value on update
-	if triggerHolder == 0 {
-		err = tx.Exec(fmt.Sprintf(`
-			CREATE TRIGGER updated_timestamp_%s
-			AFTER UPDATE ON %s
-			FOR EACH ROW
-			BEGIN
-				UPDATE %s SET updated_at = CURRENT_TIMESTAMP WHERE id = OLD.id;
-			END
-			`, params.Name, params.Name, params.Name)).Error
-		if err != nil {
-			return err
-		}
+	relations, err = s.syncJunctions(tx, params.Name, nil, relations, textIDs)
+	if err != nil {
+		return err
+	}
+
+	err = syncSearch(tx, params.Name, search)
+	if err != nil {
+		return err
 	}
 
 	indexJson, err := json.Marshal(params.Indexes)
@@ -235,13 +372,41 @@ func (s *TableServiceImpl) Create(tx *gorm.DB, params model.CreateTable) error {
 		return err
 	}
 
+	relationJson, err := json.Marshal(relations)
+	if err != nil {
+		return err
+	}
+
+	searchJson, err := json.Marshal(search)
+	if err != nil {
+		return err
+	}
+
+	permissionJson, err := json.Marshal(permissions)
+	if err != nil {
+		return err
+	}
+
+	constraintJson, err := json.Marshal(model.Constraints{Uniques: params.Uniques, Checks: params.Checks})
+	if err != nil {
+		return err
+	}
+
 	err = tx.Create(
 		&model.Tables{
-			Name:    params.Name,
-			Auth:    isAuth,
-			System:  false,
-			Indexes: string(indexJson),
-			Access:  "0;0;0;0;0",
+			Name:        params.Name,
+			Auth:        isAuth,
+			System:      false,
+			Indexes:     string(indexJson),
+			Relations:   string(relationJson),
+			Search:      string(searchJson),
+			Permissions: string(permissionJson),
+			Constraints: string(constraintJson),
+			SoftDelete:  params.SoftDelete,
+			History:     params.History,
+			Versioned:   params.Versioned,
+			IDType:      params.IDType,
+			IDPrefix:    params.IDPrefix,
 		}).
 		Error
 	if err != nil {
@@ -252,101 +417,1193 @@ func (s *TableServiceImpl) Create(tx *gorm.DB, params model.CreateTable) error {
 
 }
 
-func (s *TableServiceImpl) Rename(tx *gorm.DB, tableName string, newTableName string) error {
-	err := tx.Model(&model.Tables{}).Where("name = ?", tableName).Update("name", newTableName).Error
+// Rebuild
+//
+// Recreate an existing table with a new set of fields and indexes while keeping its data
+// and metadata (access, auth type). Follows the sqlite procedure of creating a new table,
+// copying the rows, dropping the old table and renaming the new one, so it must be run
+// through Alter to keep foreign keys on other tables intact.
+func (s *TableServiceImpl) Rebuild(tx *gorm.DB, params model.CreateTable) error {
+	var table model.Tables
+	err := tx.Model(&model.Tables{}).Where("name = ?", params.Name).First(&table).Error
 	if err != nil {
 		return err
 	}
 
-	return tx.Exec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", tableName, newTableName)).Error
-}
+	oldRelations := []model.Relation{}
+	if table.Relations != "" {
+		err = json.Unmarshal([]byte(table.Relations), &oldRelations)
+		if err != nil {
+			return err
+		}
+	}
 
-func (s *TableServiceImpl) Drop(tx *gorm.DB, tableName string) error {
-	err := tx.Model(&model.Tables{}).Where("name = ?", tableName).Delete(&model.Tables{}).Error
+	// indexes and constraints left out are kept as they are
+	if params.Indexes == nil && table.Indexes != "" {
+		err = json.Unmarshal([]byte(table.Indexes), &params.Indexes)
+		if err != nil {
+			return err
+		}
+	}
+
+	constraints, err := parseConstraints(table.Constraints)
 	if err != nil {
 		return err
 	}
+	if params.Uniques == nil {
+		params.Uniques = constraints.Uniques
+	}
+	if params.Checks == nil {
+		params.Checks = constraints.Checks
+	}
 
-	return tx.Exec(fmt.Sprintf("DROP TABLE %s", tableName)).Error
-}
+	// the id strategy stays the one the table was created with
+	params.IDType = table.IDType
+	params.IDPrefix = table.IDPrefix
 
-func (s *TableServiceImpl) Columns(tableName string, fetchAuthColumn bool, fetchTableType bool) ([]map[string]interface{}, error) {
-	var result []map[string]interface{}
-	cacheKey := "columns_" + tableName
-	storedCache, ok := s.cache.Get(cacheKey)
-	if ok {
-		return storedCache.([]map[string]interface{}), nil
+	textIDs, err := textIDTables(tx, params)
+	if err != nil {
+		return err
 	}
 
-	string1 := ""
-	string2 := ""
-	if fetchTableType {
-		string1 = ", t.auth"
-		string2 = "LEFT JOIN '_table' AS t ON fk.'table' = t.name"
+	fields, relations, err := columnDefinitions(params, table.Auth, table.SoftDelete, table.Versioned, textIDs)
+	if err != nil {
+		return err
 	}
 
-	rows, err := s.db.Raw(fmt.Sprintf(`
-		SELECT 
-			CAST(info.cid AS INT) AS cid,
-			info.name,
-			info.'type',
-			info.pk,
-			info.'notnull',
-			info.dflt_value,
-			fk.'table' AS reference
-			%s
-		FROM pragma_table_info('%s') AS info
-		LEFT JOIN pragma_foreign_key_list('%s') AS fk ON
-		info.name = fk.'from' %s
-	`, string1, tableName, tableName, string2)).Rows()
+	search, err := searchFields(params.Fields)
 	if err != nil {
-		return result, err
+		return err
 	}
 
-	defer rows.Close()
-	for rows.Next() {
-		var row map[string]interface{}
-		if err := s.db.ScanRows(rows, &row); err != nil {
-			return result, err
-		}
-		result = append(result, row)
+	permissions, err := permissionFields(params.Fields)
+	if err != nil {
+		return err
 	}
-	for i, col := range result {
-		if col["reference"] != nil {
-			result[i]["type"] = "RELATION"
-		}
+
+	// the index is filled again once the rows are copied
+	err = dropSearch(tx, params.Name)
+	if err != nil {
+		return err
 	}
 
-	table, err := s.Info(tableName, TABLE_INFO_AUTH)
+	tempTableName := "_new_" + params.Name
+	err = tx.Exec(fmt.Sprintf("CREATE TABLE %s (%s)", tempTableName, strings.Join(fields, ","))).Error
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// If table is user type, prevent displaying authentication fields
-	if table.Auth {
-		var cleanedResult []map[string]interface{}
-		if fetchAuthColumn {
-			for _, row := range result {
-				if row["name"] != "salt" {
-					cleanedResult = append(cleanedResult, row)
-				}
-			}
+	// copy all data from columns that exist on both table
+	var oldColumns, newColumns []string
+	err = tx.Raw("SELECT name FROM pragma_table_info(?)", params.Name).Scan(&oldColumns).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Raw("SELECT name FROM pragma_table_info(?)", tempTableName).Scan(&newColumns).Error
+	if err != nil {
+		return err
+	}
 
-			return cleanedResult, nil
+	copiedColumns := []string{}
+	for _, column := range newColumns {
+		if utils.ArrayContains(oldColumns, column) {
+			copiedColumns = append(copiedColumns, column)
 		}
+	}
 
-		for _, row := range result {
-			if row["name"] != "password" && row["name"] != "salt" {
-				cleanedResult = append(cleanedResult, row)
-			}
-		}
+	err = tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s",
+		tempTableName, strings.Join(copiedColumns, ","), strings.Join(copiedColumns, ","), params.Name)).Error
+	if err != nil {
+		return err
+	}
 
-		return cleanedResult, nil
+	err = tx.Exec(fmt.Sprintf("DROP TABLE %s", params.Name)).Error
+	if err != nil {
+		return err
 	}
 
-	s.cache.Set(cacheKey, result, cache.DefaultExpiration)
+	// views selecting from the table are only valid again after the rename,
+	// legacy mode skips checking them while renaming
+	err = tx.Exec("PRAGMA legacy_alter_table = ON").Error
+	if err != nil {
+		return err
+	}
 
-	return result, err
+	err = tx.Exec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", tempTableName, params.Name)).Error
+	tx.Exec("PRAGMA legacy_alter_table = OFF")
+	if err != nil {
+		return err
+	}
+
+	err = createIndexes(tx, params.Name, params.Indexes)
+	if err != nil {
+		return err
+	}
+
+	err = createTimestampTrigger(tx, params.Name, table.Versioned)
+	if err != nil {
+		return err
+	}
+
+	// dropping the old table took its triggers along
+	triggers, err := parseTriggers(table.Triggers)
+	if err != nil {
+		return err
+	}
+
+	err = createTriggers(tx, params.Name, triggers)
+	if err != nil {
+		return err
+	}
+
+	relations, err = s.syncJunctions(tx, params.Name, oldRelations, relations, textIDs)
+	if err != nil {
+		return err
+	}
+
+	err = syncSearch(tx, params.Name, search)
+	if err != nil {
+		return err
+	}
+
+	indexJson, err := json.Marshal(params.Indexes)
+	if err != nil {
+		return err
+	}
+
+	relationJson, err := json.Marshal(relations)
+	if err != nil {
+		return err
+	}
+
+	searchJson, err := json.Marshal(search)
+	if err != nil {
+		return err
+	}
+
+	permissionJson, err := json.Marshal(permissions)
+	if err != nil {
+		return err
+	}
+
+	constraintJson, err := json.Marshal(model.Constraints{Uniques: params.Uniques, Checks: params.Checks})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&model.Tables{}).
+		Where("name = ?", params.Name).
+		Updates(map[string]interface{}{
+			"indexes":     string(indexJson),
+			"relations":   string(relationJson),
+			"search":      string(searchJson),
+			"permissions": string(permissionJson),
+			"constraints": string(constraintJson),
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	// a field hidden afterwards can't stay readable through a view
+	err = checkViews(tx)
+	if err != nil {
+		return err
+	}
+
+	s.clearCache(params.Name)
+
+	return nil
+}
+
+// SetSoftDelete
+//
+// Toggle soft delete mode of a table. The deleted_at column is added when first enabled,
+// disabling requires the trash to be emptied so deleted rows don't come back
+func (s *TableServiceImpl) SetSoftDelete(tx *gorm.DB, tableName string, enabled bool) error {
+	var table model.Tables
+	err := tx.Model(&model.Tables{}).Where("name = ?", tableName).First(&table).Error
+	if err != nil {
+		return err
+	}
+
+	if table.IsView() || table.System {
+		return fmt.Errorf("soft delete is not supported on %s", tableName)
+	}
+
+	var columns []string
+	err = tx.Raw("SELECT name FROM pragma_table_info(?)", tableName).Scan(&columns).Error
+	if err != nil {
+		return err
+	}
+
+	hasColumn := utils.ArrayContains(columns, "deleted_at")
+	if enabled && !hasColumn {
+		err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN deleted_at TIMESTAMP", tableName)).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if !enabled && hasColumn {
+		var trashed int64
+		err = tx.Table(tableName).Where("deleted_at IS NOT NULL").Count(&trashed).Error
+		if err != nil {
+			return err
+		}
+
+		if trashed > 0 {
+			return fmt.Errorf("trash of %s must be emptied before disabling soft delete", tableName)
+		}
+	}
+
+	err = tx.Model(&model.Tables{}).Where("name = ?", tableName).Update("soft_delete", enabled).Error
+	if err != nil {
+		return err
+	}
+
+	s.clearCache(tableName)
+
+	return nil
+}
+
+// SetHistory
+//
+// Toggle the recording of every change on a table, recorded history is kept when disabled
+func (s *TableServiceImpl) SetHistory(tx *gorm.DB, tableName string, enabled bool) error {
+	var table model.Tables
+	err := tx.Model(&model.Tables{}).Where("name = ?", tableName).First(&table).Error
+	if err != nil {
+		return err
+	}
+
+	if table.IsView() || table.System {
+		return fmt.Errorf("history is not supported on %s", tableName)
+	}
+
+	err = tx.Model(&model.Tables{}).Where("name = ?", tableName).Update("history", enabled).Error
+	if err != nil {
+		return err
+	}
+
+	s.clearCache(tableName)
+
+	return nil
+}
+
+// SetRules
+//
+// Replace the access rules of a collection, their syntax is checked but not the fields they
+// read, see RuleService.Validate
+func (s *TableServiceImpl) SetRules(tx *gorm.DB, tableName string, rules model.Rules) error {
+	for _, operation := range model.RuleOperations {
+		if rule := rules.Get(operation); rule != nil {
+			_, err := parseRule(*rule)
+			if err != nil {
+				return fmt.Errorf("%s rule: %s", operation, err.Error())
+			}
+		}
+	}
+
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&model.Tables{}).Where("name = ?", tableName).Update("rules", string(data)).Error
+	if err != nil {
+		return err
+	}
+
+	s.clearCache(tableName)
+
+	return nil
+}
+
+// SetVersioned
+//
+// Toggle the version column of a table, it starts at 1 on every row and is dropped when
+// disabled
+func (s *TableServiceImpl) SetVersioned(tx *gorm.DB, tableName string, enabled bool) error {
+	var table model.Tables
+	err := tx.Model(&model.Tables{}).Where("name = ?", tableName).First(&table).Error
+	if err != nil {
+		return err
+	}
+
+	if table.IsView() || table.System {
+		return fmt.Errorf("versioning is not supported on %s", tableName)
+	}
+
+	if table.Versioned == enabled {
+		return nil
+	}
+
+	var columns []string
+	err = tx.Raw("SELECT name FROM pragma_table_info(?)", tableName).Scan(&columns).Error
+	if err != nil {
+		return err
+	}
+
+	hasColumn := utils.ArrayContains(columns, "version")
+	if enabled && hasColumn {
+		return fmt.Errorf("%s already has a version field", tableName)
+	}
+
+	err = tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS updated_timestamp_%s", tableName)).Error
+	if err != nil {
+		return err
+	}
+
+	if enabled {
+		err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN version INTEGER NOT NULL DEFAULT 1", tableName)).Error
+	} else if hasColumn {
+		err = tx.Exec(fmt.Sprintf("ALTER TABLE %s DROP COLUMN version", tableName)).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	err = createTimestampTrigger(tx, tableName, enabled)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&model.Tables{}).Where("name = ?", tableName).Update("versioned", enabled).Error
+	if err != nil {
+		return err
+	}
+
+	s.clearCache(tableName)
+
+	return nil
+}
+
+// Alter
+//
+// Run schema changes in a single transaction with foreign key enforcement suspended.
+// Sqlite can only toggle foreign_keys outside of a transaction, so the whole process
+// is pinned to one connection. Foreign keys are checked before committing.
+func (s *TableServiceImpl) Alter(fn func(tx *gorm.DB) error) error {
+	return s.db.Connection(func(conn *gorm.DB) error {
+		err := conn.Exec("PRAGMA foreign_keys = OFF").Error
+		if err != nil {
+			return err
+		}
+		defer conn.Exec("PRAGMA foreign_keys = ON")
+
+		return conn.Transaction(func(tx *gorm.DB) error {
+			err := fn(tx)
+			if err != nil {
+				return err
+			}
+
+			var violations []map[string]interface{}
+			err = tx.Raw("PRAGMA foreign_key_check").Scan(&violations).Error
+			if err != nil {
+				return err
+			}
+
+			if len(violations) > 0 {
+				return fmt.Errorf("foreign key constraint failed on table %v", violations[0]["table"])
+			}
+
+			return nil
+		})
+	})
+}
+
+func (s *TableServiceImpl) Relations(tableName string) ([]model.Relation, error) {
+	table, err := s.Info(tableName, TABLE_INFO_RELATIONS)
+	if err != nil {
+		return nil, err
+	}
+
+	return table.SystemRelation, nil
+}
+
+func (s *TableServiceImpl) Rename(tx *gorm.DB, tableName string, newTableName string) error {
+	var table model.Tables
+	err := tx.Model(&model.Tables{}).Where("name = ?", tableName).First(&table).Error
+	if err != nil {
+		return err
+	}
+
+	// search index and its triggers are named after the table, recreated after the rename
+	err = dropSearch(tx, tableName)
+	if err != nil {
+		return err
+	}
+
+	// triggers of the admin are created again on the new name as they are defined
+	triggers, err := parseTriggers(table.Triggers)
+	if err != nil {
+		return err
+	}
+
+	err = dropTriggers(tx, triggers)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Exec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", tableName, newTableName)).Error
+	if err != nil {
+		return err
+	}
+
+	search := []string{}
+	if table.Search != "" {
+		err = json.Unmarshal([]byte(table.Search), &search)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = syncSearch(tx, newTableName, search)
+	if err != nil {
+		return err
+	}
+
+	// timestamp trigger is named after the table
+	err = tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS updated_timestamp_%s", tableName)).Error
+	if err != nil {
+		return err
+	}
+
+	err = createTimestampTrigger(tx, newTableName, table.Versioned)
+	if err != nil {
+		return err
+	}
+
+	err = createTriggers(tx, newTableName, triggers)
+	if err != nil {
+		return err
+	}
+
+	relations := []model.Relation{}
+	if table.Relations != "" {
+		err = json.Unmarshal([]byte(table.Relations), &relations)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, relation := range relations {
+		if !relation.Multiple {
+			continue
+		}
+
+		junction := junctionName(newTableName, relation.Field)
+		err = tx.Exec(fmt.Sprintf("ALTER TABLE %s RENAME TO %s", relation.Junction, junction)).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&model.Tables{}).Where("name = ?", relation.Junction).Update("name", junction).Error
+		if err != nil {
+			return err
+		}
+
+		s.clearCache(relation.Junction)
+		relations[i].Junction = junction
+	}
+
+	relationJson, err := json.Marshal(relations)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&model.Tables{}).
+		Where("name = ?", tableName).
+		Updates(map[string]interface{}{
+			"name":      newTableName,
+			"relations": string(relationJson),
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	s.clearCache(tableName)
+	s.clearCache(newTableName)
+
+	return nil
+}
+
+func (s *TableServiceImpl) Drop(tx *gorm.DB, tableName string) error {
+	var table model.Tables
+	err := tx.Model(&model.Tables{}).Where("name = ?", tableName).First(&table).Error
+	if err != nil {
+		return err
+	}
+
+	relations := []model.Relation{}
+	if table.Relations != "" {
+		err = json.Unmarshal([]byte(table.Relations), &relations)
+		if err != nil {
+			return err
+		}
+	}
+
+	// junction tables only live as long as the table owning them
+	_, err = s.syncJunctions(tx, tableName, relations, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&model.Tables{}).Where("name = ?", tableName).Delete(&model.Tables{}).Error
+	if err != nil {
+		return err
+	}
+
+	s.clearCache(tableName)
+
+	if table.IsView() {
+		return tx.Exec(fmt.Sprintf("DROP VIEW %s", tableName)).Error
+	}
+
+	err = dropSearch(tx, tableName)
+	if err != nil {
+		return err
+	}
+
+	return tx.Exec(fmt.Sprintf("DROP TABLE %s", tableName)).Error
+}
+
+// CreateView
+//
+// Register a read only collection backed by a sql view. The query has to be a single
+// select statement returning an id column so its rows can be viewed individually
+func (s *TableServiceImpl) CreateView(tx *gorm.DB, params model.CreateView) error {
+	query, err := createViewQuery(tx, params)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(
+		&model.Tables{
+			Name:      params.Name,
+			System:    false,
+			Indexes:   "[]",
+			Relations: "[]",
+			Type:      model.TABLE_TYPE_VIEW,
+			Query:     query,
+		}).
+		Error
+}
+
+// UpdateView
+//
+// Replace the select statement of a view collection, keeping its access
+func (s *TableServiceImpl) UpdateView(tx *gorm.DB, params model.CreateView) error {
+	var table model.Tables
+	err := tx.Model(&model.Tables{}).Where("name = ?", params.Name).First(&table).Error
+	if err != nil {
+		return err
+	}
+
+	if !table.IsView() {
+		return fmt.Errorf("%s is not a view", params.Name)
+	}
+
+	err = tx.Exec(fmt.Sprintf("DROP VIEW %s", params.Name)).Error
+	if err != nil {
+		return err
+	}
+
+	query, err := createViewQuery(tx, params)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&model.Tables{}).Where("name = ?", params.Name).Update("query", query).Error
+	if err != nil {
+		return err
+	}
+
+	s.clearCache(params.Name)
+
+	return nil
+}
+
+func createViewQuery(tx *gorm.DB, params model.CreateView) (string, error) {
+	query := strings.TrimSuffix(strings.TrimSpace(params.Query), ";")
+
+	statement := strings.ToUpper(query)
+	if !strings.HasPrefix(statement, "SELECT") && !strings.HasPrefix(statement, "WITH") {
+		return "", errors.New("view query must be a select statement")
+	}
+
+	if strings.Contains(query, ";") {
+		return "", errors.New("view query must be a single statement")
+	}
+
+	err := tx.Exec(fmt.Sprintf("CREATE VIEW %s AS %s", params.Name, query)).Error
+	if err != nil {
+		return "", err
+	}
+
+	// column metadata of the view comes from the select statement
+	var columns []string
+	err = tx.Raw("SELECT name FROM pragma_table_info(?)", params.Name).Scan(&columns).Error
+	if err != nil {
+		return "", err
+	}
+
+	if !utils.ArrayContains(columns, "id") {
+		return "", errors.New("view query must select an id column")
+	}
+
+	err = checkViewFields(tx, query, columns)
+	if err != nil {
+		return "", err
+	}
+
+	return query, nil
+}
+
+// checkViewFields
+//
+// The rows of a view are listed under its own rules, so it can't read the credentials or the
+// hidden fields of the tables it selects from, neither by name nor through a star
+func checkViewFields(tx *gorm.DB, query string, columns []string) error {
+	var tables []model.Tables
+	err := tx.Model(&model.Tables{}).Select("name", "auth", "permissions").Find(&tables).Error
+	if err != nil {
+		return err
+	}
+
+	identifiers := queryIdentifiers(query)
+	for _, column := range columns {
+		identifiers[strings.ToLower(column)] = true
+	}
+
+	for _, table := range tables {
+		if !identifiers[strings.ToLower(table.Name)] {
+			continue
+		}
+
+		restricted := []string{}
+		if table.Auth {
+			restricted = append(restricted, "password", "salt")
+		}
+		if table.Permissions != "" {
+			permissions := map[string]string{}
+			err = json.Unmarshal([]byte(table.Permissions), &permissions)
+			if err != nil {
+				return err
+			}
+			for name, permission := range permissions {
+				if permission == model.FIELD_HIDDEN {
+					restricted = append(restricted, name)
+				}
+			}
+		}
+
+		for _, name := range restricted {
+			if identifiers[strings.ToLower(name)] {
+				return fmt.Errorf("view query can't read the field %s of %s", name, table.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkViews
+//
+// Check the fields read by every view against the current permissions of the tables
+func checkViews(tx *gorm.DB) error {
+	var views []model.Tables
+	err := tx.Model(&model.Tables{}).Where("type = ?", model.TABLE_TYPE_VIEW).Find(&views).Error
+	if err != nil {
+		return err
+	}
+
+	for _, view := range views {
+		var columns []string
+		err = tx.Raw("SELECT name FROM pragma_table_info(?)", view.Name).Scan(&columns).Error
+		if err != nil {
+			return err
+		}
+
+		err = checkViewFields(tx, view.Query, columns)
+		if err != nil {
+			return fmt.Errorf("view %s: %w", view.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// queryIdentifiers
+//
+// Lower cased words of a sql statement outside of its quoted text, quoted identifiers included
+func queryIdentifiers(query string) map[string]bool {
+	identifiers := map[string]bool{}
+	isWord := func(char byte) bool {
+		return char == '_' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9'
+	}
+
+	for i := 0; i < len(query); {
+		switch {
+		case query[i] == '\'':
+			end := strings.IndexByte(query[i+1:], '\'')
+			if end < 0 {
+				return identifiers
+			}
+			i += end + 2
+		case isWord(query[i]):
+			start := i
+			for i < len(query) && isWord(query[i]) {
+				i++
+			}
+			identifiers[strings.ToLower(query[start:i])] = true
+		default:
+			i++
+		}
+	}
+
+	return identifiers
+}
+
+// textIDTables
+//
+// Whether the table and each table it references store their ids as text,
+// relation columns take the type of the id they reference
+func textIDTables(tx *gorm.DB, params model.CreateTable) (map[string]bool, error) {
+	textIDs := map[string]bool{params.Name: model.TextID(params.IDType)}
+
+	for _, field := range params.Fields {
+		if field.ConvertTypeToSQLiteType() != "RELATION" {
+			continue
+		}
+		if _, ok := textIDs[field.Reference]; ok {
+			continue
+		}
+
+		var idTypes []string
+		err := tx.Model(&model.Tables{}).Where("name = ?", field.Reference).Pluck("id_type", &idTypes).Error
+		if err != nil {
+			return nil, err
+		}
+
+		textIDs[field.Reference] = len(idTypes) > 0 && model.TextID(idTypes[0])
+	}
+
+	return textIDs, nil
+}
+
+// columnDefinitions
+//
+// Build the column and constraint definitions of a table, along with its relation metadata.
+// Multiple relations are not stored as a column, they are kept on a junction table instead
+func columnDefinitions(params model.CreateTable, isAuth bool, softDelete bool, versioned bool, textIDs map[string]bool) ([]string, []model.Relation, error) {
+	fields := []string{
+		"id INTEGER PRIMARY KEY",
+	}
+	if textIDs[params.Name] {
+		fields = []string{"id TEXT PRIMARY KEY NOT NULL"}
+	}
+
+	if isAuth {
+		authFields := []string{
+			"email TEXT NOT NULL",
+			"password TEXT NOT NULL",
+			"salt TEXT NOT NULL",
+		}
+
+		fields = append(fields, authFields...)
+	}
+
+	foreignKeys := []string{}
+	uniques := []string{}
+	relations := []model.Relation{}
+
+	for i := 0; i < len(params.Fields); i++ {
+		// kept by the table itself, added below
+		if versioned && params.Fields[i].Name == "version" {
+			continue
+		}
+
+		dtype := params.Fields[i].ConvertTypeToSQLiteType()
+		// IGNORE UNSUPPORTED DATATYPES FOR NOW
+		if dtype == "" {
+			continue
+		}
+
+		var field string
+		if dtype == "RELATION" {
+			onDelete, err := params.Fields[i].OnDeleteClause()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			relations = append(relations, model.Relation{
+				Field:     params.Fields[i].Name,
+				Reference: params.Fields[i].Reference,
+				Multiple:  params.Fields[i].Multiple,
+				OnDelete:  strings.ToLower(params.Fields[i].OnDelete),
+			})
+
+			if params.Fields[i].Multiple {
+				continue
+			}
+
+			idType := "REAL"
+			if textIDs[params.Fields[i].Reference] {
+				idType = "TEXT"
+			}
+
+			field = fmt.Sprintf("%s %s", params.Fields[i].Name, idType)
+			foreignKeys = append(foreignKeys, fmt.Sprintf("FOREIGN KEY(%s) REFERENCES %s(id) ON UPDATE CASCADE%s", params.Fields[i].Name, params.Fields[i].Reference, onDelete))
+		} else {
+			field = fmt.Sprintf("%s %s", params.Fields[i].Name, dtype)
+		}
+
+		if !params.Fields[i].Nullable {
+			field += " NOT NULL"
+		}
+
+		if params.Fields[i].Unique {
+			uniques = append(uniques, fmt.Sprintf("UNIQUE (%s)", params.Fields[i].Name))
+		}
+
+		fields = append(fields, field)
+	}
+
+	fields = append(fields, []string{
+		"created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP",
+		"updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP",
+	}...)
+
+	if softDelete {
+		fields = append(fields, "deleted_at TIMESTAMP")
+	}
+
+	if versioned {
+		fields = append(fields, "version INTEGER NOT NULL DEFAULT 1")
+	}
+
+	constraints, err := constraintDefinitions(params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fields = append(append(append(fields, uniques...), constraints...), foreignKeys...)
+
+	return fields, relations, nil
+}
+
+func createIndexes(tx *gorm.DB, tableName string, indexes []model.Index) error {
+	for _, index := range indexes {
+		query := "CREATE INDEX %s ON %s (%s)"
+		if index.Unique {
+			query = "CREATE UNIQUE INDEX %s ON %s (%s)"
+		}
+		query = fmt.Sprintf(query, index.Name, tableName, strings.Join(index.Indexes, ","))
+
+		if index.Where != "" {
+			query += " WHERE " + index.Where
+		}
+
+		err := tx.Exec(query).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createTimestampTrigger
+//
+// Keep updated_at on every update, the version of versioned tables is incremented by the same
+// statement so that it goes up by one whatever wrote the row. updated_at is kept to the
+// millisecond and moves forward on each write, even two writes within the same millisecond,
+// since the entity tag of the row is read from it
+func createTimestampTrigger(tx *gorm.DB, tableName string, versioned bool) error {
+	set := "updated_at = strftime('%Y-%m-%d %H:%M:%f', max(julianday('now'), COALESCE(julianday(OLD.updated_at), 0) + 0.001 / 86400))"
+	if versioned {
+		set += ", version = OLD.version + 1"
+	}
+
+	return tx.Exec(fmt.Sprintf(`
+		CREATE TRIGGER IF NOT EXISTS updated_timestamp_%s
+		AFTER UPDATE ON %s
+		FOR EACH ROW
+		BEGIN
+			UPDATE %s SET %s WHERE id = OLD.id;
+		END
+		`, tableName, tableName, tableName, set)).Error
+}
+
+func junctionName(tableName string, field string) string {
+	return fmt.Sprintf("_rel_%s_%s", tableName, field)
+}
+
+// syncJunctions
+//
+// Create the junction tables of new multiple relations and drop the ones no longer used.
+// Returns the relations with their junction table filled
+func (s *TableServiceImpl) syncJunctions(tx *gorm.DB, tableName string, oldRelations []model.Relation, relations []model.Relation, textIDs map[string]bool) ([]model.Relation, error) {
+	idType := func(tableName string) string {
+		if textIDs[tableName] {
+			return "TEXT"
+		}
+		return "INTEGER"
+	}
+
+	kept := []string{}
+	for i, relation := range relations {
+		if !relation.Multiple {
+			continue
+		}
+
+		junction := junctionName(tableName, relation.Field)
+		relations[i].Junction = junction
+		kept = append(kept, junction)
+
+		createJunction := func(name string) error {
+			return tx.Exec(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS %s (
+					source_id %s NOT NULL REFERENCES %s(id) ON UPDATE CASCADE ON DELETE CASCADE,
+					target_id %s NOT NULL REFERENCES %s(id) ON UPDATE CASCADE ON DELETE %s,
+					PRIMARY KEY (source_id, target_id)
+				)
+			`, name, idType(tableName), tableName, idType(relation.Reference), relation.Reference, junctionOnDelete(relation))).Error
+		}
+
+		var previous *model.Relation
+		for j, oldRelation := range oldRelations {
+			if oldRelation.Multiple && oldRelation.Field == relation.Field {
+				previous = &oldRelations[j]
+			}
+		}
+
+		if previous != nil && (junctionOnDelete(*previous) != junctionOnDelete(relation) || previous.Reference != relation.Reference) {
+			// the constraints of an existing junction can't be altered, it is created again
+			err := createJunction("_new_" + junction)
+			if err != nil {
+				return nil, err
+			}
+
+			if previous.Reference == relation.Reference {
+				err = tx.Exec(fmt.Sprintf("INSERT INTO _new_%s (source_id, target_id) SELECT source_id, target_id FROM %s", junction, junction)).Error
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			err = tx.Exec(fmt.Sprintf("DROP TABLE %s", junction)).Error
+			if err != nil {
+				return nil, err
+			}
+
+			err = tx.Exec(fmt.Sprintf("ALTER TABLE _new_%s RENAME TO %s", junction, junction)).Error
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			err := createJunction(junction)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err := tx.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_target ON %s (target_id)", junction, junction)).Error
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Model(&model.Tables{}).
+			Where("name = ?", junction).
+			FirstOrCreate(&model.Tables{Name: junction, System: true, Indexes: "[]", Relations: "[]"}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, relation := range oldRelations {
+		if !relation.Multiple || utils.ArrayContains(kept, relation.Junction) {
+			continue
+		}
+
+		err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", relation.Junction)).Error
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Model(&model.Tables{}).Where("name = ?", relation.Junction).Delete(&model.Tables{}).Error
+		if err != nil {
+			return nil, err
+		}
+
+		s.clearCache(relation.Junction)
+	}
+
+	return relations, nil
+}
+
+// junctionOnDelete
+//
+// A link is removed when the referenced row is deleted, unless restricted
+func junctionOnDelete(relation model.Relation) string {
+	if relation.OnDelete == model.ON_DELETE_RESTRICT {
+		return "RESTRICT"
+	}
+
+	return "CASCADE"
+}
+
+func (s *TableServiceImpl) clearCache(tableName string) {
+	clearTableCache(s.cache, tableName)
+}
+
+func clearTableCache(c *cache.Cache, tableName string) {
+	c.Delete("columns_" + tableName)
+	tableInfoCache := []string{TABLE_INFO_NAME, TABLE_INFO_AUTH, TABLE_INFO_INDEXES, TABLE_INFO_SYSTEM, TABLE_INFO_RULES, TABLE_INFO_RELATIONS, TABLE_INFO_TYPE, TABLE_INFO_SOFT_DELETE, TABLE_INFO_HISTORY, TABLE_INFO_VERSIONED, TABLE_INFO_SEARCH, TABLE_INFO_CONSTRAINTS, TABLE_INFO_TRIGGERS, TABLE_INFO_ID_TYPE, TABLE_INFO_ID_PREFIX, TABLE_INFO_PERMISSIONS}
+	for _, info := range tableInfoCache {
+		c.Delete(fmt.Sprintf("tableInfo:%s:%s", tableName, info))
+	}
+}
+
+func (s *TableServiceImpl) Columns(tableName string, fetchAuthColumn bool, fetchTableType bool) ([]map[string]interface{}, error) {
+	var result []map[string]interface{}
+	cacheKey := "columns_" + tableName
+	storedCache, ok := s.cache.Get(cacheKey)
+	if ok {
+		return storedCache.([]map[string]interface{}), nil
+	}
+
+	string1 := ""
+	string2 := ""
+	if fetchTableType {
+		string1 = ", t.auth"
+		string2 = "LEFT JOIN '_table' AS t ON fk.'table' = t.name"
+	}
+
+	rows, err := s.db.Raw(fmt.Sprintf(`
+		SELECT 
+			CAST(info.cid AS INT) AS cid,
+			info.name,
+			info.'type',
+			info.pk,
+			info.'notnull',
+			info.dflt_value,
+			fk.'table' AS reference,
+			fk.on_delete
+			%s
+		FROM pragma_table_info('%s') AS info
+		LEFT JOIN pragma_foreign_key_list('%s') AS fk ON
+		info.name = fk.'from' %s
+	`, string1, tableName, tableName, string2)).Rows()
+	if err != nil {
+		return result, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var row map[string]interface{}
+		if err := s.db.ScanRows(rows, &row); err != nil {
+			return result, err
+		}
+		result = append(result, row)
+	}
+	for i, col := range result {
+		if reference := ColumnValue(col, "reference"); reference != nil {
+			result[i]["type"] = "RELATION"
+
+			// relation to a table with text ids holds text
+			referenced, err := s.Info(fmt.Sprintf("%v", reference), TABLE_INFO_ID_TYPE)
+			if err == nil && referenced.TextID() {
+				result[i]["text_id"] = true
+			}
+		}
+	}
+
+	table, err := s.Info(tableName, TABLE_INFO_AUTH, TABLE_INFO_RELATIONS, TABLE_INFO_SEARCH)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.Permissions(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, col := range result {
+		name := fmt.Sprintf("%v", ColumnValue(col, "name"))
+		if utils.ArrayContains(table.SystemSearch, name) {
+			result[i]["searchable"] = true
+		}
+		if permission, ok := permissions[name]; ok {
+			result[i]["permission"] = permission
+		}
+	}
+
+	// multiple relations are stored on junction table, list them as virtual columns
+	for _, relation := range table.SystemRelation {
+		if !relation.Multiple {
+			continue
+		}
+
+		column := map[string]interface{}{
+			"cid":        len(result),
+			"name":       relation.Field,
+			"type":       "RELATION",
+			"pk":         0,
+			"notnull":    0,
+			"dflt_value": nil,
+			"reference":  relation.Reference,
+			"on_delete":  relation.OnDelete,
+			"multiple":   true,
+		}
+		reference, err := s.Info(relation.Reference, TABLE_INFO_AUTH, TABLE_INFO_ID_TYPE)
+		if err != nil && fetchTableType {
+			return nil, err
+		}
+		if fetchTableType {
+			column["auth"] = reference.Auth
+		}
+		if reference.TextID() {
+			column["text_id"] = true
+		}
+
+		result = append(result, column)
+	}
+
+	// credentials are never read, the password is only listed as an input when asked for
+	cleanedResult := []map[string]interface{}{}
+	for _, row := range result {
+		switch row["permission"] {
+		case model.FIELD_SECRET:
+			continue
+		case model.FIELD_CREDENTIAL:
+			if !fetchAuthColumn {
+				continue
+			}
+		}
+		cleanedResult = append(cleanedResult, row)
+	}
+	if table.Auth {
+		// the listed columns depend on fetchAuthColumn
+		return cleanedResult, nil
+	}
+	result = cleanedResult
+
+	s.cache.Set(cacheKey, result, cache.DefaultExpiration)
+
+	return result, err
+}
+
+// ColumnValue
+//
+// Read a value of a column returned by Columns, values scanned from sqlite are pointers
+func ColumnValue(column map[string]interface{}, key string) interface{} {
+	if value, ok := column[key].(*interface{}); ok {
+		return *value
+	}
+
+	return column[key]
 }
 
 func (s *TableServiceImpl) Indexes(tableName string) ([]string, error) {
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"funcbase/model"
+	"testing"
+	"time"
+)
+
+func TestSoftDelete(t *testing.T) {
+	svc, db := newTestService(t)
+	createTables(t, svc, db, model.CreateTable{Name: "notes", SoftDelete: true, Fields: []model.Field{{Type: "text", Name: "body"}}})
+	insertRows(t, svc, db, "notes", map[string]interface{}{"body": "a"}, map[string]interface{}{"body": "b"}, map[string]interface{}{"body": "c"}, map[string]interface{}{"body": "d"})
+
+	list := func(trashed bool) string {
+		t.Helper()
+		rows, err := svc.DB.Fetch(db, &FetchParams{Table: "notes", Trashed: trashed, Order: "id"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rowIDs(rows)
+	}
+
+	err := svc.DB.BatchDelete(db, "notes", []string{"1", "2", "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, trash := list(false), list(true); got != "[4]" || trash != "[1 2 3]" {
+		t.Errorf("rows %s, trash %s after the delete", got, trash)
+	}
+
+	err = svc.DB.Restore(db, "notes", []string{"1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = svc.DB.Purge(db, "notes", []string{"2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, trash := list(false), list(true); got != "[1 4]" || trash != "[3]" {
+		t.Errorf("rows %s, trash %s after the restore and purge", got, trash)
+	}
+
+	// a row that isn't in the trash can't be purged
+	err = svc.DB.Purge(db, "notes", []string{"4"})
+	if got := list(false); err == nil && got != "[1 4]" {
+		t.Errorf("rows %s after purging a kept row", got)
+	}
+
+	err = svc.DB.BatchDelete(db, "notes", []string{"4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Table("notes").Where("id = ?", 3).Update("deleted_at", time.Now().Add(-48*time.Hour)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = svc.DB.PurgeExpired(db, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, trash := list(false), list(true); got != "[1]" || trash != "[4]" {
+		t.Errorf("rows %s, trash %s after the expired rows are purged", got, trash)
+	}
+
+	var stored int64
+	err = db.Table("notes").Count(&stored).Error
+	if err != nil || stored != 2 {
+		t.Errorf("%d rows stored, error %v", stored, err)
+	}
+}
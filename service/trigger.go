@@ -0,0 +1,339 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"funcbase/model"
+	"funcbase/utils"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var triggerTimings = []string{"BEFORE", "AFTER"}
+var triggerEvents = []string{"INSERT", "UPDATE", "DELETE"}
+
+// prefixes of the triggers managed by funcbase itself
+var reservedTriggerPrefixes = []string{"updated_timestamp_", "search_"}
+
+// rolls back the savepoint once the triggers have been checked
+var errTriggerChecked = errors.New("trigger checked")
+
+func parseTriggers(triggerJson string) ([]model.Trigger, error) {
+	triggers := []model.Trigger{}
+	if triggerJson == "" {
+		return triggers, nil
+	}
+
+	err := json.Unmarshal([]byte(triggerJson), &triggers)
+	if err != nil {
+		return nil, err
+	}
+
+	if triggers == nil {
+		triggers = []model.Trigger{}
+	}
+
+	return triggers, nil
+}
+
+// normalizeTrigger
+//
+// Validate the definition of a trigger, timing and event are uppercased and every
+// statement of the body ends with a semicolon
+func normalizeTrigger(trigger model.Trigger) (model.Trigger, error) {
+	if !identifierRegex.MatchString(trigger.Name) {
+		return trigger, fmt.Errorf("invalid trigger name %s", trigger.Name)
+	}
+
+	for _, prefix := range reservedTriggerPrefixes {
+		if strings.HasPrefix(trigger.Name, prefix) {
+			return trigger, fmt.Errorf("trigger name %s is reserved", trigger.Name)
+		}
+	}
+
+	trigger.Timing = strings.ToUpper(strings.TrimSpace(trigger.Timing))
+	if !utils.ArrayContains(triggerTimings, trigger.Timing) {
+		return trigger, fmt.Errorf("timing of trigger %s must be one of %s", trigger.Name, strings.Join(triggerTimings, ", "))
+	}
+
+	trigger.Event = strings.ToUpper(strings.TrimSpace(trigger.Event))
+	if !utils.ArrayContains(triggerEvents, trigger.Event) {
+		return trigger, fmt.Errorf("event of trigger %s must be one of %s", trigger.Name, strings.Join(triggerEvents, ", "))
+	}
+
+	trigger.When = strings.TrimSpace(trigger.When)
+
+	trigger.Body = strings.TrimSpace(trigger.Body)
+	if trigger.Body == "" {
+		return trigger, fmt.Errorf("trigger %s requires a body", trigger.Name)
+	}
+	if !strings.HasSuffix(trigger.Body, ";") {
+		trigger.Body += ";"
+	}
+
+	return trigger, nil
+}
+
+func triggerQuery(tableName string, trigger model.Trigger) string {
+	query := fmt.Sprintf("CREATE TRIGGER %s %s %s ON %s FOR EACH ROW", trigger.Name, trigger.Timing, trigger.Event, tableName)
+	if trigger.When != "" {
+		query += " WHEN " + trigger.When
+	}
+
+	return fmt.Sprintf("%s BEGIN %s END", query, trigger.Body)
+}
+
+// firingStatement
+//
+// Statement running the triggers of an event. Sqlite only compiles the body of a trigger
+// when a statement firing it is prepared, explaining it catches unknown tables and columns
+func firingStatement(tableName string, event string) string {
+	switch event {
+	case "INSERT":
+		return fmt.Sprintf("EXPLAIN INSERT INTO %s DEFAULT VALUES", tableName)
+	case "UPDATE":
+		return fmt.Sprintf("EXPLAIN UPDATE %s SET id = id", tableName)
+	default:
+		return fmt.Sprintf("EXPLAIN DELETE FROM %s", tableName)
+	}
+}
+
+func createTriggers(tx *gorm.DB, tableName string, triggers []model.Trigger) error {
+	for _, trigger := range triggers {
+		err := tx.Exec(triggerQuery(tableName, trigger)).Error
+		if err != nil {
+			return fmt.Errorf("trigger %s: %w", trigger.Name, err)
+		}
+
+		err = tx.Exec(firingStatement(tableName, trigger.Event)).Error
+		if err != nil {
+			return fmt.Errorf("trigger %s: %w", trigger.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func dropTriggers(tx *gorm.DB, triggers []model.Trigger) error {
+	for _, trigger := range triggers {
+		err := tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s", trigger.Name)).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaceTriggers
+//
+// Swap the dropped triggers for the created ones. The change is first made in a savepoint
+// that is rolled back so that an invalid trigger leaves nothing behind
+func replaceTriggers(tx *gorm.DB, tableName string, dropped []model.Trigger, created []model.Trigger) error {
+	replace := func(tx *gorm.DB) error {
+		err := dropTriggers(tx, dropped)
+		if err != nil {
+			return err
+		}
+
+		return createTriggers(tx, tableName, created)
+	}
+
+	err := tx.Transaction(func(check *gorm.DB) error {
+		err := replace(check)
+		if err != nil {
+			return err
+		}
+
+		return errTriggerChecked
+	})
+	if !errors.Is(err, errTriggerChecked) {
+		return err
+	}
+
+	return replace(tx)
+}
+
+func (s *TableServiceImpl) triggeredTable(tx *gorm.DB, tableName string) ([]model.Trigger, error) {
+	var table model.Tables
+	err := tx.Model(&model.Tables{}).Where("name = ?", tableName).First(&table).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if table.IsView() || table.System {
+		return nil, fmt.Errorf("trigger is not supported on %s", tableName)
+	}
+
+	return parseTriggers(table.Triggers)
+}
+
+func (s *TableServiceImpl) saveTriggers(tx *gorm.DB, tableName string, triggers []model.Trigger) error {
+	triggerJson, err := json.Marshal(triggers)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&model.Tables{}).Where("name = ?", tableName).Update("triggers", string(triggerJson)).Error
+	if err != nil {
+		return err
+	}
+
+	s.clearCache(tableName)
+
+	return nil
+}
+
+func (s *TableServiceImpl) Triggers(tableName string) ([]model.Trigger, error) {
+	table, err := s.Info(tableName, TABLE_INFO_TRIGGERS)
+	if err != nil {
+		return nil, err
+	}
+
+	return table.SystemTrigger, nil
+}
+
+// CreateTrigger
+//
+// Add a trigger to a table, the trigger is kept on the table metadata
+func (s *TableServiceImpl) CreateTrigger(tx *gorm.DB, tableName string, trigger model.Trigger) error {
+	triggers, err := s.triggeredTable(tx, tableName)
+	if err != nil {
+		return err
+	}
+
+	trigger, err = normalizeTrigger(trigger)
+	if err != nil {
+		return err
+	}
+
+	var exist int64
+	err = tx.Table("sqlite_master").Where("name = ?", trigger.Name).Count(&exist).Error
+	if err != nil {
+		return err
+	}
+
+	if exist > 0 {
+		return fmt.Errorf("%s already exists", trigger.Name)
+	}
+
+	err = replaceTriggers(tx, tableName, nil, []model.Trigger{trigger})
+	if err != nil {
+		return err
+	}
+
+	return s.saveTriggers(tx, tableName, append(triggers, trigger))
+}
+
+// UpdateTrigger
+//
+// Replace the definition of a trigger, it can be renamed
+func (s *TableServiceImpl) UpdateTrigger(tx *gorm.DB, tableName string, triggerName string, trigger model.Trigger) error {
+	triggers, err := s.triggeredTable(tx, tableName)
+	if err != nil {
+		return err
+	}
+
+	trigger, err = normalizeTrigger(trigger)
+	if err != nil {
+		return err
+	}
+
+	position := -1
+	for i, existing := range triggers {
+		if existing.Name == triggerName {
+			position = i
+		}
+	}
+
+	if position == -1 {
+		return fmt.Errorf("trigger %s does not exist on %s", triggerName, tableName)
+	}
+
+	if trigger.Name != triggerName {
+		var exist int64
+		err = tx.Table("sqlite_master").Where("name = ?", trigger.Name).Count(&exist).Error
+		if err != nil {
+			return err
+		}
+
+		if exist > 0 {
+			return fmt.Errorf("%s already exists", trigger.Name)
+		}
+	}
+
+	err = replaceTriggers(tx, tableName, []model.Trigger{triggers[position]}, []model.Trigger{trigger})
+	if err != nil {
+		return err
+	}
+
+	triggers[position] = trigger
+
+	return s.saveTriggers(tx, tableName, triggers)
+}
+
+// DropTrigger
+//
+// Drop a trigger created through CreateTrigger
+func (s *TableServiceImpl) DropTrigger(tx *gorm.DB, tableName string, triggerName string) error {
+	triggers, err := s.triggeredTable(tx, tableName)
+	if err != nil {
+		return err
+	}
+
+	remaining := []model.Trigger{}
+	dropped := []model.Trigger{}
+	for _, trigger := range triggers {
+		if trigger.Name == triggerName {
+			dropped = append(dropped, trigger)
+		} else {
+			remaining = append(remaining, trigger)
+		}
+	}
+
+	if len(dropped) == 0 {
+		return fmt.Errorf("trigger %s does not exist on %s", triggerName, tableName)
+	}
+
+	err = dropTriggers(tx, dropped)
+	if err != nil {
+		return err
+	}
+
+	return s.saveTriggers(tx, tableName, remaining)
+}
+
+// SetTriggers
+//
+// Replace every trigger of a table at once, used when a schema is imported
+func (s *TableServiceImpl) SetTriggers(tx *gorm.DB, tableName string, triggers []model.Trigger) error {
+	current, err := s.triggeredTable(tx, tableName)
+	if err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	normalized := []model.Trigger{}
+	for _, trigger := range triggers {
+		trigger, err = normalizeTrigger(trigger)
+		if err != nil {
+			return err
+		}
+
+		if names[trigger.Name] {
+			return fmt.Errorf("trigger %s is defined more than once", trigger.Name)
+		}
+		names[trigger.Name] = true
+
+		normalized = append(normalized, trigger)
+	}
+
+	err = replaceTriggers(tx, tableName, current, normalized)
+	if err != nil {
+		return err
+	}
+
+	return s.saveTriggers(tx, tableName, normalized)
+}
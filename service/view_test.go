@@ -0,0 +1,56 @@
+package service
+
+import (
+	"funcbase/model"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestCreateView(t *testing.T) {
+	svc, db := newTestService(t)
+	createTables(t, svc, db,
+		model.CreateTable{Name: "accounts", Type: "users", Fields: []model.Field{{Type: "text", Name: "bio", Nullable: true}}},
+		model.CreateTable{Name: "posts", Fields: []model.Field{{Type: "text", Name: "title"}}},
+	)
+	insertRows(t, svc, db, "posts", map[string]interface{}{"title": "a"}, map[string]interface{}{"title": "b"})
+
+	createView := func(name string, query string) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			return svc.Table.CreateView(tx, model.CreateView{Name: name, Query: query})
+		})
+	}
+
+	err := createView("titles", "SELECT id, title FROM posts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := svc.DB.Fetch(db, &FetchParams{Table: "titles", Order: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0]["title"] != "a" {
+		t.Errorf("rows of the view %v", rows)
+	}
+
+	for name, query := range map[string]string{
+		"no id":                  "SELECT title FROM posts",
+		"not a select":           "DELETE FROM posts",
+		"several statements":     "SELECT id FROM posts; DELETE FROM posts",
+		"password":               "SELECT id, password FROM accounts",
+		"salt through an alias":  "SELECT a.id, a.salt AS s FROM accounts a",
+		"credentials by star":    "SELECT * FROM accounts",
+		"credentials in a where": "SELECT id, bio FROM accounts WHERE substr(password, 1, 1) = 'a'",
+	} {
+		err = createView("leak", query)
+		if err == nil {
+			t.Errorf("%s: view %q created", name, query)
+		}
+	}
+
+	// the quoted text of a query isn't read as a field
+	err = createView("bios", "SELECT id, bio, 'password' AS label FROM accounts")
+	if err != nil {
+		t.Errorf("view of the readable fields refused: %v", err)
+	}
+}